@@ -2,20 +2,73 @@ package flags
 
 import (
 	"flag"
+	"net/url"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 const (
-	logLevel   = "log-level"
-	logPath    = "log-path"
-	configFile = "config-file"
+	logLevel      = "log-level"
+	logPath       = "log-path"
+	logMaxSize    = "log-max-size"
+	logMaxBackups = "log-max-backups"
+	logMaxAge     = "log-max-age"
+	configFile    = "config-file"
 )
 
+// rotateScheme zap sink scheme of the log files rotated by lumberjack
+const rotateScheme = "rotate"
+
+func init() {
+	if err := zap.RegisterSink(rotateScheme, newRotateSink); err != nil {
+		panic(err)
+	}
+}
+
+type rotateSink struct {
+	*lumberjack.Logger
+}
+
+// Sync is a no-op, lumberjack writes through to the file
+func (rotateSink) Sync() error { return nil }
+
+var (
+	rotateLoggersMu sync.Mutex
+	// rotateLoggers one lumberjack per file, the output and error paths of a logger open the same url twice
+	// and two lumberjacks of a file would rotate it under each other
+	rotateLoggers = make(map[string]*lumberjack.Logger)
+)
+
+func newRotateSink(u *url.URL) (zap.Sink, error) {
+	rotateLoggersMu.Lock()
+	defer rotateLoggersMu.Unlock()
+	if l, ok := rotateLoggers[u.Path]; ok {
+		return rotateSink{l}, nil
+	}
+	q := u.Query()
+	l := &lumberjack.Logger{Filename: u.Path, LocalTime: true}
+	var err error
+	if l.MaxSize, err = strconv.Atoi(q.Get("maxsize")); err != nil {
+		return nil, errors.Wrapf(err, "Invalid max size of log %s", u.Path)
+	}
+	if l.MaxBackups, err = strconv.Atoi(q.Get("maxbackups")); err != nil {
+		return nil, errors.Wrapf(err, "Invalid max backups of log %s", u.Path)
+	}
+	if l.MaxAge, err = strconv.Atoi(q.Get("maxage")); err != nil {
+		return nil, errors.Wrapf(err, "Invalid max age of log %s", u.Path)
+	}
+	rotateLoggers[u.Path] = l
+	return rotateSink{l}, nil
+}
+
 // AddConfigFileFlag adds flags for ExternalConfFlags
 func AddConfigFileFlag(flagSet *flag.FlagSet) {
 	flagSet.String(configFile, "", "Configuration file in JSON, TOML, YAML, HCL, or Java properties formats (default none). See spf13/viper for precedence.")
@@ -42,18 +95,28 @@ type SharedFlags struct {
 type logging struct {
 	Level string
 	Path  []string
+	// rotation of the file paths, in megabytes and days, 0 retains all backups
+	MaxSize    int
+	MaxBackups int
+	MaxAge     int
 }
 
 // AddFlags adds flags for SharedFlags
 func AddFlags(flagSet *flag.FlagSet) {
 	flagSet.String(logLevel, "info", "Minimal allowed log Level. For more levels see https://github.com/uber-go/zap")
-	flagSet.String(logPath, "stderr", "Server log path")
+	flagSet.String(logPath, "stderr", "Comma separated server log paths, stdout, stderr or files rotated by size")
+	flagSet.Int(logMaxSize, 100, "Max megabytes of a log file before it is rotated")
+	flagSet.Int(logMaxBackups, 10, "Max rotated log files to retain, 0 to retain all")
+	flagSet.Int(logMaxAge, 30, "Max days to retain rotated log files, 0 to retain all")
 }
 
 // InitFromViper initializes SharedFlags with properties from viper
 func (flags *SharedFlags) InitFromViper(v *viper.Viper) *SharedFlags {
 	flags.Logging.Level = v.GetString(logLevel)
 	flags.Logging.Path = strings.Split(v.GetString(logPath), ",")
+	flags.Logging.MaxSize = v.GetInt(logMaxSize)
+	flags.Logging.MaxBackups = v.GetInt(logMaxBackups)
+	flags.Logging.MaxAge = v.GetInt(logMaxAge)
 	return flags
 }
 
@@ -65,10 +128,34 @@ func (flags *SharedFlags) NewLogger(conf zap.Config, options ...zap.Option) (*za
 		return nil, err
 	}
 	if len(flags.Logging.Path) != 0 {
-		conf.OutputPaths = flags.Logging.Path
-		conf.ErrorOutputPaths = flags.Logging.Path
+		paths := make([]string, 0, len(flags.Logging.Path))
+		for _, path := range flags.Logging.Path {
+			if path, err = flags.rotatePath(strings.TrimSpace(path)); err != nil {
+				return nil, err
+			}
+			paths = append(paths, path)
+		}
+		conf.OutputPaths = paths
+		conf.ErrorOutputPaths = paths
 	}
 
 	conf.Level = zap.NewAtomicLevelAt(level)
 	return conf.Build(options...)
 }
+
+// rotatePath turns a file path into a sink url rotating the file, stdout, stderr and urls are kept
+func (flags *SharedFlags) rotatePath(path string) (string, error) {
+	if path == "stdout" || path == "stderr" || strings.Contains(path, "://") {
+		return path, nil
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "Invalid log path %s", path)
+	}
+	q := url.Values{}
+	q.Set("maxsize", strconv.Itoa(flags.Logging.MaxSize))
+	q.Set("maxbackups", strconv.Itoa(flags.Logging.MaxBackups))
+	q.Set("maxage", strconv.Itoa(flags.Logging.MaxAge))
+	u := url.URL{Scheme: rotateScheme, Path: filepath.ToSlash(abs), RawQuery: q.Encode()}
+	return u.String(), nil
+}
@@ -0,0 +1,78 @@
+package flags
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestRotatePath(t *testing.T) {
+	flags := &SharedFlags{Logging: logging{MaxSize: 1, MaxBackups: 2, MaxAge: 3}}
+	for _, path := range []string{"stdout", "stderr", "file:///var/log/proxy.log"} {
+		if got, err := flags.rotatePath(path); err != nil || got != path {
+			t.Errorf("path %s turned into %s error %v", path, got, err)
+		}
+	}
+	got, err := flags.rotatePath("proxy.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	abs, _ := filepath.Abs("proxy.log")
+	q := u.Query()
+	if u.Scheme != rotateScheme || u.Path != filepath.ToSlash(abs) || q.Get("maxsize") != "1" || q.Get("maxbackups") != "2" || q.Get("maxage") != "3" {
+		t.Fatalf("rotate url %s", got)
+	}
+}
+
+func TestRotateSinkSharedByPath(t *testing.T) {
+	dir, err := ioutil.TempDir("", "flags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "proxy.log")
+	flags := &SharedFlags{Logging: logging{Level: "info", Path: []string{file}, MaxSize: 1}}
+	logger, err := flags.NewLogger(zap.NewProductionConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("first")
+	logger.Sync()
+	// the output and error paths of the logger share the lumberjack of the file
+	rotateLoggersMu.Lock()
+	l := rotateLoggers[filepath.ToSlash(file)]
+	rotateLoggersMu.Unlock()
+	if l == nil || l.MaxSize != 1 || l.MaxBackups != 0 {
+		t.Fatalf("lumberjack of %s %+v", file, l)
+	}
+	u, _ := flags.rotatePath(file)
+	parsed, _ := url.Parse(u)
+	sink, err := newRotateSink(parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sink.(rotateSink).Logger != l {
+		t.Fatal("second sink of the file opened another lumberjack")
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil || !strings.Contains(string(data), `"msg":"first"`) {
+		t.Fatalf("log file %q error %v", data, err)
+	}
+	l.Close()
+}
+
+func TestRotateSinkRejectsBadQuery(t *testing.T) {
+	u, _ := url.Parse("rotate:///tmp/bad.log?maxsize=x&maxbackups=1&maxage=1")
+	if _, err := newRotateSink(u); err == nil {
+		t.Fatal("invalid max size accepted")
+	}
+}
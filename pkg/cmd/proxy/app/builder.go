@@ -1,14 +1,36 @@
 package app
 
 import (
+	"time"
+
+	"github.com/redis-force/less-state-hdfs/pkg/cmd/flags"
 	"github.com/redis-force/less-state-hdfs/pkg/proxy"
 	"github.com/redis-force/less-state-hdfs/pkg/proxy/config"
+	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
 const (
 	defaultHTTPServerHostPort = ":8080"
 	defaultKVPdaddress        = "127.0.0.1:2379"
+	defaultKVKeepAliveTime    = 10 * time.Second
+	defaultKVKeepAliveTimeout = 3 * time.Second
+	defaultKVMaxTxnTimeUse    = 590 * time.Second
+	defaultRetryCacheExpiry   = 10 * time.Minute
+	defaultRetryCacheSweep    = time.Minute
+	defaultRateLimitBurst     = 100
+	defaultLoadShedInitial    = 100
+	defaultLoadShedMin        = 10
+	defaultLoadShedMax        = 1000
+	defaultLoadShedTolerance  = 2.0
+	defaultLoadShedWindow     = 200 * time.Millisecond
+	defaultReplicationScan    = 10 * time.Minute
+	defaultReplication        = 3
+	defaultAuditMaxSize       = 100
+	defaultAuditMaxBackups    = 10
+	defaultAuditMaxAge        = 30
+	defaultTracingAgent       = "127.0.0.1:6831"
+	defaultAccessLogBodySize  = 4096
 )
 
 type Builder struct {
@@ -23,3 +45,28 @@ func (b *Builder) BuildProxy(l *zap.Logger) (*proxy.Proxy, error) {
 	b.Proxy.Logger = l
 	return proxy.New(&b.Proxy)
 }
+
+// BuildFromViper loads the config file and builds the logger and proxy from viper
+func BuildFromViper(v *viper.Viper) (*proxy.Proxy, *zap.Logger, error) {
+	err := flags.TryLoadConfigFile(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	sFlags := new(flags.SharedFlags).InitFromViper(v)
+	logger, err := sFlags.NewLogger(zap.NewProductionConfig())
+	if err != nil {
+		return nil, nil, err
+	}
+	b := NewBuilder().InitFromViper(v)
+	if err = b.InitFromConfigFile(v); err != nil {
+		return nil, logger, err
+	}
+	if len(v.GetString(tikvPDAddressAlias)) > 0 {
+		logger.Warn("deprecated config key, use the right one", zap.String("key", tikvPDAddressAlias), zap.String("use", tikvPDAddress))
+	}
+	p, err := b.BuildProxy(logger)
+	if err != nil {
+		return nil, logger, err
+	}
+	return p, logger, nil
+}
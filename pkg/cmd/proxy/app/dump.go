@@ -0,0 +1,93 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const defaultImportBatchSize = 1000
+
+// ExportCommand creates export command
+func ExportCommand(v *viper.Viper) *cobra.Command {
+	var file string
+	command := &cobra.Command{
+		Use:   "export",
+		Short: "Export the namespace",
+		Long:  `Stream inodes, dentries, file blocks, block metas and storages at a single tso into a length delimited protobuf file with a checksum`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			proxy, _, err := BuildFromViper(v)
+			if err != nil {
+				return err
+			}
+			defer proxy.Close()
+			var w io.Writer = os.Stdout
+			if file != "-" {
+				f, err := os.Create(file)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				w = f
+			}
+			stats, err := proxy.Export(context.Background(), w)
+			if err != nil {
+				return err
+			}
+			return printStats(stats)
+		},
+	}
+	command.Flags().StringVar(&file, "file", "-", "export file, - for stdout")
+	return command
+}
+
+// ImportCommand creates import command
+func ImportCommand(v *viper.Viper) *cobra.Command {
+	var (
+		file      string
+		batchSize int
+	)
+	command := &cobra.Command{
+		Use:   "import",
+		Short: "Import the namespace",
+		Long:  `Verify an export file and load it into an empty store in batched transactions`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(file) == 0 {
+				return fmt.Errorf("import file is required")
+			}
+			f, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			proxy, _, err := BuildFromViper(v)
+			if err != nil {
+				return err
+			}
+			defer proxy.Close()
+			stats, err := proxy.Import(context.Background(), f, batchSize)
+			if err != nil {
+				return err
+			}
+			return printStats(stats)
+		},
+	}
+	command.Flags().StringVar(&file, "file", "", "export file to import")
+	command.Flags().IntVar(&batchSize, "batch-size", defaultImportBatchSize, "records per transaction")
+	return command
+}
+
+// printStats prints stats to stderr so it never mixes with an export on stdout
+func printStats(stats interface{}) error {
+	out, err := json.MarshalIndent(stats, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stderr, string(out))
+	return nil
+}
@@ -2,13 +2,81 @@ package app
 
 import (
 	"flag"
+	"strings"
 
+	"github.com/pkg/errors"
+	"github.com/redis-force/less-state-hdfs/pkg/proxy/config"
 	"github.com/spf13/viper"
 )
 
 const (
 	httpServerHostPort = "proxy.server.host-port"
-	tikvPDAddress      = "proxy.tivk.pd-address"
+	tlsCert            = "proxy.server.tls.cert"
+	tlsKey             = "proxy.server.tls.key"
+	tlsClientCA        = "proxy.server.tls.client-ca"
+	tlsRequireClient   = "proxy.server.tls.require-client-cert"
+	readyTimeout       = "proxy.server.ready-timeout"
+	requestTimeout     = "proxy.server.request-timeout"
+	drainTimeout       = "proxy.server.drain-timeout"
+	tikvPDAddress      = "proxy.tikv.pd-address"
+	// misspelt key of older configs, read if the right one is not set
+	tikvPDAddressAlias = "proxy.tivk.pd-address"
+	tikvSSLCA          = "proxy.tikv.ssl-ca"
+	tikvSSLCert        = "proxy.tikv.ssl-cert"
+	tikvSSLKey         = "proxy.tikv.ssl-key"
+	tikvStartupTimeout = "proxy.tikv.startup-timeout"
+	tikvKeepAlive      = "proxy.tikv.grpc-keepalive-time"
+	tikvKeepAliveWait  = "proxy.tikv.grpc-keepalive-timeout"
+	tikvMaxTxnTimeUse  = "proxy.tikv.max-txn-time-use"
+	txnRetryAttempts   = "proxy.txn.retry-attempts"
+	txnRetryBackoff    = "proxy.txn.retry-backoff"
+	txnRetryBudget     = "proxy.txn.retry-budget"
+	retryCacheEnabled  = "proxy.retry-cache.enabled"
+	retryCacheExpiry   = "proxy.retry-cache.expiry"
+	retryCacheSweep    = "proxy.retry-cache.sweep-interval"
+	rateLimitEnabled   = "proxy.rate-limit.enabled"
+	rateLimitFile      = "proxy.rate-limit.file"
+	rateLimitRead      = "proxy.rate-limit.read-rate"
+	rateReadBurst      = "proxy.rate-limit.read-burst"
+	rateLimitWrite     = "proxy.rate-limit.write-rate"
+	rateWriteBurst     = "proxy.rate-limit.write-burst"
+	rateLimitExpensive = "proxy.rate-limit.expensive-rate"
+	rateExpensiveBurst = "proxy.rate-limit.expensive-burst"
+	rateMaxConcurrent  = "proxy.rate-limit.max-concurrent"
+	loadShedEnabled    = "proxy.load-shed.enabled"
+	loadShedInitial    = "proxy.load-shed.initial-limit"
+	loadShedMin        = "proxy.load-shed.min-limit"
+	loadShedMax        = "proxy.load-shed.max-limit"
+	loadShedTolerance  = "proxy.load-shed.latency-tolerance"
+	loadShedWindow     = "proxy.load-shed.window"
+	replicationScan    = "proxy.replication.scan-interval"
+	replication        = "proxy.replication.default"
+	auditPaths         = "proxy.audit.log-path"
+	auditMaxSize       = "proxy.audit.max-size"
+	auditMaxBackups    = "proxy.audit.max-backups"
+	auditMaxAge        = "proxy.audit.max-age"
+	auditIncludeReads  = "proxy.audit.include-reads"
+	permissionEnabled  = "proxy.permission.enabled"
+	permissionSuper    = "proxy.permission.superuser"
+	permissionGroup    = "proxy.permission.supergroup"
+	permissionProxies  = "proxy.permission.proxy-users"
+	authorizationFile  = "proxy.authorization.policy-file"
+	tracingReporter    = "proxy.tracing.reporter"
+	tracingService     = "proxy.tracing.service-name"
+	tracingAgent       = "proxy.tracing.agent-host-port"
+	tracingFile        = "proxy.tracing.file"
+	tracingSampleRate  = "proxy.tracing.sample-rate"
+	accessLogEnabled   = "proxy.access-log.enabled"
+	accessLogFields    = "proxy.access-log.fields"
+	accessLogSample    = "proxy.access-log.body-sample-rate"
+	accessLogBodySize  = "proxy.access-log.max-body-size"
+	// groups of principals are only read from the config file
+	permissionGroups = "proxy.permission.groups"
+	// deadlines of single routes are only read from the config file
+	routeTimeouts = "proxy.server.route-timeouts"
+	// webhooks and auth are only read from the config file
+	webhooks = "proxy.webhooks"
+	auth     = "proxy.auth"
 )
 
 func AddFlags(flag *flag.FlagSet) {
@@ -16,16 +84,333 @@ func AddFlags(flag *flag.FlagSet) {
 		httpServerHostPort,
 		defaultHTTPServerHostPort,
 		"host:port of the http server")
+	flag.String(
+		tlsCert,
+		"",
+		"pem certificate file of the https server, reloaded when it changes")
+	flag.String(
+		tlsKey,
+		"",
+		"pem private key file of the https server, reloaded when it changes")
+	flag.String(
+		tlsClientCA,
+		"",
+		"pem ca file verifying client certificates, reloaded when it changes")
+	flag.Bool(
+		tlsRequireClient,
+		false,
+		"reject tls clients without a certificate verified by the client ca")
+	flag.Duration(
+		readyTimeout,
+		config.DefaultReadyTimeout,
+		"timeout of the pd and tikv checks of the readiness probe")
+	flag.Duration(
+		requestTimeout,
+		config.DefaultRequestTimeout,
+		"deadline of the api requests and their transactions, per route deadlines are set in the config file")
+	flag.Duration(
+		drainTimeout,
+		config.DefaultDrainTimeout,
+		"max time to wait for the requests being served on shutdown before they are cancelled")
 	flag.String(
 		tikvPDAddress,
 		defaultKVPdaddress,
-		"address of tikv pd address")
+		"comma separated host:port of the tikv pd endpoints")
+	flag.String(
+		tikvPDAddressAlias,
+		"",
+		"deprecated, use "+tikvPDAddress)
+	flag.String(
+		tikvSSLCA,
+		"",
+		"pem ca file verifying the pd and tikv servers, enables tls to the cluster")
+	flag.String(
+		tikvSSLCert,
+		"",
+		"pem client certificate file presented to the pd and tikv servers")
+	flag.String(
+		tikvSSLKey,
+		"",
+		"pem client private key file presented to the pd and tikv servers")
+	flag.Duration(
+		tikvStartupTimeout,
+		config.DefaultKVStartupTimeout,
+		"max time to connect pd and check tikv at startup before giving up")
+	flag.Duration(
+		tikvKeepAlive,
+		defaultKVKeepAliveTime,
+		"idle time after which the tikv grpc connections are pinged")
+	flag.Duration(
+		tikvKeepAliveWait,
+		defaultKVKeepAliveTimeout,
+		"time to wait for a tikv grpc keepalive ping before closing the connection")
+	flag.Duration(
+		tikvMaxTxnTimeUse,
+		defaultKVMaxTxnTimeUse,
+		"max time a transaction may take from its start to its commit")
+	flag.Int(
+		txnRetryAttempts,
+		config.DefaultTxnRetryAttempts,
+		"max attempts of a transaction failed with a retryable tikv error like a write conflict")
+	flag.Duration(
+		txnRetryBackoff,
+		config.DefaultTxnRetryBackoff,
+		"backoff before the second attempt of a transaction, doubled after every attempt")
+	flag.Duration(
+		txnRetryBudget,
+		config.DefaultTxnRetryBudget,
+		"max total backoff of the retries of a transaction")
+	flag.Bool(
+		retryCacheEnabled,
+		true,
+		"answer retries of mutating requests having the X-Request-Id of a served request with its result")
+	flag.Duration(
+		retryCacheExpiry,
+		defaultRetryCacheExpiry,
+		"time the result of a request is kept for its retries")
+	flag.Duration(
+		retryCacheSweep,
+		defaultRetryCacheSweep,
+		"interval of deleting expired results of the retry cache")
+	flag.Bool(
+		rateLimitEnabled,
+		false,
+		"limit the requests of every principal, or client ip if not authenticated, by token buckets")
+	flag.String(
+		rateLimitFile,
+		"",
+		"yaml file of rate limits overriding the flags, reloaded when it changes")
+	flag.Float64(
+		rateLimitRead,
+		0,
+		"read requests per second of a caller, 0 for no limit")
+	flag.Int(
+		rateReadBurst,
+		defaultRateLimitBurst,
+		"read requests a caller may send at once")
+	flag.Float64(
+		rateLimitWrite,
+		0,
+		"write requests per second of a caller, 0 for no limit")
+	flag.Int(
+		rateWriteBurst,
+		defaultRateLimitBurst,
+		"write requests a caller may send at once")
+	flag.Float64(
+		rateLimitExpensive,
+		0,
+		"recursive deletes, summaries and listings per second of a caller, 0 for no limit")
+	flag.Int(
+		rateExpensiveBurst,
+		defaultRateLimitBurst,
+		"recursive deletes, summaries and listings a caller may send at once")
+	flag.Int(
+		rateMaxConcurrent,
+		0,
+		"max requests of all callers served at once, 0 for no limit")
+	flag.Bool(
+		loadShedEnabled,
+		false,
+		"shed transactions over a limit adapted to the latency and backoffs of tikv, listings and summaries first")
+	flag.Int(
+		loadShedInitial,
+		defaultLoadShedInitial,
+		"transactions run at once before the limit is adapted")
+	flag.Int(
+		loadShedMin,
+		defaultLoadShedMin,
+		"lowest limit of the transactions run at once")
+	flag.Int(
+		loadShedMax,
+		defaultLoadShedMax,
+		"highest limit of the transactions run at once")
+	flag.Float64(
+		loadShedTolerance,
+		defaultLoadShedTolerance,
+		"times the baseline latency of transactions may grow before the limit shrinks")
+	flag.Duration(
+		loadShedWindow,
+		defaultLoadShedWindow,
+		"interval of adapting the limit of the transactions run at once")
+	flag.Duration(
+		replicationScan,
+		defaultReplicationScan,
+		"interval of the background replication scanner, 0 to disable")
+	flag.Int(
+		replication,
+		defaultReplication,
+		"replication of blocks whose replication is unknown")
+	flag.String(
+		auditPaths,
+		"",
+		"comma separated audit log sinks, stdout, stderr or file paths rotated by size, empty to disable")
+	flag.Int(
+		auditMaxSize,
+		defaultAuditMaxSize,
+		"max megabytes of an audit log file before it is rotated")
+	flag.Int(
+		auditMaxBackups,
+		defaultAuditMaxBackups,
+		"max rotated audit log files to retain, 0 to retain all")
+	flag.Int(
+		auditMaxAge,
+		defaultAuditMaxAge,
+		"max days to retain rotated audit log files, 0 to retain all")
+	flag.Bool(
+		auditIncludeReads,
+		false,
+		"audit read only routes too")
+	flag.Bool(
+		permissionEnabled,
+		false,
+		"check the hdfs permission of the caller on every inode route")
+	flag.String(
+		permissionSuper,
+		config.DefaultSuperUser,
+		"hdfs user bypassing permission checks")
+	flag.String(
+		permissionGroup,
+		config.DefaultSuperGroup,
+		"hdfs group whose members bypass permission checks")
+	flag.String(
+		permissionProxies,
+		"",
+		"comma separated principals trusted to act for the user of the X-HDFS-User and X-HDFS-Groups headers")
+	flag.String(
+		authorizationFile,
+		"",
+		"yaml policy file authorizing every api route, reloaded when it changes, empty to disable")
+	flag.String(
+		tracingReporter,
+		"none",
+		"span reporter, none to disable tracing, null to drop spans, file or agent")
+	flag.String(
+		tracingService,
+		config.DefaultTracingService,
+		"service name of the spans")
+	flag.String(
+		tracingAgent,
+		defaultTracingAgent,
+		"host:port of the jaeger agent of the agent reporter")
+	flag.String(
+		tracingFile,
+		"",
+		"file the file reporter appends spans to as json lines")
+	flag.Float64(
+		tracingSampleRate,
+		1,
+		"probability a trace is sampled")
+	flag.Bool(
+		accessLogEnabled,
+		true,
+		"log every api request to the server log")
+	flag.String(
+		accessLogFields,
+		"",
+		"comma separated access log fields, empty for the default fields")
+	flag.Float64(
+		accessLogSample,
+		0,
+		"probability the bodies of a successful request are logged, bodies of failed requests are always logged")
+	flag.Int(
+		accessLogBodySize,
+		defaultAccessLogBodySize,
+		"max bytes of a request or response body in the access log, 0 to never log bodies")
 
 }
 
 // InitFromViper initializes Builder with properties retrieved from Viper.
 func (b *Builder) InitFromViper(v *viper.Viper) *Builder {
 	b.Proxy.HostPort = v.GetString(httpServerHostPort)
-	b.Proxy.KVPDAddress = v.GetString(tikvPDAddress)
+	b.Proxy.TLSCert = v.GetString(tlsCert)
+	b.Proxy.TLSKey = v.GetString(tlsKey)
+	b.Proxy.TLSClientCA = v.GetString(tlsClientCA)
+	b.Proxy.TLSRequireClientCert = v.GetBool(tlsRequireClient)
+	b.Proxy.ReadyTimeout = v.GetDuration(readyTimeout)
+	b.Proxy.RequestTimeout = v.GetDuration(requestTimeout)
+	b.Proxy.DrainTimeout = v.GetDuration(drainTimeout)
+	pd := v.GetString(tikvPDAddress)
+	if alias := v.GetString(tikvPDAddressAlias); len(alias) > 0 && pd == defaultKVPdaddress {
+		pd = alias
+	}
+	for _, addr := range strings.Split(pd, ",") {
+		if addr = strings.TrimSpace(addr); len(addr) > 0 {
+			b.Proxy.KVPDAddresses = append(b.Proxy.KVPDAddresses, addr)
+		}
+	}
+	b.Proxy.KVSSLCA = v.GetString(tikvSSLCA)
+	b.Proxy.KVSSLCert = v.GetString(tikvSSLCert)
+	b.Proxy.KVSSLKey = v.GetString(tikvSSLKey)
+	b.Proxy.KVStartupTimeout = v.GetDuration(tikvStartupTimeout)
+	b.Proxy.KVKeepAliveTime = v.GetDuration(tikvKeepAlive)
+	b.Proxy.KVKeepAliveTimeout = v.GetDuration(tikvKeepAliveWait)
+	b.Proxy.KVMaxTxnTimeUse = v.GetDuration(tikvMaxTxnTimeUse)
+	b.Proxy.TxnRetry.Attempts = v.GetInt(txnRetryAttempts)
+	b.Proxy.TxnRetry.Backoff = v.GetDuration(txnRetryBackoff)
+	b.Proxy.TxnRetry.Budget = v.GetDuration(txnRetryBudget)
+	b.Proxy.RetryCache.Enabled = v.GetBool(retryCacheEnabled)
+	b.Proxy.RetryCache.Expiry = v.GetDuration(retryCacheExpiry)
+	b.Proxy.RetryCache.SweepInterval = v.GetDuration(retryCacheSweep)
+	b.Proxy.RateLimit.Enabled = v.GetBool(rateLimitEnabled)
+	b.Proxy.RateLimit.File = v.GetString(rateLimitFile)
+	b.Proxy.RateLimit.Read.Rate = v.GetFloat64(rateLimitRead)
+	b.Proxy.RateLimit.Read.Burst = v.GetInt(rateReadBurst)
+	b.Proxy.RateLimit.Write.Rate = v.GetFloat64(rateLimitWrite)
+	b.Proxy.RateLimit.Write.Burst = v.GetInt(rateWriteBurst)
+	b.Proxy.RateLimit.Expensive.Rate = v.GetFloat64(rateLimitExpensive)
+	b.Proxy.RateLimit.Expensive.Burst = v.GetInt(rateExpensiveBurst)
+	b.Proxy.RateLimit.MaxConcurrent = v.GetInt(rateMaxConcurrent)
+	b.Proxy.LoadShed.Enabled = v.GetBool(loadShedEnabled)
+	b.Proxy.LoadShed.InitialLimit = v.GetInt(loadShedInitial)
+	b.Proxy.LoadShed.MinLimit = v.GetInt(loadShedMin)
+	b.Proxy.LoadShed.MaxLimit = v.GetInt(loadShedMax)
+	b.Proxy.LoadShed.LatencyTolerance = v.GetFloat64(loadShedTolerance)
+	b.Proxy.LoadShed.Window = v.GetDuration(loadShedWindow)
+	b.Proxy.ReplicationScanInterval = v.GetDuration(replicationScan)
+	b.Proxy.DefaultReplication = int16(v.GetInt(replication))
+	if paths := v.GetString(auditPaths); len(paths) > 0 {
+		b.Proxy.Audit.Paths = strings.Split(paths, ",")
+	}
+	b.Proxy.Audit.MaxSize = v.GetInt(auditMaxSize)
+	b.Proxy.Audit.MaxBackups = v.GetInt(auditMaxBackups)
+	b.Proxy.Audit.MaxAge = v.GetInt(auditMaxAge)
+	b.Proxy.Audit.IncludeReads = v.GetBool(auditIncludeReads)
+	b.Proxy.Permission.Enabled = v.GetBool(permissionEnabled)
+	b.Proxy.Permission.SuperUser = v.GetString(permissionSuper)
+	b.Proxy.Permission.SuperGroup = v.GetString(permissionGroup)
+	if users := v.GetString(permissionProxies); len(users) > 0 {
+		b.Proxy.Permission.ProxyUsers = strings.Split(users, ",")
+	}
+	b.Proxy.AuthorizationPolicyFile = v.GetString(authorizationFile)
+	b.Proxy.Tracing.Reporter = v.GetString(tracingReporter)
+	b.Proxy.Tracing.ServiceName = v.GetString(tracingService)
+	b.Proxy.Tracing.AgentHostPort = v.GetString(tracingAgent)
+	b.Proxy.Tracing.File = v.GetString(tracingFile)
+	b.Proxy.Tracing.SampleRate = v.GetFloat64(tracingSampleRate)
+	b.Proxy.AccessLog.Enabled = v.GetBool(accessLogEnabled)
+	for _, field := range strings.Split(v.GetString(accessLogFields), ",") {
+		if field = strings.TrimSpace(field); len(field) > 0 {
+			b.Proxy.AccessLog.Fields = append(b.Proxy.AccessLog.Fields, field)
+		}
+	}
+	b.Proxy.AccessLog.BodySampleRate = v.GetFloat64(accessLogSample)
+	b.Proxy.AccessLog.MaxBodySize = v.GetInt(accessLogBodySize)
 	return b
 }
+
+// InitFromConfigFile decodes structured settings which have no flags from the config file.
+func (b *Builder) InitFromConfigFile(v *viper.Viper) error {
+	if err := v.UnmarshalKey(webhooks, &b.Proxy.Webhooks); err != nil {
+		return errors.Wrapf(err, "Error loading %s", webhooks)
+	}
+	if err := v.UnmarshalKey(auth, &b.Proxy.Auth); err != nil {
+		return errors.Wrapf(err, "Error loading %s", auth)
+	}
+	if err := v.UnmarshalKey(routeTimeouts, &b.Proxy.RouteTimeouts); err != nil {
+		return errors.Wrapf(err, "Error loading %s", routeTimeouts)
+	}
+	if err := v.UnmarshalKey(permissionGroups, &b.Proxy.Permission.Groups); err != nil {
+		return errors.Wrapf(err, "Error loading %s", permissionGroups)
+	}
+	return nil
+}
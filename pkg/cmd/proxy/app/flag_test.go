@@ -0,0 +1,57 @@
+package app
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis-force/less-state-hdfs/pkg/proxy/config"
+	"github.com/spf13/viper"
+)
+
+func TestInitFromConfigFile(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("yaml")
+	err := v.ReadConfig(strings.NewReader(`
+proxy:
+    webhooks:
+        - name: indexer
+          url: http://indexer:8080/events
+          pathPrefixes: [/user]
+          batchSize: 50
+          timeout: 5s
+          maxRetries: 3
+    auth:
+        hmacKeys:
+            - id: k1
+              principal: nn
+              secret: s1
+        clockSkew: 1m
+        maxSignedBody: 1024
+        clientCert: true
+    server.route-timeouts:
+        putINodeFile: 2s
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := NewBuilder()
+	if err = b.InitFromConfigFile(v); err != nil {
+		t.Fatal(err)
+	}
+	hooks := []config.WebhookConfig{{Name: "indexer", URL: "http://indexer:8080/events", PathPrefixes: []string{"/user"},
+		BatchSize: 50, Timeout: 5 * time.Second, MaxRetries: 3}}
+	if !reflect.DeepEqual(b.Proxy.Webhooks, hooks) {
+		t.Errorf("webhooks %+v", b.Proxy.Webhooks)
+	}
+	auth := config.AuthConfig{HMACKeys: []config.AuthHMACKey{{ID: "k1", Principal: "nn", Secret: "s1"}},
+		ClockSkew: time.Minute, MaxSignedBody: 1024, ClientCert: true}
+	if !reflect.DeepEqual(b.Proxy.Auth, auth) {
+		t.Errorf("auth %+v", b.Proxy.Auth)
+	}
+	// viper folds the keys of maps to lower case, the proxy matches route names regardless of case
+	if b.Proxy.RouteTimeouts["putinodefile"] != 2*time.Second {
+		t.Errorf("route timeouts %v", b.Proxy.RouteTimeouts)
+	}
+}
@@ -0,0 +1,42 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// FsckCommand creates fsck command
+func FsckCommand(v *viper.Viper) *cobra.Command {
+	var repair bool
+	command := &cobra.Command{
+		Use:   "fsck",
+		Short: "Check namespace consistency",
+		Long:  `Scan every key family at one snapshot and report dangling dentries, orphan inodes, dangling file blocks and broken block chains, optionally repair them in bounded transactions which check each issue again`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			proxy, _, err := BuildFromViper(v)
+			if err != nil {
+				return err
+			}
+			defer proxy.Close()
+			report, err := proxy.Fsck(context.Background(), repair, 0, 0)
+			if err != nil {
+				return err
+			}
+			out, err := json.MarshalIndent(report, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Println(string(out))
+			if unrepaired := report.Total - report.Repaired; unrepaired > 0 {
+				return fmt.Errorf("namespace has %d unrepaired inconsistencies", unrepaired)
+			}
+			return nil
+		},
+	}
+	command.Flags().BoolVar(&repair, "repair", false, "repair the inconsistencies found, each checked again in the repair transaction")
+	return command
+}
@@ -0,0 +1,98 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/redis-force/less-state-hdfs/pkg/proxy"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	// layout version of hadoop 3
+	defaultFsimageLayoutVersion = -64
+	defaultFsimageOwner         = "hdfs"
+	defaultFsimageGroup         = "supergroup"
+)
+
+// ExportFsimageCommand creates export-fsimage command
+func ExportFsimageCommand(v *viper.Viper) *cobra.Command {
+	var (
+		file string
+		opts proxy.FsimageExportOptions
+	)
+	command := &cobra.Command{
+		Use:   "export-fsimage",
+		Short: "Export the namespace as an hdfs fsimage xml",
+		Long:  `Write the namespace at a single tso in the xml format of 'hdfs oiv -p XML', which 'hdfs oiv -p ReverseXML' turns into an fsimage`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, _, err := BuildFromViper(v)
+			if err != nil {
+				return err
+			}
+			defer p.Close()
+			var w io.Writer = os.Stdout
+			if file != "-" {
+				f, err := os.Create(file)
+				if err != nil {
+					return err
+				}
+				defer f.Close()
+				w = f
+			}
+			stats, err := p.ExportFsimage(context.Background(), w, opts)
+			if err != nil {
+				return err
+			}
+			return printStats(stats)
+		},
+	}
+	command.Flags().StringVar(&file, "file", "-", "fsimage xml file, - for stdout")
+	command.Flags().Int64Var(&opts.NamespaceID, "namespace-id", 0, "namespace id of the fsimage")
+	command.Flags().Int32Var(&opts.LayoutVersion, "layout-version", defaultFsimageLayoutVersion, "layout version of the fsimage")
+	command.Flags().Int64Var(&opts.TxID, "txid", 0, "last transaction id of the fsimage")
+	command.Flags().StringVar(&opts.Owner, "owner", defaultFsimageOwner, "owner of inodes without an owner name")
+	command.Flags().StringVar(&opts.Group, "group", defaultFsimageGroup, "group of inodes without a group name")
+	return command
+}
+
+// ImportFsimageCommand creates import-fsimage command
+func ImportFsimageCommand(v *viper.Viper) *cobra.Command {
+	var (
+		file        string
+		blockPoolID string
+		batchSize   int
+	)
+	command := &cobra.Command{
+		Use:   "import-fsimage",
+		Short: "Import an hdfs fsimage",
+		Long:  `Load the xml output of 'hdfs oiv -p XML' into an empty store, preserving inode and block ids and reporting what can not be represented`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(file) == 0 {
+				return fmt.Errorf("fsimage xml file is required")
+			}
+			f, err := os.Open(file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			proxy, _, err := BuildFromViper(v)
+			if err != nil {
+				return err
+			}
+			defer proxy.Close()
+			report, err := proxy.ImportFsimage(context.Background(), f, blockPoolID, batchSize)
+			if err != nil {
+				return err
+			}
+			return printStats(report)
+		},
+	}
+	command.Flags().StringVar(&file, "file", "", "fsimage xml file written by hdfs oiv -p XML")
+	command.Flags().StringVar(&blockPoolID, "block-pool-id", "", "block pool id of the imported blocks")
+	command.Flags().IntVar(&batchSize, "batch-size", defaultImportBatchSize, "inodes and blocks per transaction")
+	return command
+}
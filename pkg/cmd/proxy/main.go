@@ -22,21 +22,11 @@ func main() {
 		Short: "hdfs ns proxy is a daemon program which serve as a proxy to tikv.",
 		Long:  `hdfs ns proxy is a daemon program serve as a http proxy to tikv, it provides inodes api to hdfs namenode`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			err := flags.TryLoadConfigFile(v)
+			proxy, logger, err := app.BuildFromViper(v)
 			if err != nil {
-				return err
-			}
-			builder := app.NewBuilder()
-			sFlags := new(flags.SharedFlags).InitFromViper(v)
-			logger, err := sFlags.NewLogger(zap.NewProductionConfig())
-			if err != nil {
-				return err
-			}
-
-			builder.InitFromViper(v)
-			proxy, err := builder.BuildProxy(logger)
-			if err != nil {
-				logger.Fatal("Build proxy error", zap.Error(err))
+				if logger != nil {
+					logger.Fatal("Build proxy error", zap.Error(err))
+				}
 				return err
 			}
 			stop := make(chan os.Signal, 1)
@@ -54,6 +44,11 @@ func main() {
 	}
 
 	command.AddCommand(version.Command())
+	command.AddCommand(app.FsckCommand(v))
+	command.AddCommand(app.ExportCommand(v))
+	command.AddCommand(app.ImportCommand(v))
+	command.AddCommand(app.ExportFsimageCommand(v))
+	command.AddCommand(app.ImportFsimageCommand(v))
 
 	config.AddFlags(
 		v,
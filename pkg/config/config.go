@@ -21,10 +21,10 @@ func AddFlags(v *viper.Viper, command *cobra.Command, inits ...func(*flag.FlagSe
 	for i := range inits {
 		inits[i](flagSet)
 	}
-	command.Flags().AddGoFlagSet(flagSet)
+	command.PersistentFlags().AddGoFlagSet(flagSet)
 
 	configureViper(v)
-	v.BindPFlags(command.Flags())
+	v.BindPFlags(command.PersistentFlags())
 	return v, command
 }
 
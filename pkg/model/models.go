@@ -1,10 +1,20 @@
 package model
 
+import "encoding/json"
+
 //APIResponse rpc接口通用的响应格式
 type APIResponse struct {
 	Code     int         `json:"code"`
 	Error    string      `json:"error"`
 	Response interface{} `json:"response,omitempty"`
+	// java exception class of the error, e.g. AccessControlException
+	Exception string `json:"exception,omitempty"`
+}
+
+//Health liveness and readiness probe result, checks map every check to ok or its error
+type Health struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
 }
 
 //TS timestamp
@@ -21,6 +31,7 @@ type Block struct {
 	Replication  int16          `json:"replication"`
 	CollectionID int64          `json:"collection_id"`
 	BlockPoolID  string         `json:"block_pool_id"`
+	Version      int64          `json:"version"`
 	Storage      []BlockStorage `json:"storage"`
 }
 
@@ -40,6 +51,7 @@ type INode struct {
 	Header           int64  `json:"header"`
 	Type             int16  `json:"type"`
 	ParentID         int64  `json:"parent_id"`
+	Version          int64  `json:"version"`
 }
 
 //INodeDirectory hdfs directory
@@ -65,9 +77,153 @@ type INodeFile struct {
 	Header           int64  `json:"header"`
 	Type             int16  `json:"type"`
 	ParentID         int64  `json:"parent_id"`
+	Version          int64  `json:"version"`
 
 	ClientName    string `json:"client_name"`
 	ClientMachine string `json:"client_machine"`
 
 	Blocks []*Block `json:"blocks"`
 }
+
+//ReportedBlock a block replica reported by datanode
+type ReportedBlock struct {
+	BlockID    int64  `json:"block_id"`
+	Generation int64  `json:"generation"`
+	Length     int64  `json:"length"`
+	StorageID  string `json:"storage_id,omitempty"`
+}
+
+//BlockReport datanode full or incremental block report
+type BlockReport struct {
+	StorageID string          `json:"storage_id"`
+	Full      bool            `json:"full"`
+	Blocks    []ReportedBlock `json:"blocks"`
+	Received  []ReportedBlock `json:"received"`
+	Deleted   []ReportedBlock `json:"deleted"`
+}
+
+//BlockReportResult replicas the namenode should invalidate after a block report
+type BlockReportResult struct {
+	Added   int             `json:"added"`
+	Removed int             `json:"removed"`
+	Stale   []ReportedBlock `json:"stale"`
+	Corrupt []ReportedBlock `json:"corrupt"`
+	Unknown []ReportedBlock `json:"unknown"`
+}
+
+//BlockOwner inode owning a block and the block index within the file
+type BlockOwner struct {
+	BlockID int64  `json:"block_id"`
+	INodeID int64  `json:"inode_id"`
+	Index   int64  `json:"index"`
+	Deleted bool   `json:"deleted"`
+	INode   *INode `json:"inode,omitempty"`
+}
+
+//ReplicationBlock block with replication problem found by replication scanner
+type ReplicationBlock struct {
+	BlockID  int64  `json:"block_id"`
+	INodeID  int64  `json:"inode_id"`
+	Class    string `json:"class"`
+	Expected int16  `json:"expected"`
+	Live     int    `json:"live"`
+	Corrupt  int    `json:"corrupt"`
+}
+
+//ReplicationReport a page of replication scan result
+type ReplicationReport struct {
+	Timestamp uint64             `json:"timestamp"`
+	Scanned   int64              `json:"scanned"`
+	Counts    map[string]int     `json:"counts"`
+	Class     string             `json:"class,omitempty"`
+	Offset    int                `json:"offset"`
+	Limit     int                `json:"limit"`
+	Total     int                `json:"total"`
+	Blocks    []ReplicationBlock `json:"blocks"`
+}
+
+//FsckIssue namespace inconsistency found by fsck
+type FsckIssue struct {
+	Type     string `json:"type"`
+	INodeID  int64  `json:"inode_id,omitempty"`
+	ParentID int64  `json:"parent_id,omitempty"`
+	Name     string `json:"name,omitempty"`
+	BlockID  int64  `json:"block_id,omitempty"`
+	Index    int64  `json:"index,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Repaired bool   `json:"repaired"`
+}
+
+//FsckReport namespace consistency check result
+type FsckReport struct {
+	Timestamp  uint64         `json:"timestamp"`
+	INodes     int            `json:"inodes"`
+	Dentries   int            `json:"dentries"`
+	FileBlocks int            `json:"file_blocks"`
+	Blocks     int            `json:"blocks"`
+	Counts     map[string]int `json:"counts"`
+	Repaired   int            `json:"repaired"`
+	Offset     int            `json:"offset"`
+	Limit      int            `json:"limit"`
+	Total      int            `json:"total"`
+	Issues     []FsckIssue    `json:"issues"`
+}
+
+//DumpStats namespace export or import summary
+type DumpStats struct {
+	Timestamp uint64           `json:"timestamp"`
+	Records   int64            `json:"records"`
+	Counts    map[string]int64 `json:"counts"`
+	Checksum  uint32           `json:"checksum"`
+}
+
+//FsimageImportReport hdfs fsimage import summary, unsupported counts items which are not imported
+type FsimageImportReport struct {
+	INodes          int64            `json:"inodes"`
+	Directories     int64            `json:"directories"`
+	Files           int64            `json:"files"`
+	Blocks          int64            `json:"blocks"`
+	LastINodeID     int64            `json:"last_inode_id"`
+	LastBlockID     int64            `json:"last_block_id"`
+	GenerationStamp int64            `json:"generation_stamp"`
+	Unsupported     map[string]int64 `json:"unsupported"`
+	Messages        []string         `json:"messages"`
+}
+
+//ChangeEvent namespace change, fields not related to the type are empty
+type ChangeEvent struct {
+	Type        string `json:"type"`
+	INodeID     int64  `json:"inode_id"`
+	INodeType   int16  `json:"inode_type"`
+	ParentID    int64  `json:"parent_id,omitempty"`
+	Name        string `json:"name,omitempty"`
+	OldParentID int64  `json:"old_parent_id,omitempty"`
+	BlockID     int64  `json:"block_id,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	Path        string `json:"path,omitempty"`
+	OldPath     string `json:"old_path,omitempty"`
+}
+
+//ChangeEventBatch events committed by one transaction
+type ChangeEventBatch struct {
+	TxID      int64         `json:"txid"`
+	Timestamp uint64        `json:"timestamp"`
+	Events    []ChangeEvent `json:"events"`
+}
+
+//WebhookPayload body posted to a webhook subscriber
+type WebhookPayload struct {
+	Subscriber string              `json:"subscriber"`
+	Batches    []*ChangeEventBatch `json:"batches"`
+}
+
+//WebhookDeadLetter payload given up after the subscriber's max retries
+type WebhookDeadLetter struct {
+	Subscriber string          `json:"subscriber"`
+	FirstTxID  int64           `json:"first_txid"`
+	LastTxID   int64           `json:"last_txid"`
+	Payload    json.RawMessage `json:"payload"`
+	Error      string          `json:"error"`
+	Attempts   int32           `json:"attempts"`
+	Timestamp  int64           `json:"timestamp"`
+}
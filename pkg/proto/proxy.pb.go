@@ -1,21 +1,6 @@
-// Code generated by protoc-gen-go.
+// Code generated by protoc-gen-go. DO NOT EDIT.
 // source: proxy.proto
-// DO NOT EDIT!
-
-/*
-Package proxy is a generated protocol buffer package.
-
-It is generated from these files:
-	proxy.proto
-
-It has these top-level messages:
-	BlockMeta
-	BlockStorageNode
-	BlockStorage
-	INodeID
-	INodeMeta
-	INodeFileBlock
-*/
+
 package proxy
 
 import proto "github.com/golang/protobuf/proto"
@@ -34,19 +19,41 @@ var _ = math.Inf
 const _ = proto.ProtoPackageIsVersion2 // please upgrade the proto package
 
 type BlockMeta struct {
-	Id               *int64  `protobuf:"varint,1,opt,name=id" json:"id,omitempty"`
-	Generation       *int64  `protobuf:"varint,2,opt,name=generation" json:"generation,omitempty"`
-	NumberBytes      *int64  `protobuf:"varint,3,opt,name=number_bytes" json:"number_bytes,omitempty"`
-	Replication      *int32  `protobuf:"varint,4,opt,name=replication" json:"replication,omitempty"`
-	CollectionId     *int64  `protobuf:"varint,5,opt,name=collection_id" json:"collection_id,omitempty"`
-	BlockPoolId      *string `protobuf:"bytes,6,opt,name=block_pool_id" json:"block_pool_id,omitempty"`
-	XXX_unrecognized []byte  `json:"-"`
+	Id                   *int64   `protobuf:"varint,1,opt,name=id" json:"id,omitempty"`
+	Generation           *int64   `protobuf:"varint,2,opt,name=generation" json:"generation,omitempty"`
+	NumberBytes          *int64   `protobuf:"varint,3,opt,name=number_bytes" json:"number_bytes,omitempty"`
+	Replication          *int32   `protobuf:"varint,4,opt,name=replication" json:"replication,omitempty"`
+	CollectionId         *int64   `protobuf:"varint,5,opt,name=collection_id" json:"collection_id,omitempty"`
+	BlockPoolId          *string  `protobuf:"bytes,6,opt,name=block_pool_id" json:"block_pool_id,omitempty"`
+	Version              *int64   `protobuf:"varint,7,opt,name=version" json:"version,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *BlockMeta) Reset()         { *m = BlockMeta{} }
+func (m *BlockMeta) String() string { return proto.CompactTextString(m) }
+func (*BlockMeta) ProtoMessage()    {}
+func (*BlockMeta) Descriptor() ([]byte, []int) {
+	return fileDescriptor_proxy_297af728cea984de, []int{0}
+}
+func (m *BlockMeta) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BlockMeta.Unmarshal(m, b)
+}
+func (m *BlockMeta) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BlockMeta.Marshal(b, m, deterministic)
+}
+func (dst *BlockMeta) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BlockMeta.Merge(dst, src)
+}
+func (m *BlockMeta) XXX_Size() int {
+	return xxx_messageInfo_BlockMeta.Size(m)
+}
+func (m *BlockMeta) XXX_DiscardUnknown() {
+	xxx_messageInfo_BlockMeta.DiscardUnknown(m)
 }
 
-func (m *BlockMeta) Reset()                    { *m = BlockMeta{} }
-func (m *BlockMeta) String() string            { return proto.CompactTextString(m) }
-func (*BlockMeta) ProtoMessage()               {}
-func (*BlockMeta) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{0} }
+var xxx_messageInfo_BlockMeta proto.InternalMessageInfo
 
 func (m *BlockMeta) GetId() int64 {
 	if m != nil && m.Id != nil {
@@ -90,16 +97,44 @@ func (m *BlockMeta) GetBlockPoolId() string {
 	return ""
 }
 
+func (m *BlockMeta) GetVersion() int64 {
+	if m != nil && m.Version != nil {
+		return *m.Version
+	}
+	return 0
+}
+
 type BlockStorageNode struct {
-	DataNodeId       *string `protobuf:"bytes,1,req,name=data_node_id" json:"data_node_id,omitempty"`
-	StorageId        *string `protobuf:"bytes,2,req,name=storage_id" json:"storage_id,omitempty"`
-	XXX_unrecognized []byte  `json:"-"`
+	DataNodeId           *string  `protobuf:"bytes,1,req,name=data_node_id" json:"data_node_id,omitempty"`
+	StorageId            *string  `protobuf:"bytes,2,req,name=storage_id" json:"storage_id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
 }
 
-func (m *BlockStorageNode) Reset()                    { *m = BlockStorageNode{} }
-func (m *BlockStorageNode) String() string            { return proto.CompactTextString(m) }
-func (*BlockStorageNode) ProtoMessage()               {}
-func (*BlockStorageNode) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{1} }
+func (m *BlockStorageNode) Reset()         { *m = BlockStorageNode{} }
+func (m *BlockStorageNode) String() string { return proto.CompactTextString(m) }
+func (*BlockStorageNode) ProtoMessage()    {}
+func (*BlockStorageNode) Descriptor() ([]byte, []int) {
+	return fileDescriptor_proxy_297af728cea984de, []int{1}
+}
+func (m *BlockStorageNode) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BlockStorageNode.Unmarshal(m, b)
+}
+func (m *BlockStorageNode) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BlockStorageNode.Marshal(b, m, deterministic)
+}
+func (dst *BlockStorageNode) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BlockStorageNode.Merge(dst, src)
+}
+func (m *BlockStorageNode) XXX_Size() int {
+	return xxx_messageInfo_BlockStorageNode.Size(m)
+}
+func (m *BlockStorageNode) XXX_DiscardUnknown() {
+	xxx_messageInfo_BlockStorageNode.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BlockStorageNode proto.InternalMessageInfo
 
 func (m *BlockStorageNode) GetDataNodeId() string {
 	if m != nil && m.DataNodeId != nil {
@@ -116,15 +151,36 @@ func (m *BlockStorageNode) GetStorageId() string {
 }
 
 type BlockStorage struct {
-	Nodes            []*BlockStorageNode `protobuf:"bytes,1,rep,name=nodes" json:"nodes,omitempty"`
-	Id               *int64              `protobuf:"varint,2,opt,name=id" json:"id,omitempty"`
-	XXX_unrecognized []byte              `json:"-"`
+	Nodes                []*BlockStorageNode `protobuf:"bytes,1,rep,name=nodes" json:"nodes,omitempty"`
+	Id                   *int64              `protobuf:"varint,2,opt,name=id" json:"id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}            `json:"-"`
+	XXX_unrecognized     []byte              `json:"-"`
+	XXX_sizecache        int32               `json:"-"`
+}
+
+func (m *BlockStorage) Reset()         { *m = BlockStorage{} }
+func (m *BlockStorage) String() string { return proto.CompactTextString(m) }
+func (*BlockStorage) ProtoMessage()    {}
+func (*BlockStorage) Descriptor() ([]byte, []int) {
+	return fileDescriptor_proxy_297af728cea984de, []int{2}
+}
+func (m *BlockStorage) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BlockStorage.Unmarshal(m, b)
+}
+func (m *BlockStorage) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BlockStorage.Marshal(b, m, deterministic)
+}
+func (dst *BlockStorage) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BlockStorage.Merge(dst, src)
+}
+func (m *BlockStorage) XXX_Size() int {
+	return xxx_messageInfo_BlockStorage.Size(m)
+}
+func (m *BlockStorage) XXX_DiscardUnknown() {
+	xxx_messageInfo_BlockStorage.DiscardUnknown(m)
 }
 
-func (m *BlockStorage) Reset()                    { *m = BlockStorage{} }
-func (m *BlockStorage) String() string            { return proto.CompactTextString(m) }
-func (*BlockStorage) ProtoMessage()               {}
-func (*BlockStorage) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{2} }
+var xxx_messageInfo_BlockStorage proto.InternalMessageInfo
 
 func (m *BlockStorage) GetNodes() []*BlockStorageNode {
 	if m != nil {
@@ -141,14 +197,35 @@ func (m *BlockStorage) GetId() int64 {
 }
 
 type INodeID struct {
-	Id               *int64 `protobuf:"varint,1,req,name=id" json:"id,omitempty"`
-	XXX_unrecognized []byte `json:"-"`
+	Id                   *int64   `protobuf:"varint,1,req,name=id" json:"id,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *INodeID) Reset()         { *m = INodeID{} }
+func (m *INodeID) String() string { return proto.CompactTextString(m) }
+func (*INodeID) ProtoMessage()    {}
+func (*INodeID) Descriptor() ([]byte, []int) {
+	return fileDescriptor_proxy_297af728cea984de, []int{3}
+}
+func (m *INodeID) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_INodeID.Unmarshal(m, b)
+}
+func (m *INodeID) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_INodeID.Marshal(b, m, deterministic)
+}
+func (dst *INodeID) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_INodeID.Merge(dst, src)
+}
+func (m *INodeID) XXX_Size() int {
+	return xxx_messageInfo_INodeID.Size(m)
+}
+func (m *INodeID) XXX_DiscardUnknown() {
+	xxx_messageInfo_INodeID.DiscardUnknown(m)
 }
 
-func (m *INodeID) Reset()                    { *m = INodeID{} }
-func (m *INodeID) String() string            { return proto.CompactTextString(m) }
-func (*INodeID) ProtoMessage()               {}
-func (*INodeID) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{3} }
+var xxx_messageInfo_INodeID proto.InternalMessageInfo
 
 func (m *INodeID) GetId() int64 {
 	if m != nil && m.Id != nil {
@@ -158,23 +235,49 @@ func (m *INodeID) GetId() int64 {
 }
 
 type INodeMeta struct {
-	Id               *int64  `protobuf:"varint,1,req,name=id" json:"id,omitempty"`
-	Name             *string `protobuf:"bytes,2,req,name=name" json:"name,omitempty"`
-	Permission       *int64  `protobuf:"varint,3,req,name=permission" json:"permission,omitempty"`
-	ModificationTime *int64  `protobuf:"varint,4,req,name=modification_time" json:"modification_time,omitempty"`
-	AccessTime       *int64  `protobuf:"varint,5,req,name=access_time" json:"access_time,omitempty"`
-	Header           *int64  `protobuf:"varint,6,opt,name=header" json:"header,omitempty"`
-	Type             *int32  `protobuf:"varint,7,req,name=type" json:"type,omitempty"`
-	ParentId         *int64  `protobuf:"varint,8,opt,name=parent_id" json:"parent_id,omitempty"`
-	ClientName       *string `protobuf:"bytes,9,opt,name=client_name" json:"client_name,omitempty"`
-	ClientMachine    *string `protobuf:"bytes,10,opt,name=client_machine" json:"client_machine,omitempty"`
-	XXX_unrecognized []byte  `json:"-"`
-}
-
-func (m *INodeMeta) Reset()                    { *m = INodeMeta{} }
-func (m *INodeMeta) String() string            { return proto.CompactTextString(m) }
-func (*INodeMeta) ProtoMessage()               {}
-func (*INodeMeta) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{4} }
+	Id                   *int64   `protobuf:"varint,1,req,name=id" json:"id,omitempty"`
+	Name                 *string  `protobuf:"bytes,2,req,name=name" json:"name,omitempty"`
+	Permission           *int64   `protobuf:"varint,3,req,name=permission" json:"permission,omitempty"`
+	ModificationTime     *int64   `protobuf:"varint,4,req,name=modification_time" json:"modification_time,omitempty"`
+	AccessTime           *int64   `protobuf:"varint,5,req,name=access_time" json:"access_time,omitempty"`
+	Header               *int64   `protobuf:"varint,6,opt,name=header" json:"header,omitempty"`
+	Type                 *int32   `protobuf:"varint,7,req,name=type" json:"type,omitempty"`
+	ParentId             *int64   `protobuf:"varint,8,opt,name=parent_id" json:"parent_id,omitempty"`
+	ClientName           *string  `protobuf:"bytes,9,opt,name=client_name" json:"client_name,omitempty"`
+	ClientMachine        *string  `protobuf:"bytes,10,opt,name=client_machine" json:"client_machine,omitempty"`
+	Owner                *string  `protobuf:"bytes,11,opt,name=owner" json:"owner,omitempty"`
+	Group                *string  `protobuf:"bytes,12,opt,name=group" json:"group,omitempty"`
+	NsQuota              *int64   `protobuf:"varint,13,opt,name=ns_quota" json:"ns_quota,omitempty"`
+	DsQuota              *int64   `protobuf:"varint,14,opt,name=ds_quota" json:"ds_quota,omitempty"`
+	Version              *int64   `protobuf:"varint,15,opt,name=version" json:"version,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *INodeMeta) Reset()         { *m = INodeMeta{} }
+func (m *INodeMeta) String() string { return proto.CompactTextString(m) }
+func (*INodeMeta) ProtoMessage()    {}
+func (*INodeMeta) Descriptor() ([]byte, []int) {
+	return fileDescriptor_proxy_297af728cea984de, []int{4}
+}
+func (m *INodeMeta) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_INodeMeta.Unmarshal(m, b)
+}
+func (m *INodeMeta) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_INodeMeta.Marshal(b, m, deterministic)
+}
+func (dst *INodeMeta) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_INodeMeta.Merge(dst, src)
+}
+func (m *INodeMeta) XXX_Size() int {
+	return xxx_messageInfo_INodeMeta.Size(m)
+}
+func (m *INodeMeta) XXX_DiscardUnknown() {
+	xxx_messageInfo_INodeMeta.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_INodeMeta proto.InternalMessageInfo
 
 func (m *INodeMeta) GetId() int64 {
 	if m != nil && m.Id != nil {
@@ -246,17 +349,73 @@ func (m *INodeMeta) GetClientMachine() string {
 	return ""
 }
 
+func (m *INodeMeta) GetOwner() string {
+	if m != nil && m.Owner != nil {
+		return *m.Owner
+	}
+	return ""
+}
+
+func (m *INodeMeta) GetGroup() string {
+	if m != nil && m.Group != nil {
+		return *m.Group
+	}
+	return ""
+}
+
+func (m *INodeMeta) GetNsQuota() int64 {
+	if m != nil && m.NsQuota != nil {
+		return *m.NsQuota
+	}
+	return 0
+}
+
+func (m *INodeMeta) GetDsQuota() int64 {
+	if m != nil && m.DsQuota != nil {
+		return *m.DsQuota
+	}
+	return 0
+}
+
+func (m *INodeMeta) GetVersion() int64 {
+	if m != nil && m.Version != nil {
+		return *m.Version
+	}
+	return 0
+}
+
 type INodeFileBlock struct {
-	Id               *int64 `protobuf:"varint,1,req,name=id" json:"id,omitempty"`
-	NextBlockId      *int64 `protobuf:"varint,2,opt,name=next_block_id" json:"next_block_id,omitempty"`
-	NumberBytes      *int64 `protobuf:"varint,3,opt,name=number_bytes" json:"number_bytes,omitempty"`
-	XXX_unrecognized []byte `json:"-"`
+	Id                   *int64   `protobuf:"varint,1,req,name=id" json:"id,omitempty"`
+	NextBlockId          *int64   `protobuf:"varint,2,opt,name=next_block_id" json:"next_block_id,omitempty"`
+	NumberBytes          *int64   `protobuf:"varint,3,opt,name=number_bytes" json:"number_bytes,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *INodeFileBlock) Reset()         { *m = INodeFileBlock{} }
+func (m *INodeFileBlock) String() string { return proto.CompactTextString(m) }
+func (*INodeFileBlock) ProtoMessage()    {}
+func (*INodeFileBlock) Descriptor() ([]byte, []int) {
+	return fileDescriptor_proxy_297af728cea984de, []int{5}
+}
+func (m *INodeFileBlock) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_INodeFileBlock.Unmarshal(m, b)
+}
+func (m *INodeFileBlock) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_INodeFileBlock.Marshal(b, m, deterministic)
+}
+func (dst *INodeFileBlock) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_INodeFileBlock.Merge(dst, src)
+}
+func (m *INodeFileBlock) XXX_Size() int {
+	return xxx_messageInfo_INodeFileBlock.Size(m)
+}
+func (m *INodeFileBlock) XXX_DiscardUnknown() {
+	xxx_messageInfo_INodeFileBlock.DiscardUnknown(m)
 }
 
-func (m *INodeFileBlock) Reset()                    { *m = INodeFileBlock{} }
-func (m *INodeFileBlock) String() string            { return proto.CompactTextString(m) }
-func (*INodeFileBlock) ProtoMessage()               {}
-func (*INodeFileBlock) Descriptor() ([]byte, []int) { return fileDescriptor0, []int{5} }
+var xxx_messageInfo_INodeFileBlock proto.InternalMessageInfo
 
 func (m *INodeFileBlock) GetId() int64 {
 	if m != nil && m.Id != nil {
@@ -279,6 +438,664 @@ func (m *INodeFileBlock) GetNumberBytes() int64 {
 	return 0
 }
 
+type ExportHeader struct {
+	Version              *uint32  `protobuf:"varint,1,req,name=version" json:"version,omitempty"`
+	Timestamp            *uint64  `protobuf:"varint,2,req,name=timestamp" json:"timestamp,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ExportHeader) Reset()         { *m = ExportHeader{} }
+func (m *ExportHeader) String() string { return proto.CompactTextString(m) }
+func (*ExportHeader) ProtoMessage()    {}
+func (*ExportHeader) Descriptor() ([]byte, []int) {
+	return fileDescriptor_proxy_297af728cea984de, []int{6}
+}
+func (m *ExportHeader) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ExportHeader.Unmarshal(m, b)
+}
+func (m *ExportHeader) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ExportHeader.Marshal(b, m, deterministic)
+}
+func (dst *ExportHeader) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ExportHeader.Merge(dst, src)
+}
+func (m *ExportHeader) XXX_Size() int {
+	return xxx_messageInfo_ExportHeader.Size(m)
+}
+func (m *ExportHeader) XXX_DiscardUnknown() {
+	xxx_messageInfo_ExportHeader.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ExportHeader proto.InternalMessageInfo
+
+func (m *ExportHeader) GetVersion() uint32 {
+	if m != nil && m.Version != nil {
+		return *m.Version
+	}
+	return 0
+}
+
+func (m *ExportHeader) GetTimestamp() uint64 {
+	if m != nil && m.Timestamp != nil {
+		return *m.Timestamp
+	}
+	return 0
+}
+
+type ExportRecord struct {
+	Key                  []byte          `protobuf:"bytes,1,req,name=key" json:"key,omitempty"`
+	Inode                *INodeMeta      `protobuf:"bytes,2,opt,name=inode" json:"inode,omitempty"`
+	Dentry               *INodeID        `protobuf:"bytes,3,opt,name=dentry" json:"dentry,omitempty"`
+	FileBlock            *INodeFileBlock `protobuf:"bytes,4,opt,name=file_block" json:"file_block,omitempty"`
+	BlockMeta            *BlockMeta      `protobuf:"bytes,5,opt,name=block_meta" json:"block_meta,omitempty"`
+	BlockStorage         *BlockStorage   `protobuf:"bytes,6,opt,name=block_storage" json:"block_storage,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}        `json:"-"`
+	XXX_unrecognized     []byte          `json:"-"`
+	XXX_sizecache        int32           `json:"-"`
+}
+
+func (m *ExportRecord) Reset()         { *m = ExportRecord{} }
+func (m *ExportRecord) String() string { return proto.CompactTextString(m) }
+func (*ExportRecord) ProtoMessage()    {}
+func (*ExportRecord) Descriptor() ([]byte, []int) {
+	return fileDescriptor_proxy_297af728cea984de, []int{7}
+}
+func (m *ExportRecord) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ExportRecord.Unmarshal(m, b)
+}
+func (m *ExportRecord) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ExportRecord.Marshal(b, m, deterministic)
+}
+func (dst *ExportRecord) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ExportRecord.Merge(dst, src)
+}
+func (m *ExportRecord) XXX_Size() int {
+	return xxx_messageInfo_ExportRecord.Size(m)
+}
+func (m *ExportRecord) XXX_DiscardUnknown() {
+	xxx_messageInfo_ExportRecord.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ExportRecord proto.InternalMessageInfo
+
+func (m *ExportRecord) GetKey() []byte {
+	if m != nil {
+		return m.Key
+	}
+	return nil
+}
+
+func (m *ExportRecord) GetInode() *INodeMeta {
+	if m != nil {
+		return m.Inode
+	}
+	return nil
+}
+
+func (m *ExportRecord) GetDentry() *INodeID {
+	if m != nil {
+		return m.Dentry
+	}
+	return nil
+}
+
+func (m *ExportRecord) GetFileBlock() *INodeFileBlock {
+	if m != nil {
+		return m.FileBlock
+	}
+	return nil
+}
+
+func (m *ExportRecord) GetBlockMeta() *BlockMeta {
+	if m != nil {
+		return m.BlockMeta
+	}
+	return nil
+}
+
+func (m *ExportRecord) GetBlockStorage() *BlockStorage {
+	if m != nil {
+		return m.BlockStorage
+	}
+	return nil
+}
+
+type ExportTrailer struct {
+	Records              *int64   `protobuf:"varint,1,req,name=records" json:"records,omitempty"`
+	Checksum             *uint32  `protobuf:"varint,2,req,name=checksum" json:"checksum,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ExportTrailer) Reset()         { *m = ExportTrailer{} }
+func (m *ExportTrailer) String() string { return proto.CompactTextString(m) }
+func (*ExportTrailer) ProtoMessage()    {}
+func (*ExportTrailer) Descriptor() ([]byte, []int) {
+	return fileDescriptor_proxy_297af728cea984de, []int{8}
+}
+func (m *ExportTrailer) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ExportTrailer.Unmarshal(m, b)
+}
+func (m *ExportTrailer) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ExportTrailer.Marshal(b, m, deterministic)
+}
+func (dst *ExportTrailer) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ExportTrailer.Merge(dst, src)
+}
+func (m *ExportTrailer) XXX_Size() int {
+	return xxx_messageInfo_ExportTrailer.Size(m)
+}
+func (m *ExportTrailer) XXX_DiscardUnknown() {
+	xxx_messageInfo_ExportTrailer.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ExportTrailer proto.InternalMessageInfo
+
+func (m *ExportTrailer) GetRecords() int64 {
+	if m != nil && m.Records != nil {
+		return *m.Records
+	}
+	return 0
+}
+
+func (m *ExportTrailer) GetChecksum() uint32 {
+	if m != nil && m.Checksum != nil {
+		return *m.Checksum
+	}
+	return 0
+}
+
+type ExportEntry struct {
+	Header               *ExportHeader  `protobuf:"bytes,1,opt,name=header" json:"header,omitempty"`
+	Record               *ExportRecord  `protobuf:"bytes,2,opt,name=record" json:"record,omitempty"`
+	Trailer              *ExportTrailer `protobuf:"bytes,3,opt,name=trailer" json:"trailer,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *ExportEntry) Reset()         { *m = ExportEntry{} }
+func (m *ExportEntry) String() string { return proto.CompactTextString(m) }
+func (*ExportEntry) ProtoMessage()    {}
+func (*ExportEntry) Descriptor() ([]byte, []int) {
+	return fileDescriptor_proxy_297af728cea984de, []int{9}
+}
+func (m *ExportEntry) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ExportEntry.Unmarshal(m, b)
+}
+func (m *ExportEntry) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ExportEntry.Marshal(b, m, deterministic)
+}
+func (dst *ExportEntry) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ExportEntry.Merge(dst, src)
+}
+func (m *ExportEntry) XXX_Size() int {
+	return xxx_messageInfo_ExportEntry.Size(m)
+}
+func (m *ExportEntry) XXX_DiscardUnknown() {
+	xxx_messageInfo_ExportEntry.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ExportEntry proto.InternalMessageInfo
+
+func (m *ExportEntry) GetHeader() *ExportHeader {
+	if m != nil {
+		return m.Header
+	}
+	return nil
+}
+
+func (m *ExportEntry) GetRecord() *ExportRecord {
+	if m != nil {
+		return m.Record
+	}
+	return nil
+}
+
+func (m *ExportEntry) GetTrailer() *ExportTrailer {
+	if m != nil {
+		return m.Trailer
+	}
+	return nil
+}
+
+type ChangeEvent struct {
+	Type                 *string  `protobuf:"bytes,1,req,name=type" json:"type,omitempty"`
+	InodeId              *int64   `protobuf:"varint,2,req,name=inode_id" json:"inode_id,omitempty"`
+	InodeType            *int32   `protobuf:"varint,3,opt,name=inode_type" json:"inode_type,omitempty"`
+	ParentId             *int64   `protobuf:"varint,4,opt,name=parent_id" json:"parent_id,omitempty"`
+	Name                 *string  `protobuf:"bytes,5,opt,name=name" json:"name,omitempty"`
+	OldParentId          *int64   `protobuf:"varint,6,opt,name=old_parent_id" json:"old_parent_id,omitempty"`
+	BlockId              *int64   `protobuf:"varint,7,opt,name=block_id" json:"block_id,omitempty"`
+	Size                 *int64   `protobuf:"varint,8,opt,name=size" json:"size,omitempty"`
+	Path                 *string  `protobuf:"bytes,9,opt,name=path" json:"path,omitempty"`
+	OldPath              *string  `protobuf:"bytes,10,opt,name=old_path" json:"old_path,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ChangeEvent) Reset()         { *m = ChangeEvent{} }
+func (m *ChangeEvent) String() string { return proto.CompactTextString(m) }
+func (*ChangeEvent) ProtoMessage()    {}
+func (*ChangeEvent) Descriptor() ([]byte, []int) {
+	return fileDescriptor_proxy_297af728cea984de, []int{10}
+}
+func (m *ChangeEvent) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ChangeEvent.Unmarshal(m, b)
+}
+func (m *ChangeEvent) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ChangeEvent.Marshal(b, m, deterministic)
+}
+func (dst *ChangeEvent) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ChangeEvent.Merge(dst, src)
+}
+func (m *ChangeEvent) XXX_Size() int {
+	return xxx_messageInfo_ChangeEvent.Size(m)
+}
+func (m *ChangeEvent) XXX_DiscardUnknown() {
+	xxx_messageInfo_ChangeEvent.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ChangeEvent proto.InternalMessageInfo
+
+func (m *ChangeEvent) GetType() string {
+	if m != nil && m.Type != nil {
+		return *m.Type
+	}
+	return ""
+}
+
+func (m *ChangeEvent) GetInodeId() int64 {
+	if m != nil && m.InodeId != nil {
+		return *m.InodeId
+	}
+	return 0
+}
+
+func (m *ChangeEvent) GetInodeType() int32 {
+	if m != nil && m.InodeType != nil {
+		return *m.InodeType
+	}
+	return 0
+}
+
+func (m *ChangeEvent) GetParentId() int64 {
+	if m != nil && m.ParentId != nil {
+		return *m.ParentId
+	}
+	return 0
+}
+
+func (m *ChangeEvent) GetName() string {
+	if m != nil && m.Name != nil {
+		return *m.Name
+	}
+	return ""
+}
+
+func (m *ChangeEvent) GetOldParentId() int64 {
+	if m != nil && m.OldParentId != nil {
+		return *m.OldParentId
+	}
+	return 0
+}
+
+func (m *ChangeEvent) GetBlockId() int64 {
+	if m != nil && m.BlockId != nil {
+		return *m.BlockId
+	}
+	return 0
+}
+
+func (m *ChangeEvent) GetSize() int64 {
+	if m != nil && m.Size != nil {
+		return *m.Size
+	}
+	return 0
+}
+
+func (m *ChangeEvent) GetPath() string {
+	if m != nil && m.Path != nil {
+		return *m.Path
+	}
+	return ""
+}
+
+func (m *ChangeEvent) GetOldPath() string {
+	if m != nil && m.OldPath != nil {
+		return *m.OldPath
+	}
+	return ""
+}
+
+type ChangeEventBatch struct {
+	Txid                 *int64         `protobuf:"varint,1,req,name=txid" json:"txid,omitempty"`
+	Timestamp            *uint64        `protobuf:"varint,2,req,name=timestamp" json:"timestamp,omitempty"`
+	Events               []*ChangeEvent `protobuf:"bytes,3,rep,name=events" json:"events,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}       `json:"-"`
+	XXX_unrecognized     []byte         `json:"-"`
+	XXX_sizecache        int32          `json:"-"`
+}
+
+func (m *ChangeEventBatch) Reset()         { *m = ChangeEventBatch{} }
+func (m *ChangeEventBatch) String() string { return proto.CompactTextString(m) }
+func (*ChangeEventBatch) ProtoMessage()    {}
+func (*ChangeEventBatch) Descriptor() ([]byte, []int) {
+	return fileDescriptor_proxy_297af728cea984de, []int{11}
+}
+func (m *ChangeEventBatch) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ChangeEventBatch.Unmarshal(m, b)
+}
+func (m *ChangeEventBatch) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ChangeEventBatch.Marshal(b, m, deterministic)
+}
+func (dst *ChangeEventBatch) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ChangeEventBatch.Merge(dst, src)
+}
+func (m *ChangeEventBatch) XXX_Size() int {
+	return xxx_messageInfo_ChangeEventBatch.Size(m)
+}
+func (m *ChangeEventBatch) XXX_DiscardUnknown() {
+	xxx_messageInfo_ChangeEventBatch.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ChangeEventBatch proto.InternalMessageInfo
+
+func (m *ChangeEventBatch) GetTxid() int64 {
+	if m != nil && m.Txid != nil {
+		return *m.Txid
+	}
+	return 0
+}
+
+func (m *ChangeEventBatch) GetTimestamp() uint64 {
+	if m != nil && m.Timestamp != nil {
+		return *m.Timestamp
+	}
+	return 0
+}
+
+func (m *ChangeEventBatch) GetEvents() []*ChangeEvent {
+	if m != nil {
+		return m.Events
+	}
+	return nil
+}
+
+type ChangeEventCursor struct {
+	Txid                 *int64   `protobuf:"varint,1,req,name=txid" json:"txid,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *ChangeEventCursor) Reset()         { *m = ChangeEventCursor{} }
+func (m *ChangeEventCursor) String() string { return proto.CompactTextString(m) }
+func (*ChangeEventCursor) ProtoMessage()    {}
+func (*ChangeEventCursor) Descriptor() ([]byte, []int) {
+	return fileDescriptor_proxy_297af728cea984de, []int{12}
+}
+func (m *ChangeEventCursor) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_ChangeEventCursor.Unmarshal(m, b)
+}
+func (m *ChangeEventCursor) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_ChangeEventCursor.Marshal(b, m, deterministic)
+}
+func (dst *ChangeEventCursor) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_ChangeEventCursor.Merge(dst, src)
+}
+func (m *ChangeEventCursor) XXX_Size() int {
+	return xxx_messageInfo_ChangeEventCursor.Size(m)
+}
+func (m *ChangeEventCursor) XXX_DiscardUnknown() {
+	xxx_messageInfo_ChangeEventCursor.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_ChangeEventCursor proto.InternalMessageInfo
+
+func (m *ChangeEventCursor) GetTxid() int64 {
+	if m != nil && m.Txid != nil {
+		return *m.Txid
+	}
+	return 0
+}
+
+type WebhookDeadLetter struct {
+	Subscriber           *string  `protobuf:"bytes,1,req,name=subscriber" json:"subscriber,omitempty"`
+	FirstTxid            *int64   `protobuf:"varint,2,req,name=first_txid" json:"first_txid,omitempty"`
+	LastTxid             *int64   `protobuf:"varint,3,req,name=last_txid" json:"last_txid,omitempty"`
+	Payload              []byte   `protobuf:"bytes,4,req,name=payload" json:"payload,omitempty"`
+	Error                *string  `protobuf:"bytes,5,opt,name=error" json:"error,omitempty"`
+	Attempts             *int32   `protobuf:"varint,6,opt,name=attempts" json:"attempts,omitempty"`
+	Timestamp            *int64   `protobuf:"varint,7,opt,name=timestamp" json:"timestamp,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *WebhookDeadLetter) Reset()         { *m = WebhookDeadLetter{} }
+func (m *WebhookDeadLetter) String() string { return proto.CompactTextString(m) }
+func (*WebhookDeadLetter) ProtoMessage()    {}
+func (*WebhookDeadLetter) Descriptor() ([]byte, []int) {
+	return fileDescriptor_proxy_297af728cea984de, []int{13}
+}
+func (m *WebhookDeadLetter) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_WebhookDeadLetter.Unmarshal(m, b)
+}
+func (m *WebhookDeadLetter) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_WebhookDeadLetter.Marshal(b, m, deterministic)
+}
+func (dst *WebhookDeadLetter) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_WebhookDeadLetter.Merge(dst, src)
+}
+func (m *WebhookDeadLetter) XXX_Size() int {
+	return xxx_messageInfo_WebhookDeadLetter.Size(m)
+}
+func (m *WebhookDeadLetter) XXX_DiscardUnknown() {
+	xxx_messageInfo_WebhookDeadLetter.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_WebhookDeadLetter proto.InternalMessageInfo
+
+func (m *WebhookDeadLetter) GetSubscriber() string {
+	if m != nil && m.Subscriber != nil {
+		return *m.Subscriber
+	}
+	return ""
+}
+
+func (m *WebhookDeadLetter) GetFirstTxid() int64 {
+	if m != nil && m.FirstTxid != nil {
+		return *m.FirstTxid
+	}
+	return 0
+}
+
+func (m *WebhookDeadLetter) GetLastTxid() int64 {
+	if m != nil && m.LastTxid != nil {
+		return *m.LastTxid
+	}
+	return 0
+}
+
+func (m *WebhookDeadLetter) GetPayload() []byte {
+	if m != nil {
+		return m.Payload
+	}
+	return nil
+}
+
+func (m *WebhookDeadLetter) GetError() string {
+	if m != nil && m.Error != nil {
+		return *m.Error
+	}
+	return ""
+}
+
+func (m *WebhookDeadLetter) GetAttempts() int32 {
+	if m != nil && m.Attempts != nil {
+		return *m.Attempts
+	}
+	return 0
+}
+
+func (m *WebhookDeadLetter) GetTimestamp() int64 {
+	if m != nil && m.Timestamp != nil {
+		return *m.Timestamp
+	}
+	return 0
+}
+
+type RetryCacheEntry struct {
+	Operation            *string  `protobuf:"bytes,1,req,name=operation" json:"operation,omitempty"`
+	Version              *int64   `protobuf:"varint,2,opt,name=version" json:"version,omitempty"`
+	ExpireTime           *int64   `protobuf:"varint,3,req,name=expire_time" json:"expire_time,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RetryCacheEntry) Reset()         { *m = RetryCacheEntry{} }
+func (m *RetryCacheEntry) String() string { return proto.CompactTextString(m) }
+func (*RetryCacheEntry) ProtoMessage()    {}
+func (*RetryCacheEntry) Descriptor() ([]byte, []int) {
+	return fileDescriptor_proxy_297af728cea984de, []int{14}
+}
+func (m *RetryCacheEntry) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RetryCacheEntry.Unmarshal(m, b)
+}
+func (m *RetryCacheEntry) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RetryCacheEntry.Marshal(b, m, deterministic)
+}
+func (dst *RetryCacheEntry) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RetryCacheEntry.Merge(dst, src)
+}
+func (m *RetryCacheEntry) XXX_Size() int {
+	return xxx_messageInfo_RetryCacheEntry.Size(m)
+}
+func (m *RetryCacheEntry) XXX_DiscardUnknown() {
+	xxx_messageInfo_RetryCacheEntry.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RetryCacheEntry proto.InternalMessageInfo
+
+func (m *RetryCacheEntry) GetOperation() string {
+	if m != nil && m.Operation != nil {
+		return *m.Operation
+	}
+	return ""
+}
+
+func (m *RetryCacheEntry) GetVersion() int64 {
+	if m != nil && m.Version != nil {
+		return *m.Version
+	}
+	return 0
+}
+
+func (m *RetryCacheEntry) GetExpireTime() int64 {
+	if m != nil && m.ExpireTime != nil {
+		return *m.ExpireTime
+	}
+	return 0
+}
+
+type BlockTombstone struct {
+	CollectionId         *int64   `protobuf:"varint,1,req,name=collection_id" json:"collection_id,omitempty"`
+	ExpireTime           *int64   `protobuf:"varint,2,req,name=expire_time" json:"expire_time,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *BlockTombstone) Reset()         { *m = BlockTombstone{} }
+func (m *BlockTombstone) String() string { return proto.CompactTextString(m) }
+func (*BlockTombstone) ProtoMessage()    {}
+func (*BlockTombstone) Descriptor() ([]byte, []int) {
+	return fileDescriptor_proxy_297af728cea984de, []int{15}
+}
+func (m *BlockTombstone) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_BlockTombstone.Unmarshal(m, b)
+}
+func (m *BlockTombstone) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_BlockTombstone.Marshal(b, m, deterministic)
+}
+func (dst *BlockTombstone) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_BlockTombstone.Merge(dst, src)
+}
+func (m *BlockTombstone) XXX_Size() int {
+	return xxx_messageInfo_BlockTombstone.Size(m)
+}
+func (m *BlockTombstone) XXX_DiscardUnknown() {
+	xxx_messageInfo_BlockTombstone.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_BlockTombstone proto.InternalMessageInfo
+
+func (m *BlockTombstone) GetCollectionId() int64 {
+	if m != nil && m.CollectionId != nil {
+		return *m.CollectionId
+	}
+	return 0
+}
+
+func (m *BlockTombstone) GetExpireTime() int64 {
+	if m != nil && m.ExpireTime != nil {
+		return *m.ExpireTime
+	}
+	return 0
+}
+
+type WebhookLease struct {
+	Holder               *string  `protobuf:"bytes,1,req,name=holder" json:"holder,omitempty"`
+	ExpireTime           *int64   `protobuf:"varint,2,req,name=expire_time" json:"expire_time,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *WebhookLease) Reset()         { *m = WebhookLease{} }
+func (m *WebhookLease) String() string { return proto.CompactTextString(m) }
+func (*WebhookLease) ProtoMessage()    {}
+func (*WebhookLease) Descriptor() ([]byte, []int) {
+	return fileDescriptor_proxy_297af728cea984de, []int{16}
+}
+func (m *WebhookLease) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_WebhookLease.Unmarshal(m, b)
+}
+func (m *WebhookLease) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_WebhookLease.Marshal(b, m, deterministic)
+}
+func (dst *WebhookLease) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_WebhookLease.Merge(dst, src)
+}
+func (m *WebhookLease) XXX_Size() int {
+	return xxx_messageInfo_WebhookLease.Size(m)
+}
+func (m *WebhookLease) XXX_DiscardUnknown() {
+	xxx_messageInfo_WebhookLease.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_WebhookLease proto.InternalMessageInfo
+
+func (m *WebhookLease) GetHolder() string {
+	if m != nil && m.Holder != nil {
+		return *m.Holder
+	}
+	return ""
+}
+
+func (m *WebhookLease) GetExpireTime() int64 {
+	if m != nil && m.ExpireTime != nil {
+		return *m.ExpireTime
+	}
+	return 0
+}
+
 func init() {
 	proto.RegisterType((*BlockMeta)(nil), "proxy.BlockMeta")
 	proto.RegisterType((*BlockStorageNode)(nil), "proxy.BlockStorageNode")
@@ -286,33 +1103,76 @@ func init() {
 	proto.RegisterType((*INodeID)(nil), "proxy.INodeID")
 	proto.RegisterType((*INodeMeta)(nil), "proxy.INodeMeta")
 	proto.RegisterType((*INodeFileBlock)(nil), "proxy.INodeFileBlock")
+	proto.RegisterType((*ExportHeader)(nil), "proxy.ExportHeader")
+	proto.RegisterType((*ExportRecord)(nil), "proxy.ExportRecord")
+	proto.RegisterType((*ExportTrailer)(nil), "proxy.ExportTrailer")
+	proto.RegisterType((*ExportEntry)(nil), "proxy.ExportEntry")
+	proto.RegisterType((*ChangeEvent)(nil), "proxy.ChangeEvent")
+	proto.RegisterType((*ChangeEventBatch)(nil), "proxy.ChangeEventBatch")
+	proto.RegisterType((*ChangeEventCursor)(nil), "proxy.ChangeEventCursor")
+	proto.RegisterType((*WebhookDeadLetter)(nil), "proxy.WebhookDeadLetter")
+	proto.RegisterType((*RetryCacheEntry)(nil), "proxy.RetryCacheEntry")
+	proto.RegisterType((*BlockTombstone)(nil), "proxy.BlockTombstone")
+	proto.RegisterType((*WebhookLease)(nil), "proxy.WebhookLease")
 }
 
-func init() { proto.RegisterFile("proxy.proto", fileDescriptor0) }
-
-var fileDescriptor0 = []byte{
-	// 367 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x09, 0x6e, 0x88, 0x02, 0xff, 0x6c, 0x91, 0xb1, 0x6e, 0xdb, 0x30,
-	0x10, 0x86, 0x21, 0xc9, 0xb2, 0xab, 0x93, 0x6d, 0xd4, 0x74, 0xd5, 0xb2, 0x9b, 0xa0, 0xa1, 0xe0,
-	0xe4, 0xa1, 0x73, 0x27, 0xa3, 0x28, 0xe0, 0xa1, 0x59, 0xf2, 0x00, 0x02, 0x4d, 0x5d, 0x6c, 0x22,
-	0x12, 0x29, 0x50, 0x0c, 0x60, 0xef, 0x79, 0xb7, 0xbc, 0x56, 0xc0, 0x93, 0x1d, 0xc4, 0x48, 0x46,
-	0x7d, 0x3a, 0xe2, 0xfe, 0xff, 0x3b, 0xc8, 0x7b, 0x67, 0x4f, 0xe7, 0x4d, 0xef, 0xac, 0xb7, 0x2c,
-	0xa5, 0x8f, 0xea, 0x39, 0x82, 0x6c, 0xdb, 0x5a, 0xf5, 0xf8, 0x1f, 0xbd, 0x64, 0x00, 0xb1, 0x6e,
-	0x78, 0x54, 0x46, 0x22, 0x61, 0x0c, 0xe0, 0x80, 0x06, 0x9d, 0xf4, 0xda, 0x1a, 0x1e, 0x13, 0xfb,
-	0x06, 0x73, 0xf3, 0xd4, 0xed, 0xd1, 0xd5, 0xfb, 0xb3, 0xc7, 0x81, 0x27, 0x44, 0xd7, 0x90, 0x3b,
-	0xec, 0x5b, 0xad, 0xc6, 0xd1, 0x49, 0x19, 0x89, 0x94, 0x15, 0xb0, 0x50, 0xb6, 0x6d, 0x51, 0x05,
-	0x56, 0xeb, 0x86, 0xa7, 0x34, 0x5b, 0xc0, 0x62, 0x1f, 0xd6, 0xd5, 0xbd, 0xb5, 0x6d, 0xc0, 0xd3,
-	0x32, 0x12, 0x59, 0xf5, 0x07, 0xbe, 0x52, 0x8a, 0x7b, 0x6f, 0x9d, 0x3c, 0xe0, 0x9d, 0x6d, 0x30,
-	0x2c, 0x6b, 0xa4, 0x97, 0xb5, 0xb1, 0x0d, 0xd6, 0x14, 0x2b, 0x16, 0x59, 0x88, 0x35, 0x8c, 0x43,
-	0x81, 0xc5, 0x81, 0x55, 0x5b, 0x98, 0xbf, 0x7f, 0xcd, 0x7e, 0x41, 0x1a, 0x1e, 0x0d, 0x3c, 0x2a,
-	0x13, 0x91, 0xff, 0xfe, 0xb1, 0x19, 0x8b, 0x7f, 0xd8, 0x30, 0xd6, 0xa5, 0x6a, 0x55, 0x01, 0xb3,
-	0x5d, 0x80, 0xbb, 0xbf, 0x6f, 0x16, 0x62, 0x91, 0x54, 0x2f, 0x11, 0x64, 0xc4, 0x6f, 0xfc, 0xc4,
-	0x22, 0x61, 0x73, 0x98, 0x18, 0xd9, 0xe1, 0x18, 0x21, 0xc4, 0xea, 0xd1, 0x75, 0x7a, 0x18, 0x82,
-	0x82, 0x84, 0x26, 0x7e, 0xc2, 0xaa, 0xb3, 0x8d, 0x7e, 0xb8, 0x88, 0xa9, 0xbd, 0xee, 0x90, 0x4f,
-	0xe8, 0xd7, 0x1a, 0x72, 0xa9, 0x14, 0x0e, 0xc3, 0x08, 0x53, 0x82, 0x4b, 0x98, 0x1e, 0x51, 0x36,
-	0xe8, 0x48, 0x0a, 0x6d, 0xf0, 0xe7, 0x1e, 0xf9, 0xac, 0x8c, 0x45, 0xca, 0x56, 0x90, 0xf5, 0xd2,
-	0xa1, 0xf1, 0xa1, 0xf7, 0x97, 0xab, 0x78, 0xd5, 0xea, 0x80, 0x28, 0x49, 0x16, 0x54, 0xb2, 0xef,
-	0xb0, 0xbc, 0xc0, 0x4e, 0xaa, 0xa3, 0x36, 0xc8, 0x81, 0x14, 0xef, 0x60, 0x49, 0x45, 0xfe, 0xe9,
-	0x16, 0xc9, 0xc4, 0x4d, 0x9b, 0x02, 0x16, 0x06, 0x4f, 0xbe, 0x1e, 0x8f, 0x73, 0xb5, 0xf2, 0xf9,
-	0xc1, 0x5f, 0x03, 0x00, 0x00, 0xff, 0xff, 0x86, 0x0e, 0x36, 0xd1, 0x49, 0x02, 0x00, 0x00,
+func init() { proto.RegisterFile("proxy.proto", fileDescriptor_proxy_297af728cea984de) }
+
+var fileDescriptor_proxy_297af728cea984de = []byte{
+	// 876 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x6c, 0x55, 0xcd, 0x92, 0xe3, 0x34,
+	0x10, 0x2e, 0x3b, 0x71, 0x7e, 0xda, 0x71, 0xc6, 0xf1, 0x6c, 0xc0, 0x5c, 0x20, 0x78, 0x81, 0x0a,
+	0x1c, 0xf6, 0x10, 0xae, 0x7b, 0x9a, 0x1f, 0x8a, 0xa1, 0x16, 0x0e, 0xcb, 0x56, 0xed, 0xd1, 0xa5,
+	0xd8, 0xbd, 0x63, 0xd5, 0xd8, 0x96, 0x91, 0x94, 0x21, 0xe1, 0xc0, 0x4b, 0x50, 0x5c, 0x78, 0x13,
+	0x1e, 0x85, 0xb7, 0xa1, 0xd4, 0xb2, 0x13, 0x67, 0x67, 0x8e, 0xfa, 0xdc, 0xad, 0xfe, 0xfa, 0xd3,
+	0xd7, 0x6d, 0xf0, 0x1b, 0x29, 0xf6, 0x87, 0x57, 0x8d, 0x14, 0x5a, 0x44, 0x1e, 0x1d, 0x92, 0xbf,
+	0x1d, 0x98, 0x5e, 0x95, 0x22, 0x7b, 0xf8, 0x19, 0x35, 0x8b, 0x00, 0x5c, 0x9e, 0xc7, 0xce, 0xca,
+	0x59, 0x0f, 0xa2, 0x08, 0xe0, 0x1e, 0x6b, 0x94, 0x4c, 0x73, 0x51, 0xc7, 0x2e, 0x61, 0x2f, 0x60,
+	0x56, 0xef, 0xaa, 0x2d, 0xca, 0x74, 0x7b, 0xd0, 0xa8, 0xe2, 0x01, 0xa1, 0x97, 0xe0, 0x4b, 0x6c,
+	0x4a, 0x9e, 0xd9, 0xd0, 0xe1, 0xca, 0x59, 0x7b, 0xd1, 0x12, 0x82, 0x4c, 0x94, 0x25, 0x66, 0x06,
+	0x4b, 0x79, 0x1e, 0x7b, 0x14, 0xbb, 0x84, 0x60, 0x6b, 0xca, 0xa5, 0x8d, 0x10, 0xa5, 0x81, 0x47,
+	0x2b, 0x67, 0x3d, 0x8d, 0x2e, 0x60, 0xfc, 0x88, 0x52, 0x99, 0xf4, 0xb1, 0x89, 0x4b, 0x5e, 0x43,
+	0x48, 0xb4, 0x7e, 0xd5, 0x42, 0xb2, 0x7b, 0xfc, 0x45, 0xe4, 0x68, 0xaa, 0xe7, 0x4c, 0xb3, 0xb4,
+	0x16, 0x39, 0xa6, 0xc4, 0xd3, 0x5d, 0x4f, 0x0d, 0x4f, 0x65, 0x83, 0x0c, 0xe6, 0x1a, 0x2c, 0xb9,
+	0x82, 0x59, 0x3f, 0x3b, 0xfa, 0x06, 0x3c, 0x93, 0xa4, 0x62, 0x67, 0x35, 0x58, 0xfb, 0x9b, 0x4f,
+	0x5f, 0x59, 0x25, 0x9e, 0x54, 0xb0, 0xfd, 0x53, 0xaf, 0xc9, 0x12, 0xc6, 0x77, 0x06, 0xbc, 0xbb,
+	0x39, 0xca, 0xe2, 0xae, 0x07, 0xc9, 0x3f, 0x2e, 0x4c, 0x09, 0x3f, 0x13, 0xcc, 0x5d, 0x0f, 0xa2,
+	0x19, 0x0c, 0x6b, 0x56, 0x61, 0xec, 0x76, 0xb4, 0x1a, 0x94, 0x15, 0x57, 0xd4, 0xd4, 0x80, 0x22,
+	0x3e, 0x83, 0x45, 0x25, 0x72, 0xfe, 0xa1, 0x55, 0x2a, 0xd5, 0xbc, 0xc2, 0x78, 0x48, 0x9f, 0x2e,
+	0xc1, 0x67, 0x59, 0x86, 0x4a, 0x59, 0xd0, 0x23, 0x70, 0x0e, 0xa3, 0x02, 0x59, 0x8e, 0x92, 0x54,
+	0xa2, 0x0a, 0xfa, 0xd0, 0x60, 0x3c, 0x5e, 0xb9, 0x6b, 0x2f, 0x5a, 0xc0, 0xb4, 0x61, 0x12, 0x6b,
+	0x6d, 0xfa, 0x9e, 0x74, 0x2f, 0x91, 0x95, 0xdc, 0x40, 0xc4, 0x64, 0x4a, 0xda, 0x7e, 0x02, 0xf3,
+	0x16, 0xac, 0x58, 0x56, 0xf0, 0x1a, 0x63, 0x20, 0x3c, 0x00, 0x4f, 0xfc, 0x5e, 0xa3, 0x8c, 0xfd,
+	0xee, 0x78, 0x2f, 0xc5, 0xae, 0x89, 0x67, 0x74, 0x0c, 0x61, 0x52, 0xab, 0xf4, 0xb7, 0x9d, 0xd0,
+	0x2c, 0x0e, 0xe8, 0xf2, 0x10, 0x26, 0x79, 0x87, 0xcc, 0x09, 0xe9, 0xbd, 0xda, 0x05, 0x69, 0x76,
+	0x07, 0x73, 0xd2, 0xe6, 0x07, 0x5e, 0x22, 0x89, 0x7b, 0x26, 0xd0, 0x12, 0x82, 0x1a, 0xf7, 0x3a,
+	0xb5, 0x06, 0xe8, 0x84, 0x7e, 0xde, 0x54, 0xc9, 0x06, 0x66, 0xb7, 0xfb, 0x46, 0x48, 0xfd, 0x23,
+	0x29, 0xd0, 0xaf, 0x65, 0x6e, 0x0b, 0x4c, 0xfb, 0x46, 0x2a, 0xa5, 0x59, 0xd5, 0x90, 0xe6, 0xc3,
+	0xe4, 0x3f, 0xa7, 0x4b, 0x7a, 0x8b, 0x99, 0x90, 0x79, 0xe4, 0xc3, 0xe0, 0x01, 0x0f, 0x94, 0x30,
+	0x8b, 0xbe, 0x00, 0x8f, 0x1b, 0x17, 0x50, 0x59, 0x7f, 0x13, 0xb6, 0x26, 0x38, 0x3d, 0xe6, 0xe7,
+	0x30, 0xca, 0xb1, 0xd6, 0xf2, 0x40, 0x14, 0xfc, 0xcd, 0xbc, 0x1f, 0x71, 0x77, 0x13, 0x7d, 0x0b,
+	0xf0, 0x81, 0x97, 0x68, 0xf9, 0x93, 0xcd, 0xfd, 0xcd, 0xb2, 0x1f, 0x73, 0x6a, 0xfb, 0x2b, 0x00,
+	0xdb, 0x65, 0x85, 0x9a, 0xc5, 0xde, 0x59, 0xc1, 0xd3, 0xb8, 0x7d, 0xd7, 0x0d, 0x43, 0x6b, 0x60,
+	0x7a, 0x66, 0x7f, 0x73, 0xf9, 0x8c, 0x3d, 0x93, 0x0d, 0x04, 0xb6, 0xb5, 0x77, 0x92, 0xf1, 0xd2,
+	0x0a, 0x22, 0xa9, 0x4b, 0xd5, 0xca, 0x1b, 0xc2, 0x24, 0x2b, 0x30, 0x7b, 0x50, 0xbb, 0x8a, 0xf4,
+	0x08, 0x92, 0x3f, 0xc1, 0xb7, 0x39, 0xb7, 0xa6, 0xab, 0xe8, 0xe5, 0xd1, 0x4e, 0xce, 0x59, 0x9d,
+	0x33, 0x9d, 0x5f, 0xc2, 0xc8, 0x5e, 0x1b, 0xbb, 0xcf, 0x04, 0xb5, 0xba, 0x7e, 0x0d, 0x63, 0x6d,
+	0x69, 0xb4, 0x52, 0xbd, 0x38, 0x8b, 0x6a, 0x29, 0x26, 0xff, 0x3a, 0xe0, 0x5f, 0x17, 0xac, 0xbe,
+	0xc7, 0xdb, 0x47, 0xac, 0xf5, 0xd1, 0xbf, 0x76, 0x70, 0x43, 0x98, 0xf0, 0x6e, 0x94, 0x5d, 0xea,
+	0x20, 0x02, 0xb0, 0x08, 0x45, 0x0d, 0x56, 0xce, 0xc7, 0x2e, 0x1f, 0x76, 0x63, 0x40, 0xf6, 0xf6,
+	0xc8, 0xa8, 0x4b, 0x08, 0x44, 0x99, 0xa7, 0xa7, 0xa0, 0x51, 0xe7, 0xd6, 0xa3, 0xcf, 0xc6, 0x5d,
+	0x9a, 0xe2, 0x7f, 0x60, 0x3b, 0x2a, 0x33, 0x18, 0x36, 0x4c, 0x17, 0xed, 0x8c, 0x84, 0x30, 0xb1,
+	0x97, 0xe8, 0xc2, 0x4e, 0x47, 0xf2, 0x1e, 0xc2, 0x1e, 0xf5, 0x2b, 0xa6, 0xb3, 0x82, 0xf8, 0xef,
+	0x8f, 0x76, 0x7e, 0x6a, 0xc0, 0x28, 0x81, 0x11, 0x9a, 0x70, 0x63, 0x62, 0xb3, 0x68, 0xa2, 0x56,
+	0x96, 0xde, 0x4d, 0xc9, 0x97, 0xb0, 0xe8, 0x1d, 0xaf, 0x77, 0x52, 0x09, 0x79, 0x7e, 0x73, 0xf2,
+	0x97, 0x03, 0x8b, 0xf7, 0xb8, 0x2d, 0x84, 0x78, 0xb8, 0x41, 0x96, 0xbf, 0x41, 0xad, 0x51, 0xd2,
+	0xa2, 0xdb, 0x6d, 0x55, 0x26, 0xf9, 0x16, 0x65, 0xab, 0x61, 0x64, 0x2c, 0x29, 0x95, 0x4e, 0x29,
+	0xdb, 0xed, 0x78, 0x95, 0xac, 0x83, 0xec, 0xe2, 0xb9, 0x80, 0x71, 0xc3, 0x0e, 0xa5, 0x60, 0x39,
+	0xad, 0x9b, 0x99, 0x19, 0x76, 0x94, 0x52, 0xc8, 0x56, 0xc3, 0x10, 0x26, 0x4c, 0x6b, 0xac, 0x1a,
+	0xad, 0xe2, 0x51, 0x27, 0xfb, 0xa9, 0x39, 0xbb, 0x92, 0x7f, 0x82, 0x8b, 0xb7, 0xa8, 0xe5, 0xe1,
+	0x9a, 0x65, 0x05, 0x5a, 0x47, 0x2d, 0x60, 0x2a, 0x9a, 0xee, 0x17, 0x61, 0x19, 0xf5, 0xe6, 0xd4,
+	0xed, 0x76, 0x12, 0xee, 0x1b, 0x2e, 0xd1, 0x6e, 0x36, 0x22, 0x94, 0xbc, 0x86, 0x39, 0xb9, 0xfb,
+	0x9d, 0xa8, 0xb6, 0x4a, 0x8b, 0x1a, 0x9f, 0xfe, 0x2f, 0x9c, 0x95, 0xfb, 0x34, 0x9b, 0x3a, 0x4c,
+	0xbe, 0x87, 0x59, 0x2b, 0xcf, 0x1b, 0x64, 0x0a, 0x69, 0x4f, 0x8a, 0x32, 0x3f, 0xaa, 0xf2, 0x5c,
+	0xd2, 0xff, 0x03, 0x00, 0x38, 0x3a, 0xd7, 0x98, 0xfe, 0x06, 0x00, 0x00,
 }
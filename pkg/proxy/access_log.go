@@ -0,0 +1,185 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opentracing/opentracing-go"
+	"github.com/redis-force/less-state-hdfs/pkg/proxy/config"
+	"github.com/uber/jaeger-client-go"
+	"go.uber.org/zap"
+)
+
+// fields of the access log
+const (
+	accessFieldPrincipal    = "principal"
+	accessFieldUser         = "user"
+	accessFieldIP           = "ip"
+	accessFieldRoute        = "route"
+	accessFieldMethod       = "method"
+	accessFieldURI          = "uri"
+	accessFieldStatus       = "status"
+	accessFieldLatency      = "latency"
+	accessFieldRequestSize  = "request_size"
+	accessFieldResponseSize = "response_size"
+	accessFieldUserAgent    = "user_agent"
+	accessFieldTraceID      = "trace_id"
+	// the captured request and response bodies
+	accessFieldBody = "body"
+)
+
+var accessLogFields = map[string]func(c *gin.Context, start time.Time) zap.Field{
+	accessFieldPrincipal: func(c *gin.Context, _ time.Time) zap.Field {
+		return zap.String(accessFieldPrincipal, c.GetString(principalKey))
+	},
+	accessFieldUser: func(c *gin.Context, _ time.Time) zap.Field {
+		return zap.String(accessFieldUser, c.GetHeader(hdfsUserHeader))
+	},
+	accessFieldIP: func(c *gin.Context, _ time.Time) zap.Field {
+		return zap.String(accessFieldIP, remoteIP(c.Request))
+	},
+	accessFieldRoute: func(c *gin.Context, _ time.Time) zap.Field {
+		return zap.String(accessFieldRoute, auditOperation(c))
+	},
+	accessFieldMethod: func(c *gin.Context, _ time.Time) zap.Field {
+		return zap.String(accessFieldMethod, c.Request.Method)
+	},
+	accessFieldURI: func(c *gin.Context, _ time.Time) zap.Field {
+		return zap.String(accessFieldURI, c.Request.URL.RequestURI())
+	},
+	accessFieldStatus: func(c *gin.Context, _ time.Time) zap.Field {
+		return zap.Int(accessFieldStatus, c.Writer.Status())
+	},
+	accessFieldLatency: func(c *gin.Context, start time.Time) zap.Field {
+		return zap.Duration(accessFieldLatency, time.Since(start))
+	},
+	accessFieldRequestSize: func(c *gin.Context, _ time.Time) zap.Field {
+		return zap.Int64(accessFieldRequestSize, c.Request.ContentLength)
+	},
+	accessFieldResponseSize: func(c *gin.Context, _ time.Time) zap.Field {
+		return zap.Int(accessFieldResponseSize, c.Writer.Size())
+	},
+	accessFieldUserAgent: func(c *gin.Context, _ time.Time) zap.Field {
+		return zap.String(accessFieldUserAgent, c.Request.UserAgent())
+	},
+	accessFieldTraceID: func(c *gin.Context, _ time.Time) zap.Field {
+		if span := opentracing.SpanFromContext(c.Request.Context()); span != nil {
+			if sc, ok := span.Context().(jaeger.SpanContext); ok {
+				return zap.String(accessFieldTraceID, sc.TraceID().String())
+			}
+		}
+		return zap.Skip()
+	},
+}
+
+var defaultAccessLogFields = []string{
+	accessFieldPrincipal, accessFieldIP, accessFieldRoute, accessFieldMethod, accessFieldURI,
+	accessFieldStatus, accessFieldLatency, accessFieldResponseSize, accessFieldTraceID, accessFieldBody,
+}
+
+//accessLogger log one line per request with the configured fields
+type accessLogger struct {
+	logger  *zap.Logger
+	fields  []func(c *gin.Context, start time.Time) zap.Field
+	body    bool
+	maxBody int
+	sample  float64
+}
+
+func newAccessLogger(c config.AccessLogConfig, logger *zap.Logger) (*accessLogger, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+	names := c.Fields
+	if len(names) == 0 {
+		names = defaultAccessLogFields
+	}
+	l := &accessLogger{logger: logger.Named("access"), maxBody: c.MaxBodySize, sample: c.BodySampleRate}
+	for _, name := range names {
+		if name == accessFieldBody {
+			l.body = c.MaxBodySize > 0
+			continue
+		}
+		field, ok := accessLogFields[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown access log field %q", name)
+		}
+		l.fields = append(l.fields, field)
+	}
+	return l, nil
+}
+
+//limitedBuffer keep the first max bytes written to it
+type limitedBuffer struct {
+	buf       []byte
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) keep(p []byte) {
+	if n := b.max - len(b.buf); n < len(p) {
+		b.truncated = true
+		p = p[:n]
+	}
+	b.buf = append(b.buf, p...)
+}
+
+type bodyCaptureReader struct {
+	io.ReadCloser
+	body *limitedBuffer
+}
+
+func (r *bodyCaptureReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.body.keep(p[:n])
+	return n, err
+}
+
+type bodyCaptureWriter struct {
+	gin.ResponseWriter
+	body *limitedBuffer
+}
+
+func (w *bodyCaptureWriter) Write(p []byte) (int, error) {
+	w.body.keep(p)
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *bodyCaptureWriter) WriteString(s string) (int, error) {
+	w.body.keep([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+//middleware the bodies are kept up to the limit while serving, and logged only if the request failed or is sampled
+func (l *accessLogger) middleware(c *gin.Context) {
+	start := time.Now()
+	var request, response *limitedBuffer
+	if l.body {
+		request, response = &limitedBuffer{max: l.maxBody}, &limitedBuffer{max: l.maxBody}
+		if c.Request.Body != nil {
+			c.Request.Body = &bodyCaptureReader{ReadCloser: c.Request.Body, body: request}
+		}
+		c.Writer = &bodyCaptureWriter{ResponseWriter: c.Writer, body: response}
+	}
+	c.Next()
+	fields := make([]zap.Field, 0, len(l.fields)+3)
+	for _, field := range l.fields {
+		fields = append(fields, field(c, start))
+	}
+	status := c.Writer.Status()
+	if l.body && (status >= http.StatusBadRequest || (l.sample > 0 && rand.Float64() < l.sample)) {
+		fields = append(fields,
+			zap.ByteString("request_body", request.buf),
+			zap.ByteString("response_body", response.buf),
+			zap.Bool("body_truncated", request.truncated || response.truncated))
+	}
+	if status >= http.StatusInternalServerError {
+		l.logger.Warn("access", fields...)
+		return
+	}
+	l.logger.Info("access", fields...)
+}
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis-force/less-state-hdfs/pkg/proxy/config"
+	"go.uber.org/zap"
+)
+
+//serveAccessLogged serve one PUT /api/inode/:id answering the status and echoing the body through the access logger
+func serveAccessLogged(t *testing.T, c config.AccessLogConfig, status int, body string) map[string]interface{} {
+	t.Helper()
+	logger, buf := bufferLogger()
+	l, err := newAccessLogger(c, logger)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.Use(l.middleware)
+	router.PUT("/api/inode/:id", func(c *gin.Context) {
+		b, _ := ioutil.ReadAll(c.Request.Body)
+		c.String(status, "echo "+string(b))
+	})
+	r := httptest.NewRequest(http.MethodPut, "/api/inode/5", strings.NewReader(body))
+	r.RemoteAddr = "10.0.0.1:40000"
+	r.Header.Set("X-Forwarded-For", "192.168.1.1")
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	entries := logEntries(t, buf)
+	if len(entries) != 1 {
+		t.Fatalf("access entries %v", entries)
+	}
+	return entries[0]
+}
+
+func TestAccessLogFields(t *testing.T) {
+	if l, err := newAccessLogger(config.AccessLogConfig{}, zap.NewNop()); l != nil || err != nil {
+		t.Fatalf("disabled access log %v error %v", l, err)
+	}
+	if _, err := newAccessLogger(config.AccessLogConfig{Enabled: true, Fields: []string{"cookie"}}, zap.NewNop()); err == nil {
+		t.Fatal("unknown field accepted")
+	}
+	entry := serveAccessLogged(t, config.AccessLogConfig{Enabled: true, Fields: []string{accessFieldIP, accessFieldRoute, accessFieldStatus}}, http.StatusOK, "{}")
+	for _, key := range []string{accessFieldURI, accessFieldLatency, accessFieldPrincipal, "request_body"} {
+		if _, ok := entry[key]; ok {
+			t.Errorf("unselected field %s logged", key)
+		}
+	}
+	// the peer address, forwarding headers are set by any client
+	if _, ok := entry[accessFieldRoute]; !ok || entry[accessFieldIP] != "10.0.0.1" || entry[accessFieldStatus] != float64(http.StatusOK) {
+		t.Fatalf("access entry %v", entry)
+	}
+}
+
+func TestAccessLogBodies(t *testing.T) {
+	c := config.AccessLogConfig{Enabled: true, Fields: []string{accessFieldStatus, accessFieldBody}, MaxBodySize: 64}
+	if entry := serveAccessLogged(t, c, http.StatusOK, "{}"); entry["request_body"] != nil {
+		t.Fatalf("body of a successful request logged without sampling %v", entry)
+	}
+	entry := serveAccessLogged(t, c, http.StatusBadRequest, "{}")
+	if entry["request_body"] != "{}" || entry["response_body"] != "echo {}" || entry["body_truncated"] != false {
+		t.Fatalf("bodies of a failed request %v", entry)
+	}
+	c.BodySampleRate = 1
+	if entry = serveAccessLogged(t, c, http.StatusOK, "{}"); entry["request_body"] != "{}" {
+		t.Fatalf("bodies of a sampled request %v", entry)
+	}
+	c.MaxBodySize = 4
+	entry = serveAccessLogged(t, c, http.StatusOK, `{"a":1}`)
+	if entry["request_body"] != `{"a"` || entry["response_body"] != "echo" || entry["body_truncated"] != true {
+		t.Fatalf("bodies over the size limit %v", entry)
+	}
+	c.MaxBodySize = 0
+	if entry = serveAccessLogged(t, c, http.StatusBadRequest, "{}"); entry["request_body"] != nil {
+		t.Fatalf("bodies logged without a size limit %v", entry)
+	}
+}
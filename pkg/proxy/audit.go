@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+	"github.com/redis-force/less-state-hdfs/pkg/proxy/config"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	// principalKey gin context key of the authenticated caller
+	principalKey = "principal"
+	// hdfsUserHeader hdfs user the namenode acts for
+	hdfsUserHeader = "X-HDFS-User"
+)
+
+type auditContextKey struct{}
+
+//auditRecord filled by the store while serving the request
+type auditRecord struct {
+	txid int64
+	// a timestamp after the commit, the change is visible to reads from it
+	commitTS uint64
+	events   []*pb.ChangeEvent
+	// ids of the policies the authorizer decided with
+	policies []string
+	allowed  bool
+}
+
+//recordAudit keep the change events of a committed transaction for the audit log of the request, if any.
+//Their paths are resolved at a snapshot taken after the commit, whose ts is the commit ts of the record
+func (s *Proxy) recordAudit(ctx context.Context, batches []*pb.ChangeEventBatch) {
+	r, ok := ctx.Value(auditContextKey{}).(*auditRecord)
+	if !ok || len(batches) == 0 {
+		return
+	}
+	r.txid, r.commitTS, r.events = batches[0].GetTxid(), 0, nil
+	for _, b := range batches {
+		r.events = append(r.events, b.GetEvents()...)
+	}
+	tx, err := s.begin(ctx)
+	if err != nil {
+		s.logger.Warn("audit snapshot error", zap.Int64("txid", r.txid), zap.Error(err))
+		return
+	}
+	defer tx.Rollback()
+	r.commitTS = tx.StartTS()
+	paths := newEventPathResolver(s, tx)
+	for _, e := range r.events {
+		if err = paths.resolve(ctx, e); err != nil {
+			s.logger.Warn("audit path error", zap.Int64("txid", r.txid), zap.Int64("inode", e.GetInodeId()), zap.Error(err))
+			return
+		}
+	}
+}
+
+//recordAuthorization keep the authorizer decision for the audit log of the request, if any
+func recordAuthorization(ctx context.Context, d *AuthorizationDecision) {
+	if r, ok := ctx.Value(auditContextKey{}).(*auditRecord); ok {
+		r.policies = append(r.policies, d.PolicyID)
+		r.allowed = d.Allowed
+	}
+}
+
+//resetAuthorization forget the decisions of a previous check of the request
+func resetAuthorization(ctx context.Context) {
+	if r, ok := ctx.Value(auditContextKey{}).(*auditRecord); ok {
+		r.policies, r.allowed = nil, false
+	}
+}
+
+//newAuditLogger build a json logger writing to every sink, nil if no sink configured
+func newAuditLogger(c config.AuditConfig) (*zap.Logger, error) {
+	sinks := make([]zapcore.WriteSyncer, 0, len(c.Paths))
+	for _, path := range c.Paths {
+		switch path = strings.TrimSpace(path); path {
+		case "":
+			continue
+		case "stdout":
+			sinks = append(sinks, zapcore.Lock(os.Stdout))
+		case "stderr":
+			sinks = append(sinks, zapcore.Lock(os.Stderr))
+		default:
+			sinks = append(sinks, zapcore.AddSync(&lumberjack.Logger{
+				Filename:   path,
+				MaxSize:    c.MaxSize,
+				MaxBackups: c.MaxBackups,
+				MaxAge:     c.MaxAge,
+				LocalTime:  true,
+			}))
+		}
+	}
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+	encoder := zap.NewProductionEncoderConfig()
+	encoder.EncodeTime = zapcore.ISO8601TimeEncoder
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(encoder), zapcore.NewMultiWriteSyncer(sinks...), zapcore.InfoLevel)
+	return zap.New(core), nil
+}
+
+//remoteIP the address of the peer, forwarding headers are ignored since any client can set them
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+//auditOperation name the operation by its handler, e.g. putINodeFile, a shared route by the handler it dispatches to
+func auditOperation(c *gin.Context) string {
+	name := c.HandlerName()
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.TrimSuffix(name, "-fm")
+	if name == "getBlockResource" {
+		if operation, _ := blockResource(c); len(operation) > 0 {
+			return operation
+		}
+	}
+	return name
+}
+
+//auditMiddleware write one audit entry per request after it is served, reads are skipped unless configured
+func auditMiddleware(logger *zap.Logger, includeReads bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !includeReads && (c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead) {
+			c.Next()
+			return
+		}
+		start := time.Now()
+		record := new(auditRecord)
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), auditContextKey{}, record))
+		c.Next()
+		status := c.Writer.Status()
+		fields := []zap.Field{
+			zap.String("principal", c.GetString(principalKey)),
+			zap.String("user", c.GetHeader(hdfsUserHeader)),
+			zap.String("ip", remoteIP(c.Request)),
+			zap.String("op", auditOperation(c)),
+			zap.String("method", c.Request.Method),
+			zap.String("uri", c.Request.URL.RequestURI()),
+			zap.Bool("allowed", status != http.StatusUnauthorized && status != http.StatusForbidden),
+			zap.Bool("success", status < http.StatusBadRequest),
+			zap.Int("status", status),
+			zap.Duration("latency", time.Since(start)),
+		}
+		if id, ok := c.Get("id"); ok {
+			fields = append(fields, zap.Any("src_inode", id))
+		}
+		if id, ok := c.Get("new_id"); ok {
+			fields = append(fields, zap.Any("dst_inode", id))
+		}
+		if len(record.policies) > 0 {
+			fields = append(fields, zap.Strings("policy_ids", record.policies), zap.Bool("policy_allowed", record.allowed))
+		}
+		if len(record.events) > 0 {
+			e := record.events[0]
+			src, dst := e.GetPath(), ""
+			if e.OldPath != nil {
+				src, dst = e.GetOldPath(), e.GetPath()
+			}
+			fields = append(fields,
+				zap.String("src", src),
+				zap.String("dst", dst),
+				zap.Int64("txid", record.txid),
+				zap.Uint64("commit_ts", record.commitTS))
+		}
+		logger.Info("audit", fields...)
+	}
+}
@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pingcap/tidb/kv"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestAuditRecordedAfterCommit(t *testing.T) {
+	s := newTestProxy()
+	mustRunTxn(t, s, func(tx kv.Transaction) error {
+		mustSet(t, tx, generateINodeKey(1), testINode(1, 0, "", inodeDirectoryType))
+		return nil
+	})
+	record := new(auditRecord)
+	ctx := context.WithValue(context.Background(), auditContextKey{}, record)
+	failed := errors.New("failed")
+	err := s.runTxn(ctx, func(tx kv.Transaction) error {
+		m := testINode(2, 1, "d", inodeDirectoryType)
+		mustSet(t, tx, generateINodeKey(2), m)
+		if err := s.transAppendEvents(ctx, tx, newCreateEvent(m)); err != nil {
+			return err
+		}
+		return failed
+	})
+	if err != failed || record.txid != 0 || len(record.events) != 0 {
+		t.Fatalf("rolled back transaction audited %+v error %v", record, err)
+	}
+	var txid int64
+	err = s.runTxn(ctx, func(tx kv.Transaction) error {
+		txid = int64(tx.StartTS())
+		m := testINode(2, 1, "d", inodeDirectoryType)
+		mustSet(t, tx, generateINodeKey(2), m)
+		return s.transAppendEvents(ctx, tx, newCreateEvent(m))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if record.txid != txid || record.commitTS <= uint64(txid) || len(record.events) != 1 || record.events[0].GetPath() != "/d" {
+		t.Fatalf("audit record %+v of txid %d", record, txid)
+	}
+}
+
+//bufferLogger a logger writing json lines to the buffer
+func bufferLogger() (*zap.Logger, *bytes.Buffer) {
+	buf := new(bytes.Buffer)
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(buf), zapcore.DebugLevel)
+	return zap.New(core), buf
+}
+
+//logEntries decode the json lines of a bufferLogger
+func logEntries(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var entries []map[string]interface{}
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+		entry := make(map[string]interface{})
+		if err := json.Unmarshal(line, &entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func TestAuditIgnoresForwardedFor(t *testing.T) {
+	logger, buf := bufferLogger()
+	router := gin.New()
+	router.Use(auditMiddleware(logger, false))
+	router.PUT("/api/inode/:id", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	r := httptest.NewRequest(http.MethodPut, "/api/inode/5", nil)
+	r.RemoteAddr = "10.0.0.1:40000"
+	r.Header.Set("X-Forwarded-For", "192.168.1.1")
+	r.Header.Set("X-Real-IP", "192.168.1.2")
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	entries := logEntries(t, buf)
+	if len(entries) != 1 || entries[0]["ip"] != "10.0.0.1" {
+		t.Fatalf("audit entries %v", entries)
+	}
+}
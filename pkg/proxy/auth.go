@@ -0,0 +1,239 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis-force/less-state-hdfs/pkg/proxy/config"
+)
+
+const (
+	authMethodKey = "auth_method"
+
+	authBearer = "Bearer"
+	// Authorization: HMAC-SHA256 <key id>:<base64 signature>
+	authHMAC = "HMAC-SHA256"
+	// unix seconds covered by the hmac signature
+	authDateHeader = "X-Auth-Date"
+	// id of the request signed along with its body, a captured mutation is not replayed under another id
+	requestIDHeader = "X-Request-Id"
+
+	defaultAuthClockSkew     = 5 * time.Minute
+	defaultAuthMaxSignedBody = 64 << 20
+)
+
+var errAuthBodyTooLarge = errors.New("signed request body too large")
+
+//authenticator identify the caller of a request.
+//ok is false if the request carries no credential of the method, err is set if the credential is invalid.
+type authenticator interface {
+	name() string
+	authenticate(r *http.Request) (principal string, ok bool, err error)
+}
+
+//newAuthenticators build authenticators of every configured method,
+//none is an error unless authentication is explicitly disabled
+func newAuthenticators(c config.AuthConfig) ([]authenticator, error) {
+	ret := make([]authenticator, 0)
+	if c.ClientCert {
+		ret = append(ret, clientCertAuthenticator{})
+	}
+	if len(c.Tokens) > 0 {
+		a := &tokenAuthenticator{}
+		for _, t := range c.Tokens {
+			if len(t.Token) == 0 || len(t.Principal) == 0 {
+				return nil, fmt.Errorf("auth token of %q should have a token and a principal", t.Principal)
+			}
+			a.tokens = append(a.tokens, t)
+		}
+		ret = append(ret, a)
+	}
+	if len(c.HMACKeys) > 0 {
+		a := &hmacAuthenticator{keys: make(map[string]config.AuthHMACKey), skew: c.ClockSkew, maxBody: c.MaxSignedBody}
+		if a.skew <= 0 {
+			a.skew = defaultAuthClockSkew
+		}
+		if a.maxBody <= 0 {
+			a.maxBody = defaultAuthMaxSignedBody
+		}
+		for _, k := range c.HMACKeys {
+			if len(k.ID) == 0 || len(k.Secret) == 0 {
+				return nil, fmt.Errorf("hmac key %q should have an id and a secret", k.ID)
+			}
+			if _, ok := a.keys[k.ID]; ok {
+				return nil, fmt.Errorf("duplicate hmac key %q", k.ID)
+			}
+			if len(k.Principal) == 0 {
+				k.Principal = k.ID
+			}
+			a.keys[k.ID] = k
+		}
+		ret = append(ret, a)
+	}
+	if len(ret) == 0 && !c.Disabled {
+		return nil, fmt.Errorf("no auth method configured, set auth.disabled to serve unauthenticated callers")
+	}
+	if len(ret) > 0 && c.Disabled {
+		return nil, fmt.Errorf("auth is disabled but auth methods are configured")
+	}
+	return ret, nil
+}
+
+//authMiddleware attach the principal of the first authenticator recognizing the request, reject it otherwise
+func authMiddleware(authenticators []authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		for _, a := range authenticators {
+			principal, ok, err := a.authenticate(c.Request)
+			if err == errAuthBodyTooLarge {
+				apiResponseError(c, http.StatusRequestEntityTooLarge, err)
+				return
+			}
+			if err != nil {
+				apiResponseError(c, http.StatusUnauthorized, fmt.Errorf("%s: %s", ErrUnauthenticated, err))
+				return
+			}
+			if ok {
+				c.Set(principalKey, principal)
+				c.Set(authMethodKey, a.name())
+				c.Next()
+				return
+			}
+		}
+		apiResponseError(c, http.StatusUnauthorized, ErrUnauthenticated)
+	}
+}
+
+type clientCertAuthenticator struct{}
+
+func (clientCertAuthenticator) name() string {
+	return "client_cert"
+}
+
+//authenticate use the common name of a client certificate verified by the tls listener
+func (clientCertAuthenticator) authenticate(r *http.Request) (string, bool, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", false, nil
+	}
+	cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	if len(cn) == 0 {
+		return "", false, fmt.Errorf("client certificate has no common name")
+	}
+	return cn, true, nil
+}
+
+type tokenAuthenticator struct {
+	tokens []config.AuthToken
+}
+
+func (a *tokenAuthenticator) name() string {
+	return "token"
+}
+
+func (a *tokenAuthenticator) authenticate(r *http.Request) (string, bool, error) {
+	scheme, credential := authorization(r)
+	if scheme != authBearer {
+		return "", false, nil
+	}
+	principal := ""
+	// compare with every token so the time does not depend on which one matches
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Token), []byte(credential)) == 1 {
+			principal = t.Principal
+		}
+	}
+	if len(principal) == 0 {
+		return "", false, fmt.Errorf("invalid bearer token")
+	}
+	return principal, true, nil
+}
+
+type hmacAuthenticator struct {
+	keys    map[string]config.AuthHMACKey
+	skew    time.Duration
+	maxBody int64
+}
+
+func (a *hmacAuthenticator) name() string {
+	return "hmac"
+}
+
+//authenticate verify the signature of hmacCanonical by the secret of the key id. A request may be replayed
+//within the clock skew, signed mutations carry a request id so the retry cache answers their replays.
+func (a *hmacAuthenticator) authenticate(r *http.Request) (string, bool, error) {
+	scheme, credential := authorization(r)
+	if scheme != authHMAC {
+		return "", false, nil
+	}
+	i := strings.IndexByte(credential, ':')
+	if i <= 0 {
+		return "", false, fmt.Errorf("invalid hmac credential")
+	}
+	key, ok := a.keys[credential[:i]]
+	if !ok {
+		return "", false, fmt.Errorf("unknown hmac key %q", credential[:i])
+	}
+	signature, err := base64.StdEncoding.DecodeString(credential[i+1:])
+	if err != nil {
+		return "", false, fmt.Errorf("invalid hmac signature encoding")
+	}
+	date := r.Header.Get(authDateHeader)
+	sec, err := strconv.ParseInt(date, 10, 64)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid %s header", authDateHeader)
+	}
+	if skew := time.Since(time.Unix(sec, 0)); skew > a.skew || skew < -a.skew {
+		return "", false, fmt.Errorf("request date is out of the %s clock skew", a.skew)
+	}
+	requestID := r.Header.Get(requestIDHeader)
+	if len(requestID) == 0 && r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return "", false, fmt.Errorf("signed %s request without %s", r.Method, requestIDHeader)
+	}
+	var body []byte
+	if r.Body != nil {
+		// one byte past the limit tells a body of the limit from a larger one
+		body, err = ioutil.ReadAll(io.LimitReader(r.Body, a.maxBody+1))
+		r.Body.Close()
+		if err != nil {
+			return "", false, err
+		}
+		if int64(len(body)) > a.maxBody {
+			return "", false, errAuthBodyTooLarge
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	mac := hmac.New(sha256.New, []byte(key.Secret))
+	io.WriteString(mac, hmacCanonical(r.Method, r.URL.RequestURI(), date, requestID, body))
+	if !hmac.Equal(mac.Sum(nil), signature) {
+		return "", false, fmt.Errorf("hmac signature mismatch")
+	}
+	return key.Principal, true, nil
+}
+
+//hmacCanonical method\nrequest uri\ndate\nrequest id\nhex(sha256(body)), the request id is empty for reads without one
+func hmacCanonical(method, uri, date, requestID string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	return fmt.Sprintf("%s\n%s\n%s\n%s\n%s", method, uri, date, requestID, hex.EncodeToString(bodyHash[:]))
+}
+
+//authorization split the Authorization header into scheme and credential
+func authorization(r *http.Request) (string, string) {
+	h := strings.TrimSpace(r.Header.Get("Authorization"))
+	i := strings.IndexByte(h, ' ')
+	if i < 0 {
+		return h, ""
+	}
+	return h[:i], strings.TrimSpace(h[i+1:])
+}
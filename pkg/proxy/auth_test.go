@@ -0,0 +1,82 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/redis-force/less-state-hdfs/pkg/proxy/config"
+)
+
+func TestHMACCanonical(t *testing.T) {
+	got := hmacCanonical(http.MethodPut, "/api/inode/5?x=1", "1700000000", "req-1", []byte("{}"))
+	want := "PUT\n/api/inode/5?x=1\n1700000000\nreq-1\n44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a"
+	if got != want {
+		t.Fatalf("canonical %q, want %q", got, want)
+	}
+}
+
+func signedRequest(method, body, requestID, secret string) *http.Request {
+	r := httptest.NewRequest(method, "/api/inode/5", strings.NewReader(body))
+	date := strconv.FormatInt(time.Now().Unix(), 10)
+	r.Header.Set(authDateHeader, date)
+	if len(requestID) > 0 {
+		r.Header.Set(requestIDHeader, requestID)
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	io.WriteString(mac, hmacCanonical(method, "/api/inode/5", date, requestID, []byte(body)))
+	r.Header.Set("Authorization", authHMAC+" k1:"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	return r
+}
+
+func TestHMACAuthenticate(t *testing.T) {
+	authenticators, err := newAuthenticators(config.AuthConfig{
+		HMACKeys:      []config.AuthHMACKey{{ID: "k1", Principal: "nn", Secret: "s"}},
+		MaxSignedBody: 8,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := authenticators[0]
+	r := signedRequest(http.MethodPut, "{}", "req-1", "s")
+	if principal, ok, err := a.authenticate(r); err != nil || !ok || principal != "nn" {
+		t.Fatalf("principal %q ok %v error %v", principal, ok, err)
+	}
+	if body, _ := ioutil.ReadAll(r.Body); string(body) != "{}" {
+		t.Fatalf("body after authentication %q", body)
+	}
+	for name, r := range map[string]*http.Request{
+		"wrong secret":        signedRequest(http.MethodPut, "{}", "req-1", "t"),
+		"mutation without id": signedRequest(http.MethodPut, "{}", "", "s"),
+	} {
+		if _, _, err := a.authenticate(r); err == nil {
+			t.Errorf("%s authenticated", name)
+		}
+	}
+	if _, _, err := a.authenticate(signedRequest(http.MethodGet, "", "", "s")); err != nil {
+		t.Errorf("signed read without request id error %v", err)
+	}
+	if _, _, err := a.authenticate(signedRequest(http.MethodPut, "0123456789", "req-1", "s")); err != errAuthBodyTooLarge {
+		t.Errorf("oversized body error %v", err)
+	}
+}
+
+func TestAuthRequiresExplicitOptOut(t *testing.T) {
+	if _, err := newAuthenticators(config.AuthConfig{}); err == nil {
+		t.Fatal("no auth method accepted without disabling auth")
+	}
+	if a, err := newAuthenticators(config.AuthConfig{Disabled: true}); err != nil || len(a) != 0 {
+		t.Fatalf("disabled auth %v error %v", a, err)
+	}
+	if _, err := newAuthenticators(config.AuthConfig{Disabled: true, ClientCert: true}); err == nil {
+		t.Fatal("disabled auth accepted with a method")
+	}
+}
@@ -0,0 +1,71 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// accesses an authorization request asks for
+const (
+	AccessRead    = "read"
+	AccessWrite   = "write"
+	AccessExecute = "execute"
+	// operations without a path only the administrators may do, e.g. fsck
+	AccessAdmin = "admin"
+)
+
+//AuthorizationRequest operation of a route on a path, the path is empty for routes without an inode
+type AuthorizationRequest struct {
+	User      string
+	Groups    []string
+	Operation string
+	Path      string
+	Access    string
+}
+
+//AuthorizationDecision the policy id is recorded in the audit log, empty if no policy matched
+type AuthorizationDecision struct {
+	Allowed  bool
+	PolicyID string
+}
+
+//Authorizer decide on the requests of every api route beyond the hdfs mode bits
+type Authorizer interface {
+	Authorize(ctx context.Context, req *AuthorizationRequest) (*AuthorizationDecision, error)
+}
+
+//SetAuthorizer replace the configured authorizer, it should be called before Start
+func (s *Proxy) SetAuthorizer(a Authorizer) {
+	s.authorizer = a
+}
+
+//authorize ask the authorizer and record the decision, a denial is a PermissionError
+func (s *Proxy) authorize(ctx context.Context, u *caller, operation, path, access string) error {
+	req := &AuthorizationRequest{
+		User:      u.user,
+		Groups:    u.groupList(),
+		Operation: operation,
+		Path:      path,
+		Access:    access,
+	}
+	d, err := s.authorizer.Authorize(ctx, req)
+	if err != nil {
+		return err
+	}
+	recordAuthorization(ctx, d)
+	if d.Allowed {
+		s.logger.Debug("authorization allowed", zap.String("user", u.user), zap.String("op", operation), zap.String("path", path),
+			zap.String("access", access), zap.String("policy_id", d.PolicyID))
+		return nil
+	}
+	s.logger.Info("authorization denied", zap.String("user", u.user), zap.String("op", operation), zap.String("path", path),
+		zap.String("access", access), zap.String("policy_id", d.PolicyID))
+	policy := d.PolicyID
+	if len(policy) == 0 {
+		policy = "default"
+	}
+	return &PermissionError{User: u.user, msg: fmt.Sprintf("Permission denied by policy %s: user=%s, access=%s, operation=%s, path=%q",
+		policy, u.user, access, operation, path)}
+}
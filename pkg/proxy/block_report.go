@@ -0,0 +1,347 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pingcap/tidb/kv"
+	"github.com/redis-force/less-state-hdfs/pkg/model"
+	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+	"go.uber.org/zap"
+)
+
+const (
+	replicaValid = iota
+	replicaStale
+	replicaCorrupt
+	replicaUnknown
+)
+
+//ProcessBlockReport reconcile a datanode block report with stored block storages in one transaction.
+//A full report replaces every replica recorded on the reported storages of the datanode, an incremental one
+//only applies received and deleted blocks.
+func (s *Proxy) ProcessBlockReport(ctx context.Context, dataNodeID string, report *model.BlockReport) (*model.BlockReportResult, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.ProcessBlockReport")
+	defer span.Finish()
+	var ret *model.BlockReportResult
+	err := s.runTxn(ctx, func(tx kv.Transaction) error {
+		ret = &model.BlockReportResult{
+			Stale:   make([]model.ReportedBlock, 0),
+			Corrupt: make([]model.ReportedBlock, 0),
+			Unknown: make([]model.ReportedBlock, 0),
+		}
+		var err error
+		if report.Full {
+			err = s.processFullBlockReport(ctx, tx, dataNodeID, report, ret)
+		} else {
+			err = s.processIncrementalBlockReport(ctx, tx, dataNodeID, report, ret)
+		}
+		if err != nil {
+			s.logger.Error("ProcessBlockReport error", zap.String("data_node_id", dataNodeID), zap.Bool("full", report.Full), zap.Error(err))
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (s *Proxy) processFullBlockReport(ctx context.Context, tx kv.Transaction, dataNodeID string, report *model.BlockReport, ret *model.BlockReportResult) error {
+	stored, err := s.scanDataNodeBlocks(ctx, tx, dataNodeID)
+	if err != nil {
+		return err
+	}
+	// a report of some storages leaves the replicas on the other storages of the datanode alone
+	storages := make(map[string]bool)
+	if len(report.StorageID) > 0 {
+		storages[report.StorageID] = true
+	}
+	for _, b := range report.Blocks {
+		if len(b.StorageID) > 0 {
+			storages[b.StorageID] = true
+		}
+		delete(stored, b.BlockID)
+		if err = s.applyReportedBlock(ctx, tx, dataNodeID, report.StorageID, b, ret); err != nil {
+			return err
+		}
+	}
+	// 删除datanode上已经不存在的副本
+	for id, storageID := range stored {
+		if len(storages) > 0 && !storages[storageID] {
+			continue
+		}
+		removed, err := s.transRemoveBlockReplica(ctx, tx, id, dataNodeID, storageID)
+		if err != nil {
+			return err
+		}
+		if removed {
+			ret.Removed++
+		}
+	}
+	return nil
+}
+
+func (s *Proxy) processIncrementalBlockReport(ctx context.Context, tx kv.Transaction, dataNodeID string, report *model.BlockReport, ret *model.BlockReportResult) error {
+	for _, b := range report.Received {
+		if err := s.applyReportedBlock(ctx, tx, dataNodeID, report.StorageID, b, ret); err != nil {
+			return err
+		}
+	}
+	for _, b := range report.Deleted {
+		if len(b.StorageID) == 0 {
+			b.StorageID = report.StorageID
+		}
+		removed, err := s.transRemoveBlockReplica(ctx, tx, b.BlockID, dataNodeID, b.StorageID)
+		if err != nil {
+			return err
+		}
+		if removed {
+			ret.Removed++
+		}
+		if err = s.transClearCorruptReplica(ctx, tx, b.BlockID, dataNodeID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Proxy) applyReportedBlock(ctx context.Context, tx kv.Transaction, dataNodeID, storageID string, b model.ReportedBlock, ret *model.BlockReportResult) error {
+	if len(b.StorageID) == 0 {
+		b.StorageID = storageID
+	}
+	state, err := s.checkReportedBlock(ctx, tx, b)
+	if err != nil {
+		return err
+	}
+	switch state {
+	case replicaValid:
+		added, err := s.transAddBlockReplica(ctx, tx, b.BlockID, dataNodeID, b.StorageID)
+		if err != nil {
+			return err
+		}
+		if added {
+			ret.Added++
+		}
+		return s.transClearCorruptReplica(ctx, tx, b.BlockID, dataNodeID)
+	case replicaUnknown:
+		ret.Unknown = append(ret.Unknown, b)
+		return s.transDel(ctx, tx, generateDataNodeBlockKey(dataNodeID, b.BlockID))
+	}
+	removed, err := s.transRemoveBlockReplica(ctx, tx, b.BlockID, dataNodeID, b.StorageID)
+	if err != nil {
+		return err
+	}
+	if removed {
+		ret.Removed++
+	}
+	if state == replicaStale {
+		ret.Stale = append(ret.Stale, b)
+		return nil
+	}
+	ret.Corrupt = append(ret.Corrupt, b)
+	return s.transMarkCorruptReplica(ctx, tx, b.BlockID, dataNodeID, b.StorageID)
+}
+
+//checkReportedBlock compare a reported replica with the stored block meta.
+//An older generation is stale, a newer generation or a different length of a finalized block is corrupt.
+func (s *Proxy) checkReportedBlock(ctx context.Context, tx kv.Transaction, b model.ReportedBlock) (int, error) {
+	bm := new(pb.BlockMeta)
+	if err := s.transGet(ctx, tx, generateBlockMetaKey(b.BlockID), bm); err != nil {
+		if kv.ErrNotExist.Equal(err) {
+			return replicaUnknown, nil
+		}
+		return replicaUnknown, err
+	}
+	switch {
+	case b.Generation < bm.GetGeneration():
+		return replicaStale, nil
+	case b.Generation > bm.GetGeneration():
+		return replicaCorrupt, nil
+	case bm.GetNumberBytes() > 0 && b.Length != bm.GetNumberBytes():
+		return replicaCorrupt, nil
+	}
+	return replicaValid, nil
+}
+
+//scanDataNodeBlocks return block id to storage id of all replicas recorded on the datanode
+func (s *Proxy) scanDataNodeBlocks(ctx context.Context, tx kv.Transaction, dataNodeID string) (map[int64]string, error) {
+	prefix := generateDataNodeBlockScanKey(dataNodeID)
+	it, err := tx.Iter(prefix, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+	ret := make(map[int64]string)
+	for it.Valid() {
+		key, val := it.Key(), it.Value()
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		}
+		// datanode id may contain '_', only keys of exactly this datanode have an 8 bytes suffix
+		if len(key) == len(prefix)+8 {
+			n := new(pb.BlockStorageNode)
+			if err = proto.Unmarshal(val, n); err != nil {
+				return nil, err
+			}
+			ret[bytesToInt64(key[len(prefix):])] = n.GetStorageId()
+		}
+		if err = it.Next(); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+//transAddBlockReplica add a replica to the block storage and the datanode index, return false if it is already there.
+//A datanode holds one replica of a block, a replica reported on another storage of the datanode moved there
+func (s *Proxy) transAddBlockReplica(ctx context.Context, tx kv.Transaction, id int64, nodeID, storageID string) (bool, error) {
+	bs := new(pb.BlockStorage)
+	if err := s.transGet(ctx, tx, generateBlockStorageKey(id), bs); err != nil && !kv.ErrNotExist.Equal(err) {
+		return false, err
+	}
+	bs.Id = proto.Int64(id)
+	node := &pb.BlockStorageNode{
+		StorageId:  proto.String(storageID),
+		DataNodeId: proto.String(nodeID),
+	}
+	moved := false
+	for i, n := range bs.Nodes {
+		if n.GetDataNodeId() != nodeID {
+			continue
+		}
+		if n.GetStorageId() == storageID {
+			return false, nil
+		}
+		bs.Nodes[i], moved = node, true
+	}
+	if !moved {
+		bs.Nodes = append(bs.Nodes, node)
+	}
+	if err := s.transSet(ctx, tx, generateBlockStorageKey(id), bs); err != nil {
+		return false, err
+	}
+	if err := s.transSet(ctx, tx, generateDataNodeBlockKey(nodeID, id), node); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+//transRemoveBlockReplica remove the replica of the datanode on the storage, on any storage if it is empty,
+//from the block storage and the datanode index
+func (s *Proxy) transRemoveBlockReplica(ctx context.Context, tx kv.Transaction, id int64, nodeID, storageID string) (bool, error) {
+	indexed := new(pb.BlockStorageNode)
+	err := s.transGet(ctx, tx, generateDataNodeBlockKey(nodeID, id), indexed)
+	if err != nil && !kv.ErrNotExist.Equal(err) {
+		return false, err
+	}
+	if err == nil && (len(storageID) == 0 || indexed.GetStorageId() == storageID) {
+		if err = s.transDel(ctx, tx, generateDataNodeBlockKey(nodeID, id)); err != nil {
+			return false, err
+		}
+	}
+	bs := new(pb.BlockStorage)
+	if err := s.transGet(ctx, tx, generateBlockStorageKey(id), bs); err != nil {
+		if kv.ErrNotExist.Equal(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	nodes := make([]*pb.BlockStorageNode, 0, len(bs.Nodes))
+	for _, n := range bs.Nodes {
+		if n.GetDataNodeId() != nodeID || (len(storageID) > 0 && n.GetStorageId() != storageID) {
+			nodes = append(nodes, n)
+		}
+	}
+	if len(nodes) == len(bs.Nodes) {
+		return false, nil
+	}
+	bs.Nodes = nodes
+	return true, s.transSet(ctx, tx, generateBlockStorageKey(id), bs)
+}
+
+//transSetBlockStorage write the replicas of the block, the datanode index follows the replicas added and removed
+func (s *Proxy) transSetBlockStorage(ctx context.Context, tx kv.Transaction, bs *pb.BlockStorage) error {
+	id := bs.GetId()
+	old := new(pb.BlockStorage)
+	if err := s.transGet(ctx, tx, generateBlockStorageKey(id), old); err != nil && !kv.ErrNotExist.Equal(err) {
+		return err
+	}
+	kept := make(map[string]bool, len(bs.Nodes))
+	for _, n := range bs.Nodes {
+		kept[n.GetDataNodeId()] = true
+		if err := s.transSet(ctx, tx, generateDataNodeBlockKey(n.GetDataNodeId(), id), n); err != nil {
+			return err
+		}
+	}
+	for _, n := range old.Nodes {
+		if kept[n.GetDataNodeId()] {
+			continue
+		}
+		if err := s.transDel(ctx, tx, generateDataNodeBlockKey(n.GetDataNodeId(), id)); err != nil {
+			return err
+		}
+	}
+	return s.transSet(ctx, tx, generateBlockStorageKey(id), bs)
+}
+
+//transDelBlockStorage delete the replicas of the block with their datanode index entries
+func (s *Proxy) transDelBlockStorage(ctx context.Context, tx kv.Transaction, id int64) error {
+	bs := new(pb.BlockStorage)
+	if err := s.transGet(ctx, tx, generateBlockStorageKey(id), bs); err != nil {
+		if kv.ErrNotExist.Equal(err) {
+			return nil
+		}
+		return err
+	}
+	for _, n := range bs.Nodes {
+		if err := s.transDel(ctx, tx, generateDataNodeBlockKey(n.GetDataNodeId(), id)); err != nil {
+			return err
+		}
+	}
+	return s.transDel(ctx, tx, generateBlockStorageKey(id))
+}
+
+func (s *Proxy) transMarkCorruptReplica(ctx context.Context, tx kv.Transaction, id int64, nodeID, storageID string) error {
+	bc := new(pb.BlockStorage)
+	if err := s.transGet(ctx, tx, generateBlockCorruptKey(id), bc); err != nil && !kv.ErrNotExist.Equal(err) {
+		return err
+	}
+	bc.Id = proto.Int64(id)
+	for _, n := range bc.Nodes {
+		if n.GetDataNodeId() == nodeID {
+			return nil
+		}
+	}
+	bc.Nodes = append(bc.Nodes, &pb.BlockStorageNode{
+		StorageId:  proto.String(storageID),
+		DataNodeId: proto.String(nodeID),
+	})
+	return s.transSet(ctx, tx, generateBlockCorruptKey(id), bc)
+}
+
+func (s *Proxy) transClearCorruptReplica(ctx context.Context, tx kv.Transaction, id int64, nodeID string) error {
+	bc := new(pb.BlockStorage)
+	if err := s.transGet(ctx, tx, generateBlockCorruptKey(id), bc); err != nil {
+		if kv.ErrNotExist.Equal(err) {
+			return nil
+		}
+		return err
+	}
+	nodes := make([]*pb.BlockStorageNode, 0, len(bc.Nodes))
+	for _, n := range bc.Nodes {
+		if n.GetDataNodeId() != nodeID {
+			nodes = append(nodes, n)
+		}
+	}
+	if len(nodes) == len(bc.Nodes) {
+		return nil
+	}
+	if len(nodes) == 0 {
+		return s.transDel(ctx, tx, generateBlockCorruptKey(id))
+	}
+	bc.Nodes = nodes
+	return s.transSet(ctx, tx, generateBlockCorruptKey(id), bc)
+}
@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/redis-force/less-state-hdfs/pkg/model"
+	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+)
+
+func putTestBlock(t *testing.T, tx *memTxn, id, generation int64, nodes ...*pb.BlockStorageNode) {
+	mustSet(t, tx, generateBlockMetaKey(id), &pb.BlockMeta{Id: proto.Int64(id), Generation: proto.Int64(generation)})
+	s := newTestProxy()
+	if err := s.transSetBlockStorage(context.Background(), tx, &pb.BlockStorage{Id: proto.Int64(id), Nodes: nodes}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testNode(dataNodeID, storageID string) *pb.BlockStorageNode {
+	return &pb.BlockStorageNode{DataNodeId: proto.String(dataNodeID), StorageId: proto.String(storageID)}
+}
+
+func TestFullBlockReportScopedToStorage(t *testing.T) {
+	s := newTestProxy()
+	ctx := context.Background()
+	tx := newMemTxn()
+	putTestBlock(t, tx, 1, 1, testNode("dn1", "s1"))
+	putTestBlock(t, tx, 2, 1, testNode("dn1", "s1"))
+	putTestBlock(t, tx, 3, 1, testNode("dn1", "s2"), testNode("dn2", "s1"))
+
+	report := &model.BlockReport{StorageID: "s1", Full: true, Blocks: []model.ReportedBlock{{BlockID: 1, Generation: 1}}}
+	ret := &model.BlockReportResult{}
+	if err := s.processFullBlockReport(ctx, tx, "dn1", report, ret); err != nil {
+		t.Fatal(err)
+	}
+	if ret.Removed != 1 {
+		t.Fatalf("removed %d replicas, want 1", ret.Removed)
+	}
+	bs := new(pb.BlockStorage)
+	if mustGet(t, tx, generateBlockStorageKey(2), bs); len(bs.Nodes) != 0 {
+		t.Fatalf("replica of block 2 missing from the report kept: %v", bs.Nodes)
+	}
+	if mustGet(t, tx, generateBlockStorageKey(3), bs); len(bs.Nodes) != 2 {
+		t.Fatalf("replica on another storage of the datanode removed: %v", bs.Nodes)
+	}
+	if _, err := tx.Get(generateDataNodeBlockKey("dn1", 2)); err == nil {
+		t.Fatal("datanode index entry of the removed replica kept")
+	}
+	if _, err := tx.Get(generateDataNodeBlockKey("dn1", 3)); err != nil {
+		t.Fatalf("datanode index entry of storage s2 removed: %v", err)
+	}
+}
+
+func TestBlockStorageWritesKeepDataNodeIndex(t *testing.T) {
+	s := newTestProxy()
+	ctx := context.Background()
+	tx := newMemTxn()
+	putTestBlock(t, tx, 1, 1, testNode("dn1", "s1"), testNode("dn2", "s1"))
+	if got := tx.keys("{db}_"); len(got) != 2 {
+		t.Fatalf("index entries %v, want 2", got)
+	}
+	if err := s.transSetBlockStorage(ctx, tx, &pb.BlockStorage{Id: proto.Int64(1), Nodes: []*pb.BlockStorageNode{testNode("dn2", "s1")}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := tx.keys("{db}_"); len(got) != 1 || got[0] != string(generateDataNodeBlockKey("dn2", 1)) {
+		t.Fatalf("index entries %v after dn1 dropped", got)
+	}
+	if err := s.transDelBlockStorage(ctx, tx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := tx.keys("{db}_"); len(got) != 0 {
+		t.Fatalf("index entries %v after the block storage deleted", got)
+	}
+}
+
+func TestIncrementalBlockReportDeletesOnlyTheStorage(t *testing.T) {
+	s := newTestProxy()
+	ctx := context.Background()
+	tx := newMemTxn()
+	putTestBlock(t, tx, 1, 1, testNode("dn1", "s2"))
+	report := &model.BlockReport{StorageID: "s1", Deleted: []model.ReportedBlock{{BlockID: 1}}}
+	ret := &model.BlockReportResult{}
+	if err := s.processIncrementalBlockReport(ctx, tx, "dn1", report, ret); err != nil {
+		t.Fatal(err)
+	}
+	if ret.Removed != 0 {
+		t.Fatalf("removed %d replicas of another storage", ret.Removed)
+	}
+	report.StorageID = "s2"
+	if err := s.processIncrementalBlockReport(ctx, tx, "dn1", report, ret); err != nil {
+		t.Fatal(err)
+	}
+	if ret.Removed != 1 || len(tx.keys("{db}_")) != 0 {
+		t.Fatalf("removed %d, index %v", ret.Removed, tx.keys("{db}_"))
+	}
+}
@@ -1,9 +1,185 @@
 package config
 
-import "go.uber.org/zap"
+import (
+	"time"
+
+	"go.uber.org/zap"
+)
+
+//defaults of the settings applied to their zero values, the flags show them too
+const (
+	DefaultKVStartupTimeout = 10 * time.Second
+	DefaultReadyTimeout     = 3 * time.Second
+	DefaultRequestTimeout   = 30 * time.Second
+	DefaultDrainTimeout     = 30 * time.Second
+	DefaultTxnRetryAttempts = 10
+	DefaultTxnRetryBackoff  = 5 * time.Millisecond
+	DefaultTxnRetryBudget   = 2 * time.Second
+	DefaultSuperUser        = "hdfs"
+	DefaultSuperGroup       = "supergroup"
+	DefaultTracingService   = "hdfs-proxy"
+)
 
 type Config struct {
-	KVPDAddress string `yaml:"pdAddress"`
-	HostPort    string `yaml:"hostPort"`
-	Logger      *zap.Logger
+	KVPDAddresses           []string         `yaml:"pdAddresses" mapstructure:"pdAddresses"`
+	KVSSLCA                 string           `yaml:"kvSSLCA" mapstructure:"kvSSLCA"`
+	KVSSLCert               string           `yaml:"kvSSLCert" mapstructure:"kvSSLCert"`
+	KVSSLKey                string           `yaml:"kvSSLKey" mapstructure:"kvSSLKey"`
+	KVStartupTimeout        time.Duration    `yaml:"kvStartupTimeout" mapstructure:"kvStartupTimeout"`
+	KVKeepAliveTime         time.Duration    `yaml:"kvKeepAliveTime" mapstructure:"kvKeepAliveTime"`
+	KVKeepAliveTimeout      time.Duration    `yaml:"kvKeepAliveTimeout" mapstructure:"kvKeepAliveTimeout"`
+	KVMaxTxnTimeUse         time.Duration    `yaml:"kvMaxTxnTimeUse" mapstructure:"kvMaxTxnTimeUse"`
+	HostPort                string           `yaml:"hostPort" mapstructure:"hostPort"`
+	TLSCert                 string           `yaml:"tlsCert" mapstructure:"tlsCert"`
+	TLSKey                  string           `yaml:"tlsKey" mapstructure:"tlsKey"`
+	TLSClientCA             string           `yaml:"tlsClientCA" mapstructure:"tlsClientCA"`
+	TLSRequireClientCert    bool             `yaml:"tlsRequireClientCert" mapstructure:"tlsRequireClientCert"`
+	ReadyTimeout            time.Duration    `yaml:"readyTimeout" mapstructure:"readyTimeout"`
+	RequestTimeout          time.Duration    `yaml:"requestTimeout" mapstructure:"requestTimeout"`
+	DrainTimeout            time.Duration    `yaml:"drainTimeout" mapstructure:"drainTimeout"`
+	ReplicationScanInterval time.Duration    `yaml:"replicationScanInterval" mapstructure:"replicationScanInterval"`
+	DefaultReplication      int16            `yaml:"defaultReplication" mapstructure:"defaultReplication"`
+	Webhooks                []WebhookConfig  `yaml:"webhooks" mapstructure:"webhooks"`
+	Audit                   AuditConfig      `yaml:"audit" mapstructure:"audit"`
+	Auth                    AuthConfig       `yaml:"auth" mapstructure:"auth"`
+	Permission              PermissionConfig `yaml:"permission" mapstructure:"permission"`
+	RetryCache              RetryCacheConfig `yaml:"retryCache" mapstructure:"retryCache"`
+	// deadlines of routes by handler name, e.g. putINodeFile, 0 for none
+	RouteTimeouts map[string]time.Duration `yaml:"routeTimeouts" mapstructure:"routeTimeouts"`
+	// yaml policy file of the built-in authorizer, reloaded when it changes
+	AuthorizationPolicyFile string          `yaml:"authorizationPolicyFile" mapstructure:"authorizationPolicyFile"`
+	Tracing                 TracingConfig   `yaml:"tracing" mapstructure:"tracing"`
+	AccessLog               AccessLogConfig `yaml:"accessLog" mapstructure:"accessLog"`
+	TxnRetry                TxnRetryConfig  `yaml:"txnRetry" mapstructure:"txnRetry"`
+	RateLimit               RateLimitConfig `yaml:"rateLimit" mapstructure:"rateLimit"`
+	LoadShed                LoadShedConfig  `yaml:"loadShed" mapstructure:"loadShed"`
+	Logger                  *zap.Logger
+}
+
+//AuthConfig authentication of api callers, a proxy without any method only starts if it is explicitly disabled
+type AuthConfig struct {
+	Tokens   []AuthToken   `yaml:"tokens" mapstructure:"tokens"`
+	HMACKeys []AuthHMACKey `yaml:"hmacKeys" mapstructure:"hmacKeys"`
+	// max difference between the signed timestamp and the server clock
+	ClockSkew time.Duration `yaml:"clockSkew" mapstructure:"clockSkew"`
+	// max bytes of a body read to verify its hmac signature
+	MaxSignedBody int64 `yaml:"maxSignedBody" mapstructure:"maxSignedBody"`
+	// identify callers by the common name of their verified tls client certificate
+	ClientCert bool `yaml:"clientCert" mapstructure:"clientCert"`
+	// serve every caller unauthenticated, required to run without any method
+	Disabled bool `yaml:"disabled" mapstructure:"disabled"`
+}
+
+//PermissionConfig hdfs permission enforcement, any caller may read and modify any inode if disabled
+type PermissionConfig struct {
+	Enabled    bool   `yaml:"enabled" mapstructure:"enabled"`
+	SuperUser  string `yaml:"superUser" mapstructure:"superUser"`
+	SuperGroup string `yaml:"superGroup" mapstructure:"superGroup"`
+	// principals trusted to act for the user and groups of the X-HDFS-User and X-HDFS-Groups headers, e.g. namenodes
+	ProxyUsers []string `yaml:"proxyUsers" mapstructure:"proxyUsers"`
+	// groups of the principals acting for themselves
+	Groups map[string][]string `yaml:"groups" mapstructure:"groups"`
+}
+
+//TracingConfig opentracing of api requests and tikv transactions, reporter none disables it,
+//null drops the spans, file appends them to the file and agent sends them to a jaeger agent.
+//A sample rate of 0 or less samples no trace, 1 or more every trace
+type TracingConfig struct {
+	Reporter      string  `yaml:"reporter" mapstructure:"reporter"`
+	ServiceName   string  `yaml:"serviceName" mapstructure:"serviceName"`
+	AgentHostPort string  `yaml:"agentHostPort" mapstructure:"agentHostPort"`
+	File          string  `yaml:"file" mapstructure:"file"`
+	SampleRate    float64 `yaml:"sampleRate" mapstructure:"sampleRate"`
+}
+
+//AccessLogConfig access log of api requests written by the server logger, empty fields log the default fields.
+//Bodies are only captured for failed requests and the sampled ones, truncated to the max body size, 0 disables them
+type AccessLogConfig struct {
+	Enabled        bool     `yaml:"enabled" mapstructure:"enabled"`
+	Fields         []string `yaml:"fields" mapstructure:"fields"`
+	BodySampleRate float64  `yaml:"bodySampleRate" mapstructure:"bodySampleRate"`
+	MaxBodySize    int      `yaml:"maxBodySize" mapstructure:"maxBodySize"`
+}
+
+//TxnRetryConfig retry of transactions failed with a retryable tikv error, e.g. a write conflict.
+//The backoff doubles after every attempt, the budget bounds the total time slept
+type TxnRetryConfig struct {
+	Attempts int           `yaml:"attempts" mapstructure:"attempts"`
+	Backoff  time.Duration `yaml:"backoff" mapstructure:"backoff"`
+	Budget   time.Duration `yaml:"budget" mapstructure:"budget"`
+}
+
+//RetryCacheConfig results of mutating requests by their X-Request-Id, a retry within the expiry gets the
+//recorded result instead of being applied again. Expired results are deleted by a sweeper
+type RetryCacheConfig struct {
+	Enabled       bool          `yaml:"enabled" mapstructure:"enabled"`
+	Expiry        time.Duration `yaml:"expiry" mapstructure:"expiry"`
+	SweepInterval time.Duration `yaml:"sweepInterval" mapstructure:"sweepInterval"`
+}
+
+//RateLimitConfig token buckets of api requests by principal, or by remote address if the request is not authenticated.
+//The file, if any, holds limits overriding the configured ones it sets and is reloaded when it changes
+type RateLimitConfig struct {
+	Enabled    bool   `yaml:"enabled" mapstructure:"enabled"`
+	File       string `yaml:"file" mapstructure:"file"`
+	RateLimits `yaml:",inline" mapstructure:",squash"`
+}
+
+//RateLimits requests per second and burst of the read, write and expensive routes of a caller,
+//a rate of 0 leaves the class unlimited. Max concurrent bounds the requests of all callers served at once, 0 for none
+type RateLimits struct {
+	Read          RateLimit `yaml:"read" mapstructure:"read"`
+	Write         RateLimit `yaml:"write" mapstructure:"write"`
+	Expensive     RateLimit `yaml:"expensive" mapstructure:"expensive"`
+	MaxConcurrent int       `yaml:"maxConcurrent" mapstructure:"maxConcurrent"`
+}
+
+//RateLimit token bucket refilled by rate tokens per second up to burst tokens
+type RateLimit struct {
+	Rate  float64 `yaml:"rate" mapstructure:"rate"`
+	Burst int     `yaml:"burst" mapstructure:"burst"`
+}
+
+//LoadShedConfig adaptive limit of the transactions run at once, adjusted every window by their latency and backoffs.
+//Transactions slower than the tolerance times the baseline latency shrink the limit
+type LoadShedConfig struct {
+	Enabled          bool          `yaml:"enabled" mapstructure:"enabled"`
+	InitialLimit     int           `yaml:"initialLimit" mapstructure:"initialLimit"`
+	MinLimit         int           `yaml:"minLimit" mapstructure:"minLimit"`
+	MaxLimit         int           `yaml:"maxLimit" mapstructure:"maxLimit"`
+	LatencyTolerance float64       `yaml:"latencyTolerance" mapstructure:"latencyTolerance"`
+	Window           time.Duration `yaml:"window" mapstructure:"window"`
+}
+
+//AuthToken static bearer token
+type AuthToken struct {
+	Principal string `yaml:"principal" mapstructure:"principal"`
+	Token     string `yaml:"token" mapstructure:"token"`
+}
+
+//AuthHMACKey shared secret of signed requests
+type AuthHMACKey struct {
+	ID        string `yaml:"id" mapstructure:"id"`
+	Principal string `yaml:"principal" mapstructure:"principal"`
+	Secret    string `yaml:"secret" mapstructure:"secret"`
+}
+
+//AuditConfig audit log sinks, stdout, stderr or rotated files, audit is disabled without sinks
+type AuditConfig struct {
+	Paths        []string `yaml:"paths" mapstructure:"paths"`
+	MaxSize      int      `yaml:"maxSize" mapstructure:"maxSize"`
+	MaxBackups   int      `yaml:"maxBackups" mapstructure:"maxBackups"`
+	MaxAge       int      `yaml:"maxAge" mapstructure:"maxAge"`
+	IncludeReads bool     `yaml:"includeReads" mapstructure:"includeReads"`
+}
+
+//WebhookConfig subscriber of namespace change events, empty path prefixes or events match everything
+type WebhookConfig struct {
+	Name         string        `yaml:"name" mapstructure:"name"`
+	URL          string        `yaml:"url" mapstructure:"url"`
+	PathPrefixes []string      `yaml:"pathPrefixes" mapstructure:"pathPrefixes"`
+	Events       []string      `yaml:"events" mapstructure:"events"`
+	BatchSize    int           `yaml:"batchSize" mapstructure:"batchSize"`
+	Timeout      time.Duration `yaml:"timeout" mapstructure:"timeout"`
+	MaxRetries   int           `yaml:"maxRetries" mapstructure:"maxRetries"`
 }
@@ -35,7 +35,7 @@ func modelBlockToINode(blocks []*model.Block) ([]*pb.BlockMeta, []*pb.BlockStora
 			Id:          proto.Int64(bs.ID),
 			NumberBytes: proto.Int64(bs.NumberBytes),
 		}
-		if i < len(blocks)-2 {
+		if i < len(blocks)-1 {
 			ifb[i].NextBlockId = proto.Int64(blocks[i+1].ID)
 		}
 	}
@@ -85,6 +85,7 @@ func pbBlockMetaToBlock(m *pb.BlockMeta, s *pb.BlockStorage) *model.Block {
 		Replication:  int16(m.GetReplication()),
 		CollectionID: m.GetCollectionId(),
 		BlockPoolID:  m.GetBlockPoolId(),
+		Version:      m.GetVersion(),
 	}
 	bl.Storage = make([]model.BlockStorage, len(s.GetNodes()))
 	for i, node := range s.GetNodes() {
@@ -105,6 +106,7 @@ func pbINodeMetaToINode(m *pb.INodeMeta, n *model.INode) {
 	n.Header = m.GetHeader()
 	n.Type = int16(m.GetType())
 	n.ParentID = m.GetParentId()
+	n.Version = m.GetVersion()
 }
 
 func pbINodeMetaToSimpleINode(m *pb.INodeMeta) *model.INode {
@@ -118,6 +120,7 @@ func pbINodeMetaToSimpleINode(m *pb.INodeMeta) *model.INode {
 		Header:           m.GetHeader(),
 		Type:             int16(m.GetType()),
 		ParentID:         m.GetParentId(),
+		Version:          m.GetVersion(),
 	}
 
 }
@@ -135,6 +138,7 @@ func pbINodeFileToINodeFile(m *pb.INodeMeta, bs []*model.Block) *model.INodeFile
 		ParentID:         m.GetParentId(),
 		ClientName:       m.GetClientName(),
 		ClientMachine:    m.GetClientMachine(),
+		Version:          m.GetVersion(),
 	}
 	return f
 
@@ -148,6 +152,7 @@ func pbBlockToBlock(bm *pb.BlockMeta, s *pb.BlockStorage) *model.Block {
 		Replication:  int16(bm.GetReplication()),
 		CollectionID: bm.GetCollectionId(),
 		BlockPoolID:  bm.GetBlockPoolId(),
+		Version:      bm.GetVersion(),
 		Storage:      make([]model.BlockStorage, len(s.GetNodes())),
 	}
 	for i, node := range s.GetNodes() {
@@ -168,3 +173,26 @@ func int64ToBytes(u int64) []byte {
 	binary.BigEndian.PutUint64(buf, uint64(u))
 	return buf
 }
+
+func pbChangeEventBatchToChangeEventBatch(b *pb.ChangeEventBatch) *model.ChangeEventBatch {
+	ret := &model.ChangeEventBatch{
+		TxID:      b.GetTxid(),
+		Timestamp: b.GetTimestamp(),
+		Events:    make([]model.ChangeEvent, len(b.GetEvents())),
+	}
+	for i, e := range b.GetEvents() {
+		ret.Events[i] = model.ChangeEvent{
+			Type:        e.GetType(),
+			INodeID:     e.GetInodeId(),
+			INodeType:   int16(e.GetInodeType()),
+			ParentID:    e.GetParentId(),
+			Name:        e.GetName(),
+			OldParentID: e.GetOldParentId(),
+			BlockID:     e.GetBlockId(),
+			Size:        e.GetSize(),
+			Path:        e.GetPath(),
+			OldPath:     e.GetOldPath(),
+		}
+	}
+	return ret
+}
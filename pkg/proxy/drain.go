@@ -0,0 +1,210 @@
+package proxy
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/kv"
+	"github.com/redis-force/less-state-hdfs/pkg/proxy/config"
+	"go.uber.org/zap"
+)
+
+// routes without a deadline unless configured, event streams and fsck may run for long
+var defaultRouteTimeouts = map[string]time.Duration{
+	"events": 0,
+	"fsck":   0,
+}
+
+type txnScopeKey struct{}
+
+//txnScope transactions begun while serving a request, those left open are rolled back when it is served
+type txnScope struct {
+	operation string
+	mu        sync.Mutex
+	txns      map[*txn]struct{}
+}
+
+func newTxnScope(operation string) *txnScope {
+	return &txnScope{operation: operation, txns: make(map[*txn]struct{})}
+}
+
+func (s *txnScope) add(t *txn) {
+	s.mu.Lock()
+	s.txns[t] = struct{}{}
+	s.mu.Unlock()
+}
+
+func (s *txnScope) remove(t *txn) {
+	s.mu.Lock()
+	delete(s.txns, t)
+	s.mu.Unlock()
+}
+
+func (s *txnScope) release() {
+	s.mu.Lock()
+	txns := make([]*txn, 0, len(s.txns))
+	for t := range s.txns {
+		txns = append(txns, t)
+	}
+	s.mu.Unlock()
+	for _, t := range txns {
+		t.Rollback()
+	}
+}
+
+//inflightTxns the transactions not committed or rolled back yet
+type inflightTxns struct {
+	mu   sync.Mutex
+	txns map[*txn]struct{}
+}
+
+func newInflightTxns() *inflightTxns {
+	return &inflightTxns{txns: make(map[*txn]struct{})}
+}
+
+func (r *inflightTxns) add(t *txn) {
+	r.mu.Lock()
+	r.txns[t] = struct{}{}
+	r.mu.Unlock()
+	txnInflightGauge.Inc()
+}
+
+func (r *inflightTxns) remove(t *txn) {
+	r.mu.Lock()
+	_, ok := r.txns[t]
+	delete(r.txns, t)
+	r.mu.Unlock()
+	if ok {
+		txnInflightGauge.Dec()
+	}
+}
+
+func (r *inflightTxns) list() []*txn {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	txns := make([]*txn, 0, len(r.txns))
+	for t := range r.txns {
+		txns = append(txns, t)
+	}
+	return txns
+}
+
+//routeTimeout the configured deadline of the route, then the built-in one, then the default, 0 for none
+func (p *Proxy) routeTimeout(operation string) time.Duration {
+	for name, d := range p.config.RouteTimeouts {
+		// viper folds the keys of the config file to lower case
+		if strings.EqualFold(name, operation) {
+			return d
+		}
+	}
+	if d, ok := defaultRouteTimeouts[operation]; ok {
+		return d
+	}
+	if p.config.RequestTimeout > 0 {
+		return p.config.RequestTimeout
+	}
+	return config.DefaultRequestTimeout
+}
+
+//deadlineMiddleware bound the request by the deadline of its route, the transactions it leaves open are rolled back
+func (p *Proxy) deadlineMiddleware(c *gin.Context) {
+	operation := auditOperation(c)
+	ctx := c.Request.Context()
+	if d := p.routeTimeout(operation); d > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+	scope := newTxnScope(operation)
+	c.Request = c.Request.WithContext(context.WithValue(ctx, txnScopeKey{}, scope))
+	c.Next()
+	scope.release()
+}
+
+//drain wait for the requests being served within the drain timeout,
+//then cancel the requests left and log their open transactions
+func (p *Proxy) drain() {
+	timeout := p.config.DrainTimeout
+	if timeout <= 0 {
+		timeout = config.DefaultDrainTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := p.apiServer.Shutdown(ctx); err == nil {
+		return
+	}
+	now := time.Now()
+	for _, t := range p.inflight.list() {
+		p.logger.Warn("abandon transaction after drain timeout", zap.String("op", t.operation),
+			zap.Uint64("start_ts", t.StartTS()), zap.Duration("age", now.Sub(t.start)))
+	}
+	// the handlers see the cancelled context at their next kv operation and roll back
+	p.cancelRequests()
+	p.apiServer.Close()
+}
+
+//checkContext roll the transaction back if its request is done, e.g. past the deadline of the route
+func (t *txn) checkContext() error {
+	if err := t.ctx.Err(); err != nil {
+		t.Rollback()
+		if err == context.DeadlineExceeded {
+			txnTimeoutCounter.Inc()
+		}
+		return errors.Annotatef(err, "transaction %d of %s", t.StartTS(), t.operation)
+	}
+	return nil
+}
+
+//isContextError the request was cancelled or ran past its deadline
+func isContextError(err error) bool {
+	cause := errors.Cause(err)
+	return cause == context.DeadlineExceeded || cause == context.Canceled
+}
+
+func (t *txn) Get(k kv.Key) ([]byte, error) {
+	if err := t.checkContext(); err != nil {
+		return nil, err
+	}
+	return t.Transaction.Get(k)
+}
+
+func (t *txn) Set(k kv.Key, v []byte) error {
+	if err := t.checkContext(); err != nil {
+		return err
+	}
+	return t.Transaction.Set(k, v)
+}
+
+func (t *txn) Delete(k kv.Key) error {
+	if err := t.checkContext(); err != nil {
+		return err
+	}
+	return t.Transaction.Delete(k)
+}
+
+//Rollback is a no-op once the transaction is committed or rolled back
+func (t *txn) Rollback() error {
+	if !t.finish() {
+		return nil
+	}
+	return t.Transaction.Rollback()
+}
+
+//finish remove the transaction from the in-flight ones, false if it is finished already
+func (t *txn) finish() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.done {
+		return false
+	}
+	t.done = true
+	t.proxy.inflight.remove(t)
+	if t.scope != nil {
+		t.scope.remove(t)
+	}
+	return true
+}
@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/kv"
+	"github.com/redis-force/less-state-hdfs/pkg/proxy/config"
+)
+
+func TestRouteTimeout(t *testing.T) {
+	s := newTestProxy()
+	// viper folds the keys of the config file to lower case
+	s.config.RouteTimeouts = map[string]time.Duration{"putinodefile": time.Second, "fsck": time.Minute}
+	for operation, want := range map[string]time.Duration{
+		"putINodeFile": time.Second,
+		"fsck":         time.Minute,
+		"events":       0,
+		"getINode":     config.DefaultRequestTimeout,
+	} {
+		if got := s.routeTimeout(operation); got != want {
+			t.Errorf("deadline of %s %s, want %s", operation, got, want)
+		}
+	}
+	s.config.RequestTimeout = time.Millisecond
+	if got := s.routeTimeout("getINode"); got != time.Millisecond {
+		t.Errorf("deadline of getINode %s", got)
+	}
+}
+
+func TestRouteTimeoutRollsBack(t *testing.T) {
+	s := newTestProxy()
+	s.config.RequestTimeout = 20 * time.Millisecond
+	timeouts := counterValue(t, txnTimeoutCounter)
+	var setErr error
+	router := gin.New()
+	router.Use(s.deadlineMiddleware)
+	router.PUT("/slow", func(c *gin.Context) {
+		ctx := c.Request.Context()
+		touched, err := s.begin(ctx)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		touched.Set(kv.Key("a"), []byte{1})
+		left, err := s.begin(ctx)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		left.Set(kv.Key("b"), []byte{1})
+		<-ctx.Done()
+		// the next kv operation past the deadline rolls back, the other transaction is left to the scope
+		setErr = touched.Set(kv.Key("c"), []byte{1})
+	})
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPut, "/slow", nil))
+	if errors.Cause(setErr) != context.DeadlineExceeded {
+		t.Fatalf("write past the deadline error %v", setErr)
+	}
+	if got := counterValue(t, txnTimeoutCounter) - timeouts; got != 1 {
+		t.Fatalf("%v transactions timed out", got)
+	}
+	if txns := s.inflight.list(); len(txns) != 0 {
+		t.Fatalf("%d transactions left open", len(txns))
+	}
+	if got := s.store.(*memStore).keys(""); len(got) != 0 {
+		t.Fatalf("keys of rolled back transactions committed %q", got)
+	}
+}
+
+func TestDrainCancelsStuckHandler(t *testing.T) {
+	s := newTestProxy()
+	logger, buf := bufferLogger()
+	s.logger = logger
+	s.requestCtx, s.cancelRequests = context.WithCancel(context.Background())
+	s.config.DrainTimeout = 50 * time.Millisecond
+	started, served := make(chan struct{}), make(chan error, 1)
+	router := gin.New()
+	router.Use(s.deadlineMiddleware)
+	router.PUT("/stuck", func(c *gin.Context) {
+		ctx := c.Request.Context()
+		tx, err := s.begin(ctx)
+		if err != nil {
+			served <- err
+			return
+		}
+		close(started)
+		<-ctx.Done()
+		served <- tx.Set(kv.Key("a"), []byte{1})
+	})
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.apiServer = &http.Server{Handler: router, BaseContext: func(net.Listener) context.Context {
+		return s.requestCtx
+	}}
+	go s.apiServer.Serve(l)
+	go func() {
+		r, _ := http.NewRequest(http.MethodPut, "http://"+l.Addr().String()+"/stuck", nil)
+		if resp, err := http.DefaultClient.Do(r); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	select {
+	case <-started:
+	case err = <-served:
+		t.Fatalf("handler failed before the drain %v", err)
+	}
+	start := time.Now()
+	s.drain()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("drained in %s", elapsed)
+	}
+	if err = <-served; errors.Cause(err) != context.Canceled {
+		t.Fatalf("stuck handler error %v", err)
+	}
+	if txns := s.inflight.list(); len(txns) != 0 {
+		t.Fatalf("%d transactions left open", len(txns))
+	}
+	entries := logEntries(t, buf)
+	if len(entries) != 1 || entries[0]["msg"] != "abandon transaction after drain timeout" || entries[0]["op"] == nil {
+		t.Fatalf("drain logged %v", entries)
+	}
+}
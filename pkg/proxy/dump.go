@@ -0,0 +1,324 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/kv"
+	"github.com/redis-force/less-state-hdfs/pkg/model"
+	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+	"go.uber.org/zap"
+)
+
+const (
+	dumpFormatVersion = 1
+	maxDumpEntrySize  = 64 << 20
+
+	dumpINode        = "inode"
+	dumpDentry       = "dentry"
+	dumpFileBlock    = "file_block"
+	dumpBlockMeta    = "block_meta"
+	dumpBlockStorage = "block_storage"
+)
+
+var (
+	ErrNamespaceNotEmpty = errors.New("Error namespace is not empty.")
+	ErrDumpCorrupted     = errors.New("Error dump file corrupted.")
+
+	dumpChecksumTable = crc32.MakeTable(crc32.Castagnoli)
+	// the datanode index {db} is not exported, import rebuilds it from the block storages. Corrupt replicas {bc}
+	// are not exported either, they belong to the datanodes of the exporting cluster which report them again
+	dumpKeyPrefixes = [][]byte{
+		inodeKeyPrefix,
+		inodeDirectoryChildKeyPrefix,
+		inodeFileBlockKeyPrefix,
+		blockMetaKeyPrefix,
+		blockStorageKeyPrefix,
+	}
+	// an import needs these empty too, it would mix the rebuilt index with stale replica state otherwise
+	importEmptyKeyPrefixes = append(append([][]byte(nil), dumpKeyPrefixes...), dataNodeBlockKeyPrefix, blockCorruptKeyPrefix)
+)
+
+type dumpWriter struct {
+	w        *bufio.Writer
+	checksum uint32
+}
+
+//write append a length delimited entry, header and records are covered by the checksum
+func (d *dumpWriter) write(e *pb.ExportEntry) error {
+	data, err := proto.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if e.Trailer == nil {
+		d.checksum = crc32.Update(d.checksum, dumpChecksumTable, data)
+	}
+	if _, err = d.w.Write(proto.EncodeVarint(uint64(len(data)))); err != nil {
+		return err
+	}
+	_, err = d.w.Write(data)
+	return err
+}
+
+type dumpReader struct {
+	r        *bufio.Reader
+	checksum uint32
+}
+
+func (d *dumpReader) read() (*pb.ExportEntry, error) {
+	size, err := binary.ReadUvarint(d.r)
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if size > maxDumpEntrySize {
+		return nil, ErrDumpCorrupted
+	}
+	data := make([]byte, size)
+	if _, err = io.ReadFull(d.r, data); err != nil {
+		return nil, err
+	}
+	e := new(pb.ExportEntry)
+	if err = proto.Unmarshal(data, e); err != nil {
+		return nil, err
+	}
+	if e.Trailer == nil {
+		d.checksum = crc32.Update(d.checksum, dumpChecksumTable, data)
+	}
+	return e, nil
+}
+
+//Export stream inodes, dentries, file blocks, block metas and storages at one snapshot, the keys derived from them
+//or reported by datanodes are left out
+func (s *Proxy) Export(ctx context.Context, w io.Writer) (*model.DumpStats, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.Export")
+	defer span.Finish()
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	stats := &model.DumpStats{
+		Timestamp: tx.StartTS(),
+		Counts:    make(map[string]int64),
+	}
+	dw := &dumpWriter{w: bufio.NewWriter(w)}
+	header := &pb.ExportHeader{
+		Version:   proto.Uint32(dumpFormatVersion),
+		Timestamp: proto.Uint64(stats.Timestamp),
+	}
+	if err = dw.write(&pb.ExportEntry{Header: header}); err != nil {
+		return nil, err
+	}
+	for _, prefix := range dumpKeyPrefixes {
+		err = s.scanPrefix(ctx, tx, prefix, func(key, val []byte) error {
+			r, family, err := newExportRecord(key, val)
+			if err != nil {
+				return err
+			}
+			stats.Records++
+			stats.Counts[family]++
+			return dw.write(&pb.ExportEntry{Record: r})
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	stats.Checksum = dw.checksum
+	trailer := &pb.ExportTrailer{
+		Records:  proto.Int64(stats.Records),
+		Checksum: proto.Uint32(stats.Checksum),
+	}
+	if err = dw.write(&pb.ExportEntry{Trailer: trailer}); err != nil {
+		return nil, err
+	}
+	if err = dw.w.Flush(); err != nil {
+		return nil, err
+	}
+	s.logger.Info("namespace exported", zap.Uint64("ts", stats.Timestamp), zap.Int64("records", stats.Records))
+	return stats, nil
+}
+
+func newExportRecord(key, val []byte) (*pb.ExportRecord, string, error) {
+	r := &pb.ExportRecord{Key: append([]byte(nil), key...)}
+	var m proto.Message
+	var family string
+	switch {
+	case bytes.HasPrefix(key, inodeKeyPrefix):
+		r.Inode = new(pb.INodeMeta)
+		m, family = r.Inode, dumpINode
+	case bytes.HasPrefix(key, inodeDirectoryChildKeyPrefix):
+		r.Dentry = new(pb.INodeID)
+		m, family = r.Dentry, dumpDentry
+	case bytes.HasPrefix(key, inodeFileBlockKeyPrefix):
+		r.FileBlock = new(pb.INodeFileBlock)
+		m, family = r.FileBlock, dumpFileBlock
+	case bytes.HasPrefix(key, blockMetaKeyPrefix):
+		r.BlockMeta = new(pb.BlockMeta)
+		m, family = r.BlockMeta, dumpBlockMeta
+	case bytes.HasPrefix(key, blockStorageKeyPrefix):
+		r.BlockStorage = new(pb.BlockStorage)
+		m, family = r.BlockStorage, dumpBlockStorage
+	default:
+		return nil, "", fmt.Errorf("unknown key family %q", key)
+	}
+	if err := proto.Unmarshal(val, m); err != nil {
+		return nil, "", fmt.Errorf("unmarshal %q error %s", key, err)
+	}
+	return r, family, nil
+}
+
+//exportRecordValue return the value of the record and check it matches the key family
+func exportRecordValue(r *pb.ExportRecord) (proto.Message, string, error) {
+	key := r.GetKey()
+	switch {
+	case r.Inode != nil && bytes.HasPrefix(key, inodeKeyPrefix):
+		return r.Inode, dumpINode, nil
+	case r.Dentry != nil && bytes.HasPrefix(key, inodeDirectoryChildKeyPrefix):
+		return r.Dentry, dumpDentry, nil
+	case r.FileBlock != nil && bytes.HasPrefix(key, inodeFileBlockKeyPrefix):
+		return r.FileBlock, dumpFileBlock, nil
+	case r.BlockMeta != nil && bytes.HasPrefix(key, blockMetaKeyPrefix):
+		return r.BlockMeta, dumpBlockMeta, nil
+	case r.BlockStorage != nil && bytes.HasPrefix(key, blockStorageKeyPrefix):
+		return r.BlockStorage, dumpBlockStorage, nil
+	}
+	return nil, "", fmt.Errorf("record value does not match key %q", key)
+}
+
+//Import load an export file into an empty store in batched transactions.
+//The whole file is verified against its checksum before anything is written.
+func (s *Proxy) Import(ctx context.Context, r io.ReadSeeker, batchSize int) (*model.DumpStats, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.Import")
+	defer span.Finish()
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("batch size should not less than 1")
+	}
+	if err := s.checkEmptyNamespace(ctx); err != nil {
+		return nil, err
+	}
+	stats, err := s.readDump(r, nil)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	var tx kv.Transaction
+	pending := 0
+	commit := func() error {
+		if tx == nil {
+			return nil
+		}
+		err := tx.Commit(ctx)
+		tx, pending = nil, 0
+		return err
+	}
+	_, err = s.readDump(r, func(rec *pb.ExportRecord, m proto.Message) error {
+		if tx == nil {
+			var err error
+			if tx, err = s.begin(ctx); err != nil {
+				return err
+			}
+		}
+		if err := s.transSet(ctx, tx, rec.GetKey(), m); err != nil {
+			return err
+		}
+		// 重建datanode副本索引
+		for _, n := range rec.GetBlockStorage().GetNodes() {
+			if err := s.transSet(ctx, tx, generateDataNodeBlockKey(n.GetDataNodeId(), rec.GetBlockStorage().GetId()), n); err != nil {
+				return err
+			}
+		}
+		pending++
+		if pending >= batchSize {
+			return commit()
+		}
+		return nil
+	})
+	if err == nil {
+		err = commit()
+	}
+	if err != nil {
+		if tx != nil {
+			tx.Rollback()
+		}
+		s.logger.Error("namespace import error, store is partially imported", zap.Error(err))
+		return nil, err
+	}
+	s.logger.Info("namespace imported", zap.Uint64("ts", stats.Timestamp), zap.Int64("records", stats.Records))
+	return stats, nil
+}
+
+//readDump read and verify a whole export file, calling fn with every record if not nil
+func (s *Proxy) readDump(r io.Reader, fn func(*pb.ExportRecord, proto.Message) error) (*model.DumpStats, error) {
+	dr := &dumpReader{r: bufio.NewReader(r)}
+	e, err := dr.read()
+	if err != nil {
+		return nil, err
+	}
+	if e.Header == nil || e.Header.GetVersion() != dumpFormatVersion {
+		return nil, fmt.Errorf("unsupported dump header %v", e.Header)
+	}
+	stats := &model.DumpStats{
+		Timestamp: e.Header.GetTimestamp(),
+		Counts:    make(map[string]int64),
+	}
+	for {
+		if e, err = dr.read(); err != nil {
+			return nil, err
+		}
+		if e.Trailer != nil {
+			break
+		}
+		if e.Record == nil {
+			return nil, ErrDumpCorrupted
+		}
+		m, family, err := exportRecordValue(e.Record)
+		if err != nil {
+			return nil, err
+		}
+		stats.Records++
+		stats.Counts[family]++
+		if fn != nil {
+			if err = fn(e.Record, m); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if e.Trailer.GetRecords() != stats.Records || e.Trailer.GetChecksum() != dr.checksum {
+		return nil, ErrDumpCorrupted
+	}
+	stats.Checksum = dr.checksum
+	return stats, nil
+}
+
+func (s *Proxy) checkEmptyNamespace(ctx context.Context) error {
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, prefix := range importEmptyKeyPrefixes {
+		it, err := tx.Iter(prefix, nil)
+		if err != nil {
+			return err
+		}
+		found := it.Valid() && bytes.HasPrefix(it.Key(), prefix)
+		it.Close()
+		if found {
+			return ErrNamespaceNotEmpty
+		}
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pingcap/tidb/kv"
+	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+)
+
+func TestImportRebuildsDataNodeIndex(t *testing.T) {
+	s := newTestProxy()
+	ctx := context.Background()
+	node := &pb.BlockStorageNode{DataNodeId: proto.String("dn1"), StorageId: proto.String("s1")}
+	mustRunTxn(t, s, func(tx kv.Transaction) error {
+		mustSet(t, tx, generateINodeKey(1), testINode(1, 0, "", inodeDirectoryType))
+		mustSet(t, tx, generateBlockMetaKey(7), &pb.BlockMeta{Id: proto.Int64(7), CollectionId: proto.Int64(1)})
+		if err := s.transSetBlockStorage(ctx, tx, &pb.BlockStorage{Id: proto.Int64(7), Nodes: []*pb.BlockStorageNode{node}}); err != nil {
+			return err
+		}
+		mustSet(t, tx, generateBlockCorruptKey(7), &pb.BlockStorage{Id: proto.Int64(7), Nodes: []*pb.BlockStorageNode{node}})
+		return nil
+	})
+	var buf bytes.Buffer
+	stats, err := s.Export(ctx, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Records != 3 {
+		t.Fatalf("exported %d records %v", stats.Records, stats.Counts)
+	}
+	if _, err = s.Import(ctx, bytes.NewReader(buf.Bytes()), 10); err != ErrNamespaceNotEmpty {
+		t.Fatalf("import into a used store error %v", err)
+	}
+	restored := newTestProxy()
+	if _, err = restored.Import(ctx, bytes.NewReader(buf.Bytes()), 10); err != nil {
+		t.Fatal(err)
+	}
+	store := restored.store.(*memStore)
+	if got := store.keys(string(dataNodeBlockKeyPrefix)); len(got) != 1 || got[0] != string(generateDataNodeBlockKey("dn1", 7)) {
+		t.Fatalf("datanode index %q", got)
+	}
+	if got := store.keys(string(blockCorruptKeyPrefix)); len(got) != 0 {
+		t.Fatalf("corrupt replicas imported %q", got)
+	}
+}
@@ -0,0 +1,193 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"hash/fnv"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/kv"
+	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+)
+
+const (
+	ifMatchHeader     = "If-Match"
+	ifNoneMatchHeader = "If-None-Match"
+	etagHeader        = "ETag"
+)
+
+// ErrPreconditionFailed the version of the record does not satisfy If-Match or If-None-Match
+var ErrPreconditionFailed = errors.New("Error precondition failed.")
+
+type preconditionKey struct{}
+
+//precondition the If-Match and If-None-Match of a mutating request, checked against the version of the record it targets
+type precondition struct {
+	ifMatch     []string
+	ifNoneMatch []string
+}
+
+//formatETag the strong entity tag of a record version
+func formatETag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+//formatWeakETag the weak entity tag of a response joining the record with state of other keys, e.g. the block
+//storages, that does not change its version. The digest of the response tells them apart, and since the tag is
+//weak it only revalidates reads and never satisfies the If-Match of a write.
+func formatWeakETag(version int64, resp interface{}) (string, error) {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return "", err
+	}
+	h := fnv.New64a()
+	h.Write(data)
+	return `W/"` + strconv.FormatInt(version, 10) + "-" + strconv.FormatUint(h.Sum64(), 16) + `"`, nil
+}
+
+//parseETags split the entity tags of a header, weak tags keep their W/ prefix
+func parseETags(header string) []string {
+	var etags []string
+	for _, etag := range strings.Split(header, ",") {
+		if etag = strings.TrimSpace(etag); len(etag) > 0 {
+			etags = append(etags, etag)
+		}
+	}
+	return etags
+}
+
+//matchETags any of the tags matches the tag of the record, * matches any existing one.
+//The strong comparison of If-Match never matches weak tags, the weak one of If-None-Match ignores W/ on both sides.
+func matchETags(etags []string, etag string, exists, weak bool) bool {
+	if !exists {
+		return false
+	}
+	if weak {
+		etag = strings.TrimPrefix(etag, "W/")
+	} else if strings.HasPrefix(etag, "W/") {
+		return false
+	}
+	for _, e := range etags {
+		if weak {
+			e = strings.TrimPrefix(e, "W/")
+		}
+		if e == "*" || e == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func preconditionFromContext(ctx context.Context) *precondition {
+	p, _ := ctx.Value(preconditionKey{}).(*precondition)
+	return p
+}
+
+//checkPrecondition ErrPreconditionFailed if the version of the record fails the preconditions of the request
+func checkPrecondition(ctx context.Context, version int64, exists bool) error {
+	p := preconditionFromContext(ctx)
+	if p == nil {
+		return nil
+	}
+	etag := formatETag(version)
+	if len(p.ifMatch) > 0 && !matchETags(p.ifMatch, etag, exists, false) {
+		return ErrPreconditionFailed
+	}
+	if len(p.ifNoneMatch) > 0 && matchETags(p.ifNoneMatch, etag, exists, true) {
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+//preconditionMiddleware carry the preconditions of mutating requests to the transactions serving them
+func preconditionMiddleware(c *gin.Context) {
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+		c.Next()
+		return
+	}
+	p := &precondition{
+		ifMatch:     parseETags(c.GetHeader(ifMatchHeader)),
+		ifNoneMatch: parseETags(c.GetHeader(ifNoneMatchHeader)),
+	}
+	if len(p.ifMatch) > 0 || len(p.ifNoneMatch) > 0 {
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), preconditionKey{}, p))
+	}
+	c.Next()
+}
+
+//notModified set the ETag of the record read, and answer 304 if the request already has it
+func notModified(c *gin.Context, version int64) bool {
+	return notModifiedETag(c, formatETag(version))
+}
+
+//notModifiedResponse set the weak ETag of a response joining the record with other state, and answer 304
+//if the request already has it
+func notModifiedResponse(c *gin.Context, version int64, resp interface{}) bool {
+	etag, err := formatWeakETag(version, resp)
+	if err != nil {
+		// served without a tag
+		return false
+	}
+	return notModifiedETag(c, etag)
+}
+
+func notModifiedETag(c *gin.Context, etag string) bool {
+	c.Header(etagHeader, etag)
+	if matchETags(parseETags(c.GetHeader(ifNoneMatchHeader)), etag, true, true) {
+		c.AbortWithStatus(http.StatusNotModified)
+		return true
+	}
+	return false
+}
+
+//transINodeVersion the version of the stored inode, false if it does not exist
+func (s *Proxy) transINodeVersion(ctx context.Context, tx kv.Transaction, id int64) (int64, bool, error) {
+	m := new(pb.INodeMeta)
+	if err := s.transGet(ctx, tx, generateINodeKey(id), m); err != nil {
+		if kv.ErrNotExist.Equal(err) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	return m.GetVersion(), true, nil
+}
+
+//transBlockVersion the version of the stored block meta, false if it does not exist
+func (s *Proxy) transBlockVersion(ctx context.Context, tx kv.Transaction, id int64) (int64, bool, error) {
+	bm := new(pb.BlockMeta)
+	if err := s.transGet(ctx, tx, generateBlockMetaKey(id), bm); err != nil {
+		if kv.ErrNotExist.Equal(err) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	return bm.GetVersion(), true, nil
+}
+
+//transCheckINode check the preconditions of the request against the stored inode, nothing is read without them
+func (s *Proxy) transCheckINode(ctx context.Context, tx kv.Transaction, id int64) error {
+	if preconditionFromContext(ctx) == nil {
+		return nil
+	}
+	version, exists, err := s.transINodeVersion(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	return checkPrecondition(ctx, version, exists)
+}
+
+//transCheckBlock check the preconditions of the request against the stored block meta, nothing is read without them
+func (s *Proxy) transCheckBlock(ctx context.Context, tx kv.Transaction, id int64) error {
+	if preconditionFromContext(ctx) == nil {
+		return nil
+	}
+	version, exists, err := s.transBlockVersion(ctx, tx, id)
+	if err != nil {
+		return err
+	}
+	return checkPrecondition(ctx, version, exists)
+}
@@ -0,0 +1,74 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis-force/less-state-hdfs/pkg/model"
+)
+
+func TestMatchETags(t *testing.T) {
+	for _, tc := range []struct {
+		header string
+		etag   string
+		exists bool
+		strong bool
+		weak   bool
+	}{
+		{header: `"3"`, etag: `"3"`, exists: true, strong: true, weak: true},
+		{header: `"2", "3"`, etag: `"3"`, exists: true, strong: true, weak: true},
+		{header: `W/"3"`, etag: `"3"`, exists: true, weak: true},
+		{header: `W/"3-a"`, etag: `W/"3-a"`, exists: true, weak: true},
+		{header: `*`, etag: `W/"3-a"`, exists: true, weak: true},
+		{header: `"3-a"`, etag: `W/"3-a"`, exists: true, weak: true},
+		{header: `*`, etag: `"3"`, exists: true, strong: true, weak: true},
+		{header: `*`, etag: `"0"`},
+		{header: `"4"`, etag: `"3"`, exists: true},
+	} {
+		etags := parseETags(tc.header)
+		if got := matchETags(etags, tc.etag, tc.exists, false); got != tc.strong {
+			t.Errorf("strong match of %s against %s = %v", tc.header, tc.etag, got)
+		}
+		if got := matchETags(etags, tc.etag, tc.exists, true); got != tc.weak {
+			t.Errorf("weak match of %s against %s = %v", tc.header, tc.etag, got)
+		}
+	}
+}
+
+func TestCheckPreconditionRejectsWeakIfMatch(t *testing.T) {
+	for header, ok := range map[string]bool{`"3"`: true, `W/"3"`: false} {
+		ctx := context.WithValue(context.Background(), preconditionKey{}, &precondition{ifMatch: parseETags(header)})
+		if err := checkPrecondition(ctx, 3, true); (err == nil) != ok {
+			t.Errorf("If-Match %s error %v", header, err)
+		}
+	}
+}
+
+func TestNotModifiedResponseFollowsStorages(t *testing.T) {
+	block := &model.Block{ID: 7, Version: 2, Storage: []model.BlockStorage{{DataNodeID: "dn1", StorageID: "s1"}}}
+	etag, err := formatWeakETag(block.Version, block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serve := func(b *model.Block) int {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+		c.Request.Header.Set(ifNoneMatchHeader, etag)
+		if notModifiedResponse(c, b.Version, b) {
+			return w.Code
+		}
+		return http.StatusOK
+	}
+	if code := serve(block); code != http.StatusNotModified {
+		t.Fatalf("unchanged block answered %d", code)
+	}
+	// a new replica leaves the version of the block meta alone
+	block.Storage = append(block.Storage, model.BlockStorage{DataNodeID: "dn2", StorageID: "s2"})
+	if code := serve(block); code != http.StatusOK {
+		t.Fatalf("block with a new storage answered %d", code)
+	}
+}
@@ -0,0 +1,335 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"github.com/redis-force/less-state-hdfs/pkg/model"
+	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+	"go.uber.org/zap"
+)
+
+// change event types, close to hdfs inotify events
+const (
+	eventCreate      = "create"
+	eventMkdir       = "mkdir"
+	eventRename      = "rename"
+	eventDelete      = "delete"
+	eventAddBlock    = "add_block"
+	eventAppend      = "append"
+	eventRemoveBlock = "remove_block"
+	eventTruncate    = "truncate"
+	eventMetadata    = "metadata"
+)
+
+const (
+	// a transaction with events which has not started its commit by then is run again with a new txid
+	changeEventCommitWindow = 3 * time.Second
+	// readers wait this long behind the latest txid, longer than the commit window to allow for clock drift
+	changeEventSettle = 5 * time.Second
+	// batches older than it are deleted, a webhook further behind loses them
+	changeEventRetention  = 7 * 24 * time.Hour
+	changeEventSweep      = time.Minute
+	changeEventSweepBatch = 1024
+)
+
+var changeEventTypes = map[string]bool{
+	eventCreate:      true,
+	eventMkdir:       true,
+	eventRename:      true,
+	eventDelete:      true,
+	eventAddBlock:    true,
+	eventAppend:      true,
+	eventRemoveBlock: true,
+	eventTruncate:    true,
+	eventMetadata:    true,
+}
+
+//transAppendEvents append the events as a batch keyed by the start ts of the transaction, which is its txid,
+//and the next sequence of the transaction. No key is shared by two transactions, so mutations never conflict
+//on their events. Batches are ordered by the start of their transaction, readers only see the settled ones.
+//Events keep inode ids only, readers resolve their paths.
+func (s *Proxy) transAppendEvents(ctx context.Context, tx kv.Transaction, events ...*pb.ChangeEvent) error {
+	txid := int64(tx.StartTS())
+	// only batches of this transaction have its txid
+	var seq int64
+	if err := s.scanPrefix(ctx, tx, generateChangeEventScanKey(txid), func(key, val []byte) error {
+		seq++
+		return nil
+	}); err != nil {
+		return err
+	}
+	batch := &pb.ChangeEventBatch{
+		Txid:      proto.Int64(txid),
+		Timestamp: proto.Uint64(tx.StartTS()),
+		Events:    events,
+	}
+	if err := s.transSet(ctx, tx, generateChangeEventKey(txid, seq), batch); err != nil {
+		return err
+	}
+	if t, ok := tx.(*txn); ok {
+		t.events = append(t.events, batch)
+	}
+	return nil
+}
+
+//changeEventHorizon the txid below which every batch is committed or never will be. A transaction with events
+//starts its commit within changeEventCommitWindow, readers resolve the locks of a commit in progress
+func changeEventHorizon(ts uint64) int64 {
+	settle := oracle.EncodeTSO(int64(changeEventSettle / time.Millisecond))
+	if ts <= settle {
+		return 0
+	}
+	return int64(ts - settle)
+}
+
+//eventPathResolver resolve the paths of events in the transaction of a reader, the directories of a read are
+//resolved once. Paths are those of the namespace when the batch is read, empty if no longer reachable from the root
+type eventPathResolver struct {
+	proxy *Proxy
+	tx    kv.Transaction
+	// path of resolved directories, empty if unreachable
+	dirs map[int64]string
+}
+
+func newEventPathResolver(s *Proxy, tx kv.Transaction) *eventPathResolver {
+	return &eventPathResolver{proxy: s, tx: tx, dirs: map[int64]string{}}
+}
+
+//resolve set the paths of the event, batches appended when writers resolved them keep theirs
+func (r *eventPathResolver) resolve(ctx context.Context, e *pb.ChangeEvent) error {
+	var err error
+	if e.Path == nil {
+		var p string
+		if e.ParentId != nil {
+			p, err = r.childPath(ctx, e.GetParentId(), e.GetName())
+		} else {
+			p, err = r.inodePath(ctx, e.GetInodeId())
+		}
+		if err != nil {
+			return err
+		}
+		e.Path = proto.String(p)
+	}
+	if e.OldParentId != nil && e.OldPath == nil {
+		p, err := r.childPath(ctx, e.GetOldParentId(), e.GetName())
+		if err != nil {
+			return err
+		}
+		e.OldPath = proto.String(p)
+	}
+	return nil
+}
+
+//childPath the path of name under the parent
+func (r *eventPathResolver) childPath(ctx context.Context, parentID int64, name string) (string, error) {
+	dir, err := r.inodePath(ctx, parentID)
+	if err != nil || len(dir) == 0 {
+		return "", err
+	}
+	return path.Join(dir, name), nil
+}
+
+//inodePath walk up to the root or a resolved directory, the walked directories are resolved too
+func (r *eventPathResolver) inodePath(ctx context.Context, id int64) (string, error) {
+	type step struct {
+		id   int64
+		name string
+	}
+	var steps []step
+	base, known := "", false
+	for id != 0 {
+		if base, known = r.dirs[id]; known {
+			break
+		}
+		m := new(pb.INodeMeta)
+		if err := r.proxy.transGet(ctx, r.tx, generateINodeKey(id), m); err != nil {
+			if !kv.ErrNotExist.Equal(err) {
+				return "", err
+			}
+			base, known = "", true
+			break
+		}
+		if m.GetParentId() == 0 {
+			base, known = "/", true
+			r.dirs[id] = base
+			break
+		}
+		steps = append(steps, step{id, m.GetName()})
+		id = m.GetParentId()
+		if len(steps) > maxINodePathDepth {
+			return "", fmt.Errorf("inode %d path is too deep", id)
+		}
+	}
+	for i := len(steps) - 1; i >= 0; i-- {
+		if len(base) > 0 {
+			base = path.Join(base, steps[i].name)
+		}
+		r.dirs[steps[i].id] = base
+	}
+	return base, nil
+}
+
+func newINodeEvent(typ string, m *pb.INodeMeta) *pb.ChangeEvent {
+	return &pb.ChangeEvent{
+		Type:      proto.String(typ),
+		InodeId:   proto.Int64(m.GetId()),
+		InodeType: proto.Int32(m.GetType()),
+		ParentId:  proto.Int64(m.GetParentId()),
+		Name:      proto.String(m.GetName()),
+	}
+}
+
+func newCreateEvent(m *pb.INodeMeta) *pb.ChangeEvent {
+	if m.GetType() == inodeDirectoryType {
+		return newINodeEvent(eventMkdir, m)
+	}
+	return newINodeEvent(eventCreate, m)
+}
+
+//transINodeEvent build an event from the stored inode, only the id is set if the inode does not exist
+func (s *Proxy) transINodeEvent(ctx context.Context, tx kv.Transaction, typ string, id int64) (*pb.ChangeEvent, error) {
+	m := new(pb.INodeMeta)
+	if err := s.transGet(ctx, tx, generateINodeKey(id), m); err != nil {
+		if !kv.ErrNotExist.Equal(err) {
+			return nil, err
+		}
+		return &pb.ChangeEvent{Type: proto.String(typ), InodeId: proto.Int64(id)}, nil
+	}
+	return newINodeEvent(typ, m), nil
+}
+
+func newBlockEvent(typ string, id, blockID, size int64) *pb.ChangeEvent {
+	return &pb.ChangeEvent{
+		Type:      proto.String(typ),
+		InodeId:   proto.Int64(id),
+		InodeType: proto.Int32(inodeFileType),
+		BlockId:   proto.Int64(blockID),
+		Size:      proto.Int64(size),
+	}
+}
+
+//LastChangeEventTxID return the cursor after which batches are not settled yet
+func (s *Proxy) LastChangeEventTxID(ctx context.Context) (int64, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.LastChangeEventTxID")
+	defer span.Finish()
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	return changeEventHorizon(tx.StartTS()) - 1, nil
+}
+
+//GetChangeEvents return the settled event batches whose txid is greater than since, at most limit of them
+//unless the last txid has more batches, a txid is never split so it works as a cursor
+func (s *Proxy) GetChangeEvents(ctx context.Context, since int64, limit int) ([]*model.ChangeEventBatch, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.GetChangeEvents")
+	defer span.Finish()
+	var ret []*model.ChangeEventBatch
+	err := s.runTxn(ctx, func(tx kv.Transaction) error {
+		ret = make([]*model.ChangeEventBatch, 0)
+		paths := newEventPathResolver(s, tx)
+		horizon := changeEventHorizon(tx.StartTS())
+		if since+1 >= horizon {
+			return nil
+		}
+		it, err := tx.Iter(generateChangeEventScanKey(since+1), generateChangeEventScanKey(horizon))
+		if err != nil {
+			return err
+		}
+		defer it.Close()
+		for ; it.Valid(); err = it.Next() {
+			if err != nil {
+				return err
+			}
+			txid, ok := parseChangeEventKey(it.Key())
+			if !ok {
+				if !it.Key().HasPrefix(changeEventKeyPrefix) {
+					break
+				}
+				continue
+			}
+			if len(ret) >= limit && txid != ret[len(ret)-1].TxID {
+				break
+			}
+			b := new(pb.ChangeEventBatch)
+			if err = proto.Unmarshal(it.Value(), b); err != nil {
+				return err
+			}
+			for _, e := range b.Events {
+				if err = paths.resolve(ctx, e); err != nil {
+					return err
+				}
+			}
+			batch := pbChangeEventBatchToChangeEventBatch(b)
+			batch.TxID = txid
+			ret = append(ret, batch)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func (s *Proxy) runChangeEventSweeper() {
+	ticker := time.NewTicker(changeEventSweep)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.exitChan:
+			return
+		case <-ticker.C:
+			deleted, err := s.sweepChangeEvents(withTxnPriority(context.Background(), priorityLow), time.Now().Add(-changeEventRetention))
+			if err != nil {
+				s.logger.Error("change event sweep error", zap.Error(err))
+				continue
+			}
+			s.logger.Debug("change events swept", zap.Int("deleted", deleted))
+		}
+	}
+}
+
+//sweepChangeEvents delete the batches of transactions started before the time, batch by batch
+func (s *Proxy) sweepChangeEvents(ctx context.Context, before time.Time) (int, error) {
+	upper := generateChangeEventScanKey(int64(oracle.ComposeTS(oracle.GetPhysical(before), 0)))
+	total := 0
+	for {
+		deleted := 0
+		err := s.runTxn(ctx, func(tx kv.Transaction) error {
+			deleted = 0
+			var expired [][]byte
+			it, err := tx.Iter(changeEventKeyPrefix, upper)
+			if err != nil {
+				return err
+			}
+			for it.Valid() && len(expired) < changeEventSweepBatch {
+				expired = append(expired, append([]byte(nil), it.Key()...))
+				if err = it.Next(); err != nil {
+					it.Close()
+					return err
+				}
+			}
+			it.Close()
+			for _, key := range expired {
+				if err = s.transDel(ctx, tx, key); err != nil {
+					return err
+				}
+			}
+			deleted = len(expired)
+			return nil
+		})
+		total += deleted
+		if err != nil || deleted < changeEventSweepBatch {
+			return total, err
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pingcap/tidb/kv"
+	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+)
+
+func TestChangeEventsSettle(t *testing.T) {
+	s := newTestProxy()
+	ctx := context.Background()
+	var txid int64
+	mustRunTxn(t, s, func(tx kv.Transaction) error {
+		txid = int64(tx.StartTS())
+		mustSet(t, tx, generateINodeKey(1), testINode(1, 0, "", inodeDirectoryType))
+		if err := s.transAppendEvents(ctx, tx, newBlockEvent(eventAddBlock, 1, 7, 0)); err != nil {
+			return err
+		}
+		return s.transAppendEvents(ctx, tx, newBlockEvent(eventAddBlock, 1, 8, 0))
+	})
+	batches, err := s.GetChangeEvents(ctx, 0, 1)
+	if err != nil || len(batches) != 0 {
+		t.Fatalf("unsettled batches %v error %v", batches, err)
+	}
+	s.store.(*memStore).skew = changeEventSettle + time.Second
+	if batches, err = s.GetChangeEvents(ctx, 0, 1); err != nil {
+		t.Fatal(err)
+	}
+	// both batches of the transaction, the limit never splits a txid
+	if len(batches) != 2 || batches[0].TxID != txid || batches[1].TxID != txid || batches[1].Events[0].BlockID != 8 {
+		t.Fatalf("batches %+v", batches)
+	}
+	if batches, err = s.GetChangeEvents(ctx, txid, 1); err != nil || len(batches) != 0 {
+		t.Fatalf("batches after the cursor %v error %v", batches, err)
+	}
+	since, err := s.LastChangeEventTxID(ctx)
+	if err != nil || since < txid {
+		t.Fatalf("last txid %d of batch %d error %v", since, txid, err)
+	}
+}
+
+func TestChangeEventCommitWindow(t *testing.T) {
+	s := newTestProxy()
+	ctx := context.Background()
+	tx, err := s.begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = s.transAppendEvents(ctx, tx, newBlockEvent(eventAddBlock, 1, 7, 0)); err != nil {
+		t.Fatal(err)
+	}
+	tx.(*txn).start = time.Now().Add(-changeEventCommitWindow - time.Second)
+	err = tx.Commit(ctx)
+	if reason := retryReason(err); reason != retryEventWindow {
+		t.Fatalf("late commit error %v reason %q", err, reason)
+	}
+	if got := s.store.(*memStore).keys(string(changeEventKeyPrefix)); len(got) != 0 {
+		t.Fatalf("late batch committed %q", got)
+	}
+}
+
+func TestSweepChangeEvents(t *testing.T) {
+	s := newTestProxy()
+	ctx := context.Background()
+	store := s.store.(*memStore)
+	store.skew = -2 * time.Hour
+	mustRunTxn(t, s, func(tx kv.Transaction) error {
+		for seq := int64(0); seq <= changeEventSweepBatch; seq++ {
+			tx.Set(generateChangeEventKey(int64(tx.StartTS()), seq), []byte{0})
+		}
+		return nil
+	})
+	store.skew = 0
+	mustRunTxn(t, s, func(tx kv.Transaction) error {
+		return s.transAppendEvents(ctx, tx, newBlockEvent(eventAddBlock, 1, 7, 0))
+	})
+	deleted, err := s.sweepChangeEvents(ctx, time.Now().Add(-time.Hour))
+	if err != nil || deleted != changeEventSweepBatch+1 {
+		t.Fatalf("swept %d batches error %v", deleted, err)
+	}
+	if got := store.keys(string(changeEventKeyPrefix)); len(got) != 1 {
+		t.Fatalf("batches left %d", len(got))
+	}
+}
+
+func TestChangeEventPaths(t *testing.T) {
+	s := newTestProxy()
+	ctx := context.Background()
+	mustRunTxn(t, s, func(tx kv.Transaction) error {
+		mustSet(t, tx, generateINodeKey(1), testINode(1, 0, "", inodeDirectoryType))
+		mustSet(t, tx, generateINodeKey(2), testINode(2, 1, "a", inodeDirectoryType))
+		mustSet(t, tx, generateINodeKey(3), testINode(3, 2, "f", inodeFileType))
+		return nil
+	})
+	tx, _ := s.store.Begin()
+	r := newEventPathResolver(s, tx)
+	rename := newINodeEvent(eventRename, testINode(3, 2, "f", inodeFileType))
+	rename.OldParentId = proto.Int64(1)
+	events := []*pb.ChangeEvent{rename, newBlockEvent(eventAddBlock, 3, 7, 0), newBlockEvent(eventAddBlock, 9, 7, 0)}
+	for _, e := range events {
+		if err := r.resolve(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if rename.GetPath() != "/a/f" || rename.GetOldPath() != "/f" || events[1].GetPath() != "/a/f" || events[2].GetPath() != "" {
+		t.Fatalf("paths %q %q %q %q", rename.GetPath(), rename.GetOldPath(), events[1].GetPath(), events[2].GetPath())
+	}
+	if r.dirs[2] != "/a" || r.dirs[1] != "/" {
+		t.Fatalf("resolved directories %v", r.dirs)
+	}
+}
+
+func TestDeleteMissingChildAppendsNoEvent(t *testing.T) {
+	s := newTestProxy()
+	mustRunTxn(t, s, func(tx kv.Transaction) error {
+		mustSet(t, tx, generateINodeKey(1), testINode(1, 0, "", inodeDirectoryType))
+		return nil
+	})
+	if err := s.DeleteINodeDirectoryChild(context.Background(), 1, "missing"); !kv.ErrNotExist.Equal(err) {
+		t.Fatalf("deleting a missing child error %v", err)
+	}
+	if got := s.store.(*memStore).keys(string(changeEventKeyPrefix)); len(got) != 0 {
+		t.Fatalf("events of a missing child %q", got)
+	}
+}
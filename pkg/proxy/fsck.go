@@ -0,0 +1,608 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pingcap/tidb/kv"
+	"github.com/redis-force/less-state-hdfs/pkg/model"
+	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+	"go.uber.org/zap"
+)
+
+const (
+	fsckDanglingDentry     = "dangling_dentry"
+	fsckDuplicateDentry    = "duplicate_dentry"
+	fsckMismatchedDentry   = "mismatched_dentry"
+	fsckOrphanINode        = "orphan_inode"
+	fsckDanglingFileBlock  = "dangling_file_block"
+	fsckOrphanFileBlock    = "orphan_file_block"
+	fsckBrokenBlockChain   = "broken_block_chain"
+	fsckOrphanBlockStorage = "orphan_block_storage"
+)
+
+var fsckIssueTypes = []string{
+	fsckDanglingDentry,
+	fsckDuplicateDentry,
+	fsckMismatchedDentry,
+	fsckOrphanINode,
+	fsckDanglingFileBlock,
+	fsckOrphanFileBlock,
+	fsckBrokenBlockChain,
+	fsckOrphanBlockStorage,
+}
+
+const (
+	// findings repaired by one transaction, the repair of a finding writes a few keys or the block list of a file
+	fsckRepairBatch = 128
+	// detail of an issue the repair found gone or different
+	fsckChanged = "namespace changed since the scan"
+)
+
+type fsckDentry struct {
+	parentID int64
+	name     string
+	id       int64
+}
+
+type fsckFileBlock struct {
+	index int64
+	block *pb.INodeFileBlock
+}
+
+//fsckRepair fix one or more issues in a repair transaction after checking they still exist,
+//return a detail when it can not be fixed or the namespace changed since the scan
+type fsckRepair func(ctx context.Context, tx kv.Transaction) (string, error)
+
+type fsckFinding struct {
+	// indexes of the issues kept in the report
+	issues []int
+	count  int
+	repair fsckRepair
+}
+
+//fsckScan streams the key families of one snapshot, only the page of issues asked for is kept.
+//Findings are repaired in bounded transactions while the scan goes on
+type fsckScan struct {
+	proxy   *Proxy
+	tx      kv.Transaction
+	report  *model.FsckReport
+	repair  bool
+	pending []fsckFinding
+	// inodes referenced by a dentry of another parent or name, they are not orphans
+	mismatched map[int64]bool
+}
+
+//Fsck scan every key family at one snapshot and report namespace inconsistencies, the issues from offset,
+//at most limit of them if it is positive. If repair is set the issues are fixed in transactions of their own,
+//each repair checks its issue still exists first.
+func (s *Proxy) Fsck(ctx context.Context, repair bool, offset, limit int) (*model.FsckReport, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.Fsck")
+	defer span.Finish()
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	scan := &fsckScan{
+		proxy: s,
+		tx:    tx,
+		report: &model.FsckReport{
+			Timestamp: tx.StartTS(),
+			Counts:    make(map[string]int, len(fsckIssueTypes)),
+			Offset:    offset,
+			Limit:     limit,
+			Issues:    make([]model.FsckIssue, 0),
+		},
+		repair:     repair,
+		mismatched: make(map[int64]bool),
+	}
+	for _, t := range fsckIssueTypes {
+		scan.report.Counts[t] = 0
+	}
+	for _, check := range []func(context.Context) error{scan.checkDentries, scan.checkINodes, scan.checkFileBlocks, scan.checkBlocks} {
+		if err = check(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if err = scan.flush(ctx); err != nil {
+		return nil, err
+	}
+	report := scan.report
+	s.logger.Info("fsck scan finished", zap.Uint64("ts", report.Timestamp), zap.Int("issues", report.Total), zap.Int("repaired", report.Repaired))
+	if report.Repaired > 0 {
+		s.logger.Warn("fsck repaired namespace", zap.Int("repaired", report.Repaired), zap.Int("issues", report.Total))
+	}
+	return report, nil
+}
+
+//add count the issues and keep those within the page, their finding is repaired with the next batch
+func (f *fsckScan) add(ctx context.Context, repair fsckRepair, issues ...model.FsckIssue) error {
+	r := f.report
+	finding := fsckFinding{count: len(issues), repair: repair}
+	for _, issue := range issues {
+		r.Counts[issue.Type]++
+		if r.Total >= r.Offset && (r.Limit <= 0 || len(r.Issues) < r.Limit) {
+			r.Issues = append(r.Issues, issue)
+			finding.issues = append(finding.issues, len(r.Issues)-1)
+		}
+		r.Total++
+	}
+	if !f.repair {
+		return nil
+	}
+	f.pending = append(f.pending, finding)
+	if len(f.pending) < fsckRepairBatch {
+		return nil
+	}
+	return f.flush(ctx)
+}
+
+//flush repair the pending findings in one transaction, retried conflicts check the findings again
+func (f *fsckScan) flush(ctx context.Context) error {
+	if len(f.pending) == 0 {
+		return nil
+	}
+	var repaired int
+	details := make([]string, len(f.pending))
+	err := f.proxy.runTxn(ctx, func(tx kv.Transaction) error {
+		repaired = 0
+		for i, finding := range f.pending {
+			detail, err := finding.repair(ctx, tx)
+			if err != nil {
+				return err
+			}
+			details[i] = detail
+			if len(detail) == 0 {
+				repaired += finding.count
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i, finding := range f.pending {
+		for _, j := range finding.issues {
+			if len(details[i]) > 0 {
+				f.report.Issues[j].Detail = details[i]
+			} else {
+				f.report.Issues[j].Repaired = true
+			}
+		}
+	}
+	f.report.Repaired += repaired
+	f.pending = f.pending[:0]
+	return nil
+}
+
+//exists whether the key is in the snapshot of the scan
+func (f *fsckScan) exists(key []byte) (bool, error) {
+	_, err := f.tx.Get(key)
+	if kv.ErrNotExist.Equal(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+//inode the inode at the snapshot of the scan, nil if it does not exist
+func (f *fsckScan) inode(ctx context.Context, id int64) (*pb.INodeMeta, error) {
+	m := new(pb.INodeMeta)
+	if err := f.proxy.transGet(ctx, f.tx, generateINodeKey(id), m); err != nil {
+		if kv.ErrNotExist.Equal(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return m, nil
+}
+
+//checkDentries every dentry needs its inode and parent, and the inode should name it as its parent and name
+func (f *fsckScan) checkDentries(ctx context.Context) error {
+	s := f.proxy
+	return s.scanPrefix(ctx, f.tx, inodeDirectoryChildKeyPrefix, func(key, val []byte) error {
+		parentID, name, ok := parseINodeDirectoryChildKey(key)
+		if !ok {
+			return nil
+		}
+		m := new(pb.INodeID)
+		if err := proto.Unmarshal(val, m); err != nil {
+			return err
+		}
+		f.report.Dentries++
+		d := fsckDentry{parentID: parentID, name: name, id: m.GetId()}
+		child, err := f.inode(ctx, d.id)
+		if err != nil {
+			return err
+		}
+		parentOK := d.parentID == 0
+		if !parentOK {
+			if parentOK, err = f.exists(generateINodeKey(d.parentID)); err != nil {
+				return err
+			}
+		}
+		if child == nil || !parentOK {
+			detail := "inode not found"
+			if child != nil {
+				detail = "parent inode not found"
+			}
+			return f.add(ctx, s.repairDeleteDanglingDentry(d),
+				model.FsckIssue{Type: fsckDanglingDentry, INodeID: d.id, ParentID: d.parentID, Name: d.name, Detail: detail})
+		}
+		if child.GetParentId() == d.parentID && child.GetName() == d.name {
+			return nil
+		}
+		f.mismatched[d.id] = true
+		canonical := new(pb.INodeID)
+		err = s.transGet(ctx, f.tx, generateINodeDirectoryChildKey(child.GetParentId(), child.GetName()), canonical)
+		if err != nil && !kv.ErrNotExist.Equal(err) {
+			return err
+		}
+		if err == nil && canonical.GetId() == d.id {
+			return f.add(ctx, s.repairDeleteDuplicateDentry(d),
+				model.FsckIssue{Type: fsckDuplicateDentry, INodeID: d.id, ParentID: d.parentID, Name: d.name})
+		}
+		return f.add(ctx, s.repairMismatchedDentry(d), model.FsckIssue{
+			Type:     fsckMismatchedDentry,
+			INodeID:  d.id,
+			ParentID: d.parentID,
+			Name:     d.name,
+			Detail:   fmt.Sprintf("inode parent %d name %q", child.GetParentId(), child.GetName()),
+		})
+	})
+}
+
+//checkINodes every inode but the root needs a dentry
+func (f *fsckScan) checkINodes(ctx context.Context) error {
+	s := f.proxy
+	return s.scanPrefix(ctx, f.tx, inodeKeyPrefix, func(key, val []byte) error {
+		id, ok := parseIDKey(inodeKeyPrefix, key)
+		if !ok {
+			return nil
+		}
+		m := new(pb.INodeMeta)
+		if err := proto.Unmarshal(val, m); err != nil {
+			return err
+		}
+		f.report.INodes++
+		// the root, or referenced by a dentry reported already
+		if m.GetParentId() == 0 || f.mismatched[id] {
+			return nil
+		}
+		linked, err := s.transDentryID(ctx, f.tx, m.GetParentId(), m.GetName())
+		if err != nil || linked == id {
+			return err
+		}
+		return f.add(ctx, s.repairOrphanINode(id),
+			model.FsckIssue{Type: fsckOrphanINode, INodeID: id, ParentID: m.GetParentId(), Name: m.GetName()})
+	})
+}
+
+//checkFileBlocks the block list of every file needs its inode and block metas, and a chain of next block ids.
+//The entries of a file are adjacent keys, only one file is held at a time
+func (f *fsckScan) checkFileBlocks(ctx context.Context) error {
+	var file int64
+	var entries []fsckFileBlock
+	err := f.proxy.scanPrefix(ctx, f.tx, inodeFileBlockKeyPrefix, func(key, val []byte) error {
+		id, index, ok := parseINodeFileBlockKey(key)
+		if !ok {
+			return nil
+		}
+		m := new(pb.INodeFileBlock)
+		if err := proto.Unmarshal(val, m); err != nil {
+			return err
+		}
+		f.report.FileBlocks++
+		if len(entries) > 0 && id != file {
+			if err := f.checkFile(ctx, file, entries); err != nil {
+				return err
+			}
+			entries = entries[:0]
+		}
+		file = id
+		entries = append(entries, fsckFileBlock{index: index, block: m})
+		return nil
+	})
+	if err != nil || len(entries) == 0 {
+		return err
+	}
+	return f.checkFile(ctx, file, entries)
+}
+
+func (f *fsckScan) checkFile(ctx context.Context, id int64, entries []fsckFileBlock) error {
+	s := f.proxy
+	entries = append([]fsckFileBlock(nil), entries...)
+	exists, err := f.exists(generateINodeKey(id))
+	if err != nil {
+		return err
+	}
+	if !exists {
+		issues := make([]model.FsckIssue, 0, len(entries))
+		for _, e := range entries {
+			issues = append(issues, model.FsckIssue{Type: fsckOrphanFileBlock, INodeID: id, BlockID: e.block.GetId(), Index: e.index})
+		}
+		return f.add(ctx, s.repairDeleteFileBlocks(id, entries), issues...)
+	}
+	issues := make([]model.FsckIssue, 0)
+	valid := make([]fsckFileBlock, 0, len(entries))
+	for _, e := range entries {
+		ok, err := f.exists(generateBlockMetaKey(e.block.GetId()))
+		if err != nil {
+			return err
+		}
+		if ok {
+			valid = append(valid, e)
+			continue
+		}
+		issues = append(issues, model.FsckIssue{Type: fsckDanglingFileBlock, INodeID: id, BlockID: e.block.GetId(), Index: e.index})
+	}
+	for j, e := range valid {
+		var next int64
+		if j < len(valid)-1 {
+			next = valid[j+1].block.GetId()
+		}
+		if e.index != int64(j) || e.block.GetNextBlockId() != next {
+			issues = append(issues, model.FsckIssue{
+				Type:    fsckBrokenBlockChain,
+				INodeID: id,
+				BlockID: e.block.GetId(),
+				Index:   e.index,
+				Detail:  fmt.Sprintf("next block %d expected %d at index %d", e.block.GetNextBlockId(), next, j),
+			})
+			break
+		}
+	}
+	if len(issues) == 0 {
+		return nil
+	}
+	return f.add(ctx, s.repairRewriteFileBlocks(id, entries, valid), issues...)
+}
+
+//checkBlocks count the block metas, every block storage needs its block meta
+func (f *fsckScan) checkBlocks(ctx context.Context) error {
+	s := f.proxy
+	err := s.scanPrefix(ctx, f.tx, blockMetaKeyPrefix, func(key, val []byte) error {
+		if _, ok := parseIDKey(blockMetaKeyPrefix, key); ok {
+			f.report.Blocks++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.scanPrefix(ctx, f.tx, blockStorageKeyPrefix, func(key, val []byte) error {
+		id, ok := parseIDKey(blockStorageKeyPrefix, key)
+		if !ok {
+			return nil
+		}
+		exists, err := f.exists(generateBlockMetaKey(id))
+		if err != nil || exists {
+			return err
+		}
+		return f.add(ctx, s.repairDeleteBlockStorage(id), model.FsckIssue{Type: fsckOrphanBlockStorage, BlockID: id})
+	})
+}
+
+//transDentryID the inode the dentry names, 0 if it does not exist
+func (s *Proxy) transDentryID(ctx context.Context, tx kv.Transaction, parentID int64, name string) (int64, error) {
+	m := new(pb.INodeID)
+	if err := s.transGet(ctx, tx, generateINodeDirectoryChildKey(parentID, name), m); err != nil {
+		if kv.ErrNotExist.Equal(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return m.GetId(), nil
+}
+
+//transINodeExists whether the inode exists
+func (s *Proxy) transINodeExists(ctx context.Context, tx kv.Transaction, id int64) (bool, error) {
+	_, exists, err := s.transINodeVersion(ctx, tx, id)
+	return exists, err
+}
+
+//repairDeleteDanglingDentry delete the dentry if it still names the inode and the inode or its parent is still missing
+func (s *Proxy) repairDeleteDanglingDentry(d fsckDentry) fsckRepair {
+	return func(ctx context.Context, tx kv.Transaction) (string, error) {
+		if id, err := s.transDentryID(ctx, tx, d.parentID, d.name); err != nil || id != d.id {
+			return fsckChanged, err
+		}
+		child, err := s.transINodeExists(ctx, tx, d.id)
+		if err != nil {
+			return "", err
+		}
+		parent := d.parentID == 0
+		if !parent {
+			if parent, err = s.transINodeExists(ctx, tx, d.parentID); err != nil {
+				return "", err
+			}
+		}
+		if child && parent {
+			return fsckChanged, nil
+		}
+		return "", s.transDel(ctx, tx, generateINodeDirectoryChildKey(d.parentID, d.name))
+	}
+}
+
+//repairDeleteDuplicateDentry delete the dentry if the inode is still linked by its own parent and name
+func (s *Proxy) repairDeleteDuplicateDentry(d fsckDentry) fsckRepair {
+	return func(ctx context.Context, tx kv.Transaction) (string, error) {
+		if id, err := s.transDentryID(ctx, tx, d.parentID, d.name); err != nil || id != d.id {
+			return fsckChanged, err
+		}
+		m := new(pb.INodeMeta)
+		if err := s.transGet(ctx, tx, generateINodeKey(d.id), m); err != nil {
+			if kv.ErrNotExist.Equal(err) {
+				return fsckChanged, nil
+			}
+			return "", err
+		}
+		if m.GetParentId() == d.parentID && m.GetName() == d.name {
+			return fsckChanged, nil
+		}
+		if id, err := s.transDentryID(ctx, tx, m.GetParentId(), m.GetName()); err != nil || id != d.id {
+			return fsckChanged, err
+		}
+		return "", s.transDel(ctx, tx, generateINodeDirectoryChildKey(d.parentID, d.name))
+	}
+}
+
+//repairDeleteFileBlocks delete the block list of a file which is still missing, if the entries did not change
+func (s *Proxy) repairDeleteFileBlocks(id int64, entries []fsckFileBlock) fsckRepair {
+	return func(ctx context.Context, tx kv.Transaction) (string, error) {
+		exists, err := s.transINodeExists(ctx, tx, id)
+		if err != nil || exists {
+			return fsckChanged, err
+		}
+		if changed, err := s.transFileBlocksChanged(ctx, tx, id, entries); err != nil || changed {
+			return fsckChanged, err
+		}
+		for _, e := range entries {
+			if err := s.transDel(ctx, tx, generateINodeFileBlockKey(id, e.index)); err != nil {
+				return "", err
+			}
+		}
+		return "", nil
+	}
+}
+
+//repairRewriteFileBlocks drop dangling entries, renumber the rest and relink next block ids,
+//if the block list and the block metas of the valid and dangling entries are as scanned
+func (s *Proxy) repairRewriteFileBlocks(id int64, entries, valid []fsckFileBlock) fsckRepair {
+	return func(ctx context.Context, tx kv.Transaction) (string, error) {
+		if changed, err := s.transFileBlocksChanged(ctx, tx, id, entries); err != nil || changed {
+			return fsckChanged, err
+		}
+		isValid := make(map[int64]bool, len(valid))
+		for _, e := range valid {
+			isValid[e.index] = true
+		}
+		for _, e := range entries {
+			_, exists, err := s.transBlockVersion(ctx, tx, e.block.GetId())
+			if err != nil {
+				return "", err
+			}
+			if exists != isValid[e.index] {
+				return fsckChanged, nil
+			}
+		}
+		for _, e := range entries {
+			if err := s.transDel(ctx, tx, generateINodeFileBlockKey(id, e.index)); err != nil {
+				return "", err
+			}
+		}
+		for j, e := range valid {
+			m := &pb.INodeFileBlock{
+				Id:          proto.Int64(e.block.GetId()),
+				NumberBytes: e.block.NumberBytes,
+				NextBlockId: proto.Int64(0),
+			}
+			if j < len(valid)-1 {
+				m.NextBlockId = proto.Int64(valid[j+1].block.GetId())
+			}
+			if err := s.transSet(ctx, tx, generateINodeFileBlockKey(id, int64(j)), m); err != nil {
+				return "", err
+			}
+		}
+		return "", nil
+	}
+}
+
+//transFileBlocksChanged whether the block list of the file differs from the scanned entries
+func (s *Proxy) transFileBlocksChanged(ctx context.Context, tx kv.Transaction, id int64, entries []fsckFileBlock) (bool, error) {
+	i := 0
+	changed := false
+	err := s.scanPrefix(ctx, tx, generateINodeFileBlockScanKey(id), func(key, val []byte) error {
+		_, index, ok := parseINodeFileBlockKey(key)
+		if !ok {
+			return nil
+		}
+		m := new(pb.INodeFileBlock)
+		if err := proto.Unmarshal(val, m); err != nil {
+			return err
+		}
+		if i >= len(entries) || entries[i].index != index || !proto.Equal(entries[i].block, m) {
+			changed = true
+		}
+		i++
+		return nil
+	})
+	return changed || i != len(entries), err
+}
+
+//repairDeleteBlockStorage delete the replicas of a block whose meta is still missing
+func (s *Proxy) repairDeleteBlockStorage(id int64) fsckRepair {
+	return func(ctx context.Context, tx kv.Transaction) (string, error) {
+		_, exists, err := s.transBlockVersion(ctx, tx, id)
+		if err != nil || exists {
+			return fsckChanged, err
+		}
+		return "", s.transDelBlockStorage(ctx, tx, id)
+	}
+}
+
+//repairOrphanINode link the inode back to its recorded parent
+func (s *Proxy) repairOrphanINode(id int64) fsckRepair {
+	return func(ctx context.Context, tx kv.Transaction) (string, error) {
+		m := new(pb.INodeMeta)
+		if err := s.transGet(ctx, tx, generateINodeKey(id), m); err != nil {
+			if kv.ErrNotExist.Equal(err) {
+				return fsckChanged, nil
+			}
+			return "", err
+		}
+		parent := new(pb.INodeMeta)
+		if err := s.transGet(ctx, tx, generateINodeKey(m.GetParentId()), parent); err != nil {
+			if kv.ErrNotExist.Equal(err) {
+				return "parent inode not found", nil
+			}
+			return "", err
+		}
+		if parent.GetType() != inodeDirectoryType {
+			return "parent inode is not a directory", nil
+		}
+		linked, err := s.transDentryID(ctx, tx, m.GetParentId(), m.GetName())
+		if err != nil {
+			return "", err
+		}
+		if linked == id {
+			return fsckChanged, nil
+		}
+		if linked != 0 {
+			return "name already used in parent", nil
+		}
+		return "", s.transSet(ctx, tx, generateINodeDirectoryChildKey(m.GetParentId(), m.GetName()), &pb.INodeID{Id: proto.Int64(id)})
+	}
+}
+
+//repairMismatchedDentry make the inode agree with the dentry used by lookups. If a repair of another dentry
+//of the inode made it agree with that one meanwhile, this dentry is a duplicate and deleted
+func (s *Proxy) repairMismatchedDentry(d fsckDentry) fsckRepair {
+	return func(ctx context.Context, tx kv.Transaction) (string, error) {
+		if id, err := s.transDentryID(ctx, tx, d.parentID, d.name); err != nil || id != d.id {
+			return fsckChanged, err
+		}
+		m := new(pb.INodeMeta)
+		if err := s.transGet(ctx, tx, generateINodeKey(d.id), m); err != nil {
+			if kv.ErrNotExist.Equal(err) {
+				return fsckChanged, nil
+			}
+			return "", err
+		}
+		if m.GetParentId() == d.parentID && m.GetName() == d.name {
+			return fsckChanged, nil
+		}
+		linked, err := s.transDentryID(ctx, tx, m.GetParentId(), m.GetName())
+		if err != nil {
+			return "", err
+		}
+		if linked == d.id {
+			return "", s.transDel(ctx, tx, generateINodeDirectoryChildKey(d.parentID, d.name))
+		}
+		m.ParentId = proto.Int64(d.parentID)
+		m.Name = proto.String(d.name)
+		return "", s.transSetINode(ctx, tx, m)
+	}
+}
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pingcap/tidb/kv"
+	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+)
+
+func setTestDentry(t *testing.T, tx kv.Transaction, parent int64, name string, id int64) {
+	t.Helper()
+	mustSet(t, tx, generateINodeDirectoryChildKey(parent, name), &pb.INodeID{Id: proto.Int64(id)})
+}
+
+//setBrokenNamespace a root with a dangling dentry, an orphan inode, a file with a dangling block breaking its chain
+//and an orphan block storage
+func setBrokenNamespace(t *testing.T, s *Proxy) {
+	mustRunTxn(t, s, func(tx kv.Transaction) error {
+		mustSet(t, tx, generateINodeKey(1), testINode(1, 0, "", inodeDirectoryType))
+		setTestDentry(t, tx, 1, "gone", 2)
+		mustSet(t, tx, generateINodeKey(3), testINode(3, 1, "lost", inodeDirectoryType))
+		mustSet(t, tx, generateINodeKey(4), testINode(4, 1, "f", inodeFileType))
+		setTestDentry(t, tx, 1, "f", 4)
+		mustSet(t, tx, generateINodeFileBlockKey(4, 0), &pb.INodeFileBlock{Id: proto.Int64(7), NextBlockId: proto.Int64(8)})
+		mustSet(t, tx, generateINodeFileBlockKey(4, 1), &pb.INodeFileBlock{Id: proto.Int64(8), NextBlockId: proto.Int64(9)})
+		mustSet(t, tx, generateINodeFileBlockKey(4, 2), &pb.INodeFileBlock{Id: proto.Int64(9)})
+		mustSet(t, tx, generateBlockMetaKey(7), &pb.BlockMeta{Id: proto.Int64(7), CollectionId: proto.Int64(4)})
+		mustSet(t, tx, generateBlockMetaKey(9), &pb.BlockMeta{Id: proto.Int64(9), CollectionId: proto.Int64(4)})
+		mustSet(t, tx, generateBlockStorageKey(5), &pb.BlockStorage{Id: proto.Int64(5)})
+		return nil
+	})
+}
+
+func TestFsckRepair(t *testing.T) {
+	s := newTestProxy()
+	ctx := context.Background()
+	setBrokenNamespace(t, s)
+	report, err := s.Fsck(ctx, true, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for typ, want := range map[string]int{
+		fsckDanglingDentry:     1,
+		fsckOrphanINode:        1,
+		fsckDanglingFileBlock:  1,
+		fsckBrokenBlockChain:   1,
+		fsckOrphanBlockStorage: 1,
+	} {
+		if report.Counts[typ] != want {
+			t.Errorf("%s count %d, want %d", typ, report.Counts[typ], want)
+		}
+	}
+	if report.Total != len(report.Issues) || report.Repaired != report.Total {
+		t.Fatalf("total %d issues %d repaired %d", report.Total, len(report.Issues), report.Repaired)
+	}
+	if report, err = s.Fsck(ctx, false, 0, 0); err != nil || report.Total != 0 {
+		t.Fatalf("issues left after repair %+v error %v", report, err)
+	}
+	tx, _ := s.store.Begin()
+	m := new(pb.INodeFileBlock)
+	if !mustGet(t, tx, generateINodeFileBlockKey(4, 1), m) || m.GetId() != 9 {
+		t.Fatalf("block list not renumbered, index 1 is %v", m)
+	}
+}
+
+func TestFsckPage(t *testing.T) {
+	s := newTestProxy()
+	setBrokenNamespace(t, s)
+	report, err := s.Fsck(context.Background(), false, 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Total != 5 || len(report.Issues) != 2 || report.Repaired != 0 {
+		t.Fatalf("total %d page %+v repaired %d", report.Total, report.Issues, report.Repaired)
+	}
+	if report.Issues[0].Type != fsckOrphanINode {
+		t.Fatalf("page starts at %+v", report.Issues[0])
+	}
+}
+
+func TestFsckRepairRevalidates(t *testing.T) {
+	s := newTestProxy()
+	ctx := context.Background()
+	mustRunTxn(t, s, func(tx kv.Transaction) error {
+		mustSet(t, tx, generateINodeKey(1), testINode(1, 0, "", inodeDirectoryType))
+		setTestDentry(t, tx, 1, "d", 2)
+		mustSet(t, tx, generateBlockStorageKey(5), &pb.BlockStorage{Id: proto.Int64(5)})
+		return nil
+	})
+	dentry := s.repairDeleteDanglingDentry(fsckDentry{parentID: 1, name: "d", id: 2})
+	storage := s.repairDeleteBlockStorage(5)
+	// the namespace moves on between the scan and the repair
+	mustRunTxn(t, s, func(tx kv.Transaction) error {
+		mustSet(t, tx, generateINodeKey(2), testINode(2, 1, "d", inodeDirectoryType))
+		mustSet(t, tx, generateBlockMetaKey(5), &pb.BlockMeta{Id: proto.Int64(5)})
+		return nil
+	})
+	mustRunTxn(t, s, func(tx kv.Transaction) error {
+		for _, repair := range []fsckRepair{dentry, storage} {
+			detail, err := repair(ctx, tx)
+			if err != nil {
+				return err
+			}
+			if detail != fsckChanged {
+				t.Errorf("stale finding repaired, detail %q", detail)
+			}
+		}
+		return nil
+	})
+	store := s.store.(*memStore)
+	if len(store.keys(string(generateINodeDirectoryChildKey(1, "d")))) != 1 || len(store.keys(string(generateBlockStorageKey(5)))) != 1 {
+		t.Fatal("stale repair deleted live keys")
+	}
+}
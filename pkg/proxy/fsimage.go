@@ -0,0 +1,720 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pingcap/tidb/kv"
+	"github.com/redis-force/less-state-hdfs/pkg/model"
+	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+	"go.uber.org/zap"
+)
+
+// sections and elements of the xml written by `hdfs oiv -p XML`
+const (
+	fsimageRoot                  = "fsimage"
+	fsimageNameSection           = "NameSection"
+	fsimageINodeSection          = "INodeSection"
+	fsimageINodeDirSection       = "INodeDirectorySection"
+	fsimageINodeReferenceSection = "INodeReferenceSection"
+	fsimageSnapshotSection       = "SnapshotSection"
+	fsimageSnapshotDiffSection   = "SnapshotDiffSection"
+
+	fsimageTypeFile      = "FILE"
+	fsimageTypeDirectory = "DIRECTORY"
+	fsimageTypeSymlink   = "SYMLINK"
+	fsimageBlockStriped  = "STRIPED"
+
+	maxFsimageReportMessages = 100
+)
+
+// kinds of items which have no representation in the kv namespace
+const (
+	fsimageUnsupportedSymlink     = "symlink"
+	fsimageUnsupportedACL         = "acl"
+	fsimageUnsupportedXAttr       = "xattr"
+	fsimageUnsupportedTypeQuota   = "type_quota"
+	fsimageUnsupportedReference   = "reference"
+	fsimageUnsupportedSnapshot    = "snapshot"
+	fsimageUnsupportedSnapshotDir = "snapshottable_directory"
+	fsimageUnsupportedDiff        = "snapshot_diff"
+	fsimageUnsupportedOrphan      = "orphan_inode"
+)
+
+type fsimageBlock struct {
+	ID       int64 `xml:"id"`
+	GenStamp int64 `xml:"genstamp"`
+	NumBytes int64 `xml:"numBytes"`
+}
+
+type fsimageFileUC struct {
+	ClientName    string `xml:"clientName"`
+	ClientMachine string `xml:"clientMachine"`
+}
+
+type fsimageINode struct {
+	ID                    int64          `xml:"id"`
+	Type                  string         `xml:"type"`
+	Name                  string         `xml:"name"`
+	Replication           int16          `xml:"replication"`
+	ModificationTime      int64          `xml:"mtime"`
+	AccessTime            int64          `xml:"atime"`
+	PreferredBlockSize    int64          `xml:"preferredBlockSize"`
+	Permission            string         `xml:"permission"`
+	ACLs                  []string       `xml:"acls>acl"`
+	XAttrs                []struct{}     `xml:"xattrs>xattr"`
+	Blocks                []fsimageBlock `xml:"blocks>block"`
+	StoragePolicyID       byte           `xml:"storagePolicyId"`
+	BlockType             string         `xml:"blockType"`
+	ErasureCodingPolicyID int16          `xml:"erasureCodingPolicyId"`
+	UnderConstruction     *fsimageFileUC `xml:"file-under-construction"`
+	NsQuota               *int64         `xml:"nsquota"`
+	DsQuota               *int64         `xml:"dsquota"`
+	TypeQuota             []struct{}     `xml:"typeQuota>type"`
+}
+
+type fsimageDirectory struct {
+	Parent      int64   `xml:"parent"`
+	Children    []int64 `xml:"child"`
+	RefChildren []int64 `xml:"refChild"`
+}
+
+//walkFsimage call fn with every element directly under a section of the fsimage,
+//the element is skipped if fn does not decode it
+func walkFsimage(r io.Reader, fn func(section string, start xml.StartElement, decode func(v interface{}) error) error) error {
+	d := xml.NewDecoder(r)
+	depth := 0
+	section := ""
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			if depth != 0 {
+				return io.ErrUnexpectedEOF
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			switch depth {
+			case 0:
+				if t.Name.Local != fsimageRoot {
+					return fmt.Errorf("unexpected fsimage root element %s", t.Name.Local)
+				}
+				depth++
+			case 1:
+				section = t.Name.Local
+				depth++
+			default:
+				decoded := false
+				decode := func(v interface{}) error {
+					decoded = true
+					return d.DecodeElement(v, &t)
+				}
+				if err = fn(section, t, decode); err != nil {
+					return err
+				}
+				if !decoded {
+					if err = d.Skip(); err != nil {
+						return err
+					}
+				}
+			}
+		case xml.EndElement:
+			depth--
+		}
+	}
+}
+
+type fsimageImporter struct {
+	blockPoolID string
+	report      *model.FsimageImportReport
+	// child inode id to parent inode id
+	parents map[int64]int64
+	// inodes not imported, their descendants are not imported either
+	skipped map[int64]bool
+}
+
+func (f *fsimageImporter) unsupported(kind string, format string, args ...interface{}) {
+	f.report.Unsupported[kind]++
+	if len(f.report.Messages) < maxFsimageReportMessages {
+		f.report.Messages = append(f.report.Messages, fmt.Sprintf(format, args...))
+	}
+}
+
+//scan read everything but the inodes: names section counters, directory tree and unsupported sections
+func (f *fsimageImporter) scan(section string, start xml.StartElement, decode func(v interface{}) error) error {
+	switch section {
+	case fsimageNameSection:
+		switch start.Name.Local {
+		case "genstampV2":
+			return decode(&f.report.GenerationStamp)
+		case "lastAllocatedBlockId":
+			return decode(&f.report.LastBlockID)
+		}
+	case fsimageINodeSection:
+		if start.Name.Local == "lastInodeId" {
+			return decode(&f.report.LastINodeID)
+		}
+	case fsimageINodeDirSection:
+		if start.Name.Local != "directory" {
+			return nil
+		}
+		dir := new(fsimageDirectory)
+		if err := decode(dir); err != nil {
+			return err
+		}
+		for _, child := range dir.Children {
+			if p, ok := f.parents[child]; ok && p != dir.Parent {
+				return fmt.Errorf("inode %d is a child of both %d and %d", child, p, dir.Parent)
+			}
+			f.parents[child] = dir.Parent
+		}
+		for _, ref := range dir.RefChildren {
+			f.unsupported(fsimageUnsupportedReference, "reference %d under directory %d skipped", ref, dir.Parent)
+		}
+	case fsimageINodeReferenceSection:
+		if start.Name.Local == "ref" {
+			f.unsupported(fsimageUnsupportedReference, "inode reference skipped")
+		}
+	case fsimageSnapshotSection:
+		switch start.Name.Local {
+		case "snapshot":
+			f.unsupported(fsimageUnsupportedSnapshot, "snapshot skipped")
+		case "snapshottableDir":
+			f.unsupported(fsimageUnsupportedSnapshotDir, "snapshottable directory skipped")
+		}
+	case fsimageSnapshotDiffSection:
+		switch start.Name.Local {
+		case "dirDiffEntry", "fileDiffEntry":
+			f.unsupported(fsimageUnsupportedDiff, "snapshot diff %s skipped", start.Name.Local)
+		}
+	}
+	return nil
+}
+
+//convert turn an fsimage inode into inode meta and blocks, returning nil meta if it can not be imported
+func (f *fsimageImporter) convert(n *fsimageINode) (*pb.INodeMeta, []*model.Block, error) {
+	if n.ID <= 0 {
+		return nil, nil, fmt.Errorf("invalid inode id %d", n.ID)
+	}
+	parent, ok := f.parents[n.ID]
+	if !ok && (n.Type != fsimageTypeDirectory || len(n.Name) != 0) {
+		f.unsupported(fsimageUnsupportedOrphan, "inode %d %q is not in the directory tree, skipped", n.ID, n.Name)
+		return nil, nil, nil
+	}
+	if n.Type == fsimageTypeSymlink {
+		f.unsupported(fsimageUnsupportedSymlink, "symlink %d %q skipped", n.ID, n.Name)
+		return nil, nil, nil
+	}
+	user, group, mode, err := parsePermissionStatus(n.Permission)
+	if err != nil {
+		return nil, nil, fmt.Errorf("inode %d: %s", n.ID, err)
+	}
+	if len(n.ACLs) > 0 {
+		f.unsupported(fsimageUnsupportedACL, "%d acl entries of inode %d %q dropped", len(n.ACLs), n.ID, n.Name)
+	}
+	if len(n.XAttrs) > 0 {
+		f.unsupported(fsimageUnsupportedXAttr, "%d xattrs of inode %d %q dropped", len(n.XAttrs), n.ID, n.Name)
+	}
+	m := &pb.INodeMeta{
+		Id:               proto.Int64(n.ID),
+		Name:             proto.String(n.Name),
+		Permission:       proto.Int64(mode),
+		ModificationTime: proto.Int64(n.ModificationTime),
+		AccessTime:       proto.Int64(n.AccessTime),
+		ParentId:         proto.Int64(parent),
+		Owner:            proto.String(user),
+		Group:            proto.String(group),
+	}
+	switch n.Type {
+	case fsimageTypeDirectory:
+		m.Type = proto.Int32(inodeDirectoryType)
+		m.Header = proto.Int64(0)
+		m.NsQuota = n.NsQuota
+		m.DsQuota = n.DsQuota
+		if len(n.TypeQuota) > 0 {
+			f.unsupported(fsimageUnsupportedTypeQuota, "storage type quotas of directory %d %q dropped", n.ID, n.Name)
+		}
+		return m, nil, nil
+	case fsimageTypeFile:
+		m.Type = proto.Int32(inodeFileType)
+		striped := n.BlockType == fsimageBlockStriped
+		redundancy := n.Replication
+		if striped {
+			redundancy = n.ErasureCodingPolicyID
+		}
+		m.Header = proto.Int64(buildHeader(n.PreferredBlockSize, redundancy, striped, n.StoragePolicyID))
+		if n.UnderConstruction != nil {
+			m.ClientName = proto.String(n.UnderConstruction.ClientName)
+			m.ClientMachine = proto.String(n.UnderConstruction.ClientMachine)
+		}
+		blocks := make([]*model.Block, len(n.Blocks))
+		for i, b := range n.Blocks {
+			blocks[i] = &model.Block{
+				ID:           b.ID,
+				Generation:   b.GenStamp,
+				NumberBytes:  b.NumBytes,
+				Replication:  headerReplication(m.GetHeader()),
+				CollectionID: n.ID,
+				BlockPoolID:  f.blockPoolID,
+			}
+		}
+		return m, blocks, nil
+	}
+	return nil, nil, fmt.Errorf("inode %d has unknown type %q", n.ID, n.Type)
+}
+
+//skipDetached skip every inode below a skipped one so no dentry points to a missing parent
+func (f *fsimageImporter) skipDetached() {
+	ids := make([]int64, 0, len(f.parents))
+	for id := range f.parents {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		if f.skipped[id] {
+			continue
+		}
+		p, ok := f.parents[id]
+		for depth := 0; ok && depth <= len(f.parents); depth++ {
+			if f.skipped[p] {
+				f.skipped[id] = true
+				f.unsupported(fsimageUnsupportedOrphan, "inode %d is below skipped inode %d, skipped", id, p)
+				break
+			}
+			p, ok = f.parents[p]
+		}
+	}
+}
+
+//ImportFsimage load the xml output of `hdfs oiv -p XML` into an empty store in batched transactions.
+//Inode and block ids are preserved, items the namespace can not represent are skipped and reported.
+//The whole file is parsed before anything is written.
+func (s *Proxy) ImportFsimage(ctx context.Context, r io.ReadSeeker, blockPoolID string, batchSize int) (*model.FsimageImportReport, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.ImportFsimage")
+	defer span.Finish()
+	if batchSize <= 0 {
+		return nil, fmt.Errorf("batch size should not less than 1")
+	}
+	if err := s.checkEmptyNamespace(ctx); err != nil {
+		return nil, err
+	}
+	f := &fsimageImporter{
+		blockPoolID: blockPoolID,
+		report:      &model.FsimageImportReport{Unsupported: make(map[string]int64), Messages: make([]string, 0)},
+		parents:     make(map[int64]int64),
+		skipped:     make(map[int64]bool),
+	}
+	if err := walkFsimage(r, f.scan); err != nil {
+		return nil, err
+	}
+	// verify every inode converts before writing, unsupported items are reported in this pass only
+	err := walkFsimageINodes(r, func(n *fsimageINode) error {
+		m, _, err := f.convert(n)
+		if err == nil && m == nil {
+			f.skipped[n.ID] = true
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	f.skipDetached()
+	report := f.report
+	f.report = &model.FsimageImportReport{Unsupported: make(map[string]int64)}
+
+	var tx kv.Transaction
+	pending := 0
+	commit := func() error {
+		if tx == nil {
+			return nil
+		}
+		err := tx.Commit(ctx)
+		tx, pending = nil, 0
+		return err
+	}
+	err = walkFsimageINodes(r, func(n *fsimageINode) error {
+		if f.skipped[n.ID] {
+			return nil
+		}
+		m, blocks, err := f.convert(n)
+		if err != nil || m == nil {
+			return err
+		}
+		if tx == nil {
+			if tx, err = s.begin(ctx); err != nil {
+				return err
+			}
+		}
+		if err = s.transPutINode(ctx, tx, m); err != nil {
+			return err
+		}
+		bm, bs, ifb := modelBlockToINode(blocks)
+		if err = s.transPutINodeFileBlocks(ctx, tx, m.GetId(), bm, bs, ifb); err != nil {
+			return err
+		}
+		report.INodes++
+		if m.GetType() == inodeDirectoryType {
+			report.Directories++
+		} else {
+			report.Files++
+		}
+		report.Blocks += int64(len(blocks))
+		pending += 1 + len(blocks)
+		if pending >= batchSize {
+			return commit()
+		}
+		return nil
+	})
+	if err == nil {
+		err = commit()
+	}
+	if err != nil {
+		if tx != nil {
+			tx.Rollback()
+		}
+		s.logger.Error("fsimage import error, store is partially imported", zap.Error(err))
+		return nil, err
+	}
+	s.logger.Info("fsimage imported", zap.Int64("inodes", report.INodes), zap.Int64("blocks", report.Blocks), zap.Any("unsupported", report.Unsupported))
+	return report, nil
+}
+
+//walkFsimageINodes rewind the fsimage and call fn with every inode of the INodeSection
+func walkFsimageINodes(r io.ReadSeeker, fn func(n *fsimageINode) error) error {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	return walkFsimage(r, func(section string, start xml.StartElement, decode func(v interface{}) error) error {
+		if section != fsimageINodeSection || start.Name.Local != "inode" {
+			return nil
+		}
+		n := new(fsimageINode)
+		if err := decode(n); err != nil {
+			return err
+		}
+		return fn(n)
+	})
+}
+
+const (
+	fsimageGenstampV1 = 1000
+	// hdfs INodeDirectory.MAX_PATH_DEPTH
+	maxINodePathDepth = 1000
+)
+
+//FsimageExportOptions fsimage fields which are not kept in the kv namespace
+type FsimageExportOptions struct {
+	NamespaceID   int64
+	LayoutVersion int32
+	TxID          int64
+	// owner and group of inodes written by the namenode, whose permission only has serial numbers
+	Owner string
+	Group string
+}
+
+type fsimageFileOut struct {
+	XMLName               xml.Name       `xml:"inode"`
+	ID                    int64          `xml:"id"`
+	Type                  string         `xml:"type"`
+	Name                  string         `xml:"name"`
+	Replication           *int16         `xml:"replication,omitempty"`
+	ModificationTime      int64          `xml:"mtime"`
+	AccessTime            int64          `xml:"atime"`
+	PreferredBlockSize    int64          `xml:"preferredBlockSize"`
+	Permission            string         `xml:"permission"`
+	Blocks                []fsimageBlock `xml:"blocks>block"`
+	StoragePolicyID       byte           `xml:"storagePolicyId"`
+	BlockType             string         `xml:"blockType,omitempty"`
+	ErasureCodingPolicyID *int16         `xml:"erasureCodingPolicyId,omitempty"`
+	UnderConstruction     *fsimageFileUC `xml:"file-under-construction"`
+}
+
+type fsimageDirOut struct {
+	XMLName          xml.Name `xml:"inode"`
+	ID               int64    `xml:"id"`
+	Type             string   `xml:"type"`
+	Name             string   `xml:"name"`
+	ModificationTime int64    `xml:"mtime"`
+	Permission       string   `xml:"permission"`
+	NsQuota          *int64   `xml:"nsquota,omitempty"`
+	DsQuota          *int64   `xml:"dsquota,omitempty"`
+}
+
+type fsimageDirectoryOut struct {
+	XMLName  xml.Name `xml:"directory"`
+	Parent   int64    `xml:"parent"`
+	Children []int64  `xml:"child"`
+}
+
+type fsimageUCOut struct {
+	XMLName xml.Name `xml:"inode"`
+	ID      int64    `xml:"id"`
+	Path    string   `xml:"path"`
+}
+
+type fsimageWriter struct {
+	e   *xml.Encoder
+	err error
+}
+
+func (w *fsimageWriter) start(name string) {
+	if w.err == nil {
+		w.err = w.e.EncodeToken(xml.StartElement{Name: xml.Name{Local: name}})
+	}
+}
+
+func (w *fsimageWriter) end(name string) {
+	if w.err == nil {
+		w.err = w.e.EncodeToken(xml.EndElement{Name: xml.Name{Local: name}})
+	}
+}
+
+func (w *fsimageWriter) leaf(name string, v interface{}) {
+	if w.err == nil {
+		w.err = w.e.EncodeElement(v, xml.StartElement{Name: xml.Name{Local: name}})
+	}
+}
+
+func (w *fsimageWriter) encode(v interface{}) {
+	if w.err == nil {
+		w.err = w.e.Encode(v)
+	}
+}
+
+//ExportFsimage write the namespace at one snapshot as the xml of `hdfs oiv -p XML`,
+//which `hdfs oiv -p ReverseXML` turns back into an fsimage for a standard namenode
+func (s *Proxy) ExportFsimage(ctx context.Context, out io.Writer, opts FsimageExportOptions) (*model.DumpStats, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.ExportFsimage")
+	defer span.Finish()
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	stats := &model.DumpStats{
+		Timestamp: tx.StartTS(),
+		Counts:    make(map[string]int64),
+	}
+	var numINodes, lastINodeID, lastBlockID int64
+	genstamp := int64(fsimageGenstampV1)
+	err = s.scanPrefix(ctx, tx, inodeKeyPrefix, func(key, val []byte) error {
+		if id, ok := parseIDKey(inodeKeyPrefix, key); ok {
+			numINodes++
+			if id > lastINodeID {
+				lastINodeID = id
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	err = s.scanPrefix(ctx, tx, blockMetaKeyPrefix, func(key, val []byte) error {
+		bm := new(pb.BlockMeta)
+		if err := proto.Unmarshal(val, bm); err != nil {
+			return err
+		}
+		if bm.GetId() > lastBlockID {
+			lastBlockID = bm.GetId()
+		}
+		if bm.GetGeneration() > genstamp {
+			genstamp = bm.GetGeneration()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	bw := bufio.NewWriter(out)
+	w := &fsimageWriter{e: xml.NewEncoder(bw)}
+	if _, err = bw.WriteString(xml.Header); err != nil {
+		return nil, err
+	}
+	w.start(fsimageRoot)
+	w.start("version")
+	w.leaf("layoutVersion", opts.LayoutVersion)
+	w.leaf("onDiskVersion", 1)
+	w.end("version")
+	w.start(fsimageNameSection)
+	w.leaf("namespaceId", opts.NamespaceID)
+	w.leaf("genstampV1", fsimageGenstampV1)
+	w.leaf("genstampV2", genstamp)
+	w.leaf("genstampV1Limit", 0)
+	w.leaf("lastAllocatedBlockId", lastBlockID)
+	w.leaf("txid", opts.TxID)
+	w.end(fsimageNameSection)
+
+	w.start(fsimageINodeSection)
+	w.leaf("lastInodeId", lastINodeID)
+	w.leaf("numInodes", numINodes)
+	underConstruction := make([]int64, 0)
+	err = s.scanPrefix(ctx, tx, inodeKeyPrefix, func(key, val []byte) error {
+		m := new(pb.INodeMeta)
+		if err := proto.Unmarshal(val, m); err != nil {
+			return err
+		}
+		user, group := m.GetOwner(), m.GetGroup()
+		if len(user) == 0 {
+			user, group = opts.Owner, opts.Group
+			stats.Counts["default_owner"]++
+		}
+		permission := formatPermissionStatus(user, group, m.GetPermission())
+		stats.Records++
+		if m.GetType() == inodeDirectoryType {
+			stats.Counts["directory"]++
+			w.encode(&fsimageDirOut{
+				ID:               m.GetId(),
+				Type:             fsimageTypeDirectory,
+				Name:             m.GetName(),
+				ModificationTime: m.GetModificationTime(),
+				Permission:       permission,
+				NsQuota:          m.NsQuota,
+				DsQuota:          m.DsQuota,
+			})
+			return w.err
+		}
+		stats.Counts["file"]++
+		header := m.GetHeader()
+		f := &fsimageFileOut{
+			ID:                 m.GetId(),
+			Type:               fsimageTypeFile,
+			Name:               m.GetName(),
+			ModificationTime:   m.GetModificationTime(),
+			AccessTime:         m.GetAccessTime(),
+			PreferredBlockSize: headerBlockSize(header),
+			Permission:         permission,
+			StoragePolicyID:    headerStoragePolicyID(header),
+		}
+		if redundancy := headerLayoutRedundancy(header); headerStriped(header) {
+			f.BlockType = fsimageBlockStriped
+			f.ErasureCodingPolicyID = &redundancy
+		} else {
+			f.Replication = &redundancy
+		}
+		ids, err := s.scanINodeFileBlockIDs(ctx, tx, m.GetId())
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			bm := new(pb.BlockMeta)
+			if err = s.transGet(ctx, tx, generateBlockMetaKey(id), bm); err != nil {
+				return err
+			}
+			f.Blocks = append(f.Blocks, fsimageBlock{ID: id, GenStamp: bm.GetGeneration(), NumBytes: bm.GetNumberBytes()})
+		}
+		stats.Counts["block"] += int64(len(ids))
+		if len(m.GetClientName()) > 0 {
+			f.UnderConstruction = &fsimageFileUC{ClientName: m.GetClientName(), ClientMachine: m.GetClientMachine()}
+			underConstruction = append(underConstruction, m.GetId())
+		}
+		w.encode(f)
+		return w.err
+	})
+	if err != nil {
+		return nil, err
+	}
+	w.end(fsimageINodeSection)
+	w.start(fsimageINodeReferenceSection)
+	w.end(fsimageINodeReferenceSection)
+	w.start(fsimageSnapshotSection)
+	w.leaf("snapshotCounter", 0)
+	w.leaf("numSnapshots", 0)
+	w.end(fsimageSnapshotSection)
+
+	w.start(fsimageINodeDirSection)
+	dir := &fsimageDirectoryOut{}
+	flush := func() {
+		if dir.Parent != 0 && len(dir.Children) > 0 {
+			w.encode(dir)
+		}
+	}
+	err = s.scanPrefix(ctx, tx, inodeDirectoryChildKeyPrefix, func(key, val []byte) error {
+		parent, _, ok := parseINodeDirectoryChildKey(key)
+		if !ok {
+			return nil
+		}
+		child := new(pb.INodeID)
+		if err := proto.Unmarshal(val, child); err != nil {
+			return err
+		}
+		if parent != dir.Parent {
+			flush()
+			dir = &fsimageDirectoryOut{Parent: parent}
+		}
+		dir.Children = append(dir.Children, child.GetId())
+		return w.err
+	})
+	if err != nil {
+		return nil, err
+	}
+	flush()
+	w.end(fsimageINodeDirSection)
+
+	w.start("FileUnderConstructionSection")
+	for _, id := range underConstruction {
+		path, err := s.transINodePath(ctx, tx, id)
+		if err != nil {
+			return nil, err
+		}
+		w.encode(&fsimageUCOut{ID: id, Path: path})
+	}
+	w.end("FileUnderConstructionSection")
+	w.start("SecretManagerSection")
+	w.leaf("currentId", 0)
+	w.leaf("tokenSequenceNumber", 0)
+	w.leaf("numDelegationKeys", 0)
+	w.leaf("numTokens", 0)
+	w.end("SecretManagerSection")
+	w.start("CacheManagerSection")
+	w.leaf("nextDirectiveId", 1)
+	w.leaf("numDirectives", 0)
+	w.leaf("numPools", 0)
+	w.end("CacheManagerSection")
+	w.end(fsimageRoot)
+	if w.err == nil {
+		w.err = w.e.Flush()
+	}
+	if w.err != nil {
+		return nil, w.err
+	}
+	if err = bw.Flush(); err != nil {
+		return nil, err
+	}
+	s.logger.Info("fsimage exported", zap.Uint64("ts", stats.Timestamp), zap.Int64("inodes", stats.Records))
+	return stats, nil
+}
+
+//transINodePath build the absolute path of the inode from its ancestors
+func (s *Proxy) transINodePath(ctx context.Context, tx kv.Transaction, id int64) (string, error) {
+	names := make([]string, 0)
+	for id != 0 {
+		m := new(pb.INodeMeta)
+		if err := s.transGet(ctx, tx, generateINodeKey(id), m); err != nil {
+			return "", err
+		}
+		if m.GetParentId() == 0 {
+			break
+		}
+		names = append(names, m.GetName())
+		id = m.GetParentId()
+		if len(names) > maxINodePathDepth {
+			return "", fmt.Errorf("inode %d path is too deep", id)
+		}
+	}
+	for i, j := 0, len(names)-1; i < j; i, j = i+1, j-1 {
+		names[i], names[j] = names[j], names[i]
+	}
+	return "/" + strings.Join(names, "/"), nil
+}
@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+)
+
+func importTestFsimage(t *testing.T, s *Proxy) {
+	t.Helper()
+	f, err := os.Open("testdata/fsimage.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	report, err := s.ImportFsimage(context.Background(), f, "BP-1", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.INodes != 3 || report.Directories != 2 || report.Files != 1 || report.Blocks != 2 {
+		t.Fatalf("imported %+v", report)
+	}
+	if report.LastINodeID != 16390 || report.LastBlockID != 1073741826 || report.GenerationStamp != 1002 {
+		t.Fatalf("name section counters %+v", report)
+	}
+	want := map[string]int64{
+		fsimageUnsupportedSymlink:   1,
+		fsimageUnsupportedReference: 2,
+		fsimageUnsupportedOrphan:    2,
+		fsimageUnsupportedACL:       1,
+	}
+	if len(report.Unsupported) != len(want) {
+		t.Fatalf("unsupported %v, want %v", report.Unsupported, want)
+	}
+	for kind, n := range want {
+		if report.Unsupported[kind] != n {
+			t.Errorf("unsupported %s %d, want %d", kind, report.Unsupported[kind], n)
+		}
+	}
+	messages := strings.Join(report.Messages, "\n")
+	for _, m := range []string{`symlink 16388 "link"`, `inode 16389 "orphan" is not in the directory tree`, "inode 16390 is below skipped inode 16389"} {
+		if !strings.Contains(messages, m) {
+			t.Errorf("report misses %q in\n%s", m, messages)
+		}
+	}
+}
+
+func TestImportFsimage(t *testing.T) {
+	s := newTestProxy()
+	importTestFsimage(t, s)
+	tx, err := s.store.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	root := new(pb.INodeID)
+	if !mustGet(t, tx, generateINodeDirectoryChildKey(0, ""), root) || root.GetId() != 16385 {
+		t.Fatalf("root dentry %v", root)
+	}
+	child := new(pb.INodeID)
+	if !mustGet(t, tx, generateINodeDirectoryChildKey(16386, "a.txt"), child) || child.GetId() != 16387 {
+		t.Fatalf("file dentry %v", child)
+	}
+	m := new(pb.INodeMeta)
+	if !mustGet(t, tx, generateINodeKey(16385), m) || m.GetNsQuota() != math.MaxInt64 || m.GetDsQuota() != -1 || m.GetParentId() != 0 {
+		t.Fatalf("root %v", m)
+	}
+	if !mustGet(t, tx, generateINodeKey(16386), m) || m.GetOwner() != "hdfs" || m.GetGroup() != "supergroup" ||
+		m.GetPermission() != 01777 || m.GetNsQuota() != 1000 || m.GetDsQuota() != 10737418240 || m.GetParentId() != 16385 {
+		t.Fatalf("directory %v", m)
+	}
+	if !mustGet(t, tx, generateINodeKey(16387), m) || m.GetOwner() != "alice" || m.GetGroup() != "users" || m.GetPermission() != 0640 ||
+		m.GetAccessTime() != 1700000003000 || headerReplication(m.GetHeader()) != 3 || headerBlockSize(m.GetHeader()) != 134217728 {
+		t.Fatalf("file %v", m)
+	}
+	for _, id := range []int64{16388, 16389, 16390} {
+		if mustGet(t, tx, generateINodeKey(id), m) {
+			t.Errorf("unsupported inode %d imported", id)
+		}
+	}
+	bm := new(pb.BlockMeta)
+	if !mustGet(t, tx, generateBlockMetaKey(1073741826), bm) || bm.GetCollectionId() != 16387 || bm.GetGeneration() != 1002 ||
+		bm.GetNumberBytes() != 100 || bm.GetBlockPoolId() != "BP-1" {
+		t.Fatalf("block %v", bm)
+	}
+	fb := new(pb.INodeFileBlock)
+	if !mustGet(t, tx, generateINodeFileBlockKey(16387, 1), fb) || fb.GetId() != 1073741826 {
+		t.Fatalf("second block of the file %v", fb)
+	}
+
+	f, err := os.Open("testdata/fsimage.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err = s.ImportFsimage(context.Background(), f, "BP-1", 2); err != ErrNamespaceNotEmpty {
+		t.Fatalf("import into a used store error %v", err)
+	}
+}
+
+func TestImportFsimageRejectsBadPermission(t *testing.T) {
+	s := newTestProxy()
+	image := `<fsimage><INodeSection><inode><id>16385</id><type>DIRECTORY</type><name></name><permission>hdfs:0755</permission></inode></INodeSection></fsimage>`
+	if _, err := s.ImportFsimage(context.Background(), strings.NewReader(image), "BP-1", 2); err == nil {
+		t.Fatal("malformed permission imported")
+	}
+	if got := s.store.(*memStore).keys(""); len(got) != 0 {
+		t.Fatalf("failed import wrote %q", got)
+	}
+}
+
+func TestExportFsimageRoundTrip(t *testing.T) {
+	s := newTestProxy()
+	importTestFsimage(t, s)
+	var buf bytes.Buffer
+	stats, err := s.ExportFsimage(context.Background(), &buf, FsimageExportOptions{NamespaceID: 1, LayoutVersion: -64, TxID: 42})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Records != 3 || stats.Counts["directory"] != 2 || stats.Counts["file"] != 1 || stats.Counts["block"] != 2 {
+		t.Fatalf("exported %+v", stats)
+	}
+	restored := newTestProxy()
+	report, err := restored.ImportFsimage(context.Background(), bytes.NewReader(buf.Bytes()), "BP-1", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.INodes != 3 || report.Blocks != 2 || len(report.Unsupported) != 0 || report.LastBlockID != 1073741826 || report.GenerationStamp != 1002 {
+		t.Fatalf("reimported %+v", report)
+	}
+	want, got := s.store.(*memStore), restored.store.(*memStore)
+	if !reflect.DeepEqual(want.data, got.data) {
+		t.Fatalf("round trip changed the namespace\nwant %q\ngot  %q", want.keys(""), got.keys(""))
+	}
+}
@@ -0,0 +1,80 @@
+package proxy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// inode header layout of hdfs INodeFile.HeaderFormat:
+// [4-bit storage policy][1-bit striped][11-bit replication][48-bit preferred block size]
+const (
+	headerBlockSizeBits   = 48
+	headerReplicationBits = 11
+	headerStripedBit      = headerBlockSizeBits + headerReplicationBits
+	headerStoragePolicy   = headerStripedBit + 1
+)
+
+// permission layout of hdfs INodeWithAdditionalFields.PermissionStatusFormat:
+// [23-bit user serial][25-bit group serial][16-bit mode]
+// user and group names are stored in INodeMeta, so serials are always 0
+const (
+	permissionModeBits = 16
+	permissionModeMask = 01777
+)
+
+func headerReplication(header int64) int16 {
+	if header>>headerStripedBit&1 == 1 {
+		return 1
+	}
+	return int16(header >> headerBlockSizeBits & (1<<headerReplicationBits - 1))
+}
+
+//headerBlockSize return the preferred block size of the file header
+func headerBlockSize(header int64) int64 {
+	return header & (1<<headerBlockSizeBits - 1)
+}
+
+//headerStriped return true if the file is erasure coded, the replication bits hold the policy id then
+func headerStriped(header int64) bool {
+	return header>>headerStripedBit&1 == 1
+}
+
+//headerLayoutRedundancy return replication of contiguous files or erasure coding policy id of striped files
+func headerLayoutRedundancy(header int64) int16 {
+	return int16(header >> headerBlockSizeBits & (1<<headerReplicationBits - 1))
+}
+
+func headerStoragePolicyID(header int64) byte {
+	return byte(uint64(header) >> headerStoragePolicy)
+}
+
+//buildHeader pack file attributes into an hdfs file header, redundancy is the ec policy id if striped
+func buildHeader(blockSize int64, redundancy int16, striped bool, storagePolicy byte) int64 {
+	h := blockSize & (1<<headerBlockSizeBits - 1)
+	h |= int64(redundancy) & (1<<headerReplicationBits - 1) << headerBlockSizeBits
+	if striped {
+		h |= 1 << headerStripedBit
+	}
+	return int64(uint64(h) | uint64(storagePolicy&0xf)<<headerStoragePolicy)
+}
+
+func permissionMode(permission int64) int64 {
+	return permission & (1<<permissionModeBits - 1) & permissionModeMask
+}
+
+//parsePermissionStatus parse user:group:mode printed by hdfs oiv, mode is octal
+func parsePermissionStatus(s string) (user, group string, mode int64, err error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return "", "", 0, fmt.Errorf("invalid permission %q", s)
+	}
+	if mode, err = strconv.ParseInt(parts[2], 8, 32); err != nil {
+		return "", "", 0, fmt.Errorf("invalid permission mode %q", s)
+	}
+	return parts[0], parts[1], mode & permissionModeMask, nil
+}
+
+func formatPermissionStatus(user, group string, permission int64) string {
+	return fmt.Sprintf("%s:%s:%04o", user, group, permissionMode(permission))
+}
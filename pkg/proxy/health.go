@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/kv"
+	"github.com/redis-force/less-state-hdfs/pkg/model"
+	"github.com/redis-force/less-state-hdfs/pkg/proxy/config"
+)
+
+// status of model.Health
+const (
+	healthOK      = "ok"
+	healthUnready = "unready"
+)
+
+//instanceName name the proxy instance by host and listen address, the holder of the webhook leases
+func instanceName(hostPort string) string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return host + hostPort
+}
+
+//Ready check pd serves timestamps and tikv commits a write of the sentinel of the instance within the timeout,
+//the proxy is unready as soon as it starts closing
+func (s *Proxy) Ready(ctx context.Context) map[string]error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.Ready")
+	defer span.Finish()
+	checks := map[string]error{"tso": nil, "kv": nil}
+	if atomic.LoadInt32(&s.closing) != 0 {
+		checks["tso"], checks["kv"] = ErrServerClosed, ErrServerClosed
+		return checks
+	}
+	timeout := s.config.ReadyTimeout
+	if timeout <= 0 {
+		timeout = config.DefaultReadyTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	ts, err := s.oracle.GetTimestamp(ctx)
+	if err != nil {
+		checks["tso"] = errors.Annotate(err, "get timestamp from tikv pd")
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- s.writeSentinel(ctx, ts)
+	}()
+	select {
+	case err = <-done:
+		if err != nil {
+			checks["kv"] = errors.Annotate(err, "write tikv")
+		}
+	case <-ctx.Done():
+		checks["kv"] = fmt.Errorf("tikv unreachable within %s", timeout)
+	}
+	return checks
+}
+
+//writeSentinel commit the timestamp of the probe to the sentinel of the instance,
+//probes of different instances write different keys and never conflict, a loaded proxy is not shed into unready
+func (s *Proxy) writeSentinel(ctx context.Context, ts uint64) error {
+	return s.runTxn(withTxnPriority(ctx, priorityHigh), func(tx kv.Transaction) error {
+		return tx.Set(generateSentinelKey(s.instance), int64ToBytes(int64(ts)))
+	})
+}
+
+//removeSentinel delete the sentinel of the instance when it closes, a crashed instance leaves one key behind
+func (s *Proxy) removeSentinel() error {
+	ctx, cancel := context.WithTimeout(context.Background(), config.DefaultReadyTimeout)
+	defer cancel()
+	return s.runTxn(ctx, func(tx kv.Transaction) error {
+		return tx.Delete(generateSentinelKey(s.instance))
+	})
+}
+
+//healthz the process serves requests
+func (s *apiServer) healthz(c *gin.Context) {
+	c.AbortWithStatusJSON(http.StatusOK, model.Health{Status: healthOK})
+}
+
+//readyz the proxy may serve requests, 503 with the failed checks otherwise
+func (s *apiServer) readyz(c *gin.Context) {
+	health := model.Health{Status: healthOK, Checks: make(map[string]string)}
+	code := http.StatusOK
+	for name, err := range s.proxy.Ready(c.Request.Context()) {
+		if err != nil {
+			health.Status = healthUnready
+			health.Checks[name] = err.Error()
+			code = http.StatusServiceUnavailable
+			continue
+		}
+		health.Checks[name] = healthOK
+	}
+	c.AbortWithStatusJSON(code, health)
+}
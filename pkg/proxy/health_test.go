@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	"github.com/redis-force/less-state-hdfs/pkg/model"
+)
+
+//testOracle serve a fixed timestamp or fail
+type testOracle struct {
+	oracle.Oracle
+	ts  uint64
+	err error
+}
+
+func (o *testOracle) GetTimestamp(ctx context.Context) (uint64, error) {
+	return o.ts, o.err
+}
+
+//stuckStore begin no transaction until released, signal when the transaction begun then is rolled back
+type stuckStore struct {
+	*memStore
+	release    chan struct{}
+	rolledBack chan struct{}
+}
+
+func (s *stuckStore) Begin() (kv.Transaction, error) {
+	<-s.release
+	tx, err := s.memStore.Begin()
+	return &stuckTxn{memTxn: tx.(*memTxn), rolledBack: s.rolledBack}, err
+}
+
+type stuckTxn struct {
+	*memTxn
+	rolledBack chan struct{}
+}
+
+func (t *stuckTxn) Rollback() error {
+	select {
+	case t.rolledBack <- struct{}{}:
+	default:
+	}
+	return t.memTxn.Rollback()
+}
+
+func readyz(t *testing.T, s *Proxy) (int, model.Health) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	newAPIServer(s).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	var health model.Health
+	if err := json.Unmarshal(w.Body.Bytes(), &health); err != nil {
+		t.Fatal(err)
+	}
+	return w.Code, health
+}
+
+func TestReadyzWritesInstanceSentinel(t *testing.T) {
+	s := newTestProxy()
+	s.instance = "host:8080"
+	s.oracle = &testOracle{ts: 42}
+	code, health := readyz(t, s)
+	if code != http.StatusOK || health.Status != healthOK || health.Checks["kv"] != healthOK || health.Checks["tso"] != healthOK {
+		t.Fatalf("readyz answered %d %+v", code, health)
+	}
+	tx, _ := s.store.Begin()
+	defer tx.Rollback()
+	val, err := tx.Get(generateSentinelKey("host:8080"))
+	if err != nil || bytesToInt64(val) != 42 {
+		t.Fatalf("sentinel %v error %v", val, err)
+	}
+	if err = s.removeSentinel(); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.store.(*memStore).keys(string(sentinelKey)); len(got) != 0 {
+		t.Fatalf("sentinels left after close %q", got)
+	}
+}
+
+func TestReadyzUnready(t *testing.T) {
+	s := newTestProxy()
+	s.oracle = &testOracle{err: errors.New("pd down")}
+	if code, health := readyz(t, s); code != http.StatusServiceUnavailable || health.Status != healthUnready ||
+		health.Checks["kv"] != healthOK || len(health.Checks["tso"]) == 0 || health.Checks["tso"] == healthOK {
+		t.Fatalf("readyz without pd answered %d %+v", code, health)
+	}
+
+	store := &stuckStore{memStore: newMemStore(), release: make(chan struct{}), rolledBack: make(chan struct{}, 1)}
+	defer func() {
+		// the abandoned probe finishes before the next test reads the metrics
+		close(store.release)
+		<-store.rolledBack
+	}()
+	s = newTestProxy()
+	s.store = store
+	s.oracle = &testOracle{ts: 1}
+	s.config.ReadyTimeout = 20 * time.Millisecond
+	if code, health := readyz(t, s); code != http.StatusServiceUnavailable || health.Checks["tso"] != healthOK || health.Checks["kv"] == healthOK {
+		t.Fatalf("readyz with tikv stuck answered %d %+v", code, health)
+	}
+
+	s = newTestProxy()
+	s.oracle = &testOracle{ts: 1}
+	s.closing = 1
+	if code, health := readyz(t, s); code != http.StatusServiceUnavailable || health.Checks["kv"] != ErrServerClosed.Error() {
+		t.Fatalf("readyz while closing answered %d %+v", code, health)
+	}
+}
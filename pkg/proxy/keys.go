@@ -1,10 +1,28 @@
 package proxy
 
 import (
+	"bytes"
 	"fmt"
 	"strconv"
 )
 
+var (
+	inodeKeyPrefix               = []byte(`{in}_`)
+	inodeDirectoryChildKeyPrefix = []byte(`{id}_`)
+	inodeFileBlockKeyPrefix      = []byte(`{ib}_`)
+	blockMetaKeyPrefix           = []byte(`{bm}_`)
+	blockStorageKeyPrefix        = []byte(`{bs}_`)
+	blockCorruptKeyPrefix        = []byte(`{bc}_`)
+	dataNodeBlockKeyPrefix       = []byte(`{db}_`)
+	changeEventKeyPrefix         = []byte(`{ev}_`)
+	webhookDeadLetterKeyPrefix   = []byte(`{wd}_`)
+	retryCacheKeyPrefix          = []byte(`{rc}_`)
+	retryCacheExpiryPrefix       = []byte(`{re}_`)
+	blockTombstoneExpiryPrefix   = []byte(`{de}_`)
+	// only read, by the startup check, the readiness probes write the sentinels of their instances
+	sentinelKey = []byte(`{sn}`)
+)
+
 func generateBlockMetaKey(id int64) []byte {
 	return strconv.AppendInt([]byte(`{bm}_`), id, 10)
 }
@@ -35,3 +53,121 @@ func generateINodeDirectoryChildScanKey(id int64) []byte {
 func generateINodeFileBlockScanKey(id int64) []byte {
 	return []byte(fmt.Sprintf("{ib}_%d_", id))
 }
+
+func generateBlockCorruptKey(id int64) []byte {
+	return strconv.AppendInt([]byte(`{bc}_`), id, 10)
+}
+
+func generateDataNodeBlockKey(dataNodeID string, id int64) []byte {
+	return append(generateDataNodeBlockScanKey(dataNodeID), int64ToBytes(id)...)
+}
+
+func generateDataNodeBlockScanKey(dataNodeID string) []byte {
+	return []byte(fmt.Sprintf("{db}_%s_", dataNodeID))
+}
+
+//generateBlockTombstoneKey the owner of a deleted block
+func generateBlockTombstoneKey(id int64) []byte {
+	return strconv.AppendInt([]byte(`{dt}_`), id, 10)
+}
+
+//generateBlockTombstoneExpiryKey tombstones ordered by expiry, the sweeper only scans the expired ones
+func generateBlockTombstoneExpiryKey(expire, id int64) []byte {
+	return append(append([]byte(`{de}_`), int64ToBytes(expire)...), int64ToBytes(id)...)
+}
+
+//generateChangeEventKey batches ordered by the start ts of their transaction, then by their sequence in it
+func generateChangeEventKey(txid, seq int64) []byte {
+	return append(generateChangeEventScanKey(txid), int64ToBytes(seq)...)
+}
+
+func generateChangeEventScanKey(txid int64) []byte {
+	return append([]byte(`{ev}_`), int64ToBytes(txid)...)
+}
+
+//parseChangeEventKey the txid of the batch, keys written before batches had a sequence are the txid alone
+func parseChangeEventKey(key []byte) (int64, bool) {
+	if !bytes.HasPrefix(key, changeEventKeyPrefix) {
+		return 0, false
+	}
+	key = key[len(changeEventKeyPrefix):]
+	if len(key) != 8 && len(key) != 16 {
+		return 0, false
+	}
+	return bytesToInt64(key[:8]), true
+}
+
+func generateWebhookCursorKey(name string) []byte {
+	return []byte(fmt.Sprintf("{wc}_%s", name))
+}
+
+//generateWebhookLeaseKey the instance delivering to the subscriber
+func generateWebhookLeaseKey(name string) []byte {
+	return []byte(fmt.Sprintf("{wl}_%s", name))
+}
+
+func generateWebhookDeadLetterKey(name string, txid int64) []byte {
+	return append(generateWebhookDeadLetterScanKey(name), int64ToBytes(txid)...)
+}
+
+func generateWebhookDeadLetterScanKey(name string) []byte {
+	return []byte(fmt.Sprintf("{wd}_%s_", name))
+}
+
+//generateSentinelKey the sentinel written by the readiness probes of a proxy instance
+func generateSentinelKey(instance string) []byte {
+	return []byte(fmt.Sprintf("{sn}_%s", instance))
+}
+
+//generateRetryCacheKey the result of a request id, ids of different principals never collide
+func generateRetryCacheKey(principal, requestID string) []byte {
+	return []byte(fmt.Sprintf("{rc}_%d_%s_%s", len(principal), principal, requestID))
+}
+
+//generateRetryCacheExpiryKey retry cache entries ordered by expiry, the sweeper only scans the expired ones
+func generateRetryCacheExpiryKey(expire int64, key []byte) []byte {
+	return append(append([]byte(`{re}_`), int64ToBytes(expire)...), key...)
+}
+
+//parseIDKey parse keys like {in}_<id>
+func parseIDKey(prefix, key []byte) (int64, bool) {
+	if !bytes.HasPrefix(key, prefix) {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(string(key[len(prefix):]), 10, 64)
+	return id, err == nil
+}
+
+//parseINodeDirectoryChildKey parse {id}_<parent>_<name>
+func parseINodeDirectoryChildKey(key []byte) (int64, string, bool) {
+	if !bytes.HasPrefix(key, inodeDirectoryChildKeyPrefix) {
+		return 0, "", false
+	}
+	rest := key[len(inodeDirectoryChildKeyPrefix):]
+	i := bytes.IndexByte(rest, '_')
+	if i <= 0 {
+		return 0, "", false
+	}
+	id, err := strconv.ParseInt(string(rest[:i]), 10, 64)
+	if err != nil {
+		return 0, "", false
+	}
+	return id, string(rest[i+1:]), true
+}
+
+//parseINodeFileBlockKey parse {ib}_<id>_<8 bytes index>
+func parseINodeFileBlockKey(key []byte) (int64, int64, bool) {
+	if !bytes.HasPrefix(key, inodeFileBlockKeyPrefix) {
+		return 0, 0, false
+	}
+	rest := key[len(inodeFileBlockKeyPrefix):]
+	i := bytes.IndexByte(rest, '_')
+	if i <= 0 || len(rest) != i+1+8 {
+		return 0, 0, false
+	}
+	id, err := strconv.ParseInt(string(rest[:i]), 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return id, bytesToInt64(rest[i+1:]), true
+}
@@ -0,0 +1,225 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/pingcap/errors"
+	tidbcfg "github.com/pingcap/tidb/config"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/tikv"
+	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+	"github.com/redis-force/less-state-hdfs/pkg/proxy/config"
+	"go.uber.org/zap"
+)
+
+//configureKV pass the security and timeouts to the tikv driver, which reads them from the global tidb config
+func configureKV(c *config.Config) error {
+	if len(c.KVPDAddresses) == 0 {
+		return fmt.Errorf("no tikv pd address configured")
+	}
+	if (len(c.KVSSLCert) == 0) != (len(c.KVSSLKey) == 0) {
+		return fmt.Errorf("tikv ssl cert and key should be set together")
+	}
+	if len(c.KVSSLCert) > 0 && len(c.KVSSLCA) == 0 {
+		return fmt.Errorf("tikv ssl ca is required to use a client certificate")
+	}
+	global := tidbcfg.GetGlobalConfig()
+	global.Security.ClusterSSLCA = c.KVSSLCA
+	global.Security.ClusterSSLCert = c.KVSSLCert
+	global.Security.ClusterSSLKey = c.KVSSLKey
+	// load the files now, the driver would only fail later deep in a retry loop
+	if _, err := global.Security.ToTLSConfig(); err != nil {
+		return fmt.Errorf("invalid tikv tls config: %s", err)
+	}
+	if c.KVMaxTxnTimeUse > 0 {
+		global.TiKVClient.MaxTxnTimeUse = uint(c.KVMaxTxnTimeUse / time.Second)
+	}
+	if c.KVKeepAliveTime > 0 {
+		tikv.GrpcKeepAliveTime = c.KVKeepAliveTime
+	}
+	if c.KVKeepAliveTimeout > 0 {
+		tikv.GrpcKeepAliveTimeout = c.KVKeepAliveTimeout
+	}
+	return nil
+}
+
+//openStorage connect pd and check a tso and a tikv read succeed within the startup timeout
+func openStorage(c *config.Config, logger *zap.Logger) (kv.Storage, error) {
+	if err := configureKV(c); err != nil {
+		return nil, err
+	}
+	timeout := c.KVStartupTimeout
+	if timeout <= 0 {
+		timeout = config.DefaultKVStartupTimeout
+	}
+	pd := strings.Join(c.KVPDAddresses, ",")
+	type result struct {
+		store kv.Storage
+		err   error
+	}
+	// the pd client keeps retrying an unreachable cluster for a long time
+	opened := make(chan result, 1)
+	go func() {
+		store, err := tikv.Driver{}.Open(fmt.Sprintf("tikv://%s", pd))
+		opened <- result{store, err}
+	}()
+	var store kv.Storage
+	select {
+	case r := <-opened:
+		if r.err != nil {
+			return nil, errors.Annotatef(r.err, "connect tikv pd %s", pd)
+		}
+		store = r.store
+	case <-time.After(timeout):
+		go func() {
+			if r := <-opened; r.store != nil {
+				r.store.Close()
+			}
+		}()
+		return nil, fmt.Errorf("tikv pd %s unreachable within %s", pd, timeout)
+	}
+	if err := checkStorage(store, timeout); err != nil {
+		store.Close()
+		return nil, err
+	}
+	logger.Info("tikv storage opened", zap.Strings("pd", c.KVPDAddresses), zap.Bool("tls", len(c.KVSSLCA) > 0))
+	return store, nil
+}
+
+//checkStorage get a timestamp from pd and read a key from tikv
+func checkStorage(store kv.Storage, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if _, err := store.GetOracle().GetTimestamp(ctx); err != nil {
+		return errors.Annotate(err, "get timestamp from tikv pd")
+	}
+	done := make(chan error, 1)
+	go func() {
+		tx, err := store.Begin()
+		if err != nil {
+			done <- err
+			return
+		}
+		defer tx.Rollback()
+		if _, err = tx.Get(sentinelKey); kv.IsErrNotFound(err) {
+			err = nil
+		}
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			return errors.Annotate(err, "read from tikv")
+		}
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("tikv unreachable within %s", timeout)
+	}
+}
+
+//begin start a transaction of the request, its iterators and commit are traced and measured.
+//It is in flight until committed or rolled back, which happens when the request is served at the latest
+func (s *Proxy) begin(ctx context.Context) (kv.Transaction, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.Annotate(err, "begin transaction")
+	}
+	start := time.Now()
+	tx, err := s.store.Begin()
+	txnBeginDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		return nil, err
+	}
+	t := &txn{Transaction: tx, ctx: ctx, proxy: s, start: start}
+	s.inflight.add(t)
+	if scope, ok := ctx.Value(txnScopeKey{}).(*txnScope); ok {
+		t.operation, t.scope = scope.operation, scope
+		scope.add(t)
+	}
+	return t, nil
+}
+
+//txn transaction bound to the context of the request which began it
+type txn struct {
+	kv.Transaction
+	ctx       context.Context
+	proxy     *Proxy
+	operation string
+	start     time.Time
+	// nil if begun outside of a request
+	scope *txnScope
+	// batches of change events appended, see changeEventHorizon
+	events []*pb.ChangeEventBatch
+
+	mu   sync.Mutex
+	done bool
+}
+
+func (t *txn) Iter(k kv.Key, upperBound kv.Key) (kv.Iterator, error) {
+	if err := t.checkContext(); err != nil {
+		return nil, err
+	}
+	span, _ := opentracing.StartSpanFromContext(t.ctx, "kv.Iter")
+	it, err := t.Transaction.Iter(k, upperBound)
+	if err != nil {
+		ext.Error.Set(span, true)
+		span.Finish()
+		return nil, err
+	}
+	return &tracedIterator{Iterator: it, span: span}, nil
+}
+
+func (t *txn) Commit(ctx context.Context) error {
+	if err := t.checkContext(); err != nil {
+		return err
+	}
+	if !t.finish() {
+		return kv.ErrInvalidTxn
+	}
+	if len(t.events) > 0 && time.Since(t.start) > changeEventCommitWindow {
+		t.Transaction.Rollback()
+		return errors.Annotatef(errChangeEventWindow, "transaction %d of %s", t.StartTS(), t.operation)
+	}
+	span, ctx := opentracing.StartSpanFromContext(ctx, "kv.Commit")
+	defer span.Finish()
+	start := time.Now()
+	err := t.Transaction.Commit(ctx)
+	result := "ok"
+	if kv.IsRetryableError(err) {
+		result = "conflict"
+		txnConflictCounter.Inc()
+	} else if err != nil {
+		result = "error"
+	}
+	if err != nil {
+		ext.Error.Set(span, true)
+	}
+	txnCommitDuration.WithLabelValues(result).Observe(time.Since(start).Seconds())
+	if err == nil {
+		t.proxy.recordAudit(t.ctx, t.events)
+	}
+	return err
+}
+
+//tracedIterator finish the span of the scan when it is closed
+type tracedIterator struct {
+	kv.Iterator
+	span opentracing.Span
+	keys int
+}
+
+func (it *tracedIterator) Next() error {
+	it.keys++
+	return it.Iterator.Next()
+}
+
+func (it *tracedIterator) Close() {
+	it.Iterator.Close()
+	it.span.SetTag("keys", it.keys)
+	it.span.Finish()
+}
@@ -0,0 +1,290 @@
+package proxy
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	tidbcfg "github.com/pingcap/tidb/config"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/tikv/oracle"
+	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+	"github.com/redis-force/less-state-hdfs/pkg/proxy/config"
+	"go.uber.org/zap"
+)
+
+//memStore in memory storage, transactions buffer their writes until commit and only conflict when told to
+type memStore struct {
+	kv.Storage
+	mu   sync.Mutex
+	data map[string][]byte
+	ts   uint64
+	// added to the clock of the start ts
+	skew time.Duration
+	// the next commits failing with a write conflict
+	conflicts int
+}
+
+func newMemStore() *memStore {
+	return &memStore{data: make(map[string][]byte)}
+}
+
+func (s *memStore) Begin() (kv.Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ts++
+	if now := oracle.ComposeTS(oracle.GetPhysical(time.Now().Add(s.skew)), 0); now > s.ts {
+		s.ts = now
+	}
+	return &memTxn{store: s, writes: make(map[string][]byte), startTS: s.ts}, nil
+}
+
+//keys the committed keys having the prefix
+func (s *memStore) keys(prefix string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ret []string
+	for key := range s.data {
+		if strings.HasPrefix(key, prefix) {
+			ret = append(ret, key)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+//memTxn transaction of a memStore, the methods it does not override panic
+type memTxn struct {
+	kv.Transaction
+	store *memStore
+	// nil values are deletes
+	writes  map[string][]byte
+	startTS uint64
+}
+
+//newMemTxn a transaction of a store of its own, for the trans* methods
+func newMemTxn() *memTxn {
+	tx, _ := newMemStore().Begin()
+	return tx.(*memTxn)
+}
+
+func (t *memTxn) Get(k kv.Key) ([]byte, error) {
+	v, ok := t.writes[string(k)]
+	if !ok {
+		t.store.mu.Lock()
+		v, ok = t.store.data[string(k)]
+		t.store.mu.Unlock()
+	}
+	if !ok || v == nil {
+		return nil, kv.ErrNotExist
+	}
+	return v, nil
+}
+
+func (t *memTxn) Set(k kv.Key, v []byte) error {
+	if len(v) == 0 {
+		return kv.ErrCannotSetNilValue
+	}
+	t.writes[string(k)] = append([]byte(nil), v...)
+	return nil
+}
+
+func (t *memTxn) Delete(k kv.Key) error {
+	t.writes[string(k)] = nil
+	return nil
+}
+
+func (t *memTxn) Iter(k kv.Key, upperBound kv.Key) (kv.Iterator, error) {
+	inRange := func(key string) bool {
+		return key >= string(k) && (upperBound == nil || key < string(upperBound))
+	}
+	seen := make(map[string]bool)
+	var keys []string
+	for key, v := range t.writes {
+		seen[key] = true
+		if v != nil && inRange(key) {
+			keys = append(keys, key)
+		}
+	}
+	t.store.mu.Lock()
+	for key := range t.store.data {
+		if !seen[key] && inRange(key) {
+			keys = append(keys, key)
+		}
+	}
+	t.store.mu.Unlock()
+	sort.Strings(keys)
+	return &memIterator{txn: t, keys: keys}, nil
+}
+
+//LockKeys a memStore does not detect conflicts
+func (t *memTxn) LockKeys(keys ...kv.Key) error { return nil }
+
+func (t *memTxn) IsReadOnly() bool { return len(t.writes) == 0 }
+func (t *memTxn) StartTS() uint64  { return t.startTS }
+func (t *memTxn) Valid() bool      { return t.writes != nil }
+
+func (t *memTxn) Rollback() error {
+	t.writes = nil
+	return nil
+}
+
+func (t *memTxn) Commit(ctx context.Context) error {
+	t.store.mu.Lock()
+	defer t.store.mu.Unlock()
+	if t.store.conflicts > 0 {
+		t.store.conflicts--
+		t.writes = nil
+		return kv.ErrRetryable
+	}
+	for key, v := range t.writes {
+		if v == nil {
+			delete(t.store.data, key)
+		} else {
+			t.store.data[key] = v
+		}
+	}
+	t.writes = nil
+	return nil
+}
+
+//keys the keys having the prefix as the transaction sees them
+func (t *memTxn) keys(prefix string) []string {
+	it, _ := t.Iter(kv.Key(prefix), nil)
+	var ret []string
+	for ; it.Valid() && strings.HasPrefix(string(it.Key()), prefix); it.Next() {
+		ret = append(ret, string(it.Key()))
+	}
+	return ret
+}
+
+type memIterator struct {
+	txn  *memTxn
+	keys []string
+}
+
+func (it *memIterator) Valid() bool { return len(it.keys) > 0 }
+func (it *memIterator) Key() kv.Key { return kv.Key(it.keys[0]) }
+func (it *memIterator) Value() []byte {
+	v, _ := it.txn.Get(kv.Key(it.keys[0]))
+	return v
+}
+func (it *memIterator) Next() error {
+	it.keys = it.keys[1:]
+	return nil
+}
+func (it *memIterator) Close() {}
+
+func newTestProxy() *Proxy {
+	return &Proxy{
+		config:   &config.Config{},
+		store:    newMemStore(),
+		logger:   zap.NewNop(),
+		exitChan: make(chan struct{}),
+		inflight: newInflightTxns(),
+	}
+}
+
+func mustSet(t *testing.T, tx kv.Transaction, key []byte, m proto.Message) {
+	t.Helper()
+	val, err := proto.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Set(key, val); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustGet(t *testing.T, tx kv.Transaction, key []byte, m proto.Message) bool {
+	t.Helper()
+	val, err := tx.Get(key)
+	if kv.ErrNotExist.Equal(err) {
+		return false
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = proto.Unmarshal(val, m); err != nil {
+		t.Fatal(err)
+	}
+	return true
+}
+
+func testINode(id, parent int64, name string, typ int32) *pb.INodeMeta {
+	return &pb.INodeMeta{
+		Id:               proto.Int64(id),
+		Name:             proto.String(name),
+		Permission:       proto.Int64(0755),
+		ModificationTime: proto.Int64(1),
+		AccessTime:       proto.Int64(1),
+		Type:             proto.Int32(typ),
+		ParentId:         proto.Int64(parent),
+	}
+}
+
+//mustRunTxn run fn in a transaction of the proxy and commit it
+func mustRunTxn(t *testing.T, s *Proxy, fn func(tx kv.Transaction) error) {
+	t.Helper()
+	if err := s.runTxn(context.Background(), fn); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestConfigureKV(t *testing.T) {
+	global := tidbcfg.GetGlobalConfig()
+	security := global.Security
+	defer func() { global.Security = security }()
+	dir, err := ioutil.TempDir("", "kv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	cert, key := writeTestCert(t, dir, "tikv", "proxy")
+	for _, c := range []*config.Config{
+		{},
+		{KVPDAddresses: []string{"pd0:2379"}, KVSSLCA: cert, KVSSLCert: cert},
+		{KVPDAddresses: []string{"pd0:2379"}, KVSSLCert: cert, KVSSLKey: key},
+		{KVPDAddresses: []string{"pd0:2379"}, KVSSLCA: filepath.Join(dir, "missing.crt"), KVSSLCert: cert, KVSSLKey: key},
+		{KVPDAddresses: []string{"pd0:2379"}, KVSSLCA: key, KVSSLCert: cert, KVSSLKey: key},
+	} {
+		if err := configureKV(c); err == nil {
+			t.Errorf("invalid tikv config %+v accepted", c)
+		}
+	}
+	c := &config.Config{KVPDAddresses: []string{"pd0:2379", "pd1:2379"}, KVSSLCA: cert, KVSSLCert: cert, KVSSLKey: key}
+	if err = configureKV(c); err != nil {
+		t.Fatal(err)
+	}
+	if global.Security.ClusterSSLCA != cert || global.Security.ClusterSSLCert != cert || global.Security.ClusterSSLKey != key {
+		t.Fatalf("tikv security %+v", global.Security)
+	}
+}
+
+func TestOpenStorageFailsFast(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// nothing listens on the address any more
+	pd := l.Addr().String()
+	l.Close()
+	c := &config.Config{KVPDAddresses: []string{pd}, KVStartupTimeout: 200 * time.Millisecond}
+	start := time.Now()
+	store, err := openStorage(c, zap.NewNop())
+	if err == nil {
+		store.Close()
+		t.Fatal("storage opened without pd")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second || !strings.Contains(err.Error(), pd) {
+		t.Fatalf("failed after %s error %v", elapsed, err)
+	}
+}
@@ -0,0 +1,190 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/redis-force/less-state-hdfs/pkg/proxy/config"
+)
+
+const (
+	defaultLoadShedInitial   = 100
+	defaultLoadShedMin       = 10
+	defaultLoadShedMax       = 1000
+	defaultLoadShedTolerance = 2.0
+	defaultLoadShedWindow    = 200 * time.Millisecond
+	// the limit shrinks by it after a window with backoffs or slow transactions
+	loadShedDecrease = 0.9
+	// the limit only grows after windows using most of it
+	loadShedUtilization = 0.9
+	// the baseline latency is measured again after so many windows, tikv may have become faster or slower for good.
+	// It is reset to the lowest latency of those windows, a slow window at the end of them does not raise it
+	loadShedBaselineWindows = 100
+)
+
+// priorities of transactions, label values of loadShedCounter
+const (
+	priorityLow    = "low"
+	priorityNormal = "normal"
+	priorityHigh   = "high"
+)
+
+//priorityShares share of the limit the transactions of a priority may use, lower priorities are shed first
+var priorityShares = map[string]float64{
+	priorityLow:    0.5,
+	priorityNormal: 0.9,
+	priorityHigh:   1,
+}
+
+//lowPriorityOperations listings and summaries
+var lowPriorityOperations = map[string]bool{
+	"getINodeDirectoryChildren": true,
+	"getReplicationReport":      true,
+	"getWebhookDeadLetters":     true,
+	"fsck":                      true,
+	"events":                    true,
+}
+
+//highPriorityOperations creates and block allocations the namenode waits on
+var highPriorityOperations = map[string]bool{
+	"putINodeFile":           true,
+	"putINodeDirectoryChild": true,
+	"putINodeFileBlock":      true,
+}
+
+type txnPriorityKey struct{}
+
+//withTxnPriority run the transactions of a background job at the priority, they serve no route
+func withTxnPriority(ctx context.Context, priority string) context.Context {
+	return context.WithValue(ctx, txnPriorityKey{}, priority)
+}
+
+//txnPriority the priority of the background job or of the route the transaction serves, normal for neither
+func txnPriority(ctx context.Context) string {
+	if priority, ok := ctx.Value(txnPriorityKey{}).(string); ok {
+		return priority
+	}
+	scope, ok := ctx.Value(txnScopeKey{}).(*txnScope)
+	switch {
+	case !ok:
+		return priorityNormal
+	case lowPriorityOperations[scope.operation]:
+		return priorityLow
+	case highPriorityOperations[scope.operation]:
+		return priorityHigh
+	}
+	return priorityNormal
+}
+
+//loadShedder adaptive limit of the transactions run at once, AIMD on the latency and backoffs of every window:
+//the limit shrinks if transactions backed off or got slower than the tolerance allows, and grows by one if it was used up
+type loadShedder struct {
+	min       float64
+	max       float64
+	tolerance float64
+	window    time.Duration
+
+	mu       sync.Mutex
+	limit    float64
+	inflight int
+	// samples of the current window
+	windowStart time.Time
+	samples     int
+	latency     time.Duration
+	backoffs    int
+	peak        int
+	// lowest average latency of a window since the baseline was measured
+	baseline time.Duration
+	// lowest average latency of the windows since the baseline was last reset
+	periodMin time.Duration
+	windows   int
+}
+
+func newLoadShedder(c config.LoadShedConfig) (*loadShedder, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+	l := &loadShedder{
+		min:         float64(c.MinLimit),
+		max:         float64(c.MaxLimit),
+		limit:       float64(c.InitialLimit),
+		tolerance:   c.LatencyTolerance,
+		window:      c.Window,
+		windowStart: time.Now(),
+	}
+	if l.min <= 0 {
+		l.min = defaultLoadShedMin
+	}
+	if l.max <= 0 {
+		l.max = defaultLoadShedMax
+	}
+	if l.limit <= 0 {
+		l.limit = defaultLoadShedInitial
+	}
+	if l.tolerance <= 1 {
+		l.tolerance = defaultLoadShedTolerance
+	}
+	if l.window <= 0 {
+		l.window = defaultLoadShedWindow
+	}
+	if l.min > l.max || l.limit < l.min || l.limit > l.max {
+		return nil, fmt.Errorf("load shedding limit %v should be within %v and %v", l.limit, l.min, l.max)
+	}
+	loadShedLimitGauge.Set(l.limit)
+	return l, nil
+}
+
+//acquire a slot for a transaction of the priority, ErrOverloaded if its share of the limit is used up
+func (l *loadShedder) acquire(priority string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if float64(l.inflight) >= math.Max(1, l.limit*priorityShares[priority]) {
+		loadShedCounter.WithLabelValues(priority).Inc()
+		return ErrOverloaded
+	}
+	l.inflight++
+	if l.inflight > l.peak {
+		l.peak = l.inflight
+	}
+	return nil
+}
+
+//release the slot with the latency of the transaction and the backoffs it took, the limit is adjusted once a window
+func (l *loadShedder) release(latency time.Duration, backoffs int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inflight--
+	l.samples++
+	l.latency += latency
+	l.backoffs += backoffs
+	now := time.Now()
+	if now.Sub(l.windowStart) < l.window {
+		return
+	}
+	l.adjust()
+	l.windowStart, l.samples, l.latency, l.backoffs, l.peak = now, 0, 0, 0, l.inflight
+}
+
+func (l *loadShedder) adjust() {
+	avg := l.latency / time.Duration(l.samples)
+	switch {
+	case l.backoffs > 0 || (l.baseline > 0 && float64(avg) > float64(l.baseline)*l.tolerance):
+		l.limit = math.Max(l.min, l.limit*loadShedDecrease)
+	case float64(l.peak) >= l.limit*loadShedUtilization:
+		l.limit = math.Min(l.max, l.limit+1)
+	}
+	l.windows++
+	if l.periodMin == 0 || avg < l.periodMin {
+		l.periodMin = avg
+	}
+	if l.baseline == 0 || avg < l.baseline {
+		l.baseline = avg
+	}
+	if l.windows%loadShedBaselineWindows == 0 {
+		l.baseline, l.periodMin = l.periodMin, 0
+	}
+	loadShedLimitGauge.Set(l.limit)
+}
@@ -0,0 +1,62 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+//runWindow adjust the limit after a window of transactions of the latency
+func runWindow(l *loadShedder, latency time.Duration, backoffs, peak int) {
+	l.samples, l.latency, l.backoffs, l.peak = 1, latency, backoffs, peak
+	l.adjust()
+}
+
+func TestLoadShedderAdjust(t *testing.T) {
+	l := &loadShedder{min: 10, max: 100, limit: 50, tolerance: 2}
+	runWindow(l, 10*time.Millisecond, 0, 45)
+	if l.limit != 51 || l.baseline != 10*time.Millisecond {
+		t.Fatalf("used up window: limit %v baseline %s", l.limit, l.baseline)
+	}
+	runWindow(l, 10*time.Millisecond, 1, 0)
+	if l.limit != 51*loadShedDecrease {
+		t.Fatalf("window with backoffs: limit %v", l.limit)
+	}
+	limit := l.limit
+	runWindow(l, 30*time.Millisecond, 0, 0)
+	if l.limit != limit*loadShedDecrease {
+		t.Fatalf("slow window: limit %v", l.limit)
+	}
+	for l.windows < loadShedBaselineWindows-1 {
+		runWindow(l, 30*time.Millisecond, 0, 0)
+	}
+	l.limit = 50
+	runWindow(l, 90*time.Millisecond, 0, 0)
+	if l.baseline != 10*time.Millisecond {
+		t.Fatalf("baseline after the first period %s", l.baseline)
+	}
+	// tikv became slower for good, the next period measures the new baseline
+	for l.windows < 2*loadShedBaselineWindows-1 {
+		runWindow(l, 30*time.Millisecond, 0, 0)
+	}
+	runWindow(l, 90*time.Millisecond, 0, 0)
+	if l.baseline != 30*time.Millisecond {
+		t.Fatalf("baseline after a slow last window %s, want the lowest of the period", l.baseline)
+	}
+	if l.limit < l.min {
+		t.Fatalf("limit %v below its min", l.limit)
+	}
+}
+
+func TestTxnPriority(t *testing.T) {
+	ctx := context.Background()
+	for want, ctx := range map[string]context.Context{
+		priorityNormal: ctx,
+		priorityLow:    withTxnPriority(ctx, priorityLow),
+		priorityHigh:   context.WithValue(ctx, txnScopeKey{}, &txnScope{operation: "putINodeFile"}),
+	} {
+		if got := txnPriority(ctx); got != want {
+			t.Errorf("priority %s, want %s", got, want)
+		}
+	}
+}
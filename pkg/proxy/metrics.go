@@ -0,0 +1,180 @@
+package proxy
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pingcap/tidb/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const metricsNamespace = "hdfs_proxy"
+
+// scan label values of kvScanKeys
+const (
+	scanListDirectory = "list_directory"
+	scanINodeBlocks   = "inode_blocks"
+)
+
+var (
+	apiRequestCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "api",
+			Name:      "requests_total",
+			Help:      "Counter of api requests by route, method and status code.",
+		}, []string{"route", "method", "code"})
+
+	apiRequestDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "api",
+			Name:      "request_duration_seconds",
+			Help:      "Bucketed histogram of api request latency by route and method.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 18), // 0.5ms ~ 65s
+		}, []string{"route", "method"})
+
+	apiTSOWaitDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "api",
+			Name:      "tso_wait_duration_seconds",
+			Help:      "Bucketed histogram of the time the tso route waits for pd timestamps.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 16), // 0.1ms ~ 3.2s
+		})
+
+	txnBeginDuration = prometheus.NewHistogram(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "txn",
+			Name:      "begin_duration_seconds",
+			Help:      "Bucketed histogram of the time to begin a transaction.",
+			Buckets:   prometheus.ExponentialBuckets(0.0001, 2, 16), // 0.1ms ~ 3.2s
+		})
+
+	txnCommitDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "txn",
+			Name:      "commit_duration_seconds",
+			Help:      "Bucketed histogram of the time to commit a transaction by result, ok, conflict or error.",
+			Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 18), // 0.5ms ~ 65s
+		}, []string{"result"})
+
+	txnConflictCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "txn",
+			Name:      "commit_conflicts_total",
+			Help:      "Counter of commits failed with a retryable error like a write conflict.",
+		})
+
+	txnRetryCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "txn",
+			Name:      "retries_total",
+			Help:      "Counter of transactions run again by reason, write_conflict, region, lock_not_found or other.",
+		}, []string{"reason"})
+
+	txnRetryExhaustedCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "txn",
+			Name:      "retries_exhausted_total",
+			Help:      "Counter of transactions failed with a retryable error after using up the retry budget.",
+		})
+
+	txnInflightGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "txn",
+			Name:      "inflight",
+			Help:      "Gauge of the transactions not committed or rolled back yet.",
+		})
+
+	txnTimeoutCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "txn",
+			Name:      "timeouts_total",
+			Help:      "Counter of transactions rolled back since their request ran past its deadline.",
+		})
+
+	retryCacheCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "api",
+			Name:      "retry_cache_total",
+			Help:      "Counter of requests with a request id by result, hit if answered from the retry cache or miss.",
+		}, []string{"result"})
+
+	rateLimitRejectedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "api",
+			Name:      "rate_limited_total",
+			Help:      "Counter of requests rejected with 429 by class, read, write, expensive or concurrency.",
+		}, []string{"class"})
+
+	loadShedLimitGauge = prometheus.NewGauge(
+		prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "txn",
+			Name:      "concurrency_limit",
+			Help:      "Gauge of the adaptive limit of the transactions run at once.",
+		})
+
+	loadShedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "txn",
+			Name:      "shed_total",
+			Help:      "Counter of transactions rejected by the adaptive limit by priority, low, normal or high.",
+		}, []string{"priority"})
+
+	kvScanKeys = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Namespace: metricsNamespace,
+			Subsystem: "kv",
+			Name:      "scan_keys",
+			Help:      "Bucketed histogram of the keys read by a scan.",
+			Buckets:   prometheus.ExponentialBuckets(1, 4, 10), // 1 ~ 262144
+		}, []string{"scan"})
+)
+
+func init() {
+	prometheus.MustRegister(apiRequestCounter)
+	prometheus.MustRegister(apiRequestDuration)
+	prometheus.MustRegister(apiTSOWaitDuration)
+	prometheus.MustRegister(txnBeginDuration)
+	prometheus.MustRegister(txnCommitDuration)
+	prometheus.MustRegister(txnConflictCounter)
+	prometheus.MustRegister(txnRetryCounter)
+	prometheus.MustRegister(txnRetryExhaustedCounter)
+	prometheus.MustRegister(txnInflightGauge)
+	prometheus.MustRegister(txnTimeoutCounter)
+	prometheus.MustRegister(retryCacheCounter)
+	prometheus.MustRegister(rateLimitRejectedCounter)
+	prometheus.MustRegister(loadShedLimitGauge)
+	prometheus.MustRegister(loadShedCounter)
+	prometheus.MustRegister(kvScanKeys)
+	// metrics of the tikv client, the backoff counter counts its retries
+	prometheus.MustRegister(metrics.TiKVTxnCmdHistogram)
+	prometheus.MustRegister(metrics.TiKVBackoffCounter)
+	prometheus.MustRegister(metrics.TiKVBackoffHistogram)
+	prometheus.MustRegister(metrics.TiKVSendReqHistogram)
+	prometheus.MustRegister(metrics.TiKVLockResolverCounter)
+	prometheus.MustRegister(metrics.TiKVRegionErrorCounter)
+	prometheus.MustRegister(metrics.TSFutureWaitDuration)
+}
+
+//metricsMiddleware count and time every request by the handler serving it
+func metricsMiddleware(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+	route := auditOperation(c)
+	apiRequestCounter.WithLabelValues(route, c.Request.Method, strconv.Itoa(c.Writer.Status())).Inc()
+	apiRequestDuration.WithLabelValues(route, c.Request.Method).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,110 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pingcap/tidb/kv"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+)
+
+func writeMetric(t *testing.T, m prometheus.Metric) *dto.Metric {
+	t.Helper()
+	out := new(dto.Metric)
+	if err := m.Write(out); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func histogramCount(t *testing.T, o prometheus.Observer) uint64 {
+	t.Helper()
+	return writeMetric(t, o.(prometheus.Metric)).GetHistogram().GetSampleCount()
+}
+
+func histogramSum(t *testing.T, o prometheus.Observer) float64 {
+	t.Helper()
+	return writeMetric(t, o.(prometheus.Metric)).GetHistogram().GetSampleSum()
+}
+
+func counterValue(t *testing.T, c prometheus.Counter) float64 {
+	t.Helper()
+	return writeMetric(t, c).GetCounter().GetValue()
+}
+
+func TestTxnMetrics(t *testing.T) {
+	s := newTestProxy()
+	begins := histogramCount(t, txnBeginDuration)
+	commits := histogramCount(t, txnCommitDuration.WithLabelValues("ok"))
+	conflictCommits := histogramCount(t, txnCommitDuration.WithLabelValues("conflict"))
+	conflicts := counterValue(t, txnConflictCounter)
+	retries := counterValue(t, txnRetryCounter.WithLabelValues(retryWriteConflict))
+	exhausted := counterValue(t, txnRetryExhaustedCounter)
+
+	s.store.(*memStore).conflicts = 2
+	mustRunTxn(t, s, func(tx kv.Transaction) error {
+		return tx.Set(generateINodeKey(1), []byte{1})
+	})
+	if n := histogramCount(t, txnBeginDuration) - begins; n != 3 {
+		t.Errorf("%d begins observed, want 3", n)
+	}
+	if n := histogramCount(t, txnCommitDuration.WithLabelValues("ok")) - commits; n != 1 {
+		t.Errorf("%d ok commits observed, want 1", n)
+	}
+	if n := histogramCount(t, txnCommitDuration.WithLabelValues("conflict")) - conflictCommits; n != 2 {
+		t.Errorf("%d conflicting commits observed, want 2", n)
+	}
+	if n := counterValue(t, txnConflictCounter) - conflicts; n != 2 {
+		t.Errorf("%v conflicts counted, want 2", n)
+	}
+	if n := counterValue(t, txnRetryCounter.WithLabelValues(retryWriteConflict)) - retries; n != 2 {
+		t.Errorf("%v retries counted, want 2", n)
+	}
+
+	s.config.TxnRetry.Attempts = 2
+	s.store.(*memStore).conflicts = 2
+	err := s.runTxn(context.Background(), func(tx kv.Transaction) error {
+		return tx.Set(generateINodeKey(1), []byte{2})
+	})
+	if !kv.IsRetryableError(err) {
+		t.Fatalf("exhausted retries error %v", err)
+	}
+	if n := counterValue(t, txnRetryExhaustedCounter) - exhausted; n != 1 {
+		t.Errorf("%v exhausted transactions counted, want 1", n)
+	}
+}
+
+func TestScanMetrics(t *testing.T) {
+	s := newTestProxy()
+	mustRunTxn(t, s, func(tx kv.Transaction) error {
+		mustSet(t, tx, generateINodeKey(1), testINode(1, 0, "", inodeDirectoryType))
+		for i, name := range []string{"a", "b", "c"} {
+			id := int64(10 + i)
+			mustSet(t, tx, generateINodeKey(id), testINode(id, 1, name, inodeFileType))
+			mustSet(t, tx, generateINodeDirectoryChildKey(1, name), &pb.INodeID{Id: &id})
+		}
+		return nil
+	})
+	list := kvScanKeys.WithLabelValues(scanListDirectory)
+	count, sum := histogramCount(t, list), histogramSum(t, list)
+	if _, err := s.GetINodeDirectoryChildren(context.Background(), 1, true); err != nil {
+		t.Fatal(err)
+	}
+	if n := histogramCount(t, list) - count; n != 1 {
+		t.Errorf("%d directory scans observed, want 1", n)
+	}
+	if keys := histogramSum(t, list) - sum; keys != 3 {
+		t.Errorf("directory scan of %v keys observed, want 3", keys)
+	}
+	blocks := kvScanKeys.WithLabelValues(scanINodeBlocks)
+	count = histogramCount(t, blocks)
+	mustRunTxn(t, s, func(tx kv.Transaction) error {
+		_, err := s.scanINodeBlocks(context.Background(), tx, 10)
+		return err
+	})
+	if n := histogramCount(t, blocks) - count; n != 1 {
+		t.Errorf("%d block scans observed, want 1", n)
+	}
+}
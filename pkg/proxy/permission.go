@@ -0,0 +1,463 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/protobuf/proto"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pingcap/tidb/kv"
+	"github.com/redis-force/less-state-hdfs/pkg/model"
+	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+	"github.com/redis-force/less-state-hdfs/pkg/proxy/config"
+)
+
+const (
+	// hdfsGroupsHeader comma separated groups of the hdfs user the namenode acts for
+	hdfsGroupsHeader = "X-HDFS-Groups"
+	// accessControlException java exception the namenode rethrows for a 403
+	accessControlException = "AccessControlException"
+
+	stickyBit = 01000
+)
+
+//fsAction hdfs FsAction, the rwx bits of one class of the mode
+type fsAction int64
+
+const (
+	actionNone    fsAction = 0
+	actionExecute fsAction = 1
+	actionWrite   fsAction = 2
+	actionRead    fsAction = 4
+
+	actionWriteExecute = actionWrite | actionExecute
+	actionReadExecute  = actionRead | actionExecute
+	actionAll          = actionRead | actionWrite | actionExecute
+)
+
+var fsActionNames = [...]string{"NONE", "EXECUTE", "WRITE", "WRITE_EXECUTE", "READ", "READ_EXECUTE", "READ_WRITE", "ALL"}
+
+func (a fsAction) String() string {
+	return fsActionNames[a&actionAll]
+}
+
+//PermissionError access denied by the hdfs permission checker, served as 403
+type PermissionError struct {
+	User string
+	msg  string
+}
+
+func (e *PermissionError) Error() string {
+	return e.msg
+}
+
+//caller hdfs user and groups the request acts for
+type caller struct {
+	user   string
+	groups map[string]bool
+}
+
+func (u *caller) groupList() []string {
+	ret := make([]string, 0, len(u.groups))
+	for g := range u.groups {
+		ret = append(ret, g)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+//permissionChecker resolve callers and enforce hdfs mode bits with the semantics of FSPermissionChecker
+type permissionChecker struct {
+	// mode bits are only checked if enabled, callers are resolved for the authorizer anyway
+	enabled    bool
+	superUser  string
+	superGroup string
+	proxyUsers map[string]bool
+	groups     map[string][]string
+}
+
+func newPermissionChecker(c config.PermissionConfig) *permissionChecker {
+	p := &permissionChecker{
+		enabled:    c.Enabled,
+		superUser:  c.SuperUser,
+		superGroup: c.SuperGroup,
+		proxyUsers: make(map[string]bool),
+		groups:     c.Groups,
+	}
+	if len(p.superUser) == 0 {
+		p.superUser = config.DefaultSuperUser
+	}
+	if len(p.superGroup) == 0 {
+		p.superGroup = config.DefaultSuperGroup
+	}
+	for _, u := range c.ProxyUsers {
+		p.proxyUsers[u] = true
+	}
+	return p
+}
+
+//caller resolve the user of the request, authenticated proxy users may act for the user of the headers
+func (p *permissionChecker) caller(c *gin.Context) *caller {
+	principal := c.GetString(principalKey)
+	ret := &caller{user: principal, groups: make(map[string]bool)}
+	if user := c.GetHeader(hdfsUserHeader); len(user) > 0 && len(principal) > 0 && p.proxyUsers[principal] {
+		ret.user = user
+		for _, g := range strings.Split(c.GetHeader(hdfsGroupsHeader), ",") {
+			if g = strings.TrimSpace(g); len(g) > 0 {
+				ret.groups[g] = true
+			}
+		}
+		return ret
+	}
+	for _, g := range p.groups[ret.user] {
+		ret.groups[g] = true
+	}
+	return ret
+}
+
+func (p *permissionChecker) isSuperUser(u *caller) bool {
+	return u.user == p.superUser || u.groups[p.superGroup]
+}
+
+//permissionRequest access needed on an inode, EXECUTE is always needed on all of its ancestors
+type permissionRequest struct {
+	id int64
+	// the request targets the file owning the block instead of id
+	block int64
+	// the request targets the child of id with the name, id itself if empty
+	child string
+	// the request creates a child of id, so id is traversed too
+	create bool
+	// name of the created child, only used to authorize its path
+	name   string
+	access fsAction
+	// access on the parent of the target
+	parentAccess fsAction
+	// access on every directory of the target subtree
+	subAccess fsAction
+	// the sticky bit of the parent only lets the owners of the parent and the target through
+	sticky    bool
+	owner     bool
+	superuser bool
+}
+
+//authorizationAccess name the access the request needs for the authorizer
+func (req permissionRequest) authorizationAccess() string {
+	access := req.access | req.parentAccess | req.subAccess
+	switch {
+	case req.superuser:
+		return AccessAdmin
+	case req.create || access&actionWrite != 0:
+		return AccessWrite
+	case access&actionRead != 0:
+		return AccessRead
+	}
+	return AccessExecute
+}
+
+//transCheckPermission check the request for the caller if enforced, return the target inode and its path.
+//Requests without an inode have no path.
+func (s *Proxy) transCheckPermission(ctx context.Context, tx kv.Transaction, p *permissionChecker, u *caller, req permissionRequest) (*pb.INodeMeta, string, error) {
+	if req.superuser {
+		if !p.enabled || p.isSuperUser(u) {
+			return nil, "", nil
+		}
+		return nil, "", &PermissionError{User: u.user, msg: fmt.Sprintf("Access denied for user %s. Superuser privilege is required", u.user)}
+	}
+	if req.block != 0 {
+		bm := new(pb.BlockMeta)
+		err := s.transGet(ctx, tx, generateBlockMetaKey(req.block), bm)
+		if err != nil && !kv.ErrNotExist.Equal(err) {
+			return nil, "", err
+		}
+		if err == nil && bm.GetCollectionId() == 0 {
+			// a block of no file is only managed by the superuser
+			return s.transCheckPermission(ctx, tx, p, u, permissionRequest{superuser: true})
+		}
+		// nothing to protect if the block does not exist
+		req.id = bm.GetCollectionId()
+	}
+	if req.id == 0 {
+		return nil, "", nil
+	}
+	id := req.id
+	if len(req.child) > 0 {
+		child := new(pb.INodeID)
+		err := s.transGet(ctx, tx, generateINodeDirectoryChildKey(id, req.child), child)
+		if err != nil && !kv.ErrNotExist.Equal(err) {
+			return nil, "", err
+		}
+		if err != nil {
+			// nothing to protect, only the parent is checked
+			req = permissionRequest{id: id, create: true, name: req.child, access: req.parentAccess}
+		} else {
+			id = child.GetId()
+		}
+	}
+	// root first
+	chain := make([]*pb.INodeMeta, 0)
+	for next := id; next != 0; {
+		m := new(pb.INodeMeta)
+		if err := s.transGet(ctx, tx, generateINodeKey(next), m); err != nil {
+			return nil, "", err
+		}
+		chain = append([]*pb.INodeMeta{m}, chain...)
+		if len(chain) > maxINodePathDepth {
+			return nil, "", fmt.Errorf("inode %d path is too deep", id)
+		}
+		next = m.GetParentId()
+	}
+	if len(chain) == 0 {
+		return nil, "", kv.ErrNotExist
+	}
+	target := chain[len(chain)-1]
+	path := func(i int) string {
+		names := make([]string, 0, i)
+		for _, m := range chain[1 : i+1] {
+			names = append(names, m.GetName())
+		}
+		return "/" + strings.Join(names, "/")
+	}
+	targetPath := path(len(chain) - 1)
+	if req.create && len(req.name) > 0 {
+		targetPath = strings.TrimSuffix(targetPath, "/") + "/" + req.name
+	}
+	if !p.enabled || p.isSuperUser(u) {
+		return target, targetPath, nil
+	}
+	ancestors := len(chain) - 1
+	if req.create {
+		ancestors++
+	}
+	for i := 0; i < ancestors; i++ {
+		if err := checkMode(u, chain[i], path(i), actionExecute); err != nil {
+			return nil, "", err
+		}
+	}
+	if len(chain) > 1 {
+		parent := chain[len(chain)-2]
+		if req.parentAccess != actionNone {
+			if err := checkMode(u, parent, path(len(chain)-2), req.parentAccess); err != nil {
+				return nil, "", err
+			}
+		}
+		if req.sticky && parent.GetPermission()&stickyBit != 0 && parent.GetOwner() != u.user && target.GetOwner() != u.user {
+			return nil, "", &PermissionError{User: u.user, msg: fmt.Sprintf("Permission denied by sticky bit: user=%s, path=%q:%s:%s:%s, parent=%q:%s:%s:%s",
+				u.user, path(len(chain)-1), target.GetOwner(), target.GetGroup(), formatMode(target),
+				path(len(chain)-2), parent.GetOwner(), parent.GetGroup(), formatMode(parent))}
+		}
+	}
+	if req.owner && target.GetOwner() != u.user {
+		return nil, "", &PermissionError{User: u.user, msg: fmt.Sprintf("Permission denied. user=%s is not the owner of inode=%s", u.user, path(len(chain)-1))}
+	}
+	if req.access != actionNone {
+		if err := checkMode(u, target, path(len(chain)-1), req.access); err != nil {
+			return nil, "", err
+		}
+	}
+	if req.subAccess != actionNone && target.GetType() == inodeDirectoryType {
+		if err := s.transCheckSubAccess(ctx, tx, u, target, path(len(chain)-1), req.subAccess); err != nil {
+			return nil, "", err
+		}
+	}
+	return target, targetPath, nil
+}
+
+//transCheckSubAccess check the access on every non empty directory of the subtree
+func (s *Proxy) transCheckSubAccess(ctx context.Context, tx kv.Transaction, u *caller, dir *pb.INodeMeta, path string, access fsAction) error {
+	children, err := s.listINodeDirectory(ctx, tx, dir.GetId(), false)
+	if err != nil {
+		return err
+	}
+	if len(children) == 0 {
+		return nil
+	}
+	if err = checkMode(u, dir, path, access); err != nil {
+		return err
+	}
+	for _, child := range children {
+		if child.Type != inodeDirectoryType {
+			continue
+		}
+		m := new(pb.INodeMeta)
+		if err = s.transGet(ctx, tx, generateINodeKey(child.ID), m); err != nil {
+			return err
+		}
+		if err = s.transCheckSubAccess(ctx, tx, u, m, strings.TrimSuffix(path, "/")+"/"+child.Name, access); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//checkMode check the class of the mode the caller belongs to, owner then group then other
+func checkMode(u *caller, m *pb.INodeMeta, path string, access fsAction) error {
+	mode := fsAction(permissionMode(m.GetPermission()))
+	switch {
+	case len(u.user) > 0 && m.GetOwner() == u.user:
+		mode >>= 6
+	case u.groups[m.GetGroup()]:
+		mode >>= 3
+	}
+	if mode&access == access {
+		return nil
+	}
+	return &PermissionError{User: u.user, msg: fmt.Sprintf("Permission denied: user=%s, access=%s, inode=%q:%s:%s:%s",
+		u.user, access, path, m.GetOwner(), m.GetGroup(), formatMode(m))}
+}
+
+//formatMode print the mode like ls, e.g. drwxr-xr-t
+func formatMode(m *pb.INodeMeta) string {
+	mode := permissionMode(m.GetPermission())
+	b := []byte("-rwxrwxrwx")
+	if m.GetType() == inodeDirectoryType {
+		b[0] = 'd'
+	}
+	for i := uint(0); i < 9; i++ {
+		if mode&(1<<(8-i)) == 0 {
+			b[i+1] = '-'
+		}
+	}
+	if mode&stickyBit != 0 {
+		if b[9] == 'x' {
+			b[9] = 't'
+		} else {
+			b[9] = 'T'
+		}
+	}
+	return string(b)
+}
+
+type permissionKey struct{}
+
+//permissionScope the requests a mutating request was allowed by, checked again in its transactions
+type permissionScope struct {
+	caller    *caller
+	operation string
+	reqs      []permissionRequest
+	// a transaction of the request wrote after checking them
+	committed bool
+}
+
+func permissionScopeFromContext(ctx context.Context) *permissionScope {
+	scope, _ := ctx.Value(permissionKey{}).(*permissionScope)
+	return scope
+}
+
+//CheckPermission check the mode bits and ask the authorizer for the requests of the operation in one snapshot,
+//return the target inode of the first one
+func (s *Proxy) CheckPermission(ctx context.Context, u *caller, operation string, reqs ...permissionRequest) (*pb.INodeMeta, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.CheckPermission")
+	defer span.Finish()
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	ret, _, err := s.transCheckPermissions(ctx, tx, u, operation, reqs)
+	return ret, err
+}
+
+//transCheckPermissions check the requests at the snapshot of the transaction, return the target inode of the first one
+//and the keys of the inodes they were allowed by: the targets and the parents whose access or sticky bit is checked
+func (s *Proxy) transCheckPermissions(ctx context.Context, tx kv.Transaction, u *caller, operation string, reqs []permissionRequest) (*pb.INodeMeta, []kv.Key, error) {
+	// the last check decides, its policies are the audited ones
+	resetAuthorization(ctx)
+	var ret *pb.INodeMeta
+	var keys []kv.Key
+	for i, req := range reqs {
+		m, path, err := s.transCheckPermission(ctx, tx, s.permission, u, req)
+		if err != nil {
+			return nil, nil, err
+		}
+		if s.authorizer != nil {
+			if err = s.authorize(ctx, u, operation, path, req.authorizationAccess()); err != nil {
+				return nil, nil, err
+			}
+		}
+		if req.block != 0 {
+			keys = append(keys, generateBlockMetaKey(req.block))
+		}
+		if m != nil {
+			keys = append(keys, generateINodeKey(m.GetId()))
+			if (req.parentAccess != actionNone || req.sticky) && m.GetParentId() != 0 {
+				keys = append(keys, generateINodeKey(m.GetParentId()))
+			}
+		}
+		if i == 0 {
+			ret = m
+		}
+	}
+	return ret, keys, nil
+}
+
+//transCheckPermissionScope check the requests of the mutating request again in its transaction, before it reads
+//or writes anything else. The returned keys are to be locked if it writes, so a concurrent change of the inodes
+//it was allowed by conflicts with its commit
+func (s *Proxy) transCheckPermissionScope(ctx context.Context, tx kv.Transaction) ([]kv.Key, error) {
+	scope := permissionScopeFromContext(ctx)
+	if scope == nil || scope.committed {
+		return nil, nil
+	}
+	_, keys, err := s.transCheckPermissions(ctx, tx, scope.caller, scope.operation, scope.reqs)
+	return keys, err
+}
+
+//checkPermission enforce the requests, respond and return false if they are denied.
+//Every route calls it, requests without an inode are only seen by the authorizer.
+//The transactions of a mutating request check them again until one of them writes.
+//The target inode of the first request is returned, nil if nothing is enforced.
+func (s *apiServer) checkPermission(c *gin.Context, reqs ...permissionRequest) (*pb.INodeMeta, bool) {
+	p := s.proxy.permission
+	if !p.enabled && s.proxy.authorizer == nil {
+		return nil, true
+	}
+	u, operation := p.caller(c), auditOperation(c)
+	m, err := s.proxy.CheckPermission(c.Request.Context(), u, operation, reqs...)
+	if err == nil {
+		if c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead {
+			if scope := permissionScopeFromContext(c.Request.Context()); scope != nil {
+				scope.reqs = append(scope.reqs, reqs...)
+			} else {
+				scope = &permissionScope{caller: u, operation: operation, reqs: reqs}
+				c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), permissionKey{}, scope))
+			}
+		}
+		return m, true
+	}
+	if pe, ok := err.(*PermissionError); ok {
+		c.AbortWithStatusJSON(http.StatusForbidden, model.APIResponse{Code: http.StatusForbidden, Error: pe.Error(), Exception: accessControlException})
+		return nil, false
+	}
+	if kv.ErrNotExist.Equal(err) {
+		apiResponseError(c, http.StatusNotFound, err)
+		return nil, false
+	}
+	apiResponseError(c, http.StatusInternalServerError, err)
+	return nil, false
+}
+
+//checkCreate check the caller may create in the parent, the new inode is owned by the caller
+//and inherit the group of the parent unless they are given
+func (s *apiServer) checkCreate(c *gin.Context, parentID int64, m *pb.INodeMeta) bool {
+	req := permissionRequest{id: parentID, create: true, name: m.GetName(), access: actionWrite}
+	if parentID <= 0 {
+		// only the superuser creates the root
+		req = permissionRequest{superuser: true}
+	}
+	parent, ok := s.checkPermission(c, req)
+	if !ok || !s.proxy.permission.enabled {
+		return ok
+	}
+	if len(m.GetOwner()) == 0 {
+		m.Owner = proto.String(s.proxy.permission.caller(c).user)
+	}
+	if len(m.GetGroup()) == 0 && parent != nil && parentID > 0 {
+		m.Group = proto.String(parent.GetGroup())
+	}
+	return true
+}
@@ -0,0 +1,114 @@
+package proxy
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/protobuf/proto"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/kv"
+	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+	"github.com/redis-force/less-state-hdfs/pkg/proxy/config"
+)
+
+func TestCallerTrustsProxyUsersOnly(t *testing.T) {
+	p := newPermissionChecker(config.PermissionConfig{ProxyUsers: []string{"namenode"}, Groups: map[string][]string{"bob": {"staff"}}})
+	for _, tc := range []struct {
+		principal string
+		user      string
+		group     bool
+	}{
+		{principal: "namenode", user: "alice", group: true},
+		{principal: "bob", user: "bob"},
+		{principal: "", user: ""},
+	} {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest("GET", "/", nil)
+		c.Request.Header.Set(hdfsUserHeader, "alice")
+		c.Request.Header.Set(hdfsGroupsHeader, "admins")
+		if len(tc.principal) > 0 {
+			c.Set(principalKey, tc.principal)
+		}
+		u := p.caller(c)
+		if u.user != tc.user || u.groups["admins"] != tc.group {
+			t.Errorf("principal %q acts for %q groups %v", tc.principal, u.user, u.groupList())
+		}
+	}
+}
+
+func TestPermissionCheckedInTxn(t *testing.T) {
+	s := newTestProxy()
+	s.permission = newPermissionChecker(config.PermissionConfig{Enabled: true})
+	root := testINode(1, 0, "", inodeDirectoryType)
+	root.Owner = proto.String("hdfs")
+	dir := testINode(2, 1, "d", inodeDirectoryType)
+	dir.Owner, dir.Permission = proto.String("alice"), proto.Int64(0755)
+	mustRunTxn(t, s, func(tx kv.Transaction) error {
+		mustSet(t, tx, generateINodeKey(1), root)
+		mustSet(t, tx, generateINodeKey(2), dir)
+		return nil
+	})
+	u := &caller{user: "alice", groups: map[string]bool{}}
+	req := permissionRequest{id: 2, create: true, name: "f", access: actionWriteExecute}
+	if _, err := s.CheckPermission(context.Background(), u, "create", req); err != nil {
+		t.Fatal(err)
+	}
+	scope := &permissionScope{caller: u, operation: "create", reqs: []permissionRequest{req}}
+	ctx := context.WithValue(context.Background(), permissionKey{}, scope)
+	// the directory changes hands between the check of the handler and its transaction
+	dir.Owner = proto.String("bob")
+	mustRunTxn(t, s, func(tx kv.Transaction) error {
+		mustSet(t, tx, generateINodeKey(2), dir)
+		return nil
+	})
+	err := s.runTxn(ctx, func(tx kv.Transaction) error {
+		mustSet(t, tx, generateINodeKey(3), testINode(3, 2, "f", inodeFileType))
+		return nil
+	})
+	if _, ok := errors.Cause(err).(*PermissionError); !ok {
+		t.Fatalf("revoked write committed, error %v", err)
+	}
+	if scope.committed {
+		t.Fatal("denied transaction marked committed")
+	}
+	if got := s.store.(*memStore).keys(string(generateINodeKey(3))); len(got) != 0 {
+		t.Fatalf("denied write stored %q", got)
+	}
+}
+
+func TestBlockPermissionChecksOwningFile(t *testing.T) {
+	s := newTestProxy()
+	s.permission = newPermissionChecker(config.PermissionConfig{Enabled: true})
+	file := testINode(2, 1, "f", inodeFileType)
+	file.Owner, file.Permission = proto.String("alice"), proto.Int64(0600)
+	mustRunTxn(t, s, func(tx kv.Transaction) error {
+		mustSet(t, tx, generateINodeKey(1), testINode(1, 0, "", inodeDirectoryType))
+		mustSet(t, tx, generateINodeKey(2), file)
+		mustSet(t, tx, generateBlockMetaKey(7), &pb.BlockMeta{Id: proto.Int64(7), CollectionId: proto.Int64(2)})
+		mustSet(t, tx, generateBlockMetaKey(8), &pb.BlockMeta{Id: proto.Int64(8)})
+		return nil
+	})
+	ctx := context.Background()
+	for _, tc := range []struct {
+		user  string
+		block int64
+		ok    bool
+	}{
+		{user: "alice", block: 7, ok: true},
+		{user: "bob", block: 7},
+		{user: "alice", block: 8},
+		{user: "hdfs", block: 8, ok: true},
+		{user: "bob", block: 9, ok: true},
+	} {
+		u := &caller{user: tc.user, groups: map[string]bool{}}
+		m, err := s.CheckPermission(ctx, u, "putBlock", permissionRequest{block: tc.block, access: actionWrite})
+		if (err == nil) != tc.ok {
+			t.Errorf("%s writes block %d error %v", tc.user, tc.block, err)
+		}
+		if err == nil && tc.block == 7 && m.GetId() != 2 {
+			t.Errorf("block 7 resolved to inode %d", m.GetId())
+		}
+	}
+}
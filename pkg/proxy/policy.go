@@ -0,0 +1,210 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	policyAllow = "allow"
+	policyDeny  = "deny"
+	// matches every user, operation or access
+	policyAny = "*"
+)
+
+//policyFile yaml policy file of the built-in authorizer, deny policies win over allow policies
+type policyFile struct {
+	// effect when no policy matches, allow or deny
+	Default  string   `yaml:"default"`
+	Policies []policy `yaml:"policies"`
+}
+
+//policy allow or deny the users and groups the accesses on the paths.
+//A path segment may be a glob, a recursive path also matches everything below it.
+//Policies without paths match every route, operations restrict them to some handlers, e.g. fsck.
+type policy struct {
+	ID         string   `yaml:"id"`
+	Effect     string   `yaml:"effect"`
+	Paths      []string `yaml:"paths"`
+	Recursive  bool     `yaml:"recursive"`
+	Users      []string `yaml:"users"`
+	Groups     []string `yaml:"groups"`
+	Accesses   []string `yaml:"accesses"`
+	Operations []string `yaml:"operations"`
+}
+
+func (p *policy) validate() error {
+	if len(p.ID) == 0 {
+		return fmt.Errorf("policy without id")
+	}
+	if p.Effect != policyAllow && p.Effect != policyDeny {
+		return fmt.Errorf("policy %s effect should be %s or %s", p.ID, policyAllow, policyDeny)
+	}
+	if len(p.Users) == 0 && len(p.Groups) == 0 {
+		return fmt.Errorf("policy %s should have users or groups, %q for everyone", p.ID, policyAny)
+	}
+	for _, pattern := range p.Paths {
+		if !strings.HasPrefix(pattern, "/") {
+			return fmt.Errorf("policy %s path %q should be absolute", p.ID, pattern)
+		}
+		if _, err := path.Match(pattern, "/"); err != nil {
+			return fmt.Errorf("policy %s path %q: %s", p.ID, pattern, err)
+		}
+	}
+	for _, a := range p.Accesses {
+		switch a {
+		case AccessRead, AccessWrite, AccessExecute, AccessAdmin, policyAny:
+		default:
+			return fmt.Errorf("policy %s unknown access %q", p.ID, a)
+		}
+	}
+	return nil
+}
+
+func (p *policy) match(req *AuthorizationRequest) bool {
+	if !matchAny(p.Accesses, req.Access) || !matchAny(p.Operations, req.Operation) {
+		return false
+	}
+	if !containsAny(p.Users, req.User) && !p.matchGroups(req.Groups) {
+		return false
+	}
+	if len(p.Paths) == 0 {
+		return true
+	}
+	for _, pattern := range p.Paths {
+		if p.matchPath(pattern, req.Path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *policy) matchGroups(groups []string) bool {
+	for _, g := range groups {
+		if containsAny(p.Groups, g) {
+			return true
+		}
+	}
+	return false
+}
+
+//matchPath match the path, or with recursive its ancestor, segment by segment
+func (p *policy) matchPath(pattern, name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+	if pattern == "/" {
+		return name == "/" || p.Recursive
+	}
+	patterns := strings.Split(strings.TrimSuffix(pattern, "/"), "/")
+	names := strings.Split(strings.TrimSuffix(name, "/"), "/")
+	if len(names) < len(patterns) || (!p.Recursive && len(names) != len(patterns)) {
+		return false
+	}
+	for i, seg := range patterns {
+		if ok, _ := path.Match(seg, names[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+//matchAny empty values match everything
+func matchAny(values []string, v string) bool {
+	return len(values) == 0 || containsAny(values, v)
+}
+
+func containsAny(values []string, v string) bool {
+	for _, value := range values {
+		if value == v || value == policyAny {
+			return true
+		}
+	}
+	return false
+}
+
+//policyAuthorizer built-in authorizer evaluating a yaml policy file, reloaded when the file changes
+type policyAuthorizer struct {
+	file   string
+	logger *zap.Logger
+
+	mu     sync.RWMutex
+	policy *policyFile
+}
+
+func newPolicyAuthorizer(file string, logger *zap.Logger) (*policyAuthorizer, error) {
+	a := &policyAuthorizer{file: file, logger: logger}
+	if err := a.reload(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+//reload parse the file again, the old policies are kept on error
+func (a *policyAuthorizer) reload() error {
+	data, err := ioutil.ReadFile(a.file)
+	if err != nil {
+		return err
+	}
+	f := new(policyFile)
+	if err = yaml.UnmarshalStrict(data, f); err != nil {
+		return fmt.Errorf("parse policy file %s error %s", a.file, err)
+	}
+	if len(f.Default) == 0 {
+		f.Default = policyDeny
+	}
+	if f.Default != policyAllow && f.Default != policyDeny {
+		return fmt.Errorf("policy file default should be %s or %s", policyAllow, policyDeny)
+	}
+	ids := make(map[string]bool, len(f.Policies))
+	for i := range f.Policies {
+		p := &f.Policies[i]
+		if err = p.validate(); err != nil {
+			return err
+		}
+		if ids[p.ID] {
+			return fmt.Errorf("duplicate policy %s", p.ID)
+		}
+		ids[p.ID] = true
+	}
+	a.mu.Lock()
+	a.policy = f
+	a.mu.Unlock()
+	return nil
+}
+
+//Authorize the first deny policy matching wins, then the first allow policy, then the default
+func (a *policyAuthorizer) Authorize(ctx context.Context, req *AuthorizationRequest) (*AuthorizationDecision, error) {
+	a.mu.RLock()
+	f := a.policy
+	a.mu.RUnlock()
+	var allow *policy
+	for i := range f.Policies {
+		p := &f.Policies[i]
+		if !p.match(req) {
+			continue
+		}
+		if p.Effect == policyDeny {
+			return &AuthorizationDecision{Allowed: false, PolicyID: p.ID}, nil
+		}
+		if allow == nil {
+			allow = p
+		}
+	}
+	if allow != nil {
+		return &AuthorizationDecision{Allowed: true, PolicyID: allow.ID}, nil
+	}
+	return &AuthorizationDecision{Allowed: f.Default == policyAllow}, nil
+}
+
+//watch reload the policies on changes of the file
+func (a *policyAuthorizer) watch(exitChan chan struct{}) {
+	watchFile(a.file, "policy", a.logger, exitChan, a.reload)
+}
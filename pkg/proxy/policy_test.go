@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+//TestPolicyWatchSymlinkSwap a ConfigMap volume links the file through ..data and swaps the symlink on updates
+func TestPolicyWatchSymlinkSwap(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	writeVersion := func(version, effect string) {
+		if err := os.Mkdir(filepath.Join(dir, version), 0755); err != nil {
+			t.Fatal(err)
+		}
+		data := []byte("default: " + effect + "\n")
+		if err := ioutil.WriteFile(filepath.Join(dir, version, "policy.yml"), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeVersion("..v1", policyDeny)
+	if err = os.Symlink("..v1", filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "policy.yml")
+	if err = os.Symlink(filepath.Join("..data", "policy.yml"), file); err != nil {
+		t.Fatal(err)
+	}
+	a, err := newPolicyAuthorizer(file, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	exitChan := make(chan struct{})
+	defer close(exitChan)
+	go a.watch(exitChan)
+	// let the watcher start before the swap
+	time.Sleep(100 * time.Millisecond)
+	writeVersion("..v2", policyAllow)
+	if err = os.Symlink("..v2", filepath.Join(dir, "..data_tmp")); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Rename(filepath.Join(dir, "..data_tmp"), filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if d, _ := a.Authorize(context.Background(), &AuthorizationRequest{User: "alice"}); d.Allowed {
+			return
+		}
+	}
+	t.Fatal("policies not reloaded after the symlink swap")
+}
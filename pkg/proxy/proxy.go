@@ -2,38 +2,75 @@ package proxy
 
 import (
 	"context"
-	"fmt"
+	"crypto/tls"
+	"io"
 	"net"
 	"net/http"
 	_ "net/http/pprof"
 	"sync"
+	"sync/atomic"
 
 	"github.com/pingcap/errors"
 	"github.com/pingcap/tidb/kv"
-	"github.com/pingcap/tidb/store/tikv"
 	"github.com/pingcap/tidb/store/tikv/oracle"
 	"github.com/redis-force/less-state-hdfs/pkg/proxy/config"
 	"go.uber.org/zap"
 )
 
 var (
-	ErrServerClosed = errors.New("Error server closed.")
+	ErrServerClosed      = errors.New("Error server closed.")
+	ErrBlockOwnerUnknown = errors.New("Error block owner unknown.")
+	ErrUnauthenticated   = errors.New("Error unauthenticated.")
+	ErrOverloaded        = errors.New("Error overloaded, retry later.")
 )
 
 func New(config *config.Config) (*Proxy, error) {
 	s := &Proxy{}
 	s.config = config
 	s.exitChan = make(chan struct{})
+	s.inflight = newInflightTxns()
+	s.requestCtx, s.cancelRequests = context.WithCancel(context.Background())
 	s.logger = config.Logger
 
 	var err error
-	driver := tikv.Driver{}
-	s.store, err = driver.Open(fmt.Sprintf("tikv://%s", config.KVPDAddress))
-	if err != nil {
-		s.logger.Fatal("open tivk storage error", zap.Error(err))
-		return nil, errors.Trace(err)
+	if s.webhooks, err = newWebhookSubscribers(config.Webhooks); err != nil {
+		return nil, err
+	}
+	if s.audit, err = newAuditLogger(config.Audit); err != nil {
+		return nil, err
+	}
+	if s.accessLog, err = newAccessLogger(config.AccessLog, s.logger); err != nil {
+		return nil, err
+	}
+	if s.authenticators, err = newAuthenticators(config.Auth); err != nil {
+		return nil, err
+	}
+	if s.limiter, err = newRateLimiter(config.RateLimit, s.logger); err != nil {
+		return nil, err
+	}
+	if s.shedder, err = newLoadShedder(config.LoadShed); err != nil {
+		return nil, err
+	}
+	// before the storage, the tikv client reads the tracing switch when it dials
+	if s.tracer, err = newTracer(config.Tracing, s.logger); err != nil {
+		return nil, err
+	}
+	s.permission = newPermissionChecker(config.Permission)
+	if len(config.AuthorizationPolicyFile) > 0 {
+		if s.authorizer, err = newPolicyAuthorizer(config.AuthorizationPolicyFile, s.logger); err != nil {
+			return nil, err
+		}
+	}
+	// the caller of an unauthenticated request is unknown, anyone could claim to be the superuser
+	if len(s.authenticators) == 0 && (s.permission.enabled || s.authorizer != nil) {
+		return nil, errors.New("permission checks and the authorizer need authenticated callers, configure an auth method")
+	}
+	if s.store, err = openStorage(config, s.logger); err != nil {
+		s.logger.Error("open tikv storage error", zap.Error(err))
+		return nil, err
 	}
 	s.oracle = s.store.GetOracle()
+	s.instance = instanceName(config.HostPort)
 	// s.client = s.store.GetClient()
 	return s, nil
 }
@@ -45,10 +82,35 @@ type Proxy struct {
 	oracle oracle.Oracle
 	// client kv.Client
 
-	logger    *zap.Logger
+	logger *zap.Logger
+	audit  *zap.Logger
+	// nil if the access log is disabled
+	accessLog *accessLogger
+	// empty if authentication is disabled
+	authenticators []authenticator
+	permission     *permissionChecker
+	// nil if rate limiting is disabled
+	limiter *rateLimiter
+	// nil if load shedding is disabled
+	shedder *loadShedder
+	// nil if no authorizer is configured
+	authorizer Authorizer
+	// nil if tracing is disabled
+	tracer    io.Closer
 	apiServer *http.Server
 	mu        sync.Mutex
 
+	replication replicationScanner
+	webhooks    []*webhookSubscriber
+	// host and listen address, holder of the webhook leases
+	instance string
+
+	inflight *inflightTxns
+	// parent of the request contexts, cancelled when the drain times out
+	requestCtx     context.Context
+	cancelRequests context.CancelFunc
+	// set as soon as Close starts, the proxy is unready from then on
+	closing  int32
 	closed   bool
 	exitChan chan struct{}
 }
@@ -59,37 +121,78 @@ func (p *Proxy) Start() error {
 	if p.closed {
 		return ErrServerClosed
 	}
-	l, err := net.Listen("tcp4", p.config.HostPort)
+	l, err := net.Listen("tcp", p.config.HostPort)
 	if err != nil {
 		return errors.Trace(err)
 	}
+	if len(p.config.TLSCert) > 0 || len(p.config.TLSKey) > 0 {
+		certs, err := newCertReloader(p.config, p.logger)
+		if err != nil {
+			l.Close()
+			return errors.Trace(err)
+		}
+		l = tls.NewListener(l, certs.tlsConfig())
+		go certs.watch(p.exitChan)
+	}
+	if len(p.authenticators) == 0 {
+		p.logger.Error("api authentication is disabled, any caller is served unauthenticated")
+	}
+	if p.config.Auth.ClientCert && len(p.config.TLSClientCA) == 0 {
+		p.logger.Warn("client certificate authentication never succeeds without a tls client ca")
+	}
 	api := newAPIServer(p)
-	p.apiServer = &http.Server{Handler: api}
+	p.apiServer = &http.Server{Handler: api, BaseContext: func(net.Listener) context.Context {
+		return p.requestCtx
+	}}
 	go func() {
-		p.logger.Info("api server start listening", zap.String("hostPort", p.config.HostPort))
+		p.logger.Info("api server start listening", zap.String("hostPort", p.config.HostPort), zap.Bool("tls", len(p.config.TLSCert) > 0))
 		p.apiServer.Serve(l)
 	}()
+	go p.runReplicationScanner()
+	go p.runRetryCacheSweeper()
+	go p.runBlockTombstoneSweeper()
+	go p.runChangeEventSweeper()
+	if a, ok := p.authorizer.(*policyAuthorizer); ok {
+		go a.watch(p.exitChan)
+	}
+	if p.limiter != nil && len(p.limiter.file) > 0 {
+		go p.limiter.watch(p.exitChan)
+	}
+	for _, w := range p.webhooks {
+		go p.runWebhook(w)
+	}
 	return nil
 }
 
 func (p *Proxy) Close() error {
+	atomic.StoreInt32(&p.closing, 1)
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	if p.closed {
 		return nil
 	}
-	p.oracle.Close()
 	p.closed = true
 	close(p.exitChan)
-	p.logger.Warn("api server start shutdown.")
-	p.apiServer.Shutdown(context.Background())
-	p.logger.Warn("api server gracefully shutdown.")
+	if p.apiServer != nil {
+		p.logger.Warn("api server start shutdown.")
+		p.drain()
+		p.logger.Warn("api server gracefully shutdown.")
+	}
+	p.cancelRequests()
+	if err := p.removeSentinel(); err != nil {
+		p.logger.Warn("remove the readiness sentinel error", zap.Error(err))
+	}
+	p.oracle.Close()
+	if p.tracer != nil {
+		p.tracer.Close()
+	}
+	if p.audit != nil {
+		p.audit.Sync()
+	}
 	return nil
 }
 
-func (p *Proxy) IsClosed() (closed bool) {
-	p.mu.Lock()
-	closed = p.closed
-	p.mu.Unlock()
-	return
+//IsClosed true as soon as Close starts, the requests arriving while draining are rejected
+func (p *Proxy) IsClosed() bool {
+	return atomic.LoadInt32(&p.closing) != 0
 }
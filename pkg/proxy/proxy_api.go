@@ -1,20 +1,25 @@
 package proxy
 
 import (
-	"bytes"
 	"fmt"
 	"net/http"
 	"strconv"
 
 	"runtime"
 	"runtime/debug"
+	"time"
 
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/gogo/protobuf/proto"
+	"github.com/pingcap/errors"
 	"github.com/pingcap/tidb/kv"
 	"github.com/pingcap/tidb/store/tikv/oracle"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/redis-force/less-state-hdfs/pkg/model"
 	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+	"github.com/redis-force/less-state-hdfs/pkg/version"
 	"go.uber.org/zap"
 )
 
@@ -23,23 +28,10 @@ const (
 	inodeDirectoryType
 )
 
-type bodyLogWriter struct {
-	gin.ResponseWriter
-	body *bytes.Buffer
-}
-
-func (w bodyLogWriter) Write(b []byte) (int, error) {
-	w.body.Write(b)
-	return w.ResponseWriter.Write(b)
-}
-
-func ginBodyLogMiddleware(c *gin.Context) {
-	blw := &bodyLogWriter{body: bytes.NewBufferString(""), ResponseWriter: c.Writer}
-	c.Writer = blw
-	c.Next()
-	statusCode := c.Writer.Status()
-	fmt.Printf("request %s, response code %d body: %s\n", c.Request.URL.String(), statusCode, blw.body.String())
-}
+const (
+	changeEventBatchLimit   = 100
+	changeEventPollInterval = 500 * time.Millisecond
+)
 
 type apiServer struct {
 	proxy *Proxy
@@ -47,13 +39,38 @@ type apiServer struct {
 
 func newAPIServer(proxy *Proxy) *gin.Engine {
 	router := gin.New()
-	router.Use(gin.Logger(), gin.Recovery(), ginBodyLogMiddleware)
+	if proxy.accessLog != nil {
+		router.Use(proxy.accessLog.middleware)
+	}
+	router.Use(gin.Recovery(), metricsMiddleware, tracingMiddleware)
 	router.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Content-Type", "application/json; charset=utf-8")
 	})
-	router.Any("/debug/*path", func(c *gin.Context) {
+	auth := func(c *gin.Context) {
+		c.Next()
+	}
+	if len(proxy.authenticators) > 0 {
+		auth = authMiddleware(proxy.authenticators)
+	}
+	server := &apiServer{proxy: proxy}
+	admin := func(c *gin.Context) {
+		if _, ok := server.checkPermission(c, permissionRequest{superuser: true}); ok {
+			c.Next()
+		}
+	}
+	// probes are not authenticated, kubernetes calls them without credentials
+	router.GET("/healthz", server.healthz)
+	router.GET("/readyz", server.readyz)
+	router.GET("/version", gin.WrapF(version.Handler(proxy.logger)))
+	router.Any("/debug/*path", auth, admin, func(c *gin.Context) {
 		http.DefaultServeMux.ServeHTTP(c.Writer, c.Request)
 	})
+	metricsHandler := prometheus.Handler()
+	router.GET("/metrics", auth, func(c *gin.Context) {
+		if _, ok := server.checkPermission(c, permissionRequest{access: actionRead}); ok {
+			metricsHandler.ServeHTTP(c.Writer, c.Request)
+		}
+	})
 	preCheck := func(c *gin.Context) {
 		if proxy.IsClosed() {
 			apiResponseError(c, http.StatusServiceUnavailable, ErrServerClosed)
@@ -78,26 +95,37 @@ func newAPIServer(proxy *Proxy) *gin.Engine {
 			c.Next()
 		}
 	}
-	server := &apiServer{proxy: proxy}
-	//TODO auth middleware
 	api := router.Group("/api")
-	api.Use(preCheck)
+	if proxy.audit != nil {
+		api.Use(auditMiddleware(proxy.audit, proxy.config.Audit.IncludeReads))
+	}
+	api.Use(auth, preCheck)
+	if proxy.limiter != nil {
+		api.Use(proxy.limiter.middleware)
+	}
+	api.Use(proxy.deadlineMiddleware, preconditionMiddleware)
+	if proxy.config.RetryCache.Enabled {
+		api.Use(proxy.retryCacheMiddleware)
+	}
 	{
 		api.GET("/tso", server.ts)
+		// GET /api/block/meta/:id, /api/block/storage/:id and /api/block/:id/owner share one route,
+		// httprouter cannot route the :id wildcard beside the static meta and storage children
+		api.GET("/block/:id/:resource", server.getBlockResource)
 		blockMeta := api.Group("/block/meta")
 		blockMeta.Use(intCheck("id"))
 		{
-			blockMeta.GET("/:id", server.getBlock)
 			blockMeta.PUT("/:id", server.putBlock)
 			blockMeta.DELETE("/:id", server.deleteBlock)
 		}
 		blockStorage := api.Group("/block/storage")
 		blockStorage.Use(intCheck("id"))
 		{
-			blockStorage.GET("/:id", server.getBlockStorage)
 			blockStorage.PUT("/:id/:data_node_id/:storage_id", server.putBlockStorage)
 			blockStorage.DELETE("/:id/:data_node_id/:storage_id", server.deleteBlockStorage)
 		}
+		api.GET("/blocks/replication-report", server.getReplicationReport)
+		api.POST("/datanode/:data_node_id/block-report", server.blockReport)
 		file := api.Group("/file")
 		file.Use(intCheck("id"))
 		{
@@ -132,8 +160,16 @@ func newAPIServer(proxy *Proxy) *gin.Engine {
 			inode.PUT("/:id/:old_id/:new_id", intCheck("id", "old_id", "new_id"), server.updateINodeParent)
 
 		}
+		api.GET("/events", server.events)
+		api.GET("/webhooks/dead-letters", server.getWebhookDeadLetters)
+		adminAPI := api.Group("/admin")
+		{
+			adminAPI.GET("/fsck", server.fsck)
+			adminAPI.POST("/fsck", server.fsck)
+		}
 	}
 	rt := router.Group("/runtime")
+	rt.Use(auth, admin)
 	{
 		rt.PUT("/force-gc", func(c *gin.Context) {
 			runtime.GC()
@@ -148,7 +184,64 @@ func newAPIServer(proxy *Proxy) *gin.Engine {
 	return router
 }
 
+//blockResource the operation of a GET below /api/block and the param holding its block id
+func blockResource(c *gin.Context) (string, string) {
+	switch id, resource := c.Param("id"), c.Param("resource"); {
+	case id == "meta":
+		return "getBlock", resource
+	case id == "storage":
+		return "getBlockStorage", resource
+	case resource == "owner":
+		return "getBlockOwner", id
+	}
+	return "", ""
+}
+
+//getBlockResource param id/resource, dispatch to getBlock, getBlockStorage or getBlockOwner
+func (s *apiServer) getBlockResource(c *gin.Context) {
+	handlers := map[string]gin.HandlerFunc{
+		"getBlock":        s.getBlock,
+		"getBlockStorage": s.getBlockStorage,
+		"getBlockOwner":   s.getBlockOwner,
+	}
+	operation, param := blockResource(c)
+	handler, ok := handlers[operation]
+	if !ok {
+		apiResponseError(c, http.StatusNotFound, fmt.Errorf("block resource %s not found", c.Request.URL.Path))
+		return
+	}
+	id, err := strconv.ParseInt(param, 10, 64)
+	if err != nil {
+		apiResponseError(c, http.StatusBadRequest, fmt.Errorf("%q param format error %s", "id", err))
+		return
+	}
+	if id < 0 {
+		apiResponseError(c, http.StatusBadRequest, fmt.Errorf("id format error"))
+		return
+	}
+	c.Set("id", id)
+	handler(c)
+}
+
 func apiResponseError(c *gin.Context, code int, err error) {
+	if code == http.StatusInternalServerError && isContextError(err) {
+		code = http.StatusGatewayTimeout
+	}
+	if code == http.StatusInternalServerError && errors.Cause(err) == ErrPreconditionFailed {
+		code = http.StatusPreconditionFailed
+	}
+	if code == http.StatusInternalServerError && errors.Cause(err) == ErrOverloaded {
+		code = http.StatusServiceUnavailable
+		c.Header("Retry-After", "1")
+	}
+	if pe, ok := errors.Cause(err).(*PermissionError); ok {
+		c.AbortWithStatusJSON(http.StatusForbidden, model.APIResponse{Code: http.StatusForbidden, Error: pe.Error(), Exception: accessControlException})
+		return
+	}
+	if e := retryEntryFromContext(c.Request.Context()); e != nil && errors.Cause(err) == errRetryCacheHit {
+		replayRetryCache(c, e)
+		return
+	}
 	c.AbortWithStatusJSON(code, model.APIResponse{Code: code, Error: err.Error()})
 }
 
@@ -161,6 +254,9 @@ func apiResponseSuccess(c *gin.Context, resp interface{}) {
 }
 
 func (s *apiServer) ts(c *gin.Context) {
+	if _, ok := s.checkPermission(c, permissionRequest{access: actionRead}); !ok {
+		return
+	}
 	count, err := strconv.Atoi(c.DefaultQuery("count", "1"))
 	if err != nil {
 		apiResponseError(c, http.StatusBadRequest, err)
@@ -175,6 +271,7 @@ func (s *apiServer) ts(c *gin.Context) {
 		Count:     count,
 	}
 	fs := make([]oracle.Future, count)
+	start := time.Now()
 	for i := 0; i < count; i++ {
 		fs[i] = s.proxy.oracle.GetTimestampAsync(c.Request.Context())
 	}
@@ -185,11 +282,15 @@ func (s *apiServer) ts(c *gin.Context) {
 			return
 		}
 	}
+	apiTSOWaitDuration.Observe(time.Since(start).Seconds())
 	apiResponseSuccess(c, ts)
 }
 
 func (s *apiServer) getBlock(c *gin.Context) {
 	id := c.GetInt64("id")
+	if _, ok := s.checkPermission(c, permissionRequest{block: id, access: actionRead}); !ok {
+		return
+	}
 	bm, err := s.proxy.GetBlock(c.Request.Context(), id)
 	if kv.ErrNotExist.Equal(err) {
 		apiResponseError(c, http.StatusNotFound, fmt.Errorf("block id=%d not found", id))
@@ -199,6 +300,10 @@ func (s *apiServer) getBlock(c *gin.Context) {
 		apiResponseError(c, http.StatusInternalServerError, err)
 		return
 	}
+	// the storages change without the version of the block
+	if notModifiedResponse(c, bm.Version, bm) {
+		return
+	}
 	//TODO get block meta
 	apiResponseSuccess(c, bm)
 }
@@ -215,17 +320,29 @@ func (s *apiServer) putBlock(c *gin.Context) {
 		apiResponseError(c, http.StatusBadRequest, fmt.Errorf("parse put request error, filed must not by none %v ", bm))
 		return
 	}
+	// the file owning the block now and the file it is put to
+	target := permissionRequest{id: bm.GetCollectionId(), access: actionWrite}
+	if bm.GetCollectionId() == 0 {
+		target = permissionRequest{superuser: true}
+	}
+	if _, ok := s.checkPermission(c, permissionRequest{block: id, access: actionWrite}, target); !ok {
+		return
+	}
 	bm.Id = proto.Int64(id)
 	err = s.proxy.PutBlock(c.Request.Context(), bm)
 	if err != nil {
 		apiResponseError(c, http.StatusInternalServerError, err)
 		return
 	}
+	c.Header(etagHeader, formatETag(bm.GetVersion()))
 	apiResponseSuccess(c, nil)
 }
 
 func (s *apiServer) deleteBlock(c *gin.Context) {
 	id := c.GetInt64("id")
+	if _, ok := s.checkPermission(c, permissionRequest{block: id, access: actionWrite}); !ok {
+		return
+	}
 	err := s.proxy.DeleteBlock(c.Request.Context(), id)
 	if err != nil {
 		apiResponseError(c, http.StatusInternalServerError, err)
@@ -234,9 +351,69 @@ func (s *apiServer) deleteBlock(c *gin.Context) {
 	apiResponseSuccess(c, nil)
 }
 
+//getBlockOwner param id
+func (s *apiServer) getBlockOwner(c *gin.Context) {
+	id := c.GetInt64("id")
+	if _, ok := s.checkPermission(c, permissionRequest{block: id, access: actionRead}); !ok {
+		return
+	}
+	owner, err := s.proxy.GetBlockOwner(c.Request.Context(), id)
+	if kv.ErrNotExist.Equal(err) {
+		apiResponseError(c, http.StatusNotFound, fmt.Errorf("block id=%d not found", id))
+		return
+	}
+	if err == ErrBlockOwnerUnknown {
+		apiResponseError(c, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		apiResponseError(c, http.StatusInternalServerError, err)
+		return
+	}
+	apiResponseSuccess(c, owner)
+}
+
+//getReplicationReport query class/offset/limit/refresh
+func (s *apiServer) getReplicationReport(c *gin.Context) {
+	if _, ok := s.checkPermission(c, permissionRequest{access: actionRead}); !ok {
+		return
+	}
+	class := c.Query("class")
+	if len(class) > 0 && class != replicationMissing && class != replicationCorrupt && class != replicationUnder && class != replicationOver {
+		apiResponseError(c, http.StatusBadRequest, fmt.Errorf("unknown replication class %q", class))
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		apiResponseError(c, http.StatusBadRequest, fmt.Errorf("offset param format error"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "1000"))
+	if err != nil || limit <= 0 {
+		apiResponseError(c, http.StatusBadRequest, fmt.Errorf("limit param format error"))
+		return
+	}
+	_, refresh := c.GetQuery("refresh")
+	// a refresh scans every block synchronously, like fsck only the superuser starts one
+	if refresh {
+		if _, ok := s.checkPermission(c, permissionRequest{superuser: true}); !ok {
+			return
+		}
+	}
+	report, err := s.proxy.GetReplicationReport(c.Request.Context(), class, offset, limit, refresh)
+	if err != nil {
+		apiResponseError(c, http.StatusInternalServerError, err)
+		return
+	}
+	apiResponseSuccess(c, report)
+}
+
 //getBlock param id
 func (s *apiServer) getBlockStorage(c *gin.Context) {
 	id := c.GetInt64("id")
+	if _, ok := s.checkPermission(c, permissionRequest{block: id, access: actionRead}); !ok {
+		return
+	}
 	st, err := s.proxy.GetBlockStorage(c.Request.Context(), id)
 	if err != nil {
 		if kv.ErrNotExist.Equal(err) {
@@ -252,6 +429,9 @@ func (s *apiServer) getBlockStorage(c *gin.Context) {
 //putBlock param id/data_node_id/storage_id
 func (s *apiServer) putBlockStorage(c *gin.Context) {
 	id := c.GetInt64("id")
+	if _, ok := s.checkPermission(c, permissionRequest{block: id, access: actionWrite}); !ok {
+		return
+	}
 	dataNodeID := c.Param(("data_node_id"))
 	storageID := c.Param("storage_id")
 	if len(dataNodeID) == 0 || len(storageID) == 0 {
@@ -267,15 +447,50 @@ func (s *apiServer) putBlockStorage(c *gin.Context) {
 
 //deleteBlock param id/data_node_id/storage_id
 func (s *apiServer) deleteBlockStorage(c *gin.Context) {
+	if _, ok := s.checkPermission(c, permissionRequest{block: c.GetInt64("id"), access: actionWrite}); !ok {
+		return
+	}
 	// _ =
 	//TODO get block meta
 	apiResponseSuccess(c, nil)
 }
 
+//blockReport param data_node_id
+func (s *apiServer) blockReport(c *gin.Context) {
+	// a report covers the blocks of every file of the datanode
+	if _, ok := s.checkPermission(c, permissionRequest{superuser: true}); !ok {
+		return
+	}
+	dataNodeID := c.Param("data_node_id")
+	if len(dataNodeID) == 0 {
+		apiResponseError(c, http.StatusBadRequest, fmt.Errorf("data node id param error"))
+		return
+	}
+	report := new(model.BlockReport)
+	if err := c.ShouldBindJSON(report); err != nil {
+		apiResponseError(c, http.StatusBadRequest, fmt.Errorf("parse block report error %s", err))
+		return
+	}
+	ret, err := s.proxy.ProcessBlockReport(c.Request.Context(), dataNodeID, report)
+	if err != nil {
+		apiResponseError(c, http.StatusInternalServerError, err)
+		return
+	}
+	apiResponseSuccess(c, ret)
+}
+
 //getINodeFile param id
 func (s *apiServer) getINodeFile(c *gin.Context) {
 	id := c.GetInt64("id")
 	_, simple := c.GetQuery("simple")
+	// the status of a file only needs the traverse, its blocks need read
+	req := permissionRequest{id: id, access: actionRead}
+	if simple {
+		req.access = actionNone
+	}
+	if _, ok := s.checkPermission(c, req); !ok {
+		return
+	}
 	m, bs, err := s.proxy.GetINodeFile(c.Request.Context(), id, simple)
 	if kv.ErrNotExist.Equal(err) {
 		apiResponseError(c, http.StatusNotFound, fmt.Errorf("inode-file id=%d not found", id))
@@ -285,7 +500,15 @@ func (s *apiServer) getINodeFile(c *gin.Context) {
 		apiResponseError(c, http.StatusInternalServerError, err)
 		return
 	}
-	apiResponseSuccess(c, pbINodeFileToINodeFile(m, bs))
+	resp := pbINodeFileToINodeFile(m, bs)
+	if simple && notModified(c, m.GetVersion()) {
+		return
+	}
+	// the blocks and their storages change without the version of the inode
+	if !simple && notModifiedResponse(c, m.GetVersion(), resp) {
+		return
+	}
+	apiResponseSuccess(c, resp)
 
 }
 
@@ -304,12 +527,16 @@ func (s *apiServer) putINodeFile(c *gin.Context) {
 	}
 	nm.Id = proto.Int64(id)
 	nm.Type = proto.Int32(inodeFileType)
+	if !s.checkCreate(c, nm.GetParentId(), nm) {
+		return
+	}
 	s.proxy.logger.Info("putINodeFile", zap.Int64("id", id), zap.Int64("parent_id", nm.GetParentId()), zap.String("name", nm.GetName()))
 	err = s.proxy.PutINodeFile(c.Request.Context(), nm)
 	if err != nil {
 		apiResponseError(c, http.StatusInternalServerError, err)
 		return
 	}
+	c.Header(etagHeader, formatETag(nm.GetVersion()))
 	apiResponseSuccess(c, nil)
 
 }
@@ -317,6 +544,9 @@ func (s *apiServer) putINodeFile(c *gin.Context) {
 //deleteINodeFile param id
 func (s *apiServer) deleteINodeFile(c *gin.Context) {
 	id := c.GetInt64("id")
+	if _, ok := s.checkPermission(c, permissionRequest{id: id, parentAccess: actionWriteExecute, sticky: true}); !ok {
+		return
+	}
 	if err := s.proxy.DeleteINodeFile(c.Request.Context(), id); err != nil {
 		apiResponseError(c, http.StatusInternalServerError, err)
 		return
@@ -333,6 +563,9 @@ func (s *apiServer) getINodeFileBlock(c *gin.Context) {
 	// 	apiResponseError(c, http.StatusBadRequest, err)
 	// 	return
 	// }
+	if _, ok := s.checkPermission(c, permissionRequest{id: id, access: actionRead}); !ok {
+		return
+	}
 	m, err := s.proxy.GetINodeFileBlock(c.Request.Context(), id, blockID)
 	if kv.ErrNotExist.Equal(err) {
 		apiResponseError(c, http.StatusNotFound, err)
@@ -342,6 +575,9 @@ func (s *apiServer) getINodeFileBlock(c *gin.Context) {
 		apiResponseError(c, http.StatusInternalServerError, err)
 		return
 	}
+	if notModifiedResponse(c, m.Version, m) {
+		return
+	}
 	apiResponseSuccess(c, m)
 	return
 }
@@ -355,6 +591,9 @@ func (s *apiServer) putINodeFileBlock(c *gin.Context) {
 		apiResponseError(c, http.StatusBadRequest, err)
 		return
 	}
+	if _, ok := s.checkPermission(c, permissionRequest{id: id, access: actionWrite}); !ok {
+		return
+	}
 	if err := s.proxy.PutINodeFileBlock(c.Request.Context(), id, blockID, generationTime); err != nil {
 		apiResponseError(c, http.StatusInternalServerError, err)
 		return
@@ -367,12 +606,14 @@ func (s *apiServer) putINodeFileBlock(c *gin.Context) {
 func (s *apiServer) updateINodeFileBlock(c *gin.Context) {
 	id := c.GetInt64("id")
 	blockID := c.GetInt64("block_id")
-	block := new(model.Block)
-	if err := c.ShouldBindJSON(block); err != nil {
+	block, err := bindINodeFileBlock(c)
+	if err != nil {
 		apiResponseError(c, http.StatusBadRequest, err)
 		return
 	}
-	block.Replication = 1
+	if _, ok := s.checkPermission(c, permissionRequest{id: id, access: actionWrite}); !ok {
+		return
+	}
 	if err := s.proxy.UpdateINodeFileBlock(c.Request.Context(), id, blockID, block); err != nil {
 		apiResponseError(c, http.StatusInternalServerError, err)
 		return
@@ -381,6 +622,17 @@ func (s *apiServer) updateINodeFileBlock(c *gin.Context) {
 
 }
 
+//bindINodeFileBlock the block of an update, answered back to the request and to its retries
+func bindINodeFileBlock(c *gin.Context) (*model.Block, error) {
+	block := new(model.Block)
+	// kept for the replay of a retry that loses to a concurrent duplicate after binding
+	if err := c.ShouldBindBodyWith(block, binding.JSON); err != nil {
+		return nil, err
+	}
+	block.Replication = 1
+	return block, nil
+}
+
 //deleteINodeFileBlock param id/block_id
 func (s *apiServer) deleteINodeFileBlock(c *gin.Context) {
 	id := c.GetInt64("id")
@@ -390,6 +642,9 @@ func (s *apiServer) deleteINodeFileBlock(c *gin.Context) {
 	// 	apiResponseError(c, http.StatusBadRequest, err)
 	// 	return
 	// }
+	if _, ok := s.checkPermission(c, permissionRequest{id: id, access: actionWrite}); !ok {
+		return
+	}
 	if err := s.proxy.DeleteINodeFileBlock(c.Request.Context(), id, blockID); err != nil {
 		apiResponseError(c, http.StatusInternalServerError, err)
 		return
@@ -400,6 +655,9 @@ func (s *apiServer) deleteINodeFileBlock(c *gin.Context) {
 //getINodeDirectory param id
 func (s *apiServer) getINodeDirectory(c *gin.Context) {
 	id := c.GetInt64("id")
+	if _, ok := s.checkPermission(c, permissionRequest{id: id}); !ok {
+		return
+	}
 	m, err := s.proxy.GetINodeDirectory(c.Request.Context(), id)
 	if kv.ErrNotExist.Equal(err) {
 		apiResponseError(c, http.StatusNotFound, fmt.Errorf("inode-directory id=%d not found", id))
@@ -409,6 +667,9 @@ func (s *apiServer) getINodeDirectory(c *gin.Context) {
 		apiResponseError(c, http.StatusInternalServerError, err)
 		return
 	}
+	if notModified(c, m.GetVersion()) {
+		return
+	}
 	//TODO get block meta
 	apiResponseSuccess(c, m)
 
@@ -418,6 +679,9 @@ func (s *apiServer) getINodeDirectory(c *gin.Context) {
 func (s *apiServer) getINodeDirectoryChildren(c *gin.Context) {
 	id := c.GetInt64("id")
 	_, simple := c.GetQuery("simple")
+	if _, ok := s.checkPermission(c, permissionRequest{id: id, access: actionReadExecute}); !ok {
+		return
+	}
 	m, err := s.proxy.GetINodeDirectoryChildren(c.Request.Context(), id, simple)
 	if kv.ErrNotExist.Equal(err) {
 		apiResponseError(c, http.StatusNotFound, fmt.Errorf("inode-directory id=%d not found", id))
@@ -443,11 +707,15 @@ func (s *apiServer) putINodeDirectory(c *gin.Context) {
 	}
 	nm.Id = proto.Int64(id)
 	nm.Type = proto.Int32(inodeDirectoryType)
+	if !s.checkCreate(c, nm.GetParentId(), nm) {
+		return
+	}
 	err = s.proxy.PutINodeDirectory(c.Request.Context(), nm)
 	if err != nil {
 		apiResponseError(c, http.StatusInternalServerError, err)
 		return
 	}
+	c.Header(etagHeader, formatETag(nm.GetVersion()))
 	apiResponseSuccess(c, nil)
 }
 
@@ -455,6 +723,9 @@ func (s *apiServer) putINodeDirectory(c *gin.Context) {
 func (s *apiServer) deleteINodeDirectory(c *gin.Context) {
 	id := c.GetInt64("id")
 	//TODO
+	if _, ok := s.checkPermission(c, permissionRequest{id: id, parentAccess: actionWriteExecute, sticky: true, subAccess: actionAll}); !ok {
+		return
+	}
 	if err := s.proxy.DeleteINodeDirectory(c.Request.Context(), id); err != nil {
 		apiResponseError(c, http.StatusInternalServerError, err)
 		return
@@ -471,6 +742,9 @@ func (s *apiServer) getINodeDirectoryChild(c *gin.Context) {
 	}
 	id := c.GetInt64("id")
 	// _, needMore := c.GetQuery("need_more")
+	if _, ok := s.checkPermission(c, permissionRequest{id: id, create: true}); !ok {
+		return
+	}
 	im, err := s.proxy.GetINodeDirectoryChild(c.Request.Context(), id, name, true)
 	if kv.ErrNotExist.Equal(err) {
 		apiResponseError(c, http.StatusNotFound, err)
@@ -480,6 +754,9 @@ func (s *apiServer) getINodeDirectoryChild(c *gin.Context) {
 		apiResponseError(c, http.StatusInternalServerError, err)
 		return
 	}
+	if notModified(c, im.GetVersion()) {
+		return
+	}
 	apiResponseSuccess(c, pbINodeMetaToSimpleINode(im))
 }
 
@@ -500,10 +777,14 @@ func (s *apiServer) putINodeDirectoryChild(c *gin.Context) {
 	// bm.Id = proto.Int64(c.GetInt64("id"))
 	bm.Name = proto.String(name)
 	bm.ParentId = proto.Int64(id)
+	if !s.checkCreate(c, id, bm) {
+		return
+	}
 	if err := s.proxy.PutINodeDirectoryChild(c.Request.Context(), id, bm); err != nil {
 		apiResponseError(c, http.StatusInternalServerError, err)
 		return
 	}
+	c.Header(etagHeader, formatETag(bm.GetVersion()))
 	apiResponseSuccess(c, nil)
 }
 
@@ -515,18 +796,55 @@ func (s *apiServer) deleteINodeDirectoryChild(c *gin.Context) {
 		return
 	}
 	id := c.GetInt64("id")
+	if _, ok := s.checkPermission(c, permissionRequest{id: id, child: name, parentAccess: actionWriteExecute, sticky: true}); !ok {
+		return
+	}
 	if err := s.proxy.DeleteINodeDirectoryChild(c.Request.Context(), id, name); err != nil {
+		if kv.ErrNotExist.Equal(err) {
+			apiResponseError(c, http.StatusNotFound, err)
+			return
+		}
 		apiResponseError(c, http.StatusInternalServerError, err)
 		return
 	}
 	apiResponseSuccess(c, nil)
 }
 
+//fsck query offset/limit, check namespace consistency, POST also repairs the issues found
+func (s *apiServer) fsck(c *gin.Context) {
+	if _, ok := s.checkPermission(c, permissionRequest{superuser: true}); !ok {
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		apiResponseError(c, http.StatusBadRequest, fmt.Errorf("offset param format error"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "1000"))
+	if err != nil || limit <= 0 {
+		apiResponseError(c, http.StatusBadRequest, fmt.Errorf("limit param format error"))
+		return
+	}
+	report, err := s.proxy.Fsck(c.Request.Context(), c.Request.Method == http.MethodPost, offset, limit)
+	if err != nil {
+		apiResponseError(c, http.StatusInternalServerError, err)
+		return
+	}
+	apiResponseSuccess(c, report)
+}
+
 func (s *apiServer) updateINodeParent(c *gin.Context) {
 	id := c.GetInt64("id")
 	newParent := c.GetInt64("new_id")
 	oldParent := c.GetInt64("old_id")
-	if err := s.proxy.UpdateINodeParent(c.Request.Context(), id, newParent, oldParent); err != nil {
+	// like a rename, the source leaves its parent and the destination parent gets a new child
+	if _, ok := s.checkPermission(c,
+		permissionRequest{id: id, parentAccess: actionWriteExecute, sticky: true},
+		permissionRequest{id: newParent, create: true, access: actionWrite}); !ok {
+		return
+	}
+	version, err := s.proxy.UpdateINodeParent(c.Request.Context(), id, newParent, oldParent)
+	if err != nil {
 		if kv.ErrNotExist.Equal(err) {
 			apiResponseError(c, http.StatusNotFound, err)
 			return
@@ -534,6 +852,7 @@ func (s *apiServer) updateINodeParent(c *gin.Context) {
 		apiResponseError(c, http.StatusInternalServerError, err)
 		return
 	}
+	c.Header(etagHeader, formatETag(version))
 	apiResponseSuccess(c, nil)
 	return
 }
@@ -541,6 +860,9 @@ func (s *apiServer) updateINodeParent(c *gin.Context) {
 func (s *apiServer) truncateINodeFile(c *gin.Context) {
 	id := c.GetInt64("id")
 	size := c.GetInt64("size")
+	if _, ok := s.checkPermission(c, permissionRequest{id: id, access: actionWrite}); !ok {
+		return
+	}
 	if err := s.proxy.TruncateINodeFile(c.Request.Context(), id, size); err != nil {
 		apiResponseError(c, http.StatusInternalServerError, err)
 		return
@@ -556,10 +878,22 @@ func (s *apiServer) updateINodeFile(c *gin.Context) {
 		apiResponseError(c, http.StatusBadRequest, err)
 		return
 	}
-	if err = s.proxy.UpdateINodeFile(c.Request.Context(), node); err != nil {
+	old, ok := s.checkPermission(c, permissionRequest{id: node.ID, access: actionWrite})
+	if !ok {
+		return
+	}
+	// like setPermission only the owner changes the mode
+	if old != nil && permissionMode(old.GetPermission()) != permissionMode(node.Permission) {
+		if _, ok = s.checkPermission(c, permissionRequest{id: node.ID, owner: true}); !ok {
+			return
+		}
+	}
+	version, err := s.proxy.UpdateINodeFile(c.Request.Context(), node)
+	if err != nil {
 		apiResponseError(c, http.StatusInternalServerError, err)
 		return
 	}
+	c.Header(etagHeader, formatETag(version))
 	apiResponseSuccess(c, nil)
 }
 
@@ -570,9 +904,91 @@ func (s *apiServer) updateINodeDirectory(c *gin.Context) {
 		apiResponseError(c, http.StatusBadRequest, err)
 		return
 	}
+	if _, ok := s.checkPermission(c, permissionRequest{id: id.ID, access: actionWrite}); !ok {
+		return
+	}
 	if err = s.proxy.UpdateINodeDirectory(c.Request.Context(), id); err != nil {
 		apiResponseError(c, http.StatusInternalServerError, err)
 		return
 	}
 	apiResponseSuccess(c, nil)
 }
+
+//events stream change event batches after the cursor as server sent events, the event id is the txid.
+//The cursor is the since param or the Last-Event-ID header of a reconnecting client,
+//without both only batches committed from now on are streamed.
+func (s *apiServer) events(c *gin.Context) {
+	// like hdfs inotify, the feed reveals the whole namespace
+	if _, ok := s.checkPermission(c, permissionRequest{superuser: true}); !ok {
+		return
+	}
+	cursor := c.Query("since")
+	if len(cursor) == 0 {
+		cursor = c.GetHeader("Last-Event-ID")
+	}
+	var since int64
+	var err error
+	if len(cursor) > 0 {
+		if since, err = strconv.ParseInt(cursor, 10, 64); err != nil || since < 0 {
+			apiResponseError(c, http.StatusBadRequest, fmt.Errorf("since param format error"))
+			return
+		}
+	} else if since, err = s.proxy.LastChangeEventTxID(c.Request.Context()); err != nil {
+		apiResponseError(c, http.StatusInternalServerError, err)
+		return
+	}
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Status(http.StatusOK)
+	c.Writer.WriteHeaderNow()
+	c.Writer.Flush()
+	ticker := time.NewTicker(changeEventPollInterval)
+	defer ticker.Stop()
+	for {
+		batches, err := s.proxy.GetChangeEvents(ctx, since, changeEventBatchLimit)
+		if err != nil {
+			s.proxy.logger.Error("stream change events error", zap.Int64("since", since), zap.Error(err))
+			c.Render(-1, sse.Event{Event: "error", Data: model.APIResponse{Code: http.StatusInternalServerError, Error: err.Error()}})
+			c.Writer.Flush()
+			return
+		}
+		for _, b := range batches {
+			c.Render(-1, sse.Event{Id: strconv.FormatInt(b.TxID, 10), Event: "batch", Data: b})
+			since = b.TxID
+		}
+		c.Writer.Flush()
+		if len(batches) == changeEventBatchLimit && ctx.Err() == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.proxy.exitChan:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *apiServer) getWebhookDeadLetters(c *gin.Context) {
+	if _, ok := s.checkPermission(c, permissionRequest{superuser: true}); !ok {
+		return
+	}
+	offset, err := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if err != nil || offset < 0 {
+		apiResponseError(c, http.StatusBadRequest, fmt.Errorf("offset param format error"))
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "1000"))
+	if err != nil || limit <= 0 {
+		apiResponseError(c, http.StatusBadRequest, fmt.Errorf("limit param format error"))
+		return
+	}
+	letters, err := s.proxy.ListWebhookDeadLetters(c.Request.Context(), c.Query("subscriber"), offset, limit)
+	if err != nil {
+		apiResponseError(c, http.StatusInternalServerError, err)
+		return
+	}
+	apiResponseSuccess(c, letters)
+}
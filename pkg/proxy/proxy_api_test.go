@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pingcap/tidb/kv"
+	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+	"github.com/redis-force/less-state-hdfs/pkg/proxy/config"
+)
+
+func signedGet(uri, key, secret string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, uri, nil)
+	date := strconv.FormatInt(time.Now().Unix(), 10)
+	r.Header.Set(authDateHeader, date)
+	mac := hmac.New(sha256.New, []byte(secret))
+	io.WriteString(mac, hmacCanonical(http.MethodGet, uri, date, "", nil))
+	r.Header.Set("Authorization", authHMAC+" "+key+":"+base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	return r
+}
+
+func TestBlockRoutesThroughAuth(t *testing.T) {
+	s := newTestProxy()
+	s.permission = newPermissionChecker(config.PermissionConfig{})
+	authenticators, err := newAuthenticators(config.AuthConfig{
+		HMACKeys: []config.AuthHMACKey{{ID: "k1", Principal: "nn", Secret: "s"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.authenticators = authenticators
+	mustRunTxn(t, s, func(tx kv.Transaction) error {
+		mustSet(t, tx, generateINodeKey(10), testINode(10, 1, "f", inodeFileType))
+		mustSet(t, tx, generateINodeFileBlockKey(10, 0), &pb.INodeFileBlock{Id: proto.Int64(7)})
+		mustSet(t, tx, generateBlockMetaKey(7), &pb.BlockMeta{Id: proto.Int64(7), CollectionId: proto.Int64(10)})
+		mustSet(t, tx, generateBlockStorageKey(7), &pb.BlockStorage{Id: proto.Int64(7)})
+		return nil
+	})
+	api := newAPIServer(s)
+	for uri, want := range map[string]string{
+		"/api/block/7/owner":   `"inode_id":10`,
+		"/api/block/meta/7":    `"collection_id":10`,
+		"/api/block/storage/7": `"id":7`,
+	} {
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, signedGet(uri, "k1", "s"))
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), want) {
+			t.Errorf("GET %s answered %d %s, want %s", uri, w.Code, w.Body.String(), want)
+		}
+	}
+	for uri, code := range map[string]int{
+		"/api/block/x/owner":  http.StatusBadRequest,
+		"/api/block/7/blocks": http.StatusNotFound,
+	} {
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, signedGet(uri, "k1", "s"))
+		if w.Code != code {
+			t.Errorf("GET %s answered %d, want %d", uri, w.Code, code)
+		}
+	}
+	// the signature covers the path the caller sent
+	r := signedGet("/api/block/meta/7", "k1", "s")
+	r.URL.Path = "/api/block/7/owner"
+	w := httptest.NewRecorder()
+	api.ServeHTTP(w, r)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("request signed for another path answered %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	api.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/block/7/owner", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("unsigned request answered %d", w.Code)
+	}
+}
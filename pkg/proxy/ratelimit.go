@@ -0,0 +1,241 @@
+package proxy
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis-force/less-state-hdfs/pkg/proxy/config"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+)
+
+// classes of routes with separate budgets, label values of rateLimitRejectedCounter with concurrency
+const (
+	rateClassRead        = "read"
+	rateClassWrite       = "write"
+	rateClassExpensive   = "expensive"
+	rateLimitConcurrency = "concurrency"
+	// buckets of callers idle for it are dropped, they would be full again anyway
+	rateBucketIdle = 10 * time.Minute
+)
+
+//expensiveOperations routes scanning many keys, recursive deletes, summaries and listings
+var expensiveOperations = map[string]bool{
+	"deleteINodeDirectory":      true,
+	"getINodeDirectoryChildren": true,
+	"getReplicationReport":      true,
+	"getWebhookDeadLetters":     true,
+	"blockReport":               true,
+	"fsck":                      true,
+}
+
+// event streams last as long as the subscriber, they never count against the concurrency cap
+var unboundedOperations = map[string]bool{
+	"events": true,
+}
+
+//rateClass the budget a request is charged to
+func rateClass(c *gin.Context, operation string) string {
+	if expensiveOperations[operation] {
+		return rateClassExpensive
+	}
+	if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+		return rateClassRead
+	}
+	return rateClassWrite
+}
+
+//rateCaller key the buckets by the authenticated principal, by the address of the connection otherwise.
+//X-Forwarded-For and X-Real-Ip are set by the caller, trusting them would give it a bucket per header value
+func rateCaller(c *gin.Context) string {
+	if principal := c.GetString(principalKey); len(principal) > 0 {
+		return "principal:" + principal
+	}
+	return "ip:" + remoteIP(c.Request)
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+//take a token refilled up to now, or the time until the next token if the bucket is empty
+func (b *tokenBucket) take(limit config.RateLimit, now time.Time) (time.Duration, bool) {
+	burst := float64(limit.Burst)
+	if burst < 1 {
+		burst = 1
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	return time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second)), false
+}
+
+type rateBucketKey struct {
+	caller string
+	class  string
+}
+
+//rateLimiter token buckets of every caller and class, and the requests being served,
+//the limits of the file are reloaded when it changes
+type rateLimiter struct {
+	file   string
+	logger *zap.Logger
+	// the configured limits, the file overrides the ones it sets
+	base config.RateLimits
+
+	mu        sync.Mutex
+	limits    config.RateLimits
+	buckets   map[rateBucketKey]*tokenBucket
+	lastSweep time.Time
+	inflight  int
+}
+
+func newRateLimiter(c config.RateLimitConfig, logger *zap.Logger) (*rateLimiter, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+	if err := validateRateLimits(c.RateLimits); err != nil {
+		return nil, err
+	}
+	l := &rateLimiter{
+		file:      c.File,
+		logger:    logger,
+		base:      c.RateLimits,
+		limits:    c.RateLimits,
+		buckets:   make(map[rateBucketKey]*tokenBucket),
+		lastSweep: time.Now(),
+	}
+	if len(l.file) > 0 {
+		if err := l.reload(); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+func validateRateLimits(limits config.RateLimits) error {
+	for class, limit := range map[string]config.RateLimit{
+		rateClassRead:      limits.Read,
+		rateClassWrite:     limits.Write,
+		rateClassExpensive: limits.Expensive,
+	} {
+		if limit.Rate < 0 || limit.Burst < 0 {
+			return fmt.Errorf("rate limit of %s requests must not be negative", class)
+		}
+	}
+	if limits.MaxConcurrent < 0 {
+		return fmt.Errorf("max concurrent requests must not be negative")
+	}
+	return nil
+}
+
+//reload parse the file again over the configured limits, the old limits are kept on error
+func (l *rateLimiter) reload() error {
+	data, err := ioutil.ReadFile(l.file)
+	if err != nil {
+		return err
+	}
+	// classes and fields the file omits keep their configured limits
+	limits := l.base
+	if err = yaml.UnmarshalStrict(data, &limits); err != nil {
+		return fmt.Errorf("parse rate limit file %s error %s", l.file, err)
+	}
+	if err = validateRateLimits(limits); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	l.limits = limits
+	l.mu.Unlock()
+	return nil
+}
+
+func (l *rateLimiter) limit(class string) config.RateLimit {
+	switch class {
+	case rateClassRead:
+		return l.limits.Read
+	case rateClassWrite:
+		return l.limits.Write
+	}
+	return l.limits.Expensive
+}
+
+//allow take a token of the caller for the class, or the time until the caller may retry
+func (l *rateLimiter) allow(caller, class string, now time.Time) (time.Duration, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if now.Sub(l.lastSweep) > rateBucketIdle {
+		for key, b := range l.buckets {
+			if now.Sub(b.last) > rateBucketIdle {
+				delete(l.buckets, key)
+			}
+		}
+		l.lastSweep = now
+	}
+	limit := l.limit(class)
+	if limit.Rate <= 0 {
+		return 0, true
+	}
+	key := rateBucketKey{caller: caller, class: class}
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: math.Max(1, float64(limit.Burst)), last: now}
+		l.buckets[key] = b
+	}
+	return b.take(limit, now)
+}
+
+//acquire a slot of the concurrency cap, false if all are taken
+func (l *rateLimiter) acquire() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.limits.MaxConcurrent > 0 && l.inflight >= l.limits.MaxConcurrent {
+		return false
+	}
+	l.inflight++
+	return true
+}
+
+func (l *rateLimiter) release() {
+	l.mu.Lock()
+	l.inflight--
+	l.mu.Unlock()
+}
+
+//middleware reject with 429 the requests over the concurrency cap or over the budget of their caller.
+//The cap is taken first, a request it rejects keeps the tokens of its caller
+func (l *rateLimiter) middleware(c *gin.Context) {
+	operation := auditOperation(c)
+	class := rateClass(c, operation)
+	bounded := !unboundedOperations[operation]
+	if bounded {
+		if !l.acquire() {
+			rateLimitRejectedCounter.WithLabelValues(rateLimitConcurrency).Inc()
+			c.Header("Retry-After", "1")
+			apiResponseError(c, http.StatusTooManyRequests, fmt.Errorf("too many concurrent requests"))
+			return
+		}
+		defer l.release()
+	}
+	if wait, ok := l.allow(rateCaller(c), class, time.Now()); !ok {
+		rateLimitRejectedCounter.WithLabelValues(class).Inc()
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		apiResponseError(c, http.StatusTooManyRequests, fmt.Errorf("rate limit of %s requests exceeded", class))
+		return
+	}
+	c.Next()
+}
+
+//watch reload the limits on changes of the file
+func (l *rateLimiter) watch(exitChan chan struct{}) {
+	watchFile(l.file, "rate limit", l.logger, exitChan, l.reload)
+}
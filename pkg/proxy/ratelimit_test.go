@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis-force/less-state-hdfs/pkg/proxy/config"
+	"go.uber.org/zap"
+)
+
+func TestRateCaller(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	c.Request.RemoteAddr = "10.0.0.1:4321"
+	c.Request.Header.Set("X-Forwarded-For", "1.2.3.4")
+	c.Request.Header.Set("X-Real-Ip", "5.6.7.8")
+	if got := rateCaller(c); got != "ip:10.0.0.1" {
+		t.Fatalf("unauthenticated caller %q", got)
+	}
+	c.Set(principalKey, "namenode")
+	if got := rateCaller(c); got != "principal:namenode" {
+		t.Fatalf("authenticated caller %q", got)
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	limit := config.RateLimit{Rate: 2, Burst: 3}
+	now := time.Now()
+	b := &tokenBucket{tokens: 3, last: now}
+	for i := 0; i < 3; i++ {
+		if _, ok := b.take(limit, now); !ok {
+			t.Fatalf("burst token %d rejected", i)
+		}
+	}
+	wait, ok := b.take(limit, now)
+	if ok || wait != 500*time.Millisecond {
+		t.Fatalf("empty bucket ok %v wait %s", ok, wait)
+	}
+	if _, ok = b.take(limit, now.Add(500*time.Millisecond)); !ok {
+		t.Fatal("refilled token rejected")
+	}
+	// refills never exceed the burst
+	later := now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if _, ok = b.take(limit, later); !ok {
+			t.Fatalf("token %d after idling rejected", i)
+		}
+	}
+	if _, ok = b.take(limit, later); ok {
+		t.Fatal("bucket refilled over its burst")
+	}
+}
+
+func TestRateLimitFileOverrides(t *testing.T) {
+	f, err := ioutil.TempFile("", "ratelimit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("read:\n  rate: 5\n")
+	f.Close()
+	base := config.RateLimits{
+		Read:          config.RateLimit{Rate: 100, Burst: 10},
+		Write:         config.RateLimit{Rate: 50, Burst: 20},
+		MaxConcurrent: 8,
+	}
+	l, err := newRateLimiter(config.RateLimitConfig{Enabled: true, File: f.Name(), RateLimits: base}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := base
+	want.Read.Rate = 5
+	if l.limits != want {
+		t.Fatalf("limits %+v, want %+v", l.limits, want)
+	}
+}
+
+func TestConcurrencyRejectKeepsTokens(t *testing.T) {
+	l, err := newRateLimiter(config.RateLimitConfig{Enabled: true, RateLimits: config.RateLimits{
+		Read:          config.RateLimit{Rate: 1, Burst: 1},
+		MaxConcurrent: 1,
+	}}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.GET("/", l.middleware, func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	serve := func() int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+		return w.Code
+	}
+	// another request holds the only slot
+	l.acquire()
+	if code := serve(); code != http.StatusTooManyRequests {
+		t.Fatalf("request over the cap answered %d", code)
+	}
+	l.release()
+	if code := serve(); code != http.StatusOK {
+		t.Fatalf("request after the cap rejected one answered %d", code)
+	}
+}
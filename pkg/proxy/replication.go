@@ -0,0 +1,208 @@
+package proxy
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pingcap/tidb/kv"
+	"github.com/redis-force/less-state-hdfs/pkg/model"
+	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+	"go.uber.org/zap"
+)
+
+const (
+	replicationMissing = "missing"
+	replicationCorrupt = "corrupt"
+	replicationUnder   = "under"
+	replicationOver    = "over"
+)
+
+// classes from the most severe, a missing block is not reported corrupt nor a corrupt one under replicated
+var replicationClasses = []string{replicationMissing, replicationCorrupt, replicationUnder, replicationOver}
+
+type replicationScan struct {
+	timestamp uint64
+	scanned   int64
+	counts    map[string]int
+	blocks    []model.ReplicationBlock
+}
+
+type replicationScanner struct {
+	mu     sync.Mutex
+	scanMu sync.Mutex
+	last   *replicationScan
+}
+
+func (s *Proxy) runReplicationScanner() {
+	interval := s.config.ReplicationScanInterval
+	if interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.exitChan:
+			return
+		case <-ticker.C:
+			if _, err := s.scanReplication(withTxnPriority(context.Background(), priorityLow)); err != nil {
+				s.logger.Error("replication scan error", zap.Error(err))
+			}
+		}
+	}
+}
+
+//scanReplication walk all block metas at one snapshot and classify blocks by live, corrupt and expected replicas.
+//Classes are ordered by severity, see replicationClasses
+func (s *Proxy) scanReplication(ctx context.Context) (*replicationScan, error) {
+	s.replication.scanMu.Lock()
+	defer s.replication.scanMu.Unlock()
+	start := time.Now()
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	scan := &replicationScan{
+		timestamp: tx.StartTS(),
+		counts:    make(map[string]int, len(replicationClasses)),
+		blocks:    make([]model.ReplicationBlock, 0),
+	}
+	inodeReplication := make(map[int64]int16)
+	err = s.scanPrefix(ctx, tx, blockMetaKeyPrefix, func(key, val []byte) error {
+		bm := new(pb.BlockMeta)
+		if err := proto.Unmarshal(val, bm); err != nil {
+			return err
+		}
+		if bm.GetId() == 0 {
+			if id, ok := parseIDKey(blockMetaKeyPrefix, key); ok {
+				bm.Id = proto.Int64(id)
+			}
+		}
+		b, err := s.checkBlockReplication(ctx, tx, bm, inodeReplication)
+		if err != nil {
+			return err
+		}
+		scan.scanned++
+		// a block is reported once, in the most severe of its classes
+		switch {
+		case b.Live == 0:
+			b.Class = replicationMissing
+		case b.Corrupt > 0:
+			b.Class = replicationCorrupt
+		case b.Live < int(b.Expected):
+			b.Class = replicationUnder
+		case b.Live > int(b.Expected):
+			b.Class = replicationOver
+		default:
+			return nil
+		}
+		scan.blocks = append(scan.blocks, b)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	classOrder := make(map[string]int, len(replicationClasses))
+	for i, class := range replicationClasses {
+		classOrder[class] = i
+	}
+	sort.Slice(scan.blocks, func(i, j int) bool {
+		if scan.blocks[i].Class != scan.blocks[j].Class {
+			return classOrder[scan.blocks[i].Class] < classOrder[scan.blocks[j].Class]
+		}
+		return scan.blocks[i].BlockID < scan.blocks[j].BlockID
+	})
+	for _, b := range scan.blocks {
+		scan.counts[b.Class]++
+	}
+	s.replication.mu.Lock()
+	s.replication.last = scan
+	s.replication.mu.Unlock()
+	s.logger.Info("replication scan finished", zap.Int64("scanned", scan.scanned), zap.Int("reported", len(scan.blocks)), zap.Duration("cost", time.Since(start)))
+	return scan, nil
+}
+
+func (s *Proxy) checkBlockReplication(ctx context.Context, tx kv.Transaction, bm *pb.BlockMeta, inodeReplication map[int64]int16) (model.ReplicationBlock, error) {
+	b := model.ReplicationBlock{
+		BlockID:  bm.GetId(),
+		INodeID:  bm.GetCollectionId(),
+		Expected: int16(bm.GetReplication()),
+	}
+	if b.Expected <= 0 && b.INodeID > 0 {
+		// block meta没有副本数, 使用文件header中的副本数
+		replication, ok := inodeReplication[b.INodeID]
+		if !ok {
+			m := new(pb.INodeMeta)
+			if err := s.transGet(ctx, tx, generateINodeKey(b.INodeID), m); err != nil && !kv.ErrNotExist.Equal(err) {
+				return b, err
+			}
+			replication = headerReplication(m.GetHeader())
+			inodeReplication[b.INodeID] = replication
+		}
+		b.Expected = replication
+	}
+	if b.Expected <= 0 {
+		b.Expected = s.config.DefaultReplication
+	}
+	bs := new(pb.BlockStorage)
+	if err := s.transGet(ctx, tx, generateBlockStorageKey(b.BlockID), bs); err != nil && !kv.ErrNotExist.Equal(err) {
+		return b, err
+	}
+	b.Live = len(bs.GetNodes())
+	bc := new(pb.BlockStorage)
+	if err := s.transGet(ctx, tx, generateBlockCorruptKey(b.BlockID), bc); err != nil && !kv.ErrNotExist.Equal(err) {
+		return b, err
+	}
+	b.Corrupt = len(bc.GetNodes())
+	return b, nil
+}
+
+//GetReplicationReport return a page of the latest replication scan, scan synchronously if refresh or never scanned
+func (s *Proxy) GetReplicationReport(ctx context.Context, class string, offset, limit int, refresh bool) (*model.ReplicationReport, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.GetReplicationReport")
+	defer span.Finish()
+	s.replication.mu.Lock()
+	scan := s.replication.last
+	s.replication.mu.Unlock()
+	if scan == nil || refresh {
+		var err error
+		if scan, err = s.scanReplication(ctx); err != nil {
+			return nil, err
+		}
+	}
+	report := &model.ReplicationReport{
+		Timestamp: scan.timestamp,
+		Scanned:   scan.scanned,
+		Counts:    make(map[string]int, len(replicationClasses)),
+		Class:     class,
+		Offset:    offset,
+		Limit:     limit,
+	}
+	for _, c := range replicationClasses {
+		report.Counts[c] = scan.counts[c]
+	}
+	blocks := scan.blocks
+	if len(class) > 0 {
+		blocks = make([]model.ReplicationBlock, 0, scan.counts[class])
+		for _, b := range scan.blocks {
+			if b.Class == class {
+				blocks = append(blocks, b)
+			}
+		}
+	}
+	report.Total = len(blocks)
+	if offset > len(blocks) {
+		offset = len(blocks)
+	}
+	end := offset + limit
+	if end > len(blocks) {
+		end = len(blocks)
+	}
+	report.Blocks = blocks[offset:end]
+	return report, nil
+}
@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pingcap/tidb/kv"
+	"github.com/redis-force/less-state-hdfs/pkg/model"
+	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+	"github.com/redis-force/less-state-hdfs/pkg/proxy/config"
+)
+
+func storageNodes(n int) []*pb.BlockStorageNode {
+	nodes := make([]*pb.BlockStorageNode, n)
+	for i := range nodes {
+		nodes[i] = &pb.BlockStorageNode{DataNodeId: proto.String(string(rune('a' + i))), StorageId: proto.String("s")}
+	}
+	return nodes
+}
+
+//setReplicationBlocks write blocks of file 10 by id with their live and corrupt replicas, the file expects 3
+func setReplicationBlocks(t *testing.T, s *Proxy, blocks map[int64][2]int) {
+	t.Helper()
+	mustRunTxn(t, s, func(tx kv.Transaction) error {
+		m := testINode(10, 1, "f", inodeFileType)
+		m.Header = proto.Int64(buildHeader(128, 3, false, 0))
+		mustSet(t, tx, generateINodeKey(10), m)
+		for id, replicas := range blocks {
+			mustSet(t, tx, generateBlockMetaKey(id), &pb.BlockMeta{Id: proto.Int64(id), CollectionId: proto.Int64(10)})
+			if replicas[0] > 0 {
+				mustSet(t, tx, generateBlockStorageKey(id), &pb.BlockStorage{Id: proto.Int64(id), Nodes: storageNodes(replicas[0])})
+			}
+			if replicas[1] > 0 {
+				mustSet(t, tx, generateBlockCorruptKey(id), &pb.BlockStorage{Id: proto.Int64(id), Nodes: storageNodes(replicas[1])})
+			}
+		}
+		return nil
+	})
+}
+
+func TestReplicationScanClassifiesOnce(t *testing.T) {
+	s := newTestProxy()
+	setReplicationBlocks(t, s, map[int64][2]int{
+		1: {0, 1}, // missing, not corrupt
+		2: {1, 1}, // corrupt, not under replicated
+		3: {2, 0},
+		4: {4, 0},
+		5: {3, 0},
+		6: {4, 1}, // corrupt, not over replicated
+	})
+	report, err := s.GetReplicationReport(context.Background(), "", 0, 10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []model.ReplicationBlock{
+		{BlockID: 1, INodeID: 10, Class: replicationMissing, Expected: 3, Live: 0, Corrupt: 1},
+		{BlockID: 2, INodeID: 10, Class: replicationCorrupt, Expected: 3, Live: 1, Corrupt: 1},
+		{BlockID: 6, INodeID: 10, Class: replicationCorrupt, Expected: 3, Live: 4, Corrupt: 1},
+		{BlockID: 3, INodeID: 10, Class: replicationUnder, Expected: 3, Live: 2},
+		{BlockID: 4, INodeID: 10, Class: replicationOver, Expected: 3, Live: 4},
+	}
+	if report.Scanned != 6 || report.Total != len(want) || len(report.Blocks) != len(want) {
+		t.Fatalf("report %+v", report)
+	}
+	for i, b := range want {
+		if report.Blocks[i] != b {
+			t.Errorf("block %d %+v, want %+v", i, report.Blocks[i], b)
+		}
+	}
+	counts := map[string]int{replicationMissing: 1, replicationCorrupt: 2, replicationUnder: 1, replicationOver: 1}
+	for class, n := range counts {
+		if report.Counts[class] != n {
+			t.Errorf("%s count %d, want %d", class, report.Counts[class], n)
+		}
+	}
+
+	page, err := s.GetReplicationReport(context.Background(), replicationCorrupt, 1, 1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 2 || len(page.Blocks) != 1 || page.Blocks[0].BlockID != 6 || page.Timestamp != report.Timestamp {
+		t.Fatalf("second corrupt block page %+v", page)
+	}
+}
+
+func TestReplicationRefreshNeedsSuperuser(t *testing.T) {
+	s := newTestProxy()
+	s.permission = newPermissionChecker(config.PermissionConfig{Enabled: true, SuperUser: "hdfs"})
+	authenticators, err := newAuthenticators(config.AuthConfig{
+		HMACKeys: []config.AuthHMACKey{{ID: "k1", Principal: "nn", Secret: "s"}, {ID: "k2", Principal: "hdfs", Secret: "t"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.authenticators = authenticators
+	setReplicationBlocks(t, s, map[int64][2]int{1: {0, 0}})
+	api := newAPIServer(s)
+	for _, c := range []struct {
+		uri, key, secret string
+		code             int
+	}{
+		{"/api/blocks/replication-report", "k1", "s", http.StatusOK},
+		{"/api/blocks/replication-report?refresh", "k1", "s", http.StatusForbidden},
+		{"/api/blocks/replication-report?refresh", "k2", "t", http.StatusOK},
+	} {
+		w := httptest.NewRecorder()
+		api.ServeHTTP(w, signedGet(c.uri, c.key, c.secret))
+		if w.Code != c.code {
+			t.Errorf("GET %s by %s answered %d %s, want %d", c.uri, c.key, w.Code, w.Body.String(), c.code)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package proxy
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/tikv"
+	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+	"github.com/redis-force/less-state-hdfs/pkg/proxy/config"
+	"go.uber.org/zap"
+)
+
+// the backoff stops doubling after it
+const maxTxnRetryShift = 16
+
+// reasons a transaction is run again, label values of txnRetryCounter
+const (
+	retryWriteConflict = "write_conflict"
+	retryRegion        = "region"
+	retryLockNotFound  = "lock_not_found"
+	retryEventWindow   = "event_window"
+	retryOther         = "other"
+)
+
+// messages of the tikv errors without an error code, matched on the cause only
+const (
+	tikvWriteConflictPrefix = "WriteConflict:"
+	// the primary lock of the commit is gone, a concurrent transaction resolved it
+	tikvCommitFailedMark = " 2PC commit failed: "
+)
+
+//errChangeEventWindow the events of the transaction would commit after readers passed their txid
+var errChangeEventWindow = errors.New("change events missed their commit window")
+
+//retryReason classify the errors of tikv a new transaction may succeed after, empty if it is not retryable.
+//Errors are matched by their code, the write conflicts and failed commits of tikv only by the message of their cause.
+func retryReason(err error) string {
+	if err == nil || isContextError(err) {
+		return ""
+	}
+	cause := errors.Cause(err)
+	msg := cause.Error()
+	switch {
+	case cause == errChangeEventWindow:
+		return retryEventWindow
+	case kv.ErrLockConflict.Equal(cause), kv.ErrRetryable.Equal(cause), strings.HasPrefix(msg, tikvWriteConflictPrefix):
+		return retryWriteConflict
+	case tikv.ErrRegionUnavailable.Equal(cause), tikv.ErrTiKVServerBusy.Equal(cause), tikv.ErrTiKVServerTimeout.Equal(cause),
+		tikv.ErrResolveLockTimeout.Equal(cause), tikv.ErrPDServerTimeout.Equal(cause):
+		return retryRegion
+	case strings.HasPrefix(msg, "con:") && strings.Contains(msg, tikvCommitFailedMark):
+		return retryLockNotFound
+	case kv.IsRetryableError(err):
+		return retryOther
+	}
+	return ""
+}
+
+//runTxn run fn in a transaction and commit it, read only transactions are rolled back.
+//On a retryable error the whole closure runs again in a new transaction after a jittered exponential backoff,
+//until the attempts or the backoff budget are used up. fn must only change state through the transaction.
+//With load shedding enabled it fails with ErrOverloaded if its priority used up its share of the adaptive limit.
+func (s *Proxy) runTxn(ctx context.Context, fn func(tx kv.Transaction) error) error {
+	attempts := s.config.TxnRetry.Attempts
+	if attempts <= 0 {
+		attempts = config.DefaultTxnRetryAttempts
+	}
+	backoff := s.config.TxnRetry.Backoff
+	if backoff <= 0 {
+		backoff = config.DefaultTxnRetryBackoff
+	}
+	budget := s.config.TxnRetry.Budget
+	if budget <= 0 {
+		budget = config.DefaultTxnRetryBudget
+	}
+	backoffs := 0
+	if s.shedder != nil {
+		if err := s.shedder.acquire(txnPriority(ctx)); err != nil {
+			return err
+		}
+		start := time.Now()
+		defer func() {
+			s.shedder.release(time.Since(start), backoffs)
+		}()
+	}
+	for attempt := 1; ; attempt++ {
+		err := s.runTxnOnce(ctx, fn)
+		reason := retryReason(err)
+		if len(reason) == 0 {
+			return err
+		}
+		backoffs++
+		if attempt >= attempts || budget <= 0 {
+			txnRetryExhaustedCounter.Inc()
+			s.logger.Warn("transaction retries exhausted", zap.Int("attempts", attempt), zap.String("reason", reason), zap.Error(err))
+			return err
+		}
+		shift := attempt - 1
+		if shift > maxTxnRetryShift {
+			shift = maxTxnRetryShift
+		}
+		sleep := time.Duration(rand.Int63n(int64(backoff) << uint(shift)))
+		if sleep > budget {
+			sleep = budget
+		}
+		budget -= sleep
+		txnRetryCounter.WithLabelValues(reason).Inc()
+		if span := opentracing.SpanFromContext(ctx); span != nil {
+			span.LogKV("event", "txn retry", "attempt", attempt, "reason", reason, "backoff", sleep.String())
+		}
+		s.logger.Debug("retry transaction", zap.Int("attempt", attempt), zap.String("reason", reason),
+			zap.Duration("backoff", sleep), zap.Error(err))
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(sleep):
+		}
+	}
+}
+
+func (s *Proxy) runTxnOnce(ctx context.Context, fn func(tx kv.Transaction) error) error {
+	tx, err := s.begin(ctx)
+	if err != nil {
+		return err
+	}
+	locks, err := s.transCheckPermissionScope(ctx, tx)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	e := retryEntryFromContext(ctx)
+	var expired *pb.RetryCacheEntry
+	if e != nil && !e.recorded {
+		if expired, err = s.transLookupRetry(ctx, tx, e); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if tx.IsReadOnly() {
+		tx.Rollback()
+		return nil
+	}
+	if len(locks) > 0 {
+		if err = tx.LockKeys(locks...); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if e != nil && !e.recorded {
+		if err = s.transRecordRetry(ctx, tx, e, expired); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err = tx.Commit(ctx); err != nil {
+		return err
+	}
+	if e != nil {
+		e.recorded = true
+	}
+	if scope := permissionScopeFromContext(ctx); scope != nil {
+		scope.committed = true
+	}
+	return nil
+}
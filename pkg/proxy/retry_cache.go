@@ -0,0 +1,273 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang/protobuf/proto"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/kv"
+	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+	"go.uber.org/zap"
+)
+
+const (
+	maxRequestIDLength      = 128
+	defaultRetryCacheExpiry = 10 * time.Minute
+	defaultRetryCacheSweep  = time.Minute
+	// expired entries deleted by one transaction of the sweeper
+	retryCacheSweepBatch = 1024
+)
+
+//retryCacheOperations routes applied at most once per request id like the at most once calls of the namenode,
+//they respond no body on success so a retry is answered from the recorded version only, or from retryCacheBodies
+var retryCacheOperations = map[string]bool{
+	"putBlock":                  true,
+	"deleteBlock":               true,
+	"putBlockStorage":           true,
+	"putINodeFile":              true,
+	"updateINodeFile":           true,
+	"deleteINodeFile":           true,
+	"putINodeFileBlock":         true,
+	"updateINodeFileBlock":      true,
+	"deleteINodeFileBlock":      true,
+	"truncateINodeFile":         true,
+	"putINodeDirectory":         true,
+	"deleteINodeDirectory":      true,
+	"putINodeDirectoryChild":    true,
+	"deleteINodeDirectoryChild": true,
+	"updateINodeParent":         true,
+}
+
+//retryCacheBodies bodies of the cached routes echoing their request, built from the retry again
+var retryCacheBodies = map[string]func(c *gin.Context) (interface{}, error){
+	"updateINodeFileBlock": func(c *gin.Context) (interface{}, error) {
+		return bindINodeFileBlock(c)
+	},
+}
+
+// a concurrent request with the same id committed first
+var errRetryCacheHit = errors.New("Error request already served.")
+
+type retryEntryKey struct{}
+
+//retryEntry the request id of a mutating request, recorded by the first transaction of the request that writes
+type retryEntry struct {
+	key       []byte
+	operation string
+	// version of the inode or block meta the request wrote, its ETag
+	version  int64
+	recorded bool
+}
+
+func retryEntryFromContext(ctx context.Context) *retryEntry {
+	e, _ := ctx.Value(retryEntryKey{}).(*retryEntry)
+	return e
+}
+
+//recordVersion keep the version written by the request for the replays of its retries
+func recordVersion(ctx context.Context, version int64) {
+	if e := retryEntryFromContext(ctx); e != nil {
+		e.version = version
+	}
+}
+
+func (s *Proxy) retryCacheExpiry() time.Duration {
+	if s.config.RetryCache.Expiry > 0 {
+		return s.config.RetryCache.Expiry
+	}
+	return defaultRetryCacheExpiry
+}
+
+//transLookupRetry errRetryCacheHit if a request with the id committed before the transaction, run before the
+//request changes anything so a duplicate is not applied again
+func (s *Proxy) transLookupRetry(ctx context.Context, tx kv.Transaction, e *retryEntry) (*pb.RetryCacheEntry, error) {
+	cached := new(pb.RetryCacheEntry)
+	err := s.transGet(ctx, tx, e.key, cached)
+	if kv.ErrNotExist.Equal(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cached.GetExpireTime() > time.Now().UnixNano() {
+		e.version = cached.GetVersion()
+		return nil, errRetryCacheHit
+	}
+	return cached, nil
+}
+
+//transRecordRetry write the request id with the result into the transaction applying the request, replacing
+//the expired entry of the lookup. A concurrent duplicate writes the same key, so only one of them commits.
+func (s *Proxy) transRecordRetry(ctx context.Context, tx kv.Transaction, e *retryEntry, expired *pb.RetryCacheEntry) error {
+	if expired != nil {
+		if err := s.transDel(ctx, tx, generateRetryCacheExpiryKey(expired.GetExpireTime(), e.key)); err != nil {
+			return err
+		}
+	}
+	expire := time.Now().Add(s.retryCacheExpiry()).UnixNano()
+	if err := s.transSet(ctx, tx, e.key, &pb.RetryCacheEntry{
+		Operation:  proto.String(e.operation),
+		Version:    proto.Int64(e.version),
+		ExpireTime: proto.Int64(expire),
+	}); err != nil {
+		return err
+	}
+	return tx.Set(generateRetryCacheExpiryKey(expire, e.key), []byte{0})
+}
+
+//getRetryEntry the result recorded for the key, nil if there is none or it expired
+func (s *Proxy) getRetryEntry(ctx context.Context, key []byte) (*pb.RetryCacheEntry, error) {
+	var cached *pb.RetryCacheEntry
+	err := s.runTxn(ctx, func(tx kv.Transaction) error {
+		cached = new(pb.RetryCacheEntry)
+		err := s.transGet(ctx, tx, key, cached)
+		if kv.ErrNotExist.Equal(err) {
+			cached = nil
+			return nil
+		}
+		return err
+	})
+	if err != nil || cached == nil || cached.GetExpireTime() <= time.Now().UnixNano() {
+		return nil, err
+	}
+	return cached, nil
+}
+
+//retryCacheMiddleware answer the retries of served requests with their recorded result instead of applying them again
+func (p *Proxy) retryCacheMiddleware(c *gin.Context) {
+	id := c.GetHeader(requestIDHeader)
+	operation := auditOperation(c)
+	if len(id) == 0 || !retryCacheOperations[operation] {
+		c.Next()
+		return
+	}
+	if len(id) > maxRequestIDLength {
+		apiResponseError(c, http.StatusBadRequest, fmt.Errorf("%s longer than %d", requestIDHeader, maxRequestIDLength))
+		return
+	}
+	ctx := c.Request.Context()
+	e := &retryEntry{key: generateRetryCacheKey(c.GetString(principalKey), id), operation: operation}
+	cached, err := p.getRetryEntry(ctx, e.key)
+	if err != nil {
+		apiResponseError(c, http.StatusInternalServerError, err)
+		return
+	}
+	if cached != nil {
+		if cached.GetOperation() != operation {
+			apiResponseError(c, http.StatusConflict, fmt.Errorf("request id %s was used by %s", id, cached.GetOperation()))
+			return
+		}
+		e.version = cached.GetVersion()
+		replayRetryCache(c, e)
+		return
+	}
+	retryCacheCounter.WithLabelValues("miss").Inc()
+	c.Request = c.Request.WithContext(context.WithValue(ctx, retryEntryKey{}, e))
+	c.Next()
+}
+
+//replayRetryCache answer a retry with the result of the request it repeats
+func replayRetryCache(c *gin.Context, e *retryEntry) {
+	retryCacheCounter.WithLabelValues("hit").Inc()
+	if e.version > 0 {
+		c.Header(etagHeader, formatETag(e.version))
+	}
+	if body, ok := retryCacheBodies[e.operation]; ok {
+		resp, err := body(c)
+		if err != nil {
+			apiResponseError(c, http.StatusBadRequest, err)
+			return
+		}
+		apiResponseSuccess(c, resp)
+		return
+	}
+	apiResponseSuccess(c, nil)
+}
+
+func (s *Proxy) runRetryCacheSweeper() {
+	if !s.config.RetryCache.Enabled {
+		return
+	}
+	interval := s.config.RetryCache.SweepInterval
+	if interval <= 0 {
+		interval = defaultRetryCacheSweep
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.exitChan:
+			return
+		case <-ticker.C:
+			deleted, err := s.sweepRetryCache(withTxnPriority(context.Background(), priorityLow))
+			if err != nil {
+				s.logger.Error("retry cache sweep error", zap.Error(err))
+				continue
+			}
+			s.logger.Debug("retry cache swept", zap.Int("deleted", deleted))
+		}
+	}
+}
+
+//sweepRetryCache delete the expired entries batch by batch, only the expired part of the expiry index is scanned
+func (s *Proxy) sweepRetryCache(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		deleted, err := s.sweepRetryCacheBatch(ctx)
+		total += deleted
+		if err != nil || deleted < retryCacheSweepBatch {
+			return total, err
+		}
+	}
+}
+
+func (s *Proxy) sweepRetryCacheBatch(ctx context.Context) (int, error) {
+	var expired [][]byte
+	err := s.runTxn(ctx, func(tx kv.Transaction) error {
+		expired = expired[:0]
+		now := time.Now().UnixNano()
+		it, err := tx.Iter(retryCacheExpiryPrefix, generateRetryCacheExpiryKey(now+1, nil))
+		if err != nil {
+			return err
+		}
+		for it.Valid() && len(expired) < retryCacheSweepBatch {
+			if key := it.Key(); bytes.HasPrefix(key, retryCacheExpiryPrefix) {
+				expired = append(expired, append([]byte(nil), key...))
+			}
+			if err = it.Next(); err != nil {
+				it.Close()
+				return err
+			}
+		}
+		it.Close()
+		for _, key := range expired {
+			if len(key) > len(retryCacheExpiryPrefix)+8 {
+				entry := key[len(retryCacheExpiryPrefix)+8:]
+				// the request id may have been used again since, its newer entry stays
+				cached := new(pb.RetryCacheEntry)
+				err := s.transGet(ctx, tx, entry, cached)
+				if err != nil && !kv.ErrNotExist.Equal(err) {
+					return err
+				}
+				if err == nil && cached.GetExpireTime() <= now {
+					if err = s.transDel(ctx, tx, entry); err != nil {
+						return err
+					}
+				}
+			}
+			if err = s.transDel(ctx, tx, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(expired), nil
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/kv"
+	"github.com/redis-force/less-state-hdfs/pkg/model"
+	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+)
+
+func TestRetryCacheLookupBeforeApply(t *testing.T) {
+	s := newTestProxy()
+	key := generateRetryCacheKey("namenode", "r1")
+	applied := 0
+	var ctx context.Context
+	apply := func(tx kv.Transaction) error {
+		applied++
+		recordVersion(ctx, 3)
+		return tx.Set(generateINodeKey(2), []byte{1})
+	}
+	first := &retryEntry{key: key, operation: "putINodeFile"}
+	ctx = context.WithValue(context.Background(), retryEntryKey{}, first)
+	if err := s.runTxn(ctx, apply); err != nil {
+		t.Fatal(err)
+	}
+	retry := &retryEntry{key: key, operation: "putINodeFile"}
+	ctx = context.WithValue(context.Background(), retryEntryKey{}, retry)
+	if err := s.runTxn(ctx, apply); errors.Cause(err) != errRetryCacheHit {
+		t.Fatalf("duplicate error %v", err)
+	}
+	if applied != 1 || retry.version != 3 {
+		t.Fatalf("applied %d times, replayed version %d", applied, retry.version)
+	}
+}
+
+func TestSweepRetryCache(t *testing.T) {
+	s := newTestProxy()
+	now := time.Now()
+	expired := now.Add(-time.Minute).UnixNano()
+	mustRunTxn(t, s, func(tx kv.Transaction) error {
+		for i := 0; i <= retryCacheSweepBatch; i++ {
+			key := generateRetryCacheKey("namenode", fmt.Sprintf("r%d", i))
+			mustSet(t, tx, key, &pb.RetryCacheEntry{Operation: proto.String("putBlock"), ExpireTime: proto.Int64(expired)})
+			tx.Set(generateRetryCacheExpiryKey(expired, key), []byte{0})
+		}
+		// the id was used again later, the newer entry outlives the old expiry entry
+		key := generateRetryCacheKey("namenode", "r0")
+		live := now.Add(time.Hour).UnixNano()
+		mustSet(t, tx, key, &pb.RetryCacheEntry{Operation: proto.String("putBlock"), ExpireTime: proto.Int64(live)})
+		return tx.Set(generateRetryCacheExpiryKey(live, key), []byte{0})
+	})
+	deleted, err := s.sweepRetryCache(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != retryCacheSweepBatch+1 {
+		t.Fatalf("swept %d expiry entries", deleted)
+	}
+	store := s.store.(*memStore)
+	if got := store.keys(string(retryCacheKeyPrefix)); len(got) != 1 || got[0] != string(generateRetryCacheKey("namenode", "r0")) {
+		t.Fatalf("entries left %d", len(got))
+	}
+	if got := store.keys(string(retryCacheExpiryPrefix)); len(got) != 1 {
+		t.Fatalf("expiry entries left %d", len(got))
+	}
+}
+
+func TestUpdatesRecordVersion(t *testing.T) {
+	s := newTestProxy()
+	mustRunTxn(t, s, func(tx kv.Transaction) error {
+		mustSet(t, tx, generateINodeKey(1), testINode(1, 0, "", inodeDirectoryType))
+		mustSet(t, tx, generateINodeKey(2), testINode(2, 1, "d", inodeDirectoryType))
+		m := testINode(10, 1, "f", inodeFileType)
+		m.Version = proto.Int64(2)
+		mustSet(t, tx, generateINodeKey(10), m)
+		mustSet(t, tx, generateINodeDirectoryChildKey(1, "f"), &pb.INodeID{Id: proto.Int64(10)})
+		return nil
+	})
+	e := &retryEntry{key: generateRetryCacheKey("namenode", "r1"), operation: "updateINodeFile"}
+	ctx := context.WithValue(context.Background(), retryEntryKey{}, e)
+	version, err := s.UpdateINodeFile(ctx, &model.INodeFile{ID: 10, Name: "f", ParentID: 1, Permission: 0755})
+	if err != nil || version != 3 || e.version != 3 {
+		t.Fatalf("file update version %d, recorded %d, error %v", version, e.version, err)
+	}
+	e = &retryEntry{key: generateRetryCacheKey("namenode", "r2"), operation: "updateINodeParent"}
+	ctx = context.WithValue(context.Background(), retryEntryKey{}, e)
+	version, err = s.UpdateINodeParent(ctx, 10, 2, 1)
+	if err != nil || version != 4 || e.version != 4 {
+		t.Fatalf("parent update version %d, recorded %d, error %v", version, e.version, err)
+	}
+}
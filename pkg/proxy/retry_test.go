@@ -0,0 +1,40 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/kv"
+	"github.com/pingcap/tidb/store/tikv"
+)
+
+func TestRetryReason(t *testing.T) {
+	// tikv annotates the errors a new transaction may succeed after with it
+	const retryable = "[try again later]"
+	for _, tc := range []struct {
+		err  error
+		want string
+	}{
+		{err: nil},
+		{err: context.Canceled},
+		{err: errors.Annotate(context.DeadlineExceeded, retryable)},
+		{err: errors.Trace(errChangeEventWindow), want: retryEventWindow},
+		{err: errors.Annotate(errors.New("WriteConflict: startTS=1, conflictTS=2, key={in}_1 primary={in}_1"), retryable), want: retryWriteConflict},
+		{err: errors.Trace(kv.ErrLockConflict), want: retryWriteConflict},
+		{err: kv.ErrRetryable, want: retryWriteConflict},
+		{err: errors.Trace(tikv.ErrRegionUnavailable), want: retryRegion},
+		{err: errors.Annotate(tikv.ErrTiKVServerBusy, "prewrite"), want: retryRegion},
+		{err: tikv.ErrPDServerTimeout.GenWithStackByArgs(retryable), want: retryRegion},
+		{err: errors.Annotate(errors.New("con:0 2PC commit failed: txn_not_found"), retryable), want: retryLockNotFound},
+		{err: errors.Annotate(errors.New("tikv restarts txn: stale epoch"), retryable), want: retryOther},
+		// messages merely mentioning regions or conflicts are not retried
+		{err: errors.New("block of region rack-3 has no storage")},
+		{err: errors.Annotate(errors.New("decode inode error"), "WriteConflict: would be swallowed")},
+		{err: kv.ErrNotExist},
+	} {
+		if got := retryReason(tc.err); got != tc.want {
+			t.Errorf("retryReason(%v) = %q, want %q", tc.err, got, tc.want)
+		}
+	}
+}
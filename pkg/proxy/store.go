@@ -5,6 +5,7 @@ import (
 	"context"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/opentracing/opentracing-go"
 	"github.com/pingcap/errors"
 	"github.com/pingcap/tidb/kv"
 	"github.com/redis-force/less-state-hdfs/pkg/model"
@@ -13,12 +14,9 @@ import (
 )
 
 func (s *Proxy) set(ctx context.Context, key []byte, m proto.Message) error {
-	tx, err := s.store.Begin()
-	err = s.transSet(ctx, tx, key, m)
-	if err != nil {
-		return err
-	}
-	return tx.Commit(ctx)
+	return s.runTxn(ctx, func(tx kv.Transaction) error {
+		return s.transSet(ctx, tx, key, m)
+	})
 }
 
 func (s *Proxy) transSet(ctx context.Context, tx kv.Transaction, key []byte, m proto.Message) error {
@@ -35,14 +33,14 @@ func (s *Proxy) transSet(ctx context.Context, tx kv.Transaction, key []byte, m p
 }
 
 func (s *Proxy) get(ctx context.Context, key []byte, m proto.Message) error {
-	tx, err := s.store.Begin()
-	if err != nil {
-		return err
-	}
-	return s.transGet(ctx, tx, key, m)
+	return s.runTxn(ctx, func(tx kv.Transaction) error {
+		return s.transGet(ctx, tx, key, m)
+	})
 }
 
 func (s *Proxy) transGet(ctx context.Context, tx kv.Transaction, key []byte, m proto.Message) error {
+	span, _ := opentracing.StartSpanFromContext(ctx, "transGet")
+	defer span.Finish()
 	val, err := tx.Get(key)
 	if err != nil {
 		return err
@@ -61,127 +59,162 @@ func (s *Proxy) transDel(ctx context.Context, tx kv.Transaction, keys ...[]byte)
 	return nil
 }
 
-func (s *Proxy) del(ctx context.Context, keys ...[]byte) error {
-	tx, err := s.store.Begin()
+//scanPrefix call fn with every key value pair having the prefix
+func (s *Proxy) scanPrefix(ctx context.Context, tx kv.Transaction, prefix []byte, fn func(key, val []byte) error) error {
+	it, err := tx.Iter(prefix, nil)
 	if err != nil {
-		return err
+		return errors.Trace(err)
 	}
-	if err = s.transDel(ctx, tx, keys...); err != nil {
-		return err
+	defer it.Close()
+	for it.Valid() {
+		key := it.Key()
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		}
+		if err = fn(key, it.Value()); err != nil {
+			return err
+		}
+		if err = it.Next(); err != nil {
+			return errors.Trace(err)
+		}
 	}
-	return tx.Commit(ctx)
+	return nil
+}
+
+func (s *Proxy) del(ctx context.Context, keys ...[]byte) error {
+	return s.runTxn(ctx, func(tx kv.Transaction) error {
+		return s.transDel(ctx, tx, keys...)
+	})
 }
 
 func (s *Proxy) GetBlock(ctx context.Context, id int64) (*model.Block, error) {
-	tx, err := s.store.Begin()
-	if err != nil {
-		return nil, err
-	}
-	bm := new(pb.BlockMeta)
-	if err = s.transGet(ctx, tx, generateBlockMetaKey(id), bm); err != nil {
-		return nil, err
-	}
-	bs := new(pb.BlockStorage)
-	if err = s.transGet(ctx, tx, generateBlockStorageKey(id), bs); err != nil {
-		return nil, err
-	}
-	return pbBlockMetaToBlock(bm, bs), nil
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.GetBlock")
+	defer span.Finish()
+	var ret *model.Block
+	err := s.runTxn(ctx, func(tx kv.Transaction) error {
+		bm := new(pb.BlockMeta)
+		if err := s.transGet(ctx, tx, generateBlockMetaKey(id), bm); err != nil {
+			return err
+		}
+		bs := new(pb.BlockStorage)
+		if err := s.transGet(ctx, tx, generateBlockStorageKey(id), bs); err != nil {
+			return err
+		}
+		ret = pbBlockMetaToBlock(bm, bs)
+		return nil
+	})
+	return ret, err
 }
 
 func (s *Proxy) PutBlock(ctx context.Context, block *pb.BlockMeta) error {
-	tx, err := s.store.Begin()
-	if err != nil {
-		return err
-	}
-	if err = s.transSet(ctx, tx, generateBlockMetaKey(block.GetId()), block); err != nil {
-		return err
-	}
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.PutBlock")
+	defer span.Finish()
 	// add block to file
-	return tx.Commit(ctx)
+	return s.runTxn(ctx, func(tx kv.Transaction) error {
+		version, exists, err := s.transBlockVersion(ctx, tx, block.GetId())
+		if err != nil {
+			return err
+		}
+		if err = checkPrecondition(ctx, version, exists); err != nil {
+			return err
+		}
+		block.Version = proto.Int64(version + 1)
+		recordVersion(ctx, block.GetVersion())
+		return s.transSet(ctx, tx, generateBlockMetaKey(block.GetId()), block)
+	})
 }
 
 func (s *Proxy) DeleteBlock(ctx context.Context, id int64) error {
-	return s.del(ctx, generateBlockMetaKey(id))
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.DeleteBlock")
+	defer span.Finish()
+	return s.runTxn(ctx, func(tx kv.Transaction) error {
+		if err := s.transCheckBlock(ctx, tx, id); err != nil {
+			return err
+		}
+		return s.transDel(ctx, tx, generateBlockMetaKey(id))
+	})
 }
 
 func (s *Proxy) GetBlockStorage(ctx context.Context, id int64) (*pb.BlockStorage, error) {
-	tx, err := s.store.Begin()
-	if err != nil {
-		return nil, err
-	}
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.GetBlockStorage")
+	defer span.Finish()
 	bs := new(pb.BlockStorage)
-	if err = s.transGet(ctx, tx, generateBlockStorageKey(id), bs); err != nil {
+	if err := s.get(ctx, generateBlockStorageKey(id), bs); err != nil {
 		return nil, err
 	}
 	return bs, nil
 }
 func (s *Proxy) AddBlockStorage(ctx context.Context, id int64, nodeID, storageID string) error {
-	tx, err := s.store.Begin()
-	if err != nil {
-		return err
-	}
-	bs := new(pb.BlockStorage)
-	if err = s.transGet(ctx, tx, generateBlockStorageKey(id), bs); err != nil && !kv.ErrNotExist.Equal(err) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.AddBlockStorage")
+	defer span.Finish()
+	return s.runTxn(ctx, func(tx kv.Transaction) error {
+		_, err := s.transAddBlockReplica(ctx, tx, id, nodeID, storageID)
 		return err
-	}
-	bs.Id = proto.Int64(id)
-	if len(bs.Nodes) == 0 {
-		bs.Nodes = make([]*pb.BlockStorageNode, 0)
-	}
-	for _, b := range bs.Nodes {
-		if b.GetDataNodeId() == nodeID && b.GetStorageId() == storageID {
-			return nil
-		}
-	}
-	bs.Nodes = append(bs.Nodes, &pb.BlockStorageNode{
-		StorageId:  proto.String(storageID),
-		DataNodeId: proto.String(nodeID),
 	})
-	if err = s.transSet(ctx, tx, generateBlockStorageKey(id), bs); err != nil {
-		return err
-	}
-	return tx.Commit(ctx)
 }
 func (s *Proxy) DeleteBlockStorage(ctx context.Context, id int64) *pb.BlockStorage {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.DeleteBlockStorage")
+	defer span.Finish()
 	return nil
 }
 
 func (s *Proxy) GetINodeFile(ctx context.Context, id int64, simple bool) (*pb.INodeMeta, []*model.Block, error) {
-	m := new(pb.INodeMeta)
-	tx, err := s.store.Begin()
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.GetINodeFile")
+	defer span.Finish()
+	var m *pb.INodeMeta
+	var ret []*model.Block
+	err := s.runTxn(ctx, func(tx kv.Transaction) error {
+		m, ret = new(pb.INodeMeta), nil
+		if err := s.transGet(ctx, tx, generateINodeKey(id), m); err != nil {
+			s.logger.Error("GetINodeFile error", zap.Int64("id", id), zap.Error(err))
+			return err
+		}
+		if simple {
+			return nil
+		}
+		var err error
+		if ret, err = s.scanINodeBlocks(ctx, tx, id); err != nil {
+			s.logger.Error("scanINodeBlocks error", zap.Int64("id", id), zap.Error(err))
+		}
+		return err
+	})
 	if err != nil {
 		return nil, nil, err
 	}
-	if err = s.transGet(ctx, tx, generateINodeKey(id), m); err != nil {
-		s.logger.Error("GetINodeFile error", zap.Int64("id", id), zap.Error(err))
-		return nil, nil, err
-	}
-	if simple {
-		return m, nil, nil
-	}
-	ret, err := s.scanINodeBlocks(ctx, tx, id)
-	if err != nil {
-		s.logger.Error("scanINodeBlocks error", zap.Int64("id", id), zap.Error(err))
-	}
-	return m, ret, err
+	return m, ret, nil
 }
 
 func (s *Proxy) PutINodeFile(ctx context.Context, m *pb.INodeMeta) error {
-	tx, err := s.store.Begin()
-	if err != nil {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.PutINodeFile")
+	defer span.Finish()
+	return s.runTxn(ctx, func(tx kv.Transaction) error {
+		if err := s.transPutINode(ctx, tx, m); err != nil {
+			return err
+		}
+		return s.transAppendEvents(ctx, tx, newCreateEvent(m))
+	})
+}
+
+//transPutINode write the inode with the version after the stored one and link it to its parent directory
+func (s *Proxy) transPutINode(ctx context.Context, tx kv.Transaction, m *pb.INodeMeta) error {
+	if err := s.transSetINode(ctx, tx, m); err != nil {
 		return err
 	}
-	if err = s.transSet(ctx, tx, generateINodeKey(m.GetId()), m); err != nil {
-		tx.Rollback()
+	return s.linkNode(ctx, tx, m.GetParentId(), m)
+}
+
+//transSetINode write the inode with the version after the stored one, checked against the preconditions of the request
+func (s *Proxy) transSetINode(ctx context.Context, tx kv.Transaction, m *pb.INodeMeta) error {
+	version, exists, err := s.transINodeVersion(ctx, tx, m.GetId())
+	if err != nil {
 		return err
 	}
-	// if m.GetParentId() > 0 {
-	if err = s.linkNode(ctx, tx, m.GetParentId(), m); err != nil {
-		tx.Rollback()
+	if err = checkPrecondition(ctx, version, exists); err != nil {
 		return err
 	}
-	// }
-	return tx.Commit(ctx)
+	m.Version = proto.Int64(version + 1)
+	recordVersion(ctx, m.GetVersion())
+	return s.transSet(ctx, tx, generateINodeKey(m.GetId()), m)
 }
 
 func (s *Proxy) deleteINodeFile(ctx context.Context, tx kv.Transaction, id int64) error {
@@ -191,7 +224,10 @@ func (s *Proxy) deleteINodeFile(ctx context.Context, tx kv.Transaction, id int64
 	}
 	// 删除之前的block
 	for i, b := range blocks {
-		if err = s.transDel(ctx, tx, generateINodeFileBlockKey(id, int64(i)), generateBlockMetaKey(b.ID), generateBlockStorageKey(b.ID)); err != nil {
+		if err = s.transDel(ctx, tx, generateINodeFileBlockKey(id, int64(i))); err != nil {
+			return err
+		}
+		if err = s.transRemoveBlock(ctx, tx, id, b.ID); err != nil {
 			return err
 		}
 	}
@@ -199,19 +235,27 @@ func (s *Proxy) deleteINodeFile(ctx context.Context, tx kv.Transaction, id int64
 }
 
 func (s *Proxy) DeleteINodeFile(ctx context.Context, id int64) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.DeleteINodeFile")
+	defer span.Finish()
 	//TODO delete inode block
-	tx, err := s.store.Begin()
-	if err != nil {
-		return err
-	}
-	if err = s.deleteINodeFile(ctx, tx, id); err != nil {
-		tx.Rollback()
-		return err
-	}
-	return tx.Commit(ctx)
+	return s.runTxn(ctx, func(tx kv.Transaction) error {
+		if err := s.transCheckINode(ctx, tx, id); err != nil {
+			return err
+		}
+		event, err := s.transINodeEvent(ctx, tx, eventDelete, id)
+		if err != nil {
+			return err
+		}
+		if err = s.deleteINodeFile(ctx, tx, id); err != nil {
+			return err
+		}
+		return s.transAppendEvents(ctx, tx, event)
+	})
 }
 
 func (s *Proxy) GetINodeDirectory(ctx context.Context, id int64) (*pb.INodeMeta, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.GetINodeDirectory")
+	defer span.Finish()
 	m := new(pb.INodeMeta)
 	err := s.get(ctx, generateINodeKey(id), m)
 	if err != nil {
@@ -221,6 +265,8 @@ func (s *Proxy) GetINodeDirectory(ctx context.Context, id int64) (*pb.INodeMeta,
 }
 
 func (s *Proxy) PutINodeDirectory(ctx context.Context, m *pb.INodeMeta) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.PutINodeDirectory")
+	defer span.Finish()
 	return s.PutINodeFile(ctx, m)
 }
 
@@ -255,42 +301,51 @@ func (s *Proxy) deleteDirectory(ctx context.Context, tx kv.Transaction, id int64
 }
 
 func (s *Proxy) DeleteINodeDirectory(ctx context.Context, id int64) error {
-	tx, err := s.store.Begin()
-	if err != nil {
-		return err
-	}
-	deleteMap := make(map[int64]bool)
-	if err = s.deleteDirectory(ctx, tx, id, deleteMap); err != nil {
-		tx.Rollback()
-		return err
-	}
-	return tx.Commit(ctx)
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.DeleteINodeDirectory")
+	defer span.Finish()
+	return s.runTxn(ctx, func(tx kv.Transaction) error {
+		if err := s.transCheckINode(ctx, tx, id); err != nil {
+			return err
+		}
+		event, err := s.transINodeEvent(ctx, tx, eventDelete, id)
+		if err != nil {
+			return err
+		}
+		deleteMap := make(map[int64]bool)
+		if err = s.deleteDirectory(ctx, tx, id, deleteMap); err != nil {
+			return err
+		}
+		return s.transAppendEvents(ctx, tx, event)
+	})
 }
 
 //GetINodeDirectoryChild get inode directory child by name
 func (s *Proxy) GetINodeDirectoryChild(ctx context.Context, id int64, name string, needMore bool) (*pb.INodeMeta, error) {
-	m := new(pb.INodeID)
-	tx, err := s.store.Begin()
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.GetINodeDirectoryChild")
+	defer span.Finish()
+	var nm *pb.INodeMeta
+	err := s.runTxn(ctx, func(tx kv.Transaction) error {
+		m := new(pb.INodeID)
+		if err := s.transGet(ctx, tx, generateINodeDirectoryChildKey(id, name), m); err != nil {
+			return err
+		}
+		nm = new(pb.INodeMeta)
+		nm.Id = m.Id
+		if needMore {
+			return s.transGet(ctx, tx, generateINodeKey(m.GetId()), nm)
+		}
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
-	if err = s.transGet(ctx, tx, generateINodeDirectoryChildKey(id, name), m); err != nil {
-		return nil, err
-	}
-	nm := new(pb.INodeMeta)
-	nm.Id = m.Id
-	if needMore {
-		if err = s.transGet(ctx, tx, generateINodeKey(m.GetId()), nm); err != nil {
-			return nil, err
-		}
-	}
 	return nm, nil
 }
 func (s *Proxy) linkNode(ctx context.Context, tx kv.Transaction, parentID int64, node *pb.INodeMeta) error {
 	var err error
 	id := new(pb.INodeID)
 	id.Id = node.Id
-	s.logger.Info("linkNode", zap.Int64("id", id.GetId()), zap.Int64("parent", parentID))
+	s.logger.Debug("linkNode", zap.Int64("id", id.GetId()), zap.Int64("parent", parentID))
 	if err != nil {
 		return err
 	}
@@ -302,82 +357,85 @@ func (s *Proxy) linkNode(ctx context.Context, tx kv.Transaction, parentID int64,
 
 //PutINodeDirectoryChild put inode directory child by name
 func (s *Proxy) PutINodeDirectoryChild(ctx context.Context, directoryID int64, node *pb.INodeMeta) error {
-	tx, err := s.store.Begin()
-	if err = s.transSet(ctx, tx, generateINodeKey(node.GetId()), node); err != nil {
-		return err
-	}
-	if err = s.linkNode(ctx, tx, directoryID, node); err != nil {
-		tx.Rollback()
-		return err
-	}
-	return tx.Commit(ctx)
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.PutINodeDirectoryChild")
+	defer span.Finish()
+	return s.runTxn(ctx, func(tx kv.Transaction) error {
+		if err := s.transSetINode(ctx, tx, node); err != nil {
+			return err
+		}
+		if err := s.linkNode(ctx, tx, directoryID, node); err != nil {
+			return err
+		}
+		event := newCreateEvent(node)
+		event.ParentId = proto.Int64(directoryID)
+		return s.transAppendEvents(ctx, tx, event)
+	})
 }
 
 func (s *Proxy) DeleteINodeDirectoryChild(ctx context.Context, id int64, name string) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.DeleteINodeDirectoryChild")
+	defer span.Finish()
 	// return nil
-	tx, err := s.store.Begin()
-	if err != nil {
-		return err
-	}
-	if err = s.transDel(ctx, tx, generateINodeDirectoryChildKey(id, name)); err != nil {
-		return err
-	}
-	// m := new(pb.INodeMeta)
-	// if err = s.transGet(ctx, tx, generateINodeDirectoryChildKey(id, name), m); err != nil {
-	// 	fmt.Printf("get inode meta error %s\n", err)
-	// 	tx.Rollback()
-	// 	return err
-	// }
-	// nm := new(pb.INodeMeta)
-	// nm.Id = m.Id
-	// if err = s.transGet(ctx, tx, generateINodeKey(m.GetId()), nm); err != nil {
-	// 	tx.Rollback()
-	// 	return err
-	// }
-	// switch nm.GetType() {
-	// case inodeDirectoryType:
-	// 	if err = s.deleteDirectory(ctx, tx, id, make(map[int64]bool)); err != nil {
-	// 		tx.Rollback()
-	// 		return err
-
-	// 	}
-	// case inodeFileType:
-	// 	if err = s.deleteINodeFile(ctx, tx, id); err != nil {
-	// 		tx.Rollback()
-	// 		return err
-	// 	}
-
-	// }
-	return tx.Commit(ctx)
+	return s.runTxn(ctx, func(tx kv.Transaction) error {
+		// nothing to delete and no event to append for a missing child
+		child := new(pb.INodeID)
+		if err := s.transGet(ctx, tx, generateINodeDirectoryChildKey(id, name), child); err != nil {
+			return err
+		}
+		if err := s.transCheckINode(ctx, tx, child.GetId()); err != nil {
+			return err
+		}
+		if err := s.transDel(ctx, tx, generateINodeDirectoryChildKey(id, name)); err != nil {
+			return err
+		}
+		event := &pb.ChangeEvent{
+			Type:     proto.String(eventDelete),
+			InodeId:  proto.Int64(child.GetId()),
+			ParentId: proto.Int64(id),
+			Name:     proto.String(name),
+		}
+		return s.transAppendEvents(ctx, tx, event)
+	})
 }
 
 func (s *Proxy) GetINodeFileBlock(ctx context.Context, id, blockID int64) (*model.Block, error) {
-	tx, err := s.store.Begin()
-	if err != nil {
-		return nil, err
-	}
-	blocks, err := s.scanINodeBlocks(ctx, tx, id)
-	for _, b := range blocks {
-		if b.ID == blockID {
-			return b, nil
-		}
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.GetINodeFileBlock")
+	defer span.Finish()
+	var ret *model.Block
+	err := s.runTxn(ctx, func(tx kv.Transaction) error {
+		blocks, err := s.scanINodeBlocks(ctx, tx, id)
+		for _, b := range blocks {
+			if b.ID == blockID {
+				ret = b
+				return nil
+			}
 
-	}
-	return nil, kv.ErrNotExist
+		}
+		if err != nil {
+			return err
+		}
+		return kv.ErrNotExist
+	})
+	return ret, err
 }
 
 func (s *Proxy) DeleteINodeFileBlock(ctx context.Context, id, blockID int64) error {
-	tx, err := s.store.Begin()
-	if err != nil {
-		return err
-	}
-	index, err := s.getFileBlockIndex(ctx, tx, id, blockID)
-	if err = s.transDel(ctx, tx, generateINodeFileBlockKey(id, index), generateBlockMetaKey(blockID), generateBlockStorageKey(blockID)); err != nil {
-		tx.Rollback()
-		return err
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.DeleteINodeFileBlock")
+	defer span.Finish()
+	return s.runTxn(ctx, func(tx kv.Transaction) error {
+		if err := s.transCheckBlock(ctx, tx, blockID); err != nil {
+			return err
+		}
+		index, err := s.getFileBlockIndex(ctx, tx, id, blockID)
+		if err = s.transDel(ctx, tx, generateINodeFileBlockKey(id, index)); err != nil {
+			return err
 
-	}
-	return tx.Commit(ctx)
+		}
+		if err = s.transRemoveBlock(ctx, tx, id, blockID); err != nil {
+			return err
+		}
+		return s.transAppendEvents(ctx, tx, newBlockEvent(eventRemoveBlock, id, blockID, 0))
+	})
 }
 
 func (s *Proxy) getFileBlockIndex(ctx context.Context, tx kv.Transaction, id, blockID int64) (int64, error) {
@@ -399,17 +457,15 @@ func (s *Proxy) getFileBlockIndex(ctx context.Context, tx kv.Transaction, id, bl
 }
 
 func (s *Proxy) UpdateINodeFileBlock(ctx context.Context, id, blockID int64, block *model.Block) error {
-	ib, sb, ifb := modelBlockToINode([]*model.Block{block})
-	tx, err := s.store.Begin()
-	if err != nil {
-		return err
-	}
-	if err = s.updateINodeFileBlock(ctx, tx, id, blockID, ifb[0], ib[0], sb[0]); err != nil {
-		tx.Rollback()
-		return err
-	}
-	tx.Commit(ctx)
-	return nil
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.UpdateINodeFileBlock")
+	defer span.Finish()
+	return s.runTxn(ctx, func(tx kv.Transaction) error {
+		ib, sb, ifb := modelBlockToINode([]*model.Block{block})
+		if err := s.updateINodeFileBlock(ctx, tx, id, blockID, ifb[0], ib[0], sb[0]); err != nil {
+			return err
+		}
+		return s.transAppendEvents(ctx, tx, newBlockEvent(eventAppend, id, blockID, block.NumberBytes))
+	})
 }
 
 func (s *Proxy) updateINodeFileBlock(ctx context.Context, tx kv.Transaction, id, blockID int64, m *pb.INodeFileBlock, bm *pb.BlockMeta, bs *pb.BlockStorage) error {
@@ -431,61 +487,63 @@ func (s *Proxy) updateINodeFileBlock(ctx context.Context, tx kv.Transaction, id,
 	if err = s.transSet(ctx, tx, generateINodeFileBlockKey(id, index), m); err != nil {
 		return err
 	}
+	version, exists, err := s.transBlockVersion(ctx, tx, blockID)
+	if err != nil {
+		return err
+	}
+	if err = checkPrecondition(ctx, version, exists); err != nil {
+		return err
+	}
+	bm.CollectionId = proto.Int64(id)
+	bm.Version = proto.Int64(version + 1)
 	if err := s.transSet(ctx, tx, generateBlockMetaKey(blockID), bm); err != nil {
 		return err
 	}
 
 	oldBs := new(pb.BlockStorage)
-	blockStorageKey := generateBlockStorageKey(blockID)
-	if err = s.transGet(ctx, tx, blockStorageKey, bs); err != nil && !kv.ErrNotExist.Equal(err) {
+	if err = s.transGet(ctx, tx, generateBlockStorageKey(blockID), oldBs); err != nil && !kv.ErrNotExist.Equal(err) {
 		return err
 	}
-	oldBs.Id = proto.Int64(id)
+	oldBs.Id = proto.Int64(blockID)
 	if len(oldBs.Nodes) == 0 {
 		oldBs.Nodes = make([]*pb.BlockStorageNode, 0)
 	}
-	nodesLen := len(bs.Nodes)
-	for i := 0; i < nodesLen; i++ {
+	for _, n := range bs.Nodes {
 		found := false
-		for _, bn := range bs.Nodes {
-			if bs.Nodes[i].GetDataNodeId() == bn.GetDataNodeId() && bs.Nodes[i].GetStorageId() == bn.GetStorageId() {
+		for _, bn := range oldBs.Nodes {
+			if n.GetDataNodeId() == bn.GetDataNodeId() && n.GetStorageId() == bn.GetStorageId() {
 				found = true
 			}
 		}
 		if !found {
 			oldBs.Nodes = append(oldBs.Nodes, &pb.BlockStorageNode{
-				StorageId:  proto.String(bs.Nodes[i].GetStorageId()),
-				DataNodeId: proto.String(bs.Nodes[i].GetDataNodeId()),
+				StorageId:  proto.String(n.GetStorageId()),
+				DataNodeId: proto.String(n.GetDataNodeId()),
 			})
 		}
 	}
-	if err := s.transSet(ctx, tx, blockStorageKey, oldBs); err != nil {
-		return err
-	}
-	return nil
+	return s.transSetBlockStorage(ctx, tx, oldBs)
 }
 
 func (s *Proxy) PutINodeFileBlock(ctx context.Context, id, blockID, generationTime int64) error {
-	m := new(pb.INodeFileBlock)
-	m.Id = proto.Int64(blockID)
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.PutINodeFileBlock")
+	defer span.Finish()
+	return s.runTxn(ctx, func(tx kv.Transaction) error {
+		m := new(pb.INodeFileBlock)
+		m.Id = proto.Int64(blockID)
 
-	bm := new(pb.BlockMeta)
-	bm.Id = proto.Int64(blockID)
-	bm.Generation = proto.Int64(generationTime)
+		bm := new(pb.BlockMeta)
+		bm.Id = proto.Int64(blockID)
+		bm.Generation = proto.Int64(generationTime)
 
-	bs := new(pb.BlockStorage)
-	bs.Id = proto.Int64(blockID)
+		bs := new(pb.BlockStorage)
+		bs.Id = proto.Int64(blockID)
 
-	tx, err := s.store.Begin()
-	if err != nil {
-		return err
-	}
-	if err = s.updateINodeFileBlock(ctx, tx, id, blockID, m, bm, bs); err != nil {
-		tx.Rollback()
-		return err
-	}
-	tx.Commit(ctx)
-	return nil
+		if err := s.updateINodeFileBlock(ctx, tx, id, blockID, m, bm, bs); err != nil {
+			return err
+		}
+		return s.transAppendEvents(ctx, tx, newBlockEvent(eventAddBlock, id, blockID, 0))
+	})
 }
 
 func (s *Proxy) listINodeDirectory(ctx context.Context, tx kv.Transaction, id int64, simple bool) ([]*model.INode, error) {
@@ -516,6 +574,7 @@ func (s *Proxy) listINodeDirectory(ctx context.Context, tx kv.Transaction, id in
 		})
 		it.Next()
 	}
+	kvScanKeys.WithLabelValues(scanListDirectory).Observe(float64(len(ret)))
 	if !simple {
 		for _, n := range ret {
 			m := new(pb.INodeMeta)
@@ -536,49 +595,62 @@ func (s *Proxy) listINodeDirectory(ctx context.Context, tx kv.Transaction, id in
 }
 
 func (s *Proxy) GetINodeDirectoryChildren(ctx context.Context, id int64, simple bool) ([]*model.INode, error) {
-	tx, err := s.store.Begin()
-	if err != nil {
-		return nil, err
-	}
-	return s.listINodeDirectory(ctx, tx, id, simple)
-}
-
-func (s *Proxy) UpdateINodeParent(ctx context.Context, id, newParent, old int64) error {
-	tx, err := s.store.Begin()
-	if err != nil {
-		return err
-	}
-	inodeKey := generateINodeKey(id)
-	m := new(pb.INodeMeta)
-	err = s.transGet(ctx, tx, inodeKey, m)
-	if err != nil {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.GetINodeDirectoryChildren")
+	defer span.Finish()
+	var ret []*model.INode
+	err := s.runTxn(ctx, func(tx kv.Transaction) error {
+		var err error
+		ret, err = s.listINodeDirectory(ctx, tx, id, simple)
 		return err
-	}
-	om := new(pb.INodeMeta)
-	err = s.transGet(ctx, tx, generateINodeKey(old), om)
-	if err != nil {
-		return err
-	}
-	nm := new(pb.INodeMeta)
-	err = s.transGet(ctx, tx, generateINodeKey(newParent), nm)
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-	//TODO get id and old inode, modify parent and children
-	m.ParentId = proto.Int64(newParent)
-	err = s.transSet(ctx, tx, inodeKey, m)
-	if err != nil {
-		return err
-	}
-	if err = s.transDel(ctx, tx, generateINodeDirectoryChildKey(old, om.GetName())); err != nil {
-		return err
-	}
-	if err = s.transSet(ctx, tx, generateINodeDirectoryChildKey(newParent, om.GetName()), &pb.INodeID{Id: proto.Int64(id)}); err != nil {
-		return err
-	}
-	tx.Commit(ctx)
-	return nil
+	})
+	return ret, err
+}
+
+//UpdateINodeParent move the inode from the old parent to the new one, the version written is its ETag
+func (s *Proxy) UpdateINodeParent(ctx context.Context, id, newParent, old int64) (int64, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.UpdateINodeParent")
+	defer span.Finish()
+	var version int64
+	err := s.runTxn(ctx, func(tx kv.Transaction) error {
+		inodeKey := generateINodeKey(id)
+		m := new(pb.INodeMeta)
+		err := s.transGet(ctx, tx, inodeKey, m)
+		if err != nil {
+			return err
+		}
+		om := new(pb.INodeMeta)
+		err = s.transGet(ctx, tx, generateINodeKey(old), om)
+		if err != nil {
+			return err
+		}
+		nm := new(pb.INodeMeta)
+		err = s.transGet(ctx, tx, generateINodeKey(newParent), nm)
+		if err != nil {
+			return err
+		}
+		if err = checkPrecondition(ctx, m.GetVersion(), true); err != nil {
+			return err
+		}
+		//TODO get id and old inode, modify parent and children
+		m.ParentId = proto.Int64(newParent)
+		m.Version = proto.Int64(m.GetVersion() + 1)
+		version = m.GetVersion()
+		recordVersion(ctx, version)
+		err = s.transSet(ctx, tx, inodeKey, m)
+		if err != nil {
+			return err
+		}
+		if err = s.transDel(ctx, tx, generateINodeDirectoryChildKey(old, om.GetName())); err != nil {
+			return err
+		}
+		if err = s.transSet(ctx, tx, generateINodeDirectoryChildKey(newParent, om.GetName()), &pb.INodeID{Id: proto.Int64(id)}); err != nil {
+			return err
+		}
+		event := newINodeEvent(eventRename, m)
+		event.OldParentId = proto.Int64(old)
+		return s.transAppendEvents(ctx, tx, event)
+	})
+	return version, err
 }
 
 func (s *Proxy) scanINodeBlocks(ctx context.Context, tx kv.Transaction, id int64) ([]*model.Block, error) {
@@ -615,103 +687,250 @@ func (s *Proxy) scanINodeBlocks(ctx context.Context, tx kv.Transaction, id int64
 		ret = append(ret, pbBlockToBlock(bm, bs))
 		it.Next()
 	}
+	kvScanKeys.WithLabelValues(scanINodeBlocks).Observe(float64(len(ret)))
 	return ret, nil
 }
 
-func (s *Proxy) TruncateINodeFile(ctx context.Context, id, size int64) error {
-	tx, err := s.store.Begin()
+//scanINodeFileBlockIDs return block ids of the file in order without loading block metas
+func (s *Proxy) scanINodeFileBlockIDs(ctx context.Context, tx kv.Transaction, id int64) ([]int64, error) {
+	prefix := generateINodeFileBlockScanKey(id)
+	it, err := tx.Iter(prefix, nil)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	blocks, err := s.scanINodeBlocks(ctx, tx, id)
-	if err != nil {
-		tx.Rollback()
-		return err
+	defer it.Close()
+	ret := make([]int64, 0)
+	for it.Valid() {
+		key, val := it.Key(), it.Value()
+		if !bytes.HasPrefix(key, prefix) {
+			break
+		}
+		if len(key) == len(prefix)+8 {
+			m := new(pb.INodeFileBlock)
+			if err = proto.Unmarshal(val, m); err != nil {
+				return nil, err
+			}
+			ret = append(ret, m.GetId())
+		}
+		if err = it.Next(); err != nil {
+			return nil, err
+		}
 	}
-	var totalSize, endBlockSizeNew int64
-	endBlockIndex := -1
-	for i, b := range blocks {
-		totalSize += b.NumberBytes
-		if totalSize == size {
-			endBlockIndex = i - 1
-			endBlockSizeNew = -1 //not update
-		} else if totalSize > size {
-			endBlockSizeNew = b.NumberBytes - (totalSize - size)
-			endBlockIndex = i
-		} else {
-			if endBlockIndex != -1 {
-				// 删除多余的block
-				if err = s.transDel(ctx, tx, generateBlockMetaKey(b.ID), generateINodeFileBlockKey(id, int64(i)), generateBlockStorageKey(b.ID)); err != nil {
-					tx.Rollback()
-					return err
-				}
+	return ret, nil
+}
+
+//GetBlockOwner find the inode owning the block by its collection id, or by its tombstone if the file dropped it
+func (s *Proxy) GetBlockOwner(ctx context.Context, id int64) (*model.BlockOwner, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.GetBlockOwner")
+	defer span.Finish()
+	var owner *model.BlockOwner
+	err := s.runTxn(ctx, func(tx kv.Transaction) error {
+		bm := new(pb.BlockMeta)
+		if err := s.transGet(ctx, tx, generateBlockMetaKey(id), bm); err != nil {
+			if !kv.ErrNotExist.Equal(err) {
+				return err
 			}
+			// the file dropped the block, its tombstone keeps the owner
+			inodeID, ok, err := s.transGetBlockTombstone(ctx, tx, id)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				return kv.ErrNotExist
+			}
+			owner = &model.BlockOwner{BlockID: id, INodeID: inodeID, Index: -1, Deleted: true}
+			return nil
 		}
+		if bm.GetCollectionId() <= 0 {
+			return ErrBlockOwnerUnknown
+		}
+		owner = &model.BlockOwner{
+			BlockID: id,
+			INodeID: bm.GetCollectionId(),
+			Index:   -1,
+		}
+		m := new(pb.INodeMeta)
+		if err := s.transGet(ctx, tx, generateINodeKey(owner.INodeID), m); err != nil {
+			if kv.ErrNotExist.Equal(err) {
+				// 文件已经被删除, block还没有被回收
+				owner.Deleted = true
+				return nil
+			}
+			return err
+		}
+		owner.INode = pbINodeMetaToSimpleINode(m)
+		ids, err := s.scanINodeFileBlockIDs(ctx, tx, owner.INodeID)
+		if err != nil {
+			return err
+		}
+		for i, blockID := range ids {
+			if blockID == id {
+				owner.Index = int64(i)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	if endBlockIndex >= 0 {
-		block := blocks[endBlockIndex]
-		m := new(pb.INodeFileBlock)
-		m.Id = proto.Int64(block.ID)
-		if endBlockSizeNew == -1 {
-			m.NumberBytes = proto.Int64(block.NumberBytes)
-		} else {
-			m.NumberBytes = proto.Int64(endBlockSizeNew)
+	return owner, nil
+}
+
+func (s *Proxy) TruncateINodeFile(ctx context.Context, id, size int64) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.TruncateINodeFile")
+	defer span.Finish()
+	return s.runTxn(ctx, func(tx kv.Transaction) error {
+		m := new(pb.INodeMeta)
+		err := s.transGet(ctx, tx, generateINodeKey(id), m)
+		if err != nil && !kv.ErrNotExist.Equal(err) {
+			return err
 		}
-		m.NextBlockId = proto.Int64(0)
-		if err = s.transSet(ctx, tx, generateINodeFileBlockKey(id, int64(endBlockIndex)), m); err != nil {
-			tx.Rollback()
+		exists := err == nil
+		if err = checkPrecondition(ctx, m.GetVersion(), exists); err != nil {
 			return err
 		}
-		bm := &pb.BlockMeta{
-			Id:           proto.Int64(block.ID),
-			Generation:   proto.Int64(block.Generation),
-			NumberBytes:  proto.Int64(endBlockSizeNew),
-			Replication:  proto.Int32(int32(block.Replication)),
-			CollectionId: proto.Int64(block.CollectionID),
-			BlockPoolId:  proto.String(block.BlockPoolID),
+		if exists {
+			m.Version = proto.Int64(m.GetVersion() + 1)
+			if err = s.transSet(ctx, tx, generateINodeKey(id), m); err != nil {
+				return err
+			}
 		}
-		if err = s.transSet(ctx, tx, generateBlockMetaKey(block.ID), bm); err != nil {
-			tx.Rollback()
+		blocks, err := s.scanINodeBlocks(ctx, tx, id)
+		if err != nil {
 			return err
 		}
-	}
-	tx.Commit(ctx)
-	return nil
+		var totalSize, endBlockSizeNew int64
+		endBlockIndex := -1
+		for i, b := range blocks {
+			totalSize += b.NumberBytes
+			if totalSize == size {
+				endBlockIndex = i - 1
+				endBlockSizeNew = -1 //not update
+			} else if totalSize > size {
+				endBlockSizeNew = b.NumberBytes - (totalSize - size)
+				endBlockIndex = i
+			} else {
+				if endBlockIndex != -1 {
+					// 删除多余的block
+					if err = s.transDel(ctx, tx, generateINodeFileBlockKey(id, int64(i))); err != nil {
+						return err
+					}
+					if err = s.transRemoveBlock(ctx, tx, id, b.ID); err != nil {
+						return err
+					}
+				}
+			}
+		}
+		if endBlockIndex >= 0 {
+			block := blocks[endBlockIndex]
+			m := new(pb.INodeFileBlock)
+			m.Id = proto.Int64(block.ID)
+			if endBlockSizeNew == -1 {
+				m.NumberBytes = proto.Int64(block.NumberBytes)
+			} else {
+				m.NumberBytes = proto.Int64(endBlockSizeNew)
+			}
+			m.NextBlockId = proto.Int64(0)
+			if err = s.transSet(ctx, tx, generateINodeFileBlockKey(id, int64(endBlockIndex)), m); err != nil {
+				return err
+			}
+			bm := &pb.BlockMeta{
+				Id:           proto.Int64(block.ID),
+				Generation:   proto.Int64(block.Generation),
+				NumberBytes:  proto.Int64(endBlockSizeNew),
+				Replication:  proto.Int32(int32(block.Replication)),
+				CollectionId: proto.Int64(id),
+				BlockPoolId:  proto.String(block.BlockPoolID),
+				Version:      proto.Int64(block.Version + 1),
+			}
+			if err = s.transSet(ctx, tx, generateBlockMetaKey(block.ID), bm); err != nil {
+				return err
+			}
+		}
+		return s.transAppendEvents(ctx, tx, newBlockEvent(eventTruncate, id, 0, size))
+	})
 }
 
-func (s *Proxy) UpdateINodeFile(ctx context.Context, node *model.INodeFile) error {
-	tx, err := s.store.Begin()
-	if err != nil {
-		return err
-	}
-	blocks, err := s.scanINodeBlocks(ctx, tx, node.ID)
-	// 删除之前的block
-	for i, b := range blocks {
-		if err = s.transDel(ctx, tx, generateINodeFileBlockKey(node.ID, int64(i)), generateBlockMetaKey(b.ID), generateBlockStorageKey(b.ID)); err != nil {
-			tx.Rollback()
+//UpdateINodeFile replace the metadata and the block list of the file, the version written is its ETag
+func (s *Proxy) UpdateINodeFile(ctx context.Context, node *model.INodeFile) (int64, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.UpdateINodeFile")
+	defer span.Finish()
+	var version int64
+	err := s.runTxn(ctx, func(tx kv.Transaction) error {
+		blocks, err := s.scanINodeBlocks(ctx, tx, node.ID)
+		if err != nil {
 			return err
 		}
-	}
-	im, bm, bs, ifb := modelINodeFileToPbINode(node)
-	if err = s.transSet(ctx, tx, generateINodeFileKey(node.ID), im); err != nil {
-		tx.Rollback()
-		return err
-	}
+		im, bm, bs, ifb := modelINodeFileToPbINode(node)
+		kept := make(map[int64]bool, len(bm))
+		for _, b := range bm {
+			kept[b.GetId()] = true
+		}
+		// 删除之前的block
+		versions := make(map[int64]int64, len(blocks))
+		for i, b := range blocks {
+			versions[b.ID] = b.Version
+			if err = s.transDel(ctx, tx, generateINodeFileBlockKey(node.ID, int64(i)), generateBlockMetaKey(b.ID)); err != nil {
+				return err
+			}
+			if kept[b.ID] {
+				err = s.transDelBlockStorage(ctx, tx, b.ID)
+			} else {
+				err = s.transRemoveBlock(ctx, tx, node.ID, b.ID)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		// owner, group and quotas are not part of the update
+		old := new(pb.INodeMeta)
+		err = s.transGet(ctx, tx, generateINodeKey(node.ID), old)
+		if err == nil {
+			im.Owner, im.Group, im.NsQuota, im.DsQuota = old.Owner, old.Group, old.NsQuota, old.DsQuota
+		} else if !kv.ErrNotExist.Equal(err) {
+			return err
+		}
+		if err = checkPrecondition(ctx, old.GetVersion(), err == nil); err != nil {
+			return err
+		}
+		im.Version = proto.Int64(old.GetVersion() + 1)
+		version = im.GetVersion()
+		recordVersion(ctx, version)
+		for _, b := range bm {
+			b.Version = proto.Int64(versions[b.GetId()] + 1)
+		}
+		if err = s.transSet(ctx, tx, generateINodeFileKey(node.ID), im); err != nil {
+			return err
+		}
+		if err = s.transPutINodeFileBlocks(ctx, tx, node.ID, bm, bs, ifb); err != nil {
+			return err
+		}
+		return s.transAppendEvents(ctx, tx, newINodeEvent(eventMetadata, im))
+	})
+	return version, err
+}
+
+//transPutINodeFileBlocks write the block list of the file with its block metas and storages
+func (s *Proxy) transPutINodeFileBlocks(ctx context.Context, tx kv.Transaction, id int64, bm []*pb.BlockMeta, bs []*pb.BlockStorage, ifb []*pb.INodeFileBlock) error {
 	for i, b := range bm {
-		if err = s.transSet(ctx, tx, generateINodeFileBlockKey(node.ID, int64(i)), ifb[i]); err != nil {
+		if err := s.transSet(ctx, tx, generateINodeFileBlockKey(id, int64(i)), ifb[i]); err != nil {
 			return err
 		}
-		if err = s.transSet(ctx, tx, generateBlockMetaKey(node.ID), b); err != nil {
+		b.CollectionId = proto.Int64(id)
+		if err := s.transSet(ctx, tx, generateBlockMetaKey(b.GetId()), b); err != nil {
 			return err
 		}
-		if err = s.transSet(ctx, tx, generateBlockStorageKey(b.GetId()), bs[i]); err != nil {
+		if err := s.transSetBlockStorage(ctx, tx, bs[i]); err != nil {
 			return err
 		}
 	}
-	return tx.Commit(ctx)
+	return nil
 }
 
 func (s *Proxy) UpdateINodeDirectory(ctx context.Context, dir *model.INodeDirectory) error {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.UpdateINodeDirectory")
+	defer span.Finish()
 	// tx, err := s.store.Begin()
 	// if err != nil {
 	// 	return err
@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/redis-force/less-state-hdfs/pkg/proxy/config"
+	"go.uber.org/zap"
+)
+
+//certReloader serve the certificate and client ca read from disk, reloading them when the files change
+type certReloader struct {
+	config *config.Config
+	logger *zap.Logger
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	clientCA *x509.CertPool
+}
+
+func newCertReloader(c *config.Config, logger *zap.Logger) (*certReloader, error) {
+	if len(c.TLSCert) == 0 || len(c.TLSKey) == 0 {
+		return nil, fmt.Errorf("tls cert and key should be set together")
+	}
+	if c.TLSRequireClientCert && len(c.TLSClientCA) == 0 {
+		return nil, fmt.Errorf("tls client ca is required to verify client certificates")
+	}
+	r := &certReloader{config: c, logger: logger}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+//reload read the files again, the old ones are kept on error
+func (r *certReloader) reload() error {
+	cert, err := tls.LoadX509KeyPair(r.config.TLSCert, r.config.TLSKey)
+	if err != nil {
+		return err
+	}
+	var pool *x509.CertPool
+	if len(r.config.TLSClientCA) > 0 {
+		pem, err := ioutil.ReadFile(r.config.TLSClientCA)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificate found in tls client ca %s", r.config.TLSClientCA)
+		}
+	}
+	r.mu.Lock()
+	r.cert, r.clientCA = &cert, pool
+	r.mu.Unlock()
+	return nil
+}
+
+//watch reload the certificates on changes of any of the files, a cert renewed before its key
+//fails to load until the key is written too and keeps the old pair serving meanwhile
+func (r *certReloader) watch(exitChan chan struct{}) {
+	if len(r.config.TLSClientCA) > 0 {
+		go watchFile(r.config.TLSClientCA, "tls client ca", r.logger, exitChan, r.reload)
+	}
+	go watchFile(r.config.TLSKey, "tls key", r.logger, exitChan, r.reload)
+	watchFile(r.config.TLSCert, "tls cert", r.logger, exitChan, r.reload)
+}
+
+//tlsConfig build a server config picking up the current certificate and client ca on every handshake
+func (r *certReloader) tlsConfig() *tls.Config {
+	clientAuth := tls.NoClientCert
+	if len(r.config.TLSClientCA) > 0 {
+		clientAuth = tls.VerifyClientCertIfGiven
+		if r.config.TLSRequireClientCert {
+			clientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*r.cert},
+				ClientAuth:   clientAuth,
+				ClientCAs:    r.clientCA,
+				NextProtos:   []string{"http/1.1"},
+			}, nil
+		},
+	}
+}
@@ -0,0 +1,209 @@
+package proxy
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/redis-force/less-state-hdfs/pkg/proxy/config"
+	"go.uber.org/zap"
+)
+
+//writeTestCert write a self signed certificate of the common name to <name>.crt and <name>.key in dir,
+//it is its own ca so the same files verify the clients presenting it
+func writeTestCert(t *testing.T, dir, name, cn string) (string, string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(time.Now().UnixNano()),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err = ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+func servingCN(t *testing.T, r *certReloader) string {
+	t.Helper()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	leaf, err := x509.ParseCertificate(r.cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.Subject.CommonName
+}
+
+func TestCertReloaderWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeTestCert(t, dir, "server", "v1")
+	r, err := newCertReloader(&config.Config{TLSCert: certFile, TLSKey: keyFile}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	exitChan := make(chan struct{})
+	defer close(exitChan)
+	go r.watch(exitChan)
+	// let the watchers start before the renewal
+	time.Sleep(100 * time.Millisecond)
+	writeTestCert(t, dir, "server", "v2")
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if servingCN(t, r) == "v2" {
+			return
+		}
+	}
+	t.Fatal("certificate not reloaded after the renewal")
+}
+
+func TestCertReloaderKeepsOldOnError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeTestCert(t, dir, "server", "v1")
+	r, err := newCertReloader(&config.Config{TLSCert: certFile, TLSKey: keyFile}, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(certFile, []byte("not a certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.reload(); err == nil {
+		t.Fatal("invalid certificate loaded")
+	}
+	// a cert renewed before its key does not pair with the old key
+	writeTestCert(t, dir, "other", "v2")
+	other, err := ioutil.ReadFile(filepath.Join(dir, "other.crt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(certFile, other, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.reload(); err == nil {
+		t.Fatal("certificate loaded with the key of another one")
+	}
+	if cn := servingCN(t, r); cn != "v1" {
+		t.Fatalf("serving %s after failed reloads", cn)
+	}
+	if _, err = newCertReloader(&config.Config{TLSCert: certFile, TLSKey: keyFile}, zap.NewNop()); err == nil {
+		t.Fatal("reloader started without a valid certificate")
+	}
+}
+
+func mustLeaf(t *testing.T, certFile, keyFile string) *x509.Certificate {
+	t.Helper()
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf
+}
+
+//handshake dial a listener serving the config with the client certificates, answer the error of the server side
+func handshake(t *testing.T, server *tls.Config, roots *x509.CertPool, certs []tls.Certificate) error {
+	t.Helper()
+	l, err := tls.Listen("tcp", "127.0.0.1:0", server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	result := make(chan error, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			result <- err
+			return
+		}
+		defer conn.Close()
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		result <- conn.(*tls.Conn).Handshake()
+	}()
+	conn, err := tls.Dial("tcp", l.Addr().String(), &tls.Config{RootCAs: roots, Certificates: certs})
+	if err == nil {
+		defer conn.Close()
+	}
+	return <-result
+}
+
+func TestCertReloaderRequireClientCert(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeTestCert(t, dir, "server", "server")
+	clientCert, clientKey := writeTestCert(t, dir, "client", "alice")
+	strangerCert, strangerKey := writeTestCert(t, dir, "stranger", "mallory")
+	c := &config.Config{TLSCert: certFile, TLSKey: keyFile, TLSRequireClientCert: true}
+	if _, err = newCertReloader(c, zap.NewNop()); err == nil {
+		t.Fatal("client certificates required without a client ca")
+	}
+	c.TLSClientCA = clientCert
+	r, err := newCertReloader(c, zap.NewNop())
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(mustLeaf(t, certFile, keyFile))
+	if err = handshake(t, r.tlsConfig(), roots, nil); err == nil {
+		t.Fatal("client without a certificate accepted")
+	}
+	stranger, err := tls.LoadX509KeyPair(strangerCert, strangerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = handshake(t, r.tlsConfig(), roots, []tls.Certificate{stranger}); err == nil {
+		t.Fatal("client certificate of another ca accepted")
+	}
+	client, err := tls.LoadX509KeyPair(clientCert, clientKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = handshake(t, r.tlsConfig(), roots, []tls.Certificate{client}); err != nil {
+		t.Fatalf("client certificate of the ca rejected %v", err)
+	}
+}
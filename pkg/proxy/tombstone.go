@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pingcap/tidb/kv"
+	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+	"go.uber.org/zap"
+)
+
+const (
+	// the owner of a deleted block is known for it, datanodes report and drop its replicas meanwhile
+	blockTombstoneExpiry = 24 * time.Hour
+	blockTombstoneSweep  = time.Minute
+	// expired tombstones deleted by one transaction of the sweeper
+	blockTombstoneSweepBatch = 1024
+)
+
+//transRemoveBlock delete the meta and the replicas of a block of the file, and keep the file as its owner for a while
+func (s *Proxy) transRemoveBlock(ctx context.Context, tx kv.Transaction, owner, id int64) error {
+	if err := s.transDel(ctx, tx, generateBlockMetaKey(id)); err != nil {
+		return err
+	}
+	if err := s.transDelBlockStorage(ctx, tx, id); err != nil {
+		return err
+	}
+	if owner <= 0 {
+		return nil
+	}
+	expire := time.Now().Add(blockTombstoneExpiry).UnixNano()
+	if err := s.transSet(ctx, tx, generateBlockTombstoneKey(id), &pb.BlockTombstone{
+		CollectionId: proto.Int64(owner),
+		ExpireTime:   proto.Int64(expire),
+	}); err != nil {
+		return err
+	}
+	return tx.Set(generateBlockTombstoneExpiryKey(expire, id), []byte{0})
+}
+
+//transGetBlockTombstone the owner of the deleted block, false if it is unknown or expired
+func (s *Proxy) transGetBlockTombstone(ctx context.Context, tx kv.Transaction, id int64) (int64, bool, error) {
+	t := new(pb.BlockTombstone)
+	if err := s.transGet(ctx, tx, generateBlockTombstoneKey(id), t); err != nil {
+		if kv.ErrNotExist.Equal(err) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	if t.GetExpireTime() <= time.Now().UnixNano() {
+		return 0, false, nil
+	}
+	return t.GetCollectionId(), true, nil
+}
+
+func (s *Proxy) runBlockTombstoneSweeper() {
+	ticker := time.NewTicker(blockTombstoneSweep)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.exitChan:
+			return
+		case <-ticker.C:
+			deleted, err := s.sweepBlockTombstones(withTxnPriority(context.Background(), priorityLow))
+			if err != nil {
+				s.logger.Error("block tombstone sweep error", zap.Error(err))
+				continue
+			}
+			s.logger.Debug("block tombstones swept", zap.Int("deleted", deleted))
+		}
+	}
+}
+
+//sweepBlockTombstones delete the expired tombstones batch by batch, only the expired part of the expiry index is scanned
+func (s *Proxy) sweepBlockTombstones(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		deleted, err := s.sweepBlockTombstoneBatch(ctx)
+		total += deleted
+		if err != nil || deleted < blockTombstoneSweepBatch {
+			return total, err
+		}
+	}
+}
+
+func (s *Proxy) sweepBlockTombstoneBatch(ctx context.Context) (int, error) {
+	var expired [][]byte
+	err := s.runTxn(ctx, func(tx kv.Transaction) error {
+		expired = expired[:0]
+		it, err := tx.Iter(blockTombstoneExpiryPrefix, generateBlockTombstoneExpiryKey(time.Now().UnixNano()+1, 0))
+		if err != nil {
+			return err
+		}
+		for it.Valid() && len(expired) < blockTombstoneSweepBatch {
+			if key := it.Key(); bytes.HasPrefix(key, blockTombstoneExpiryPrefix) {
+				expired = append(expired, append([]byte(nil), key...))
+			}
+			if err = it.Next(); err != nil {
+				it.Close()
+				return err
+			}
+		}
+		it.Close()
+		for _, key := range expired {
+			if len(key) == len(blockTombstoneExpiryPrefix)+16 {
+				id := bytesToInt64(key[len(blockTombstoneExpiryPrefix)+8:])
+				// the block may have been deleted again since, its newer tombstone stays
+				_, live, err := s.transGetBlockTombstone(ctx, tx, id)
+				if err != nil {
+					return err
+				}
+				if !live {
+					if err = s.transDel(ctx, tx, generateBlockTombstoneKey(id)); err != nil {
+						return err
+					}
+				}
+			}
+			if err = s.transDel(ctx, tx, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(expired), nil
+}
@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pingcap/tidb/kv"
+	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+)
+
+func TestBlockOwnerOfDeletedFile(t *testing.T) {
+	s := newTestProxy()
+	ctx := context.Background()
+	mustRunTxn(t, s, func(tx kv.Transaction) error {
+		mustSet(t, tx, generateINodeKey(10), testINode(10, 1, "f", inodeFileType))
+		mustSet(t, tx, generateINodeFileBlockKey(10, 0), &pb.INodeFileBlock{Id: proto.Int64(7)})
+		mustSet(t, tx, generateBlockMetaKey(7), &pb.BlockMeta{Id: proto.Int64(7), CollectionId: proto.Int64(10)})
+		mustSet(t, tx, generateBlockStorageKey(7), &pb.BlockStorage{Id: proto.Int64(7)})
+		return nil
+	})
+	owner, err := s.GetBlockOwner(ctx, 7)
+	if err != nil || owner.Deleted || owner.INodeID != 10 || owner.Index != 0 {
+		t.Fatalf("owner %+v error %v", owner, err)
+	}
+	if err = s.DeleteINodeFile(ctx, 10); err != nil {
+		t.Fatal(err)
+	}
+	owner, err = s.GetBlockOwner(ctx, 7)
+	if err != nil || !owner.Deleted || owner.INodeID != 10 {
+		t.Fatalf("owner of the block of a deleted file %+v error %v", owner, err)
+	}
+	if _, err = s.GetBlockOwner(ctx, 8); !kv.ErrNotExist.Equal(err) {
+		t.Fatalf("owner of an unknown block error %v", err)
+	}
+}
+
+func TestSweepBlockTombstones(t *testing.T) {
+	s := newTestProxy()
+	ctx := context.Background()
+	now := time.Now()
+	mustRunTxn(t, s, func(tx kv.Transaction) error {
+		for id := int64(1); id <= blockTombstoneSweepBatch+1; id++ {
+			expire := now.Add(-time.Minute).UnixNano()
+			mustSet(t, tx, generateBlockTombstoneKey(id), &pb.BlockTombstone{CollectionId: proto.Int64(1), ExpireTime: proto.Int64(expire)})
+			tx.Set(generateBlockTombstoneExpiryKey(expire, id), []byte{0})
+		}
+		// deleted again later, the newer tombstone outlives the old expiry entry
+		expire := now.Add(time.Hour).UnixNano()
+		mustSet(t, tx, generateBlockTombstoneKey(1), &pb.BlockTombstone{CollectionId: proto.Int64(2), ExpireTime: proto.Int64(expire)})
+		return tx.Set(generateBlockTombstoneExpiryKey(expire, 1), []byte{0})
+	})
+	deleted, err := s.sweepBlockTombstones(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != blockTombstoneSweepBatch+1 {
+		t.Fatalf("swept %d expiry entries", deleted)
+	}
+	store := s.store.(*memStore)
+	if got := store.keys("{dt}_"); len(got) != 1 || got[0] != string(generateBlockTombstoneKey(1)) {
+		t.Fatalf("tombstones left %v", got)
+	}
+	if got := store.keys("{de}_"); len(got) != 1 {
+		t.Fatalf("expiry entries left %v", got)
+	}
+}
@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	tidbcfg "github.com/pingcap/tidb/config"
+	"github.com/redis-force/less-state-hdfs/pkg/proxy/config"
+	"github.com/uber/jaeger-client-go"
+	"go.uber.org/zap"
+)
+
+// reporters of TracingConfig
+const (
+	// tracing is disabled
+	tracingReporterNone = "none"
+	// spans are created and propagated but dropped
+	tracingReporterNull = "null"
+	// spans are appended to a local file as json lines
+	tracingReporterFile = "file"
+	// spans are sent to a jaeger agent over udp
+	tracingReporterAgent = "agent"
+)
+
+//newTracer build the tracer of the configured reporter, set it global so the tikv client spans join the request traces
+func newTracer(c config.TracingConfig, logger *zap.Logger) (io.Closer, error) {
+	if len(c.Reporter) == 0 || c.Reporter == tracingReporterNone {
+		return nil, nil
+	}
+	service := c.ServiceName
+	if len(service) == 0 {
+		service = config.DefaultTracingService
+	}
+	sampler, err := newTracingSampler(c.SampleRate)
+	if err != nil {
+		return nil, err
+	}
+	var reporter jaeger.Reporter
+	switch c.Reporter {
+	case tracingReporterNull:
+		reporter = jaeger.NewNullReporter()
+	case tracingReporterFile:
+		if len(c.File) == 0 {
+			return nil, fmt.Errorf("tracing file reporter needs a file")
+		}
+		f, err := os.OpenFile(c.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, err
+		}
+		reporter = &fileReporter{w: f, closer: f, logger: logger}
+	case tracingReporterAgent:
+		transport, err := jaeger.NewUDPTransport(c.AgentHostPort, 0)
+		if err != nil {
+			return nil, err
+		}
+		reporter = jaeger.NewRemoteReporter(transport)
+	default:
+		return nil, fmt.Errorf("unknown tracing reporter %q", c.Reporter)
+	}
+	tracer, closer := jaeger.NewTracer(service, sampler, reporter)
+	opentracing.SetGlobalTracer(tracer)
+	// the tikv client traces its grpc calls as children of the span of the context
+	tidbcfg.GetGlobalConfig().OpenTracing.Enable = true
+	logger.Info("tracing enabled", zap.String("reporter", c.Reporter), zap.String("service", service))
+	return closer, nil
+}
+
+//newTracingSampler sample no trace at a rate of 0 or less, every trace at 1 or more
+func newTracingSampler(rate float64) (jaeger.Sampler, error) {
+	switch {
+	case rate <= 0:
+		return jaeger.NewConstSampler(false), nil
+	case rate >= 1:
+		return jaeger.NewConstSampler(true), nil
+	}
+	return jaeger.NewProbabilisticSampler(rate)
+}
+
+//fileReporter write every finished span as a json line of the jaeger thrift model
+type fileReporter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+	logger *zap.Logger
+}
+
+func (r *fileReporter) Report(span *jaeger.Span) {
+	line, err := json.Marshal(jaeger.BuildJaegerThrift(span))
+	if err != nil {
+		r.logger.Error("encode span error", zap.String("operation", span.OperationName()), zap.Error(err))
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, err = r.w.Write(append(line, '\n')); err != nil {
+		r.logger.Error("write span error", zap.Error(err))
+	}
+}
+
+func (r *fileReporter) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closer.Close()
+}
+
+//tracingMiddleware continue the trace of the request headers, the span is in the request context
+func tracingMiddleware(c *gin.Context) {
+	tracer := opentracing.GlobalTracer()
+	parent, err := tracer.Extract(opentracing.HTTPHeaders, opentracing.HTTPHeadersCarrier(c.Request.Header))
+	if err != nil {
+		parent = nil
+	}
+	span := tracer.StartSpan(auditOperation(c), ext.RPCServerOption(parent))
+	ext.Component.Set(span, "gin")
+	ext.HTTPMethod.Set(span, c.Request.Method)
+	ext.HTTPUrl.Set(span, c.Request.URL.RequestURI())
+	c.Request = c.Request.WithContext(opentracing.ContextWithSpan(c.Request.Context(), span))
+	c.Next()
+	status := c.Writer.Status()
+	ext.HTTPStatusCode.Set(span, uint16(status))
+	if status >= 500 {
+		ext.Error.Set(span, true)
+	}
+	span.Finish()
+}
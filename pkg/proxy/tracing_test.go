@@ -0,0 +1,35 @@
+package proxy
+
+import (
+	"testing"
+
+	"github.com/uber/jaeger-client-go"
+)
+
+func TestNewTracingSampler(t *testing.T) {
+	for _, rate := range []float64{-1, 0} {
+		sampler, err := newTracingSampler(rate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c, ok := sampler.(*jaeger.ConstSampler); !ok || c.Decision {
+			t.Errorf("rate %v sampler %v, want never", rate, sampler)
+		}
+	}
+	for _, rate := range []float64{1, 2} {
+		sampler, err := newTracingSampler(rate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c, ok := sampler.(*jaeger.ConstSampler); !ok || !c.Decision {
+			t.Errorf("rate %v sampler %v, want always", rate, sampler)
+		}
+	}
+	sampler, err := newTracingSampler(0.25)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := sampler.(*jaeger.ProbabilisticSampler); !ok || p.SamplingRate() != 0.25 {
+		t.Errorf("rate 0.25 sampler %v", sampler)
+	}
+}
@@ -0,0 +1,52 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+//watchFile call reload on changes of the file until exitChan is closed, kind names the file in the logs.
+//Every event of the directory stats the file again, editors replace it and a ConfigMap volume swaps
+//the ..data symlink the file links through without touching the file name.
+func watchFile(file, kind string, logger *zap.Logger, exitChan chan struct{}, reload func() error) {
+	logger = logger.With(zap.String("file", file), zap.String("kind", kind))
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Error("watch file error, changes are not reloaded", zap.Error(err))
+		return
+	}
+	defer watcher.Close()
+	if err = watcher.Add(filepath.Dir(file)); err != nil {
+		logger.Error("watch file error, changes are not reloaded", zap.Error(err))
+		return
+	}
+	last, _ := os.Stat(file)
+	for {
+		select {
+		case <-exitChan:
+			return
+		case err := <-watcher.Errors:
+			logger.Error("watch file error", zap.Error(err))
+		case <-watcher.Events:
+			st, err := os.Stat(file)
+			if err != nil || !fileChanged(last, st) {
+				// a missing file is in the middle of a swap, the next event sees the new one
+				continue
+			}
+			last = st
+			if err := reload(); err != nil {
+				logger.Error("reload file error, keep the old settings", zap.Error(err))
+				continue
+			}
+			logger.Info("file reloaded")
+		}
+	}
+}
+
+//fileChanged the stat of the resolved file is another file, or the file was written
+func fileChanged(last, st os.FileInfo) bool {
+	return last == nil || !os.SameFile(last, st) || !last.ModTime().Equal(st.ModTime()) || last.Size() != st.Size()
+}
@@ -0,0 +1,353 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/opentracing/opentracing-go"
+	"github.com/pingcap/errors"
+	"github.com/pingcap/tidb/kv"
+	"github.com/redis-force/less-state-hdfs/pkg/model"
+	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+	"github.com/redis-force/less-state-hdfs/pkg/proxy/config"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultWebhookBatchSize  = 100
+	defaultWebhookTimeout    = 10 * time.Second
+	defaultWebhookMaxRetries = 8
+
+	webhookPollInterval = time.Second
+	webhookMinBackoff   = time.Second
+	webhookMaxBackoff   = 5 * time.Minute
+	// one instance delivers to a subscriber, another takes over once the lease of a failed one expires
+	webhookLeaseTTL = 30 * time.Second
+)
+
+var errWebhookLeaseLost = errors.New("webhook lease held by another instance")
+
+type webhookSubscriber struct {
+	config config.WebhookConfig
+	events map[string]bool
+	client *http.Client
+	// txid of the last delivered batch, -1 until loaded from kv
+	cursor   int64
+	attempts int
+	// the lease of this instance is valid until then, zero if it holds none
+	leaseExpire time.Time
+}
+
+//newWebhookSubscribers validate webhook configs and fill defaults
+func newWebhookSubscribers(configs []config.WebhookConfig) ([]*webhookSubscriber, error) {
+	names := make(map[string]bool)
+	ret := make([]*webhookSubscriber, 0, len(configs))
+	for _, c := range configs {
+		if len(c.Name) == 0 || strings.Contains(c.Name, "_") {
+			return nil, fmt.Errorf("webhook name %q should not be empty or contain '_'", c.Name)
+		}
+		if names[c.Name] {
+			return nil, fmt.Errorf("duplicate webhook %q", c.Name)
+		}
+		names[c.Name] = true
+		if !strings.HasPrefix(c.URL, "http://") && !strings.HasPrefix(c.URL, "https://") {
+			return nil, fmt.Errorf("webhook %q url %q should be http or https", c.Name, c.URL)
+		}
+		if c.BatchSize <= 0 {
+			c.BatchSize = defaultWebhookBatchSize
+		}
+		if c.Timeout <= 0 {
+			c.Timeout = defaultWebhookTimeout
+		}
+		if c.MaxRetries <= 0 {
+			c.MaxRetries = defaultWebhookMaxRetries
+		}
+		w := &webhookSubscriber{
+			config: c,
+			events: make(map[string]bool),
+			client: &http.Client{Timeout: c.Timeout},
+			cursor: -1,
+		}
+		for _, e := range c.Events {
+			if !changeEventTypes[e] {
+				return nil, fmt.Errorf("webhook %q unknown event type %q", c.Name, e)
+			}
+			w.events[e] = true
+		}
+		ret = append(ret, w)
+	}
+	return ret, nil
+}
+
+func (w *webhookSubscriber) match(e *model.ChangeEvent) bool {
+	if len(w.events) > 0 && !w.events[e.Type] {
+		return false
+	}
+	if len(w.config.PathPrefixes) == 0 {
+		return true
+	}
+	for _, p := range w.config.PathPrefixes {
+		if pathHasPrefix(e.Path, p) || pathHasPrefix(e.OldPath, p) {
+			return true
+		}
+	}
+	return false
+}
+
+//pathHasPrefix match whole path components, /a matches /a and /a/b but not /ab
+func pathHasPrefix(path, prefix string) bool {
+	if len(path) == 0 {
+		return false
+	}
+	prefix = strings.TrimSuffix(prefix, "/")
+	return len(prefix) == 0 || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+func (w *webhookSubscriber) backoff() time.Duration {
+	d := webhookMinBackoff
+	for i := 1; i < w.attempts && d < webhookMaxBackoff; i++ {
+		d *= 2
+	}
+	if d > webhookMaxBackoff {
+		d = webhookMaxBackoff
+	}
+	return d
+}
+
+func (s *Proxy) runWebhook(w *webhookSubscriber) {
+	for {
+		wait := webhookPollInterval
+		more, err := s.deliverWebhook(withTxnPriority(context.Background(), priorityNormal), w)
+		if err != nil {
+			wait = w.backoff()
+			s.logger.Warn("webhook delivery error", zap.String("webhook", w.config.Name), zap.Int("attempts", w.attempts), zap.Duration("retry", wait), zap.Error(err))
+		} else if more {
+			wait = 0
+		}
+		select {
+		case <-s.exitChan:
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+//deliverWebhook post the next matching batches to the subscriber and advance its cursor after the post succeeds,
+//so batches may be delivered more than once. A payload failing more than max retries goes to the dead letters.
+//Only the instance holding the lease of the subscriber delivers.
+func (s *Proxy) deliverWebhook(ctx context.Context, w *webhookSubscriber) (bool, error) {
+	held, err := s.acquireWebhookLease(ctx, w)
+	if err != nil || !held {
+		return false, err
+	}
+	if w.cursor < 0 {
+		if err := s.loadWebhookCursor(ctx, w); err != nil {
+			w.attempts++
+			return false, err
+		}
+	}
+	batches, err := s.GetChangeEvents(ctx, w.cursor, w.config.BatchSize)
+	if err != nil {
+		w.attempts++
+		return false, err
+	}
+	if len(batches) == 0 {
+		return false, nil
+	}
+	more := len(batches) >= w.config.BatchSize
+	first, last := batches[0].TxID, batches[len(batches)-1].TxID
+	payload := &model.WebhookPayload{Subscriber: w.config.Name, Batches: make([]*model.ChangeEventBatch, 0, len(batches))}
+	for _, b := range batches {
+		events := make([]model.ChangeEvent, 0, len(b.Events))
+		for i := range b.Events {
+			if w.match(&b.Events[i]) {
+				events = append(events, b.Events[i])
+			}
+		}
+		if len(events) > 0 {
+			b.Events = events
+			payload.Batches = append(payload.Batches, b)
+		}
+	}
+	if len(payload.Batches) == 0 {
+		return more, s.saveWebhookCursor(ctx, w, last, nil)
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return false, err
+	}
+	if err = w.post(data); err == nil {
+		return more, s.saveWebhookCursor(ctx, w, last, nil)
+	}
+	w.attempts++
+	if w.attempts <= w.config.MaxRetries {
+		return false, err
+	}
+	dead := &pb.WebhookDeadLetter{
+		Subscriber: proto.String(w.config.Name),
+		FirstTxid:  proto.Int64(first),
+		LastTxid:   proto.Int64(last),
+		Payload:    data,
+		Error:      proto.String(err.Error()),
+		Attempts:   proto.Int32(int32(w.attempts)),
+		Timestamp:  proto.Int64(time.Now().UnixNano() / int64(time.Millisecond)),
+	}
+	s.logger.Error("webhook payload moved to dead letters", zap.String("webhook", w.config.Name), zap.Int64("first_txid", first), zap.Int64("last_txid", last), zap.Error(err))
+	return more, s.saveWebhookCursor(ctx, w, last, dead)
+}
+
+func (w *webhookSubscriber) post(data []byte) error {
+	resp, err := w.client.Post(w.config.URL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook %q response status %s", w.config.Name, resp.Status)
+	}
+	return nil
+}
+
+//loadWebhookCursor read the persisted cursor, a new subscriber starts from the latest batch
+func (s *Proxy) loadWebhookCursor(ctx context.Context, w *webhookSubscriber) error {
+	cursor := new(pb.ChangeEventCursor)
+	err := s.get(ctx, generateWebhookCursorKey(w.config.Name), cursor)
+	if err == nil {
+		w.cursor = cursor.GetTxid()
+		return nil
+	}
+	if !kv.ErrNotExist.Equal(err) {
+		return err
+	}
+	txid, err := s.LastChangeEventTxID(ctx)
+	if err != nil {
+		return err
+	}
+	return s.saveWebhookCursor(ctx, w, txid, nil)
+}
+
+//acquireWebhookLease take or renew the lease of the subscriber, false if another instance holds it.
+//A lease is renewed once half of it is used, the cursor is read again after it was lost
+func (s *Proxy) acquireWebhookLease(ctx context.Context, w *webhookSubscriber) (bool, error) {
+	ttl := webhookLeaseTTL
+	// a post in progress must not outlive the lease
+	if ttl < 3*w.config.Timeout {
+		ttl = 3 * w.config.Timeout
+	}
+	now := time.Now()
+	if w.leaseExpire.Sub(now) > ttl/2 {
+		return true, nil
+	}
+	held := false
+	err := s.runTxn(ctx, func(tx kv.Transaction) error {
+		lease := new(pb.WebhookLease)
+		if err := s.transGet(ctx, tx, generateWebhookLeaseKey(w.config.Name), lease); err != nil && !kv.ErrNotExist.Equal(err) {
+			return err
+		}
+		held = lease.GetHolder() == s.instance || lease.GetExpireTime() <= now.UnixNano()
+		if !held {
+			return nil
+		}
+		return s.transSet(ctx, tx, generateWebhookLeaseKey(w.config.Name), &pb.WebhookLease{
+			Holder:     proto.String(s.instance),
+			ExpireTime: proto.Int64(now.Add(ttl).UnixNano()),
+		})
+	})
+	if err != nil {
+		return false, err
+	}
+	if !held {
+		if !w.leaseExpire.IsZero() {
+			s.logger.Info("webhook lease taken over", zap.String("webhook", w.config.Name))
+		}
+		w.leaseExpire, w.cursor, w.attempts = time.Time{}, -1, 0
+		return false, nil
+	}
+	if w.leaseExpire.IsZero() {
+		s.logger.Info("webhook lease acquired", zap.String("webhook", w.config.Name))
+		// another instance may have moved the cursor meanwhile
+		w.cursor = -1
+	}
+	w.leaseExpire = now.Add(ttl)
+	return true, nil
+}
+
+//saveWebhookCursor persist the cursor together with the dead letter if not nil,
+//only while this instance holds the lease of the subscriber
+func (s *Proxy) saveWebhookCursor(ctx context.Context, w *webhookSubscriber, txid int64, dead *pb.WebhookDeadLetter) error {
+	err := s.runTxn(ctx, func(tx kv.Transaction) error {
+		lease := new(pb.WebhookLease)
+		if err := s.transGet(ctx, tx, generateWebhookLeaseKey(w.config.Name), lease); err != nil && !kv.ErrNotExist.Equal(err) {
+			return err
+		}
+		if lease.GetHolder() != s.instance {
+			return errWebhookLeaseLost
+		}
+		if dead != nil {
+			if err := s.transSet(ctx, tx, generateWebhookDeadLetterKey(w.config.Name, dead.GetFirstTxid()), dead); err != nil {
+				return err
+			}
+		}
+		return s.transSet(ctx, tx, generateWebhookCursorKey(w.config.Name), &pb.ChangeEventCursor{Txid: proto.Int64(txid)})
+	})
+	if err == errWebhookLeaseLost {
+		w.leaseExpire, w.cursor, w.attempts = time.Time{}, -1, 0
+	}
+	if err != nil {
+		return err
+	}
+	w.cursor, w.attempts = txid, 0
+	return nil
+}
+
+//ListWebhookDeadLetters list dead letters of the subscriber, or of all subscribers if it is empty
+func (s *Proxy) ListWebhookDeadLetters(ctx context.Context, subscriber string, offset, limit int) ([]*model.WebhookDeadLetter, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "Proxy.ListWebhookDeadLetters")
+	defer span.Finish()
+	prefix := webhookDeadLetterKeyPrefix
+	if len(subscriber) > 0 {
+		prefix = generateWebhookDeadLetterScanKey(subscriber)
+	}
+	var ret []*model.WebhookDeadLetter
+	errLimit := fmt.Errorf("limit reached")
+	err := s.runTxn(ctx, func(tx kv.Transaction) error {
+		ret = make([]*model.WebhookDeadLetter, 0)
+		skip := offset
+		return s.scanPrefix(ctx, tx, prefix, func(key, val []byte) error {
+			if skip > 0 {
+				skip--
+				return nil
+			}
+			if len(ret) >= limit {
+				return errLimit
+			}
+			m := new(pb.WebhookDeadLetter)
+			if err := proto.Unmarshal(val, m); err != nil {
+				return err
+			}
+			ret = append(ret, &model.WebhookDeadLetter{
+				Subscriber: m.GetSubscriber(),
+				FirstTxID:  m.GetFirstTxid(),
+				LastTxID:   m.GetLastTxid(),
+				Payload:    m.GetPayload(),
+				Error:      m.GetError(),
+				Attempts:   m.GetAttempts(),
+				Timestamp:  m.GetTimestamp(),
+			})
+			return nil
+		})
+	})
+	if err != nil && err != errLimit {
+		return nil, err
+	}
+	return ret, nil
+}
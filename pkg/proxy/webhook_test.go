@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/pingcap/tidb/kv"
+	pb "github.com/redis-force/less-state-hdfs/pkg/proto"
+	"github.com/redis-force/less-state-hdfs/pkg/proxy/config"
+)
+
+func TestWebhookLease(t *testing.T) {
+	ctx := context.Background()
+	a, b := newTestProxy(), newTestProxy()
+	b.store = a.store
+	a.instance, b.instance = "a:1", "b:1"
+	hook := config.WebhookConfig{Name: "hook", Timeout: time.Second}
+	wa := &webhookSubscriber{config: hook, cursor: -1}
+	wb := &webhookSubscriber{config: hook, cursor: -1}
+	if held, err := a.acquireWebhookLease(ctx, wa); err != nil || !held {
+		t.Fatalf("first lease held %v error %v", held, err)
+	}
+	if held, err := b.acquireWebhookLease(ctx, wb); err != nil || held {
+		t.Fatalf("lease of another instance held %v error %v", held, err)
+	}
+	if err := a.saveWebhookCursor(ctx, wa, 5, nil); err != nil || wa.cursor != 5 {
+		t.Fatalf("cursor %d error %v", wa.cursor, err)
+	}
+	if err := b.saveWebhookCursor(ctx, wb, 6, nil); err != errWebhookLeaseLost {
+		t.Fatalf("cursor saved without the lease, error %v", err)
+	}
+	// a stops renewing
+	mustRunTxn(t, a, func(tx kv.Transaction) error {
+		mustSet(t, tx, generateWebhookLeaseKey("hook"), &pb.WebhookLease{Holder: proto.String("a:1"), ExpireTime: proto.Int64(1)})
+		return nil
+	})
+	if held, err := b.acquireWebhookLease(ctx, wb); err != nil || !held {
+		t.Fatalf("expired lease taken over %v error %v", held, err)
+	}
+	if err := a.saveWebhookCursor(ctx, wa, 7, nil); err != errWebhookLeaseLost || wa.cursor != -1 {
+		t.Fatalf("cursor %d saved after the lease was lost, error %v", wa.cursor, err)
+	}
+}
+
+func TestWebhookMoreAfterSplitTxID(t *testing.T) {
+	s := newTestProxy()
+	s.instance = "a:1"
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		mustRunTxn(t, s, func(tx kv.Transaction) error {
+			mustSet(t, tx, generateINodeKey(1), testINode(1, 0, "", inodeDirectoryType))
+			// two batches of one transaction are delivered together
+			if err := s.transAppendEvents(ctx, tx, newBlockEvent(eventAddBlock, 1, 7, 0)); err != nil {
+				return err
+			}
+			return s.transAppendEvents(ctx, tx, newBlockEvent(eventAddBlock, 1, 8, 0))
+		})
+	}
+	// the subscriber delivers from the first transaction instead of the last one
+	mustRunTxn(t, s, func(tx kv.Transaction) error {
+		mustSet(t, tx, generateWebhookCursorKey("hook"), &pb.ChangeEventCursor{Txid: proto.Int64(0)})
+		return nil
+	})
+	s.store.(*memStore).skew = changeEventSettle + time.Second
+	posts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		posts++
+	}))
+	defer server.Close()
+	subscribers, err := newWebhookSubscribers([]config.WebhookConfig{{Name: "hook", URL: server.URL, BatchSize: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := subscribers[0]
+	if more, err := s.deliverWebhook(ctx, w); err != nil || !more {
+		t.Fatalf("first transaction delivered, more %v error %v", more, err)
+	}
+	// the page of the last transaction was full too, only the next one tells it was the last
+	if more, err := s.deliverWebhook(ctx, w); err != nil || !more {
+		t.Fatalf("second transaction delivered, more %v error %v", more, err)
+	}
+	if more, err := s.deliverWebhook(ctx, w); err != nil || more || posts != 2 {
+		t.Fatalf("%d posts, more %v error %v", posts, more, err)
+	}
+}
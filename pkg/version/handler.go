@@ -8,13 +8,18 @@ import (
 
 // RegisterHandler registers version handler to /version
 func RegisterHandler(mu *http.ServeMux, logger *zap.Logger) {
+	mu.HandleFunc("/version", Handler(logger))
+}
+
+// Handler returns a handler writing the build information as json
+func Handler(logger *zap.Logger) http.HandlerFunc {
 	info := Get()
 	json, err := json.Marshal(info)
 	if err != nil {
 		logger.Fatal("Could not get server version", zap.Error(err))
 	}
-	mu.HandleFunc("/version", func(w http.ResponseWriter, _ *http.Request) {
+	return func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(200)
 		w.Write(json)
-	})
+	}
 }